@@ -0,0 +1,44 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// appendToArray appends elements to the array property of object. A missing property is treated as an empty
+// array. If unique is true, elements which are already contained in the array are skipped.
+func appendToArray(object map[string]interface{}, property string, elements []interface{}, unique bool) error {
+	var array []interface{}
+	if value, ok := object[property]; ok && value != nil {
+		if array, ok = value.([]interface{}); !ok {
+			return fmt.Errorf("property '%s' is not an array", property)
+		}
+	}
+	for _, element := range elements {
+		if unique && containsElement(array, element) {
+			continue
+		}
+		array = append(array, element)
+	}
+	if array == nil {
+		array = []interface{}{}
+	}
+	object[property] = array
+	return nil
+}
+
+// containsElement returns true if array contains element
+func containsElement(array []interface{}, element interface{}) bool {
+	for _, e := range array {
+		if reflect.DeepEqual(e, element) {
+			return true
+		}
+	}
+	return false
+}
@@ -7,10 +7,12 @@
 package backend
 
 import (
+	"context"
 	"crypto/sha1"
 	"embed"
 	"fmt"
 	"log"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -44,13 +46,17 @@ var ConfigSchemaJSON string
 
 // InternalDatabaseSchemaVersion is a sequential versioning number of the database schema.
 // If it increases, the backend will try to update the schema.
-const InternalDatabaseSchemaVersion = 3
+const InternalDatabaseSchemaVersion = 4
 
 // Backend is the generic rest backend
 type Backend struct {
 	config              Configuration
 	db                  *csql.DB
 	router              *mux.Router
+	basePath            string
+	halRoutes           map[string]string
+	untimedRoutes       map[*mux.Route]bool
+	rewrittenRoutes     map[*mux.Route]func(r *http.Request, vars map[string]string) string
 	publicURL           string
 	collectionFunctions map[string]*collectionFunctions
 	relations           map[string]string
@@ -58,18 +64,37 @@ type Backend struct {
 	Registry             registry.Registry
 	authorizationEnabled bool
 	updateSchema         bool
+	jsonErrors           bool
+	camelCase            bool
+	timestampPrecision   time.Duration
+	maxResourceDepth     int
+	statisticsTimeout    time.Duration
+	requestTimeout       time.Duration
+	strictSchemas        bool
+	maxListResponseBytes int
+	maxImportBytes       int64
+	maxImportItemBytes   int64
+	serverTimeHeader     bool
+	notifier             core.Notifier
+	maintenanceWindow    *MaintenanceWindow
+	encryption           *encryption
+	warmUpQueries        []warmUpQuery
 
 	collectionsAndSingletons map[string]bool
 	callbacks                map[string]jobHandler
 	rateLimits               map[string]rateLimit
+	deferrableEvents         map[string]bool
 	interceptors             map[string]requestHandler
+	afterCommitHooks         map[string]afterCommitHook
+	filterUsage              *filterUsage
+	computedProperties       map[string][]computedProperty
 
 	pipelineConcurrency int
 
 	// these queries exist for foreground and background
 	jobsInsertQuery, jobsInsertIfNotExistQuery, jobsCancelQuery,
 	jobsUpdateQuery, jobsDeleteQuery, jobsResetImplicitScheduleQuery,
-	jobsRenewImplicitScheduleQuery, jobsUpdateScheduleQuery [2]string
+	jobsRenewImplicitScheduleQuery, jobsUpdateScheduleQuery, jobsDeferQuery [2]string
 
 	rateLimitQuery string
 
@@ -90,6 +115,9 @@ type Builder struct {
 	DB *csql.DB
 	// Router is a mux router. This is mandatory.
 	Router *mux.Router
+	// BasePath is an optional path prefix, e.g. "/api/v1", under which all routes of the backend are mounted.
+	// Clients must use the same prefix, see client.Client.WithBasePath.
+	BasePath string
 	// Optional public URL of the deployment
 	PublicURL string
 	// If AuthorizationEnabled is true, the backend requires auhorization for each route
@@ -108,6 +136,20 @@ type Builder struct {
 	// JSONSchemasRefs is a list of references JSON Schemas as strings. It is exclusive with the JSONSchemasFS
 	JSONSchemasRefs []string
 
+	// JSONSchemasDir is a directory with JSON schema files. Like with JSONSchemasFS, json files in the directory
+	// are top level schemas, while json files in its subdirectory refs are references. The schemas are added to
+	// JSONSchemas and JSONSchemasRefs, hence the directory is exclusive with the JSONSchemasFS as well.
+	JSONSchemasDir string
+
+	// JSONSchemasURLs and JSONSchemasRefsURLs are URLs of top level and reference JSON schemas, e.g. in a
+	// schema registry. They are downloaded at startup and added to JSONSchemas and JSONSchemasRefs.
+	JSONSchemasURLs     []string
+	JSONSchemasRefsURLs []string
+
+	// JSONSchemasCacheDir is an optional directory in which downloaded schemas are cached. If a download
+	// fails at startup, the cached schema is used instead.
+	JSONSchemasCacheDir string
+
 	// If populated with a logger, the logger will be used. Otherwise a logger with LogLevel will be created (see InitLogger).
 	Logger *logrus.Logger
 
@@ -119,6 +161,91 @@ type Builder struct {
 
 	// Defines the configuration for the KSS service
 	KssConfiguration kss.Configuration
+
+	// CORSExposeHeaders are additional response headers which browser clients may read. Generic headers like
+	// Etag, pagination headers and headers derived from the static properties of blobs are always exposed.
+	CORSExposeHeaders []string
+
+	// if true, errors are always returned as structured JSON. Otherwise only when the request
+	// accepts application/json.
+	JSONErrors bool
+
+	// TimestampPrecision truncates the timestamps of resources to the given precision when they are
+	// written, e.g. time.Millisecond. Postgres stores microseconds, which many clients cannot represent.
+	// Default is 0, which keeps the full precision.
+	TimestampPrecision time.Duration
+
+	// if true, clients use camelCase property names in JSON requests and responses, while the
+	// resources are stored with snake_case names. Otherwise clients can request this per request
+	// with the header Kurbisio-Property-Casing: camel.
+	CamelCase bool
+
+	// MaxResourceDepth limits how deep resources may nest, e.g. 3 for fleet/user/device. Configurations
+	// with deeper resources are rejected, and so are requests with deeper paths. Default is 0, which
+	// means no limit.
+	MaxResourceDepth int
+
+	// StatisticsTimeout limits how long the statistics endpoint may take to compute its response.
+	// Requests which take longer fail with 503 (Service Unavailable). Default is 30 seconds.
+	StatisticsTimeout time.Duration
+
+	// RequestTimeout limits how long a single request may take. Requests which exceed it are cancelled,
+	// also in the database, and fail with 503 (Service Unavailable). Routes which stream big bodies, i.e.
+	// the up- and download of blobs and the export and import of collections, and the rotation of encryption
+	// keys are not limited. Default is 0, which means no limit.
+	RequestTimeout time.Duration
+
+	// if true, a resource whose schema_id is unknown is a configuration error. New panics, and should the
+	// schema still be missing at request time, writes fail with 500. Otherwise validation is deactivated
+	// for such a resource, and only an error is logged.
+	StrictSchemas bool
+
+	// MaxListResponseBytes limits the size of list responses. Lists which would be bigger fail with
+	// 413 (Request Entity Too Large), and clients should request them with a lower limit. Default is 0,
+	// which means no limit.
+	MaxListResponseBytes int
+
+	// MaxImportBytes limits the size of the body of an import, and for compressed bodies also the size of the
+	// uncompressed data. Bigger imports fail with 413 (Request Entity Too Large). Default is 1 GiB.
+	MaxImportBytes int64
+
+	// MaxImportItemBytes limits the size of a single resource of an import. Imports with a bigger resource fail
+	// with 413 (Request Entity Too Large). Default is 10 MiB.
+	MaxImportItemBytes int64
+
+	// if true, list responses carry the current time of the server in the header Kurbisio-Server-Time,
+	// so that clients can anchor their from and until parameters to server time.
+	ServerTimeHeader bool
+
+	// Notifier receives the notifications of all resources through a transactional outbox: the notifications
+	// are written in the transaction of the resource write and relayed to the Notifier by the job processing.
+	// Notifications survive a restart, and a notification may be delivered more than once. If the Notifier
+	// implements core.NotifierWithError, a notification which fails is not marked as published, and the relay
+	// retries it and all later notifications in order with the next job processing. Optional.
+	Notifier core.Notifier
+
+	// MaintenanceWindow is the recurring time range in which events defined with DefineDeferrableEvent are
+	// processed. Optional.
+	MaintenanceWindow *MaintenanceWindow
+
+	// EncryptionKeys are the keys for encrypted_properties by their key id. Each key has 32 bytes for
+	// AES-256-GCM. Keys must be kept as long as values encrypted with them exist. Optional.
+	EncryptionKeys map[string][]byte
+
+	// EncryptionKeyID is the id of the key in EncryptionKeys which encrypts new values.
+	EncryptionKeyID string
+
+	// TrailingSlash selects whether request paths with a trailing slash, e.g. /users/, are not found, redirected
+	// or rewritten to the path without it. Default is TrailingSlashStrict, which treats them as not found.
+	TrailingSlash TrailingSlash
+
+	// if true, New prepares the hot statements of all resources before it returns, so that the first requests
+	// to each resource do not pay for it. Startup becomes slower accordingly.
+	WarmUp bool
+
+	// if true, the warm-up also runs ANALYZE on the resource tables, so that the query planner has statistics.
+	// Only effective together with WarmUp.
+	WarmUpAnalyze bool
 }
 
 // New realizes the actual backend. It creates the sql relations (if they
@@ -131,19 +258,56 @@ func New(bb *Builder) *Backend {
 		panic(fmt.Errorf("parse error in backend configuration: %s", err))
 	}
 
+	if err = config.expandAccess(); err != nil {
+		panic(fmt.Errorf("invalid backend configuration: %s", err))
+	}
+
 	if bb.DB == nil {
 		panic("DB is missing")
 	}
 
+	if err = validateResourceDepth(config, bb.MaxResourceDepth); err != nil {
+		panic(fmt.Errorf("invalid backend configuration: %s", err))
+	}
+
 	if bb.Router == nil {
 		panic("Router is missing")
 	}
 
+	if bb.BasePath != "" && !strings.HasPrefix(bb.BasePath, "/") {
+		panic("BasePath must start with /")
+	}
+
+	encryption, err := newEncryption(bb.EncryptionKeys, bb.EncryptionKeyID)
+	if err != nil {
+		panic(fmt.Errorf("invalid encryption keys: %s", err))
+	}
+
+	if bb.MaintenanceWindow != nil {
+		if err = bb.MaintenanceWindow.validate(); err != nil {
+			panic(fmt.Errorf("invalid maintenance window: %s", err))
+		}
+	}
+
 	pipelineConcurrency := 5
 	if bb.PipelineConcurrency > 0 {
 		pipelineConcurrency = bb.PipelineConcurrency
 	}
 
+	statisticsTimeout := 30 * time.Second
+	if bb.StatisticsTimeout > 0 {
+		statisticsTimeout = bb.StatisticsTimeout
+	}
+
+	maxImportBytes := int64(1 << 30)
+	if bb.MaxImportBytes > 0 {
+		maxImportBytes = bb.MaxImportBytes
+	}
+	maxImportItemBytes := int64(10 << 20)
+	if bb.MaxImportItemBytes > 0 {
+		maxImportItemBytes = bb.MaxImportItemBytes
+	}
+
 	jsonValidator, err := schema.NewValidator([]string{ConfigSchemaJSON}, nil)
 	if err != nil {
 		log.Fatalf("Cannot created json Validator %v", err)
@@ -154,10 +318,19 @@ func New(bb *Builder) *Backend {
 		log.Fatalf("Invalid json %v", err)
 	}
 	bb.Router.UseEncodedPath()
+	router := bb.Router
+	basePath := strings.TrimSuffix(bb.BasePath, "/")
+	if basePath != "" {
+		router = bb.Router.PathPrefix(basePath).Subrouter()
+	}
 	b := &Backend{
 		config:                   config,
 		db:                       bb.DB,
-		router:                   bb.Router,
+		router:                   router,
+		basePath:                 basePath,
+		halRoutes:                make(map[string]string),
+		untimedRoutes:            make(map[*mux.Route]bool),
+		rewrittenRoutes:          make(map[*mux.Route]func(r *http.Request, vars map[string]string) string),
 		publicURL:                bb.PublicURL,
 		collectionFunctions:      make(map[string]*collectionFunctions),
 		relations:                make(map[string]string),
@@ -165,10 +338,28 @@ func New(bb *Builder) *Backend {
 		authorizationEnabled:     bb.AuthorizationEnabled,
 		callbacks:                make(map[string]jobHandler),
 		rateLimits:               make(map[string]rateLimit),
+		deferrableEvents:         make(map[string]bool),
 		interceptors:             make(map[string]requestHandler),
+		afterCommitHooks:         make(map[string]afterCommitHook),
+		filterUsage:              newFilterUsage(),
+		computedProperties:       make(map[string][]computedProperty),
 		collectionsAndSingletons: make(map[string]bool),
 		pipelineConcurrency:      pipelineConcurrency,
 		updateSchema:             bb.UpdateSchema,
+		jsonErrors:               bb.JSONErrors,
+		camelCase:                bb.CamelCase,
+		timestampPrecision:       bb.TimestampPrecision,
+		maxResourceDepth:         bb.MaxResourceDepth,
+		statisticsTimeout:        statisticsTimeout,
+		requestTimeout:           bb.RequestTimeout,
+		strictSchemas:            bb.StrictSchemas,
+		maxListResponseBytes:     bb.MaxListResponseBytes,
+		maxImportBytes:           maxImportBytes,
+		maxImportItemBytes:       maxImportItemBytes,
+		serverTimeHeader:         bb.ServerTimeHeader,
+		notifier:                 bb.Notifier,
+		maintenanceWindow:        bb.MaintenanceWindow,
+		encryption:               encryption,
 	}
 
 	if bb.Logger != nil {
@@ -195,7 +386,8 @@ func New(bb *Builder) *Backend {
 	}
 
 	if bb.JSONSchemasFS != nil {
-		if len(bb.JSONSchemas) > 0 || len(bb.JSONSchemasRefs) > 0 {
+		if len(bb.JSONSchemas) > 0 || len(bb.JSONSchemasRefs) > 0 || bb.JSONSchemasDir != "" ||
+			len(bb.JSONSchemasURLs) > 0 || len(bb.JSONSchemasRefsURLs) > 0 {
 			logger.Default().Fatal("Cannot use both JSONSchemas and JSONSchemasFS")
 		}
 		b.JsonValidator, err = schema.NewValidatorFromFS(*bb.JSONSchemasFS)
@@ -203,7 +395,27 @@ func New(bb *Builder) *Backend {
 			logger.Default().Fatalf("Cannot create json Validator %v", err)
 		}
 	} else {
-		b.JsonValidator, err = schema.NewValidator(bb.JSONSchemas, bb.JSONSchemasRefs)
+		schemas := append([]string{}, bb.JSONSchemas...)
+		refs := append([]string{}, bb.JSONSchemasRefs...)
+		if bb.JSONSchemasDir != "" {
+			dirSchemas, dirRefs, err := schema.ReadDir(bb.JSONSchemasDir)
+			if err != nil {
+				logger.Default().Fatalf("Cannot read json schemas from %s: %v", bb.JSONSchemasDir, err)
+			}
+			schemas = append(schemas, dirSchemas...)
+			refs = append(refs, dirRefs...)
+		}
+		fetchedSchemas, err := schema.Fetch(bb.JSONSchemasURLs, bb.JSONSchemasCacheDir)
+		if err != nil {
+			logger.Default().Fatalf("Cannot fetch json schemas: %v", err)
+		}
+		fetchedRefs, err := schema.Fetch(bb.JSONSchemasRefsURLs, bb.JSONSchemasCacheDir)
+		if err != nil {
+			logger.Default().Fatalf("Cannot fetch json schema refs: %v", err)
+		}
+		schemas = append(schemas, fetchedSchemas...)
+		refs = append(refs, fetchedRefs...)
+		b.JsonValidator, err = schema.NewValidator(schemas, refs)
 		if err != nil {
 			logger.Default().Fatalf("Cannot create json Validator %v", err)
 		}
@@ -234,12 +446,25 @@ func New(bb *Builder) *Backend {
 		log.Fatalf("Invalid json %v", err)
 	}
 	logger.AddRequestID(b.router)
-	b.handleCORS()
+	b.handleCORS(bb.CORSExposeHeaders)
+	b.handleKurbisioContentEncoding()
+	b.handlePropertyCasing()
+	b.handleHAL()
+	b.handleErrors()
+	b.handleRequestTimeout()
 	access.HandleAuthorizationRoute(b.router)
 	b.handleResourceRoutes()
 	b.handleStatistics(b.router)
+	b.handleChanges(b.router)
+	b.handleEncryption(b.router)
+	b.handleIndexAdvice(b.router)
 	b.handleVersion(b.router)
+	b.handleTime(b.router)
+	b.handleConfig(b.router)
+	b.handleShortcuts(b.router)
 	b.handleJobs(b.router)
+	b.handleTrailingSlash(bb.TrailingSlash)
+	b.handleMethodNotAllowed()
 	if b.updateSchema {
 		registry.Write("schema_version", newVersion)
 		_, err = b.db.Exec(fmt.Sprintf("SELECT pg_advisory_unlock(%d);", advisoryLock))
@@ -247,6 +472,9 @@ func New(bb *Builder) *Backend {
 			logger.Default().Fatalf("Cannot release schema update advisory lock %v", err)
 		}
 	}
+	if bb.WarmUp {
+		b.warmUp(bb.WarmUpAnalyze)
+	}
 
 	return b
 }
@@ -297,6 +525,7 @@ func (b *Backend) handleResourceRoutes() {
 	nillog := logger.FromContext(nil)
 	nillog.Debugln("backend: handle resource routes")
 	router := b.router
+	b.handleMaxResourceDepth(router)
 
 	// we combine all types of resources into one and sort them by depth. Rationale: dependencies of
 	// resources must be generated first, otherwise we cannot enforce those dependencies via sql
@@ -365,13 +594,24 @@ func (b *Backend) handleResourceRoutes() {
 		if rc.singleton != nil {
 			// a singleton is a specialized collection
 			tmp := collectionConfiguration{
-				Resource:             rc.singleton.Resource,
-				Permits:              rc.singleton.Permits,
-				SchemaID:             rc.singleton.SchemaID,
-				Description:          rc.singleton.Description,
-				StaticProperties:     rc.singleton.StaticProperties,
-				SearchableProperties: rc.singleton.SearchableProperties,
-				Default:              rc.singleton.Default,
+				Resource:                rc.singleton.Resource,
+				Permits:                 rc.singleton.Permits,
+				SchemaID:                rc.singleton.SchemaID,
+				SchemaIDCreate:          rc.singleton.SchemaIDCreate,
+				SchemaIDUpdate:          rc.singleton.SchemaIDUpdate,
+				Description:             rc.singleton.Description,
+				StaticProperties:        rc.singleton.StaticProperties,
+				SearchableProperties:    rc.singleton.SearchableProperties,
+				Default:                 rc.singleton.Default,
+				RoleDefaults:            rc.singleton.RoleDefaults,
+				RejectUnknownProperties: rc.singleton.RejectUnknownProperties,
+				Coerce:                  rc.singleton.Coerce,
+				DisableCompression:      rc.singleton.DisableCompression,
+				ImmutableProperties:     rc.singleton.ImmutableProperties,
+				MaxConcurrentWrites:     rc.singleton.MaxConcurrentWrites,
+				CoalesceReads:           rc.singleton.CoalesceReads,
+				NotifyOnParentDelete:    rc.singleton.NotifyOnParentDelete,
+				EncryptedProperties:     rc.singleton.EncryptedProperties,
 			}
 			b.createCollectionResource(router, tmp, true)
 		}
@@ -391,18 +631,29 @@ func (b *Backend) handleResourceRoutes() {
 		b.createShortcut(router, sc)
 	}
 
+	for _, rc := range b.config.Collections {
+		for _, alias := range rc.Aliases {
+			b.createAlias(router, rc.Resource, alias)
+		}
+	}
 }
 
 type relationInjection struct {
 	subquery        string
 	columns         []string
 	queryParameters []interface{}
+	// timestampSubquery selects the timestamp of the relation to a listed resource, for order_by=relation_timestamp
+	timestampSubquery string
 }
 
 type collectionFunctions struct {
 	permits []access.Permit
 	list    func(w http.ResponseWriter, r *http.Request, relation *relationInjection)
 	read    func(w http.ResponseWriter, r *http.Request, relation *relationInjection)
+	// table, searchableColumns and idColumns make it possible to filter relations by the related resource
+	table             string
+	searchableColumns []string
+	idColumns         []string
 }
 
 // returns $1,...,$n
@@ -443,12 +694,53 @@ func compareIDsStringWithOffset(offset int, s []string) string {
 	return result
 }
 
+// paginationQuery returns the ORDER BY, LIMIT and OFFSET clause for lists of collections and blobs.
+// All lists are ordered by timestamp and then by the primary identifier idColumn, so that resources
+// with equal timestamps have the same stable order in every list and pagination mode. The limit is
+// the query parameter with index limitParameter, the offset the one after it.
+func paginationQuery(idColumn string, ascending bool, limitParameter int) string {
+	direction := "DESC"
+	if ascending {
+		direction = "ASC"
+	}
+	return fmt.Sprintf("ORDER BY timestamp %s, %s %s LIMIT $%d OFFSET $%d;",
+		direction, idColumn, direction, limitParameter, limitParameter+1)
+}
+
+// relationPaginationQuery returns the ORDER BY, LIMIT and OFFSET clause for lists of related resources which
+// are ordered by the timestamp of their relation instead of their own timestamp, i.e. by the time the relation
+// was established. The identifiers of the relation are the query parameters after offset.
+func relationPaginationQuery(relation *relationInjection, offset int, idColumn string, ascending bool, limitParameter int) string {
+	direction := "DESC"
+	if ascending {
+		direction = "ASC"
+	}
+	timestamp := fmt.Sprintf(relation.timestampSubquery, compareIDsStringWithOffset(offset, relation.columns))
+	return fmt.Sprintf("ORDER BY %s %s, %s %s LIMIT $%d OFFSET $%d;",
+		timestamp, direction, idColumn, direction, limitParameter, limitParameter+1)
+}
+
+// truncateTimestamp truncates a timestamp which is about to be written to the configured precision
+func (b *Backend) truncateTimestamp(t time.Time) time.Time {
+	if b.timestampPrecision <= 0 {
+		return t
+	}
+	return t.Truncate(b.timestampPrecision)
+}
+
 func timeToEtag(t time.Time) string {
 	return fmt.Sprintf("\"%x\"", sha1.Sum([]byte(t.String())))
 }
 func bytesToEtag(b []byte) string {
 	return fmt.Sprintf("\"%x\"", sha1.Sum(b))
 }
+
+// bytesToWeakEtag returns a weak entity tag, i.e. one which identifies semantically equivalent
+// but not necessarily byte-identical responses
+func bytesToWeakEtag(b []byte) string {
+	return "W/" + bytesToEtag(b)
+}
+
 func bytesPlusTotalCountToEtag(b []byte, t int) string {
 	return fmt.Sprintf("\"%x%x\"", sha1.Sum(b), t)
 }
@@ -467,6 +759,101 @@ func patchObject(object map[string]interface{}, patch map[string]interface{}) {
 	}
 }
 
+// isSilent returns true if the request must not send notifications, either because of the query
+// parameter silent=true or because its context was created with core.ContextWithSilent
+func isSilent(r *http.Request) bool {
+	if core.SilentFromContext(r.Context()) {
+		return true
+	}
+	silent, _ := strconv.ParseBool(r.URL.Query().Get("silent"))
+	return silent
+}
+
+// notificationContext returns the context for commitWithNotification. For silent requests it suppresses the
+// notifications, but the after commit hooks still run.
+func notificationContext(r *http.Request) context.Context {
+	if isSilent(r) {
+		return core.ContextWithSilent(r.Context())
+	}
+	return r.Context()
+}
+
+// isAdmin returns true if the request has admin authorization, or if authorization is disabled
+func (b *Backend) isAdmin(r *http.Request) bool {
+	return !b.authorizationEnabled || access.AuthorizationFromContext(r.Context()).HasRole("admin")
+}
+
+// returnPrevious returns true if the client requested the state of a resource before an update or
+// delete, either with the query parameter return=previous or with the header Kurbisio-Return-Previous: true
+func returnPrevious(r *http.Request) bool {
+	if r.URL.Query().Get("return") == "previous" {
+		return true
+	}
+	previous, _ := strconv.ParseBool(r.Header.Get("Kurbisio-Return-Previous"))
+	return previous
+}
+
+// returnChanged returns true if the client requested only the changed properties of a resource in the
+// response to an update, with the query parameter return=changed
+func returnChanged(r *http.Request) bool {
+	return r.URL.Query().Get("return") == "changed"
+}
+
+// changedProperties returns the properties of the JSON object after which differ from the JSON object before,
+// plus the properties listed in keep. Properties which were removed are null.
+func changedProperties(before, after []byte, keep []string) []byte {
+	var beforeJSON, afterJSON map[string]interface{}
+	json.Unmarshal(before, &beforeJSON)
+	json.Unmarshal(after, &afterJSON)
+	changed := map[string]interface{}{}
+	for key, value := range afterJSON {
+		if previous, ok := beforeJSON[key]; !ok || !reflect.DeepEqual(previous, value) {
+			changed[key] = value
+		}
+	}
+	for key := range beforeJSON {
+		if _, ok := afterJSON[key]; !ok {
+			changed[key] = nil
+		}
+	}
+	for _, key := range keep {
+		if value, ok := afterJSON[key]; ok {
+			changed[key] = value
+		}
+	}
+	data, _ := json.MarshalWithOption(changed, json.DisableHTMLEscape())
+	return data
+}
+
+// localizeObject overlays the translations for locale onto object. Translations are stored in the
+// property "translations", which maps locales to property overrides. If there are no translations for
+// a regional locale like "de-AT", the translations for its language "de" are used. Properties without
+// a translation keep their base value.
+func localizeObject(object map[string]interface{}, locale string) {
+	translations, ok := object["translations"].(map[string]interface{})
+	if !ok || locale == "" {
+		return
+	}
+	overrides, ok := translations[locale].(map[string]interface{})
+	if !ok {
+		if i := strings.IndexAny(locale, "-_"); i > 0 {
+			overrides, ok = translations[locale[:i]].(map[string]interface{})
+		}
+	}
+	if !ok {
+		return
+	}
+	// never overlay the core identifiers or the translations themselves
+	patch := map[string]interface{}{}
+	for key, value := range overrides {
+		if key == "translations" || strings.HasSuffix(key, "_id") || key == "timestamp" || key == "revision" {
+			continue
+		}
+		patch[key] = value
+	}
+	patchObject(object, patch)
+}
+
 func (b *Backend) hasCollectionOrSingleton(resource string) bool {
 	_, ok := b.collectionsAndSingletons[resource]
 	return ok
@@ -515,14 +902,19 @@ func (b *Backend) createShortcut(router *mux.Router, sc shortcutConfiguration) {
 	rlog.Debugln("create shortcut from", shortcut, "to", targetDoc)
 	rlog.Debugln("  handle shortcut routes: "+prefix+"[/...]", "GET,POST,PUT,PATCH,DELETE")
 
+	// matchPath returns the path of the target with the names of the identifiers as placeholders
+	matchPath := func(r *http.Request, vars map[string]string) string {
+		return b.basePath + matchPrefix + strings.TrimPrefix(r.URL.Path, b.basePath+prefix)
+	}
+
 	replaceHandler := func(w http.ResponseWriter, r *http.Request) {
 		rlog := logger.FromContext(r.Context())
 		rlog.Debugln("called shortcut route for", r.URL, r.Method)
 
-		tail := strings.TrimPrefix(r.URL.Path, prefix)
+		tail := strings.TrimPrefix(r.URL.Path, b.basePath+prefix)
 
 		var match mux.RouteMatch
-		r.URL.Path = matchPrefix + tail
+		r.URL.Path = matchPath(r, nil)
 		rlog.Debugln("try to match route", r.URL.Path)
 		if !router.Match(r, &match) {
 			rlog.Errorf("Found no match for %s", r.URL.Path)
@@ -531,12 +923,7 @@ func (b *Backend) createShortcut(router *mux.Router, sc shortcutConfiguration) {
 		}
 
 		auth := access.AuthorizationFromContext(r.Context())
-		authorized := auth.HasRole("admin")
-		for i := 0; i < len(sc.Roles) && !authorized; i++ {
-			role := sc.Roles[i]
-			authorized = (auth.HasRole(role) || (auth.HasRoles() && role == "everybody") || role == "public")
-		}
-		if !authorized {
+		if !shortcutAuthorized(auth, sc) {
 			http.Error(w, "not authorized", http.StatusUnauthorized)
 			return
 		}
@@ -549,19 +936,75 @@ func (b *Backend) createShortcut(router *mux.Router, sc shortcutConfiguration) {
 			}
 			newPrefix += "/" + core.Plural(s) + "/" + id
 		}
-		r.URL.Path = newPrefix + tail
+		r.URL.Path = b.basePath + newPrefix + tail
 		rlog.Debugln("redirect shortcut route to ", r.URL)
 		router.ServeHTTP(w, r)
 	}
-	router.HandleFunc(prefix, replaceHandler).Methods(http.MethodOptions, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete)
-	router.HandleFunc(prefix+"/{rest:.+}", replaceHandler).Methods(http.MethodOptions, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete)
+	b.rewrittenRoutes[router.HandleFunc(prefix, replaceHandler).Methods(http.MethodOptions, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete)] = matchPath
+	b.rewrittenRoutes[router.HandleFunc(prefix+"/{rest:.+}", replaceHandler).Methods(http.MethodOptions, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete)] = matchPath
+}
+
+// createAlias makes the collection resource, and all its children, also reachable under an alias name
+// for its last path segment. This keeps old routes working after a resource was renamed. The alias
+// routes rewrite the path to the actual resource and route the request again, so there is no
+// duplicated storage and the same permits apply.
+func (b *Backend) createAlias(router *mux.Router, resource, alias string) {
+	nillog := logger.FromContext(nil)
+	resources := strings.Split(resource, "/")
+	parents := resources[:len(resources)-1]
+	aliasResource := strings.Join(append(append([]string{}, parents...), alias), "/")
+	conflict := b.hasCollectionOrSingleton(aliasResource)
+	for _, rc := range b.config.Blobs {
+		conflict = conflict || rc.Resource == aliasResource
+	}
+	if conflict {
+		nillog.Fatalf("alias %s of %s conflicts with an existing resource", alias, resource)
+	}
+
+	var prefix string
+	for _, s := range parents {
+		prefix += "/" + core.Plural(s) + "/{" + s + "_id}"
+	}
+	prefix += "/" + core.Plural(alias)
+
+	nillog.Debugln("create alias from", alias, "to", resource)
+	nillog.Debugln("  handle alias routes: "+prefix+"[/...]", "GET,POST,PUT,PATCH,DELETE")
+
+	// targetPath returns the path of the actual resource for the route variables of an alias route
+	targetPath := func(r *http.Request, vars map[string]string) string {
+		path := b.basePath
+		for _, s := range parents {
+			path += "/" + core.Plural(s) + "/" + vars[s+"_id"]
+		}
+		path += "/" + core.Plural(resources[len(resources)-1])
+		if rest, ok := vars["rest"]; ok {
+			path += "/" + rest
+		}
+		return path
+	}
+
+	aliasHandler := func(w http.ResponseWriter, r *http.Request) {
+		rlog := logger.FromContext(r.Context())
+		rlog.Debugln("called alias route for", r.URL, r.Method)
+		r.URL.Path = targetPath(r, mux.Vars(r))
+		r.URL.RawPath = ""
+		rlog.Debugln("redirect alias route to ", r.URL)
+		router.ServeHTTP(w, r)
+	}
+	b.rewrittenRoutes[router.HandleFunc(prefix, aliasHandler).Methods(http.MethodOptions, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete)] = targetPath
+	b.rewrittenRoutes[router.HandleFunc(prefix+"/{rest:.+}", aliasHandler).Methods(http.MethodOptions, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete)] = targetPath
 }
 
-// Router returns the mux.Router for this backend
+// Router returns the mux.Router for this backend. With a base path, this is the subrouter for the base path.
 func (b *Backend) Router() *mux.Router {
 	return b.router
 }
 
+// BasePath returns the path prefix under which the backend is mounted, see Builder.BasePath
+func (b *Backend) BasePath() string {
+	return b.basePath
+}
+
 // PublicURL returns this backend's deployments public URL
 func (b *Backend) PublicURL() string {
 	return b.publicURL
@@ -12,6 +12,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -108,6 +110,11 @@ var configurationJSON string = `{
 		"resource": "with_schema",
 		"schema_id": "http://some_host.com/workout.json"
 	  },
+	  {
+		"resource": "with_strict_schema",
+		"schema_id": "http://some_host.com/workout.json",
+		"reject_unknown_properties": true
+	  },
 	  {
 		"resource":"order"
 	  },
@@ -1396,6 +1403,53 @@ func TestPaginationCollection(t *testing.T) {
 
 }
 
+func TestPaginationWithoutTotalCount(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "a"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	numberOfElements := 15
+	for i := 0; i < numberOfElements; i++ {
+		if _, err := testService.client.RawPost("/as", map[string]interface{}{"index": i}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{"/as?limit=10&withtotalcount=false", "/as?limit=10&withtotalcount=false&metaonly=true"} {
+		received := map[string]bool{}
+		for page := 1; page <= 3; page++ {
+			var as []map[string]interface{}
+			status, h, err := testService.client.RawGetWithHeader(fmt.Sprintf("%s&page=%d", path, page), map[string]string{}, &as)
+			if err != nil || status != http.StatusOK {
+				t.Fatal("error: ", err, "status: ", status)
+			}
+			assert.Equal(t, "10", h.Get("Pagination-Limit"), path)
+			assert.Equal(t, strconv.Itoa(page), h.Get("Pagination-Current-Page"), path)
+			assert.Empty(t, h.Get("Pagination-Total-Count"), path)
+			assert.Empty(t, h.Get("Pagination-Page-Count"), path)
+			for _, a := range as {
+				received[a["a_id"].(string)] = true
+			}
+		}
+		assert.Len(t, received, numberOfElements, path)
+	}
+
+	// the total count is still the default
+	_, h, err := testService.client.RawGetWithHeader("/as?limit=10", map[string]string{}, &[]map[string]interface{}{})
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(numberOfElements), h.Get("Pagination-Total-Count"))
+
+	status, _ := testService.client.RawGet("/as?withtotalcount=maybe", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
 func TestPaginationBlob(t *testing.T) {
 	numberOfElements := 10
 	beforeCreation := time.Now().UTC().Add(-time.Second)
@@ -1455,6 +1509,122 @@ func TestPaginationBlob(t *testing.T) {
 	}
 }
 
+// TestPaginationOrderWithEqualTimestamps verifies that collections and blobs with equal timestamps are
+// returned in the same order in all pagination modes
+func TestPaginationOrderWithEqualTimestamps(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "a"
+		  }
+		],
+		"blobs": [
+		  {
+			"resource": "image"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	numberOfElements := 6
+	timestamp := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	for i := 0; i < numberOfElements; i++ {
+		if _, err := testService.client.RawPost("/as", map[string]interface{}{"timestamp": timestamp}, nil); err != nil {
+			t.Fatal(err)
+		}
+		header := map[string]string{"Kurbisio-Meta-Data": asJSON(map[string]interface{}{"timestamp": timestamp})}
+		if _, err := testService.client.RawPostBlob("/images", header, []byte("data"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type item struct {
+		AID     uuid.UUID `json:"a_id"`
+		ImageID uuid.UUID `json:"image_id"`
+	}
+	ids := func(path string) []uuid.UUID {
+		var items []item
+		if _, err := testService.client.RawGet(path, &items); err != nil {
+			t.Fatal(err)
+		}
+		result := []uuid.UUID{}
+		for _, i := range items {
+			if i.AID != uuid.Nil {
+				result = append(result, i.AID)
+			} else {
+				result = append(result, i.ImageID)
+			}
+		}
+		return result
+	}
+
+	until := url.QueryEscape(timestamp.Format(time.RFC3339))
+	for _, route := range []string{"/as", "/images"} {
+		t.Run(route, func(t *testing.T) {
+			all := ids(route)
+			assert.Equal(t, numberOfElements, len(all))
+
+			var paged, pagedUntil, ascending []uuid.UUID
+			for page := 1; page <= numberOfElements/2; page++ {
+				paged = append(paged, ids(fmt.Sprintf("%s?limit=2&page=%d", route, page))...)
+				pagedUntil = append(pagedUntil, ids(fmt.Sprintf("%s?limit=2&page=%d&until=%s", route, page, until))...)
+				ascending = append(ascending, ids(fmt.Sprintf("%s?limit=2&page=%d&order=asc", route, page))...)
+			}
+			assert.Equal(t, all, paged)
+			assert.Equal(t, all, pagedUntil)
+			for i := range ascending {
+				assert.Equal(t, all[len(all)-1-i], ascending[i])
+			}
+		})
+	}
+}
+
+func TestRandomOrder(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "a"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type item struct {
+		AID uuid.UUID `json:"a_id"`
+	}
+	created := map[uuid.UUID]bool{}
+	for i := 0; i < 10; i++ {
+		var a item
+		if _, err := testService.client.RawPost("/as", item{}, &a); err != nil {
+			t.Fatal(err)
+		}
+		created[a.AID] = true
+	}
+
+	var sample []item
+	_, header, err := testService.client.RawGetWithHeader("/as?order=random&limit=4", map[string]string{}, &sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, sample, 4)
+	seen := map[uuid.UUID]bool{}
+	for _, a := range sample {
+		assert.True(t, created[a.AID])
+		assert.False(t, seen[a.AID])
+		seen[a.AID] = true
+	}
+	assert.Equal(t, "10", header.Get("Pagination-Total-Count"))
+	assert.Equal(t, "", header.Get("Pagination-Page-Count"))
+
+	status, err := testService.client.RawGet("/as?order=random&limit=4&page=2", &sample)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
 func TestInvalidPaths(t *testing.T) {
 	testCases := []struct {
 		path           string
@@ -1534,3 +1704,384 @@ func TestScheduleEvents(t *testing.T) {
 	assert.Nil(t, err, "cancel handled event")
 	assert.Equal(t, true, ok, "cancel handled event")
 }
+
+func TestMaxResourceDepth(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "fleet"
+		  },
+		  {
+			"resource": "fleet/user"
+		  }
+		]
+	  }
+	`
+	assert.Panics(t, func() {
+		CreateTestServiceWithBuilder(jsonConfig, t.Name(), func(b *backend.Builder) {
+			b.MaxResourceDepth = 1
+		})
+	})
+
+	testService := CreateTestServiceWithBuilder(jsonConfig, t.Name(), func(b *backend.Builder) {
+		b.MaxResourceDepth = 2
+	})
+	defer testService.Db.Close()
+
+	var fleet map[string]interface{}
+	if _, err := testService.client.RawPost("/fleets", map[string]string{}, &fleet); err != nil {
+		t.Fatal(err)
+	}
+	users := "/fleets/" + fleet["fleet_id"].(string) + "/users"
+	if _, err := testService.client.RawGet(users, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := testService.client.RawGet(users+"/all/devices/all/sensors/all", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestBasePath(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user"
+		  },
+		  {
+			"resource": "user/device",
+			"aliases": ["gadget"],
+			"permits": [
+			  {
+				"role": "userrole",
+				"operations": ["list"],
+				"selectors": ["user"]
+			  }
+			]
+		  }
+		],
+		"shortcuts": [
+		  {
+			"shortcut": "user",
+			"target": "user",
+			"roles": ["userrole"]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestServiceWithBuilder(jsonConfig, t.Name(), func(b *backend.Builder) {
+		b.BasePath = "/api/v1/"
+		b.MaxResourceDepth = 2
+	})
+	defer testService.Db.Close()
+	assert.Equal(t, "/api/v1", testService.backend.BasePath())
+
+	apiClient := testService.client.WithBasePath("/api/v1")
+
+	var user map[string]interface{}
+	if _, err := apiClient.RawPost("/users", map[string]interface{}{"name": "alice"}, &user); err != nil {
+		t.Fatal(err)
+	}
+	userID := user["user_id"].(string)
+	var device map[string]interface{}
+	if _, err := apiClient.RawPost("/users/"+userID+"/devices", map[string]interface{}{}, &device); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is mounted at the root
+	status, err := testService.client.RawGet("/users/"+userID, &user)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, err = testService.client.RawGet("/version", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// generated routes, aliases, shortcuts and the built-in routes live under the base path
+	if _, err = apiClient.RawGet("/users/"+userID, &user); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "alice", user["name"])
+
+	var devices []map[string]interface{}
+	if _, err = apiClient.RawGet("/users/"+userID+"/gadgets", &devices); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, devices, 1)
+
+	userClient := testService.clientNoAuth.WithBasePath("/api/v1").WithAuthorization(&access.Authorization{
+		Roles:     []string{"userrole"},
+		Selectors: map[string]string{"user_id": userID},
+	})
+	if _, err = userClient.RawGet("/user/devices", &devices); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, devices, 1)
+
+	var version map[string]interface{}
+	if _, err = apiClient.RawGet("/version", &version); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, version, "version")
+
+	// the base path does not count towards the maximum resource depth
+	deviceID := device["device_id"].(string)
+	status, _ = apiClient.RawGet("/users/"+userID+"/devices/"+deviceID+"/uploads/x/parts/1", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = apiClient.RawGet("/users/"+userID+"/devices/"+deviceID+"/uploads/x/parts/1/x", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestTrailingSlash(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user"
+		  }
+		]
+	  }
+	`
+	request := func(router *mux.Router, method, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader("{}"))
+		r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, r)
+		return rec
+	}
+
+	strictService := CreateTestService(jsonConfig, t.Name())
+	defer strictService.Db.Close()
+	assert.Equal(t, http.StatusOK, request(strictService.Router, http.MethodGet, "/users").Code)
+	assert.Equal(t, http.StatusNotFound, request(strictService.Router, http.MethodGet, "/users/").Code)
+
+	redirectService := CreateTestServiceWithBuilder(jsonConfig, t.Name(), func(b *backend.Builder) {
+		b.TrailingSlash = backend.TrailingSlashRedirect
+	})
+	defer redirectService.Db.Close()
+	rec := request(redirectService.Router, http.MethodPost, "/users/?silent=true")
+	assert.Equal(t, http.StatusPermanentRedirect, rec.Code)
+	assert.Equal(t, "/users?silent=true", rec.Header().Get("Location"))
+	// paths which do not exist without the slash either are still not found
+	assert.Equal(t, http.StatusNotFound, request(redirectService.Router, http.MethodGet, "/unknown/").Code)
+
+	rewriteService := CreateTestServiceWithBuilder(jsonConfig, t.Name(), func(b *backend.Builder) {
+		b.TrailingSlash = backend.TrailingSlashRewrite
+	})
+	defer rewriteService.Db.Close()
+	rec = request(rewriteService.Router, http.MethodPost, "/users/")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var user map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &user); err != nil {
+		t.Fatal(err)
+	}
+	userID := user["user_id"].(string)
+	assert.Equal(t, http.StatusOK, request(rewriteService.Router, http.MethodGet, "/users/"+userID+"/").Code)
+	assert.Equal(t, http.StatusNotFound, request(rewriteService.Router, http.MethodGet, "/unknown/").Code)
+}
+
+func TestWarmUp(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user",
+			"searchable_properties": ["email"]
+		  },
+		  {
+			"resource": "user/device"
+		  }
+		],
+		"singletons": [
+		  {
+			"resource": "user/profile"
+		  }
+		],
+		"blobs": [
+		  {
+			"resource": "user/picture"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestServiceWithBuilder(jsonConfig, t.Name(), func(b *backend.Builder) {
+		b.WarmUp = true
+		b.WarmUpAnalyze = true
+	})
+	defer testService.Db.Close()
+
+	var user map[string]interface{}
+	if _, err := testService.client.RawPost("/users", map[string]interface{}{"email": "alice@example.com"}, &user); err != nil {
+		t.Fatal(err)
+	}
+	var users []map[string]interface{}
+	if _, err := testService.client.RawGet("/users", &users); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, users, 1)
+}
+
+func TestHandleCustom(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	testService.backend.HandleCustom("/reports/{report}", []string{http.MethodGet}, []string{"reporter"},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			data, _ := json.Marshal(map[string]string{"report": mux.Vars(r)["report"]})
+			w.Write(data)
+		})
+
+	var report map[string]string
+	status, err := testService.clientNoAuth.WithRole("reporter").RawGet("/reports/sales", &report)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "sales", report["report"])
+
+	// admins are always authorized
+	status, err = testService.client.RawGet("/reports/sales", &report)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = testService.clientNoAuth.WithRole("other").RawGet("/reports/sales", nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = testService.clientNoAuth.RawGet("/reports/sales", nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// only the given methods are routed
+	status, _ = testService.clientNoAuth.WithRole("reporter").RawPost("/reports/sales", nil, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "event",
+			"immutable": true,
+			"no_delete": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var event map[string]interface{}
+	if _, err := testService.client.RawPost("/events", map[string]interface{}{}, &event); err != nil {
+		t.Fatal(err)
+	}
+	request := func(method, path string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader("{}"))
+		r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		testService.Router.ServeHTTP(rec, r)
+		return rec
+	}
+
+	itemPath := "/events/" + event["event_id"].(string)
+	for _, method := range []string{http.MethodDelete, http.MethodPut, http.MethodPatch} {
+		rec := request(method, itemPath, nil)
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code, method)
+		assert.Equal(t, "OPTIONS, GET", rec.Header().Get("Allow"), method)
+	}
+	rec := request(http.MethodDelete, "/events", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "OPTIONS, GET, POST", rec.Header().Get("Allow"))
+
+	// structured errors
+	rec = request(http.MethodDelete, itemPath, map[string]string{"Accept": "application/json"})
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	var errorResponse backend.ErrorResponse
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &errorResponse)) {
+		assert.Equal(t, "method_not_allowed", errorResponse.Error.Code)
+	}
+
+	// unknown paths are still not found
+	rec = request(http.MethodDelete, "/unknown", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestShortcutsForCaller(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "fleet"
+		  },
+		  {
+			"resource": "fleet/user"
+		  },
+		  {
+			"resource": "org"
+		  }
+		],
+		"shortcuts": [
+		  {
+			"shortcut": "user",
+			"target": "fleet/user",
+			"roles": ["userrole"]
+		  },
+		  {
+			"shortcut": "org",
+			"target": "org",
+			"roles": ["everybody"]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	fleetID, userID, orgID := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	shortcuts := func(auth *access.Authorization) map[string]backend.ShortcutInfo {
+		var list []backend.ShortcutInfo
+		if _, err := testService.clientNoAuth.WithAuthorization(auth).RawGet("/shortcuts", &list); err != nil {
+			t.Fatal(err)
+		}
+		result := map[string]backend.ShortcutInfo{}
+		for _, sc := range list {
+			result[sc.Shortcut] = sc
+		}
+		return result
+	}
+
+	result := shortcuts(&access.Authorization{
+		Roles:     []string{"userrole"},
+		Selectors: map[string]string{"fleet_id": fleetID, "user_id": userID, "org_id": orgID},
+	})
+	assert.Len(t, result, 2)
+	assert.Equal(t, backend.ShortcutInfo{
+		Shortcut: "user",
+		Target:   "fleet/user",
+		Prefix:   "/user",
+		Path:     "/fleets/" + fleetID + "/users/" + userID,
+	}, result["user"])
+	assert.Equal(t, "/orgs/"+orgID, result["org"].Path)
+
+	// other roles only get the shortcuts for everybody
+	result = shortcuts(&access.Authorization{
+		Roles:     []string{"otherrole"},
+		Selectors: map[string]string{"fleet_id": fleetID, "user_id": userID, "org_id": orgID},
+	})
+	assert.Len(t, result, 1)
+	assert.Contains(t, result, "org")
+
+	// shortcuts without selectors for their target are not usable
+	result = shortcuts(&access.Authorization{
+		Roles:     []string{"userrole"},
+		Selectors: map[string]string{"user_id": userID},
+	})
+	assert.Len(t, result, 0)
+
+	// anonymous callers have no shortcuts
+	result = shortcuts(nil)
+	assert.Len(t, result, 0)
+}
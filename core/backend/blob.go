@@ -8,9 +8,9 @@ package backend
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -25,9 +25,29 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/relabs-tech/kurbisio/core"
 	"github.com/relabs-tech/kurbisio/core/access"
+	"github.com/relabs-tech/kurbisio/core/backend/kss"
 	"github.com/relabs-tech/kurbisio/core/logger"
 )
 
+// maxUploadParts is the maximum number of parts of a multipart upload
+const maxUploadParts = 10000
+
+// multipartUploadURLValidity is the validity of the presigned URLs of multipart upload parts
+const multipartUploadURLValidity = time.Hour
+
+// MultipartUploadResponse is the response of a request to initiate a multipart upload of an
+// externally stored blob. PartURLs contains one presigned upload URL per requested part.
+type MultipartUploadResponse struct {
+	UploadID string   `json:"upload_id"`
+	PartURLs []string `json:"part_urls"`
+}
+
+// MultipartUploadCompletion is the request body to complete a multipart upload. It lists all uploaded
+// parts in ascending order with the Etags returned by the part uploads.
+type MultipartUploadCompletion struct {
+	Parts []kss.CompletedPart `json:"parts"`
+}
+
 func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 	schema := b.db.Schema
 	resource := rc.Resource
@@ -50,20 +70,31 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 	columns := []string{this + "_id"}
 	searchableColumns := []string{columns[0]}
 
+	onParentDelete, err := b.parentDeleteAction(resource, rc.OnParentDelete, false)
+	if err != nil {
+		nillog.WithError(err).Errorf("invalid configuration for resource %s", resource)
+		panic("invalid configuration on_parent_delete")
+	}
+
 	for i := range dependencies {
 		that := dependencies[i]
 		createColumn := fmt.Sprintf("%s_id uuid NOT NULL", that)
+		if onParentDelete.code == "n" {
+			// orphans keep their own identifier, but lose their parent
+			createColumn = fmt.Sprintf("%s_id uuid", that)
+		}
 		createColumns = append(createColumns, createColumn)
 		columns = append(columns, that+"_id")
 		searchableColumns = append(searchableColumns, that+"_id")
 	}
 
+	var parentForeignKey string
 	if len(dependencies) > 0 {
 		foreignColumns := strings.Join(columns[1:], ",")
-		createColumn := "FOREIGN KEY (" + foreignColumns + ") " +
+		parentForeignKey = "FOREIGN KEY (" + foreignColumns + ") " +
 			"REFERENCES " + schema + ".\"" + strings.Join(dependencies, "/") + "\" " +
-			"(" + foreignColumns + ") ON DELETE CASCADE"
-		createColumns = append(createColumns, createColumn)
+			"(" + foreignColumns + ") ON DELETE " + onParentDelete.clause
+		createColumns = append(createColumns, parentForeignKey)
 	}
 
 	// enforce a unique constraint on all our identifying indices. This enables child
@@ -84,6 +115,8 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 	jsonToHeader := map[string]string{}
 
 	createPropertiesQuery := ""
+	var propertyIndices []string
+	staticPropertiesIndex := len(columns) // where static properties start
 	// static properties are varchars
 	for _, property := range rc.StaticProperties {
 		createPropertiesQuery += fmt.Sprintf("ALTER TABLE %s.\"%s\" ADD COLUMN IF NOT EXISTS \"%s\" varchar NOT NULL DEFAULT '';", schema, resource, property)
@@ -97,6 +130,7 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		createIndicesQuery += fmt.Sprintf("CREATE index IF NOT EXISTS %s ON %s.\"%s\"(%s);",
 			"searchable_property_"+this+"_"+property,
 			schema, resource, property)
+		propertyIndices = append(propertyIndices, "searchable_property_"+this+"_"+property)
 		columns = append(columns, property)
 		jsonToHeader[property] = core.PropertyNameToCanonicalHeader(property)
 		searchableColumns = append(searchableColumns, property)
@@ -111,6 +145,7 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		createIndicesQuery = createIndicesQuery + fmt.Sprintf("CREATE UNIQUE index IF NOT EXISTS %s ON %s.\"%s\"(%s);",
 			"external_index_"+this+"_"+name,
 			schema, resource, name)
+		propertyIndices = append(propertyIndices, "external_index_"+this+"_"+name)
 		columns = append(columns, name)
 		jsonToHeader[name] = core.PropertyNameToCanonicalHeader(name)
 		searchableColumns = append(searchableColumns, name)
@@ -122,12 +157,22 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 
 	createQuery += "(" + strings.Join(createColumns, ", ") + ");" + createPropertiesQuery + createIndicesQuery
 
-	var err error
 	if b.updateSchema {
 		_, err = b.db.Exec(createQuery)
 		if err != nil {
 			panic(err)
 		}
+		b.reconcileSchema(schemaLayout{
+			resource:           resource,
+			this:               this,
+			coreColumns:        append([]string{"timestamp", "blob"}, columns[:propertiesIndex+1]...),
+			propertyColumns:    columns[staticPropertiesIndex:],
+			indices:            propertyIndices,
+			parent:             strings.Join(dependencies, "/"),
+			parentColumns:      append([]string{}, columns[1:propertiesIndex]...),
+			parentForeignKey:   parentForeignKey,
+			parentDeleteAction: onParentDelete,
+		})
 	}
 
 	listRoute := ""
@@ -137,8 +182,14 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		itemRoute = itemRoute + "/" + core.Plural(r) + "/{" + r + "_id}"
 	}
 
+	b.registerHALRoute(listRoute, resource)
 	nillog.Debugln("  handle blob routes:", listRoute, "GET,POST,DELETE")
 	nillog.Debugln("  handle blob routes:", itemRoute, "GET,PUT, DELETE")
+	if rc.StoredExternally {
+		nillog.Debugln("  handle blob routes:", itemRoute+"/uploads", "POST")
+		nillog.Debugln("  handle blob routes:", itemRoute+"/uploads/{upload_id}", "POST,DELETE")
+		nillog.Debugln("  handle blob routes:", itemRoute+"/uploads/{upload_id}/parts/{part_number}", "GET")
+	}
 
 	readQuery := "SELECT " + strings.Join(columns, ", ") + fmt.Sprintf(", timestamp, blob FROM %s.\"%s\" ", schema, resource)
 	readQueryMeta := "SELECT " + strings.Join(columns, ", ") + fmt.Sprintf(", timestamp FROM %s.\"%s\" ", schema, resource)
@@ -154,7 +205,8 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 	sqlWhereAll += fmt.Sprintf("($%d OR timestamp<=$%d) AND ($%d OR timestamp>=$%d) ",
 		propertiesIndex, propertiesIndex+1, propertiesIndex+2, propertiesIndex+3)
 
-	sqlPagination := fmt.Sprintf("ORDER BY timestamp DESC, %s  DESC LIMIT $%d OFFSET $%d;", columns[0], propertiesIndex+4, propertiesIndex+5)
+	sqlPaginationDesc := paginationQuery(columns[0], false, propertiesIndex+4)
+	sqlPaginationAsc := paginationQuery(columns[0], true, propertiesIndex+4)
 
 	sqlWhereAllPlusOneExternalIndex := sqlWhereAll + fmt.Sprintf("AND %%s = $%d ", propertiesIndex+6)
 
@@ -178,6 +230,8 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 	insertUpdateQuery += strings.Join(sets, ", ") + ", blob = $" + strconv.Itoa(len(columns)+1)
 	insertUpdateQuery += ", timestamp = $" + strconv.Itoa(len(columns)+2) + " RETURNING " + this + "_id;"
 
+	b.registerWarmUp(resource, readQuery+sqlWhereOne+";", readQueryWithTotal+sqlWhereAll+sqlPaginationDesc, insertQuery, updateQuery)
+
 	maxAge := ""
 	if !rc.Mutable {
 		rc.MaxAgeCache = 31536000
@@ -226,6 +280,7 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		}
 	}
 	list := func(w http.ResponseWriter, r *http.Request, relation *relationInjection) {
+		b.setServerTime(w)
 		var (
 			queryParameters []interface{}
 			sqlQuery        string
@@ -235,6 +290,8 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 			from            time.Time
 			externalColumn  string
 			externalIndex   string
+			ascendingOrder  bool
+			orderByRelation bool
 		)
 
 		urlQuery := r.URL.Query()
@@ -257,10 +314,10 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 					err = fmt.Errorf("out of range")
 				}
 			case "until":
-				until, err = time.Parse(time.RFC3339, value)
+				until, err = parseTimeParameter(value)
 
 			case "from":
-				from, err = time.Parse(time.RFC3339, value)
+				from, err = parseTimeParameter(value)
 			case "filter", "search":
 				i := strings.IndexRune(value, '=')
 				if i < 0 {
@@ -281,7 +338,26 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 				}
 				if !found {
 					err = fmt.Errorf("unknown filter property '%s'", filterKey)
+					break
 				}
+				err = checkIDFilter(filterKey, filterValue, columns[:propertiesIndex])
+			case "order":
+				if value != "asc" && value != "desc" {
+					err = fmt.Errorf("order must be asc or desc")
+					break
+				}
+				ascendingOrder = (value == "asc")
+
+			case "order_by":
+				if value != "timestamp" && value != "relation_timestamp" {
+					err = fmt.Errorf("order_by must be timestamp or relation_timestamp")
+					break
+				}
+				if value == "relation_timestamp" && relation == nil {
+					err = fmt.Errorf("relation_timestamp is only supported for relations")
+					break
+				}
+				orderByRelation = (value == "relation_timestamp")
 
 			default:
 				err = fmt.Errorf("unknown")
@@ -316,19 +392,31 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		queryParameters[propertiesIndex-1+4] = limit
 		queryParameters[propertiesIndex-1+5] = (page - 1) * limit
 
+		sqlPaginationRelation := ""
 		if relation != nil {
 			// inject subquery for relation
 			sqlQuery += fmt.Sprintf(relation.subquery,
 				compareIDsStringWithOffset(len(queryParameters), relation.columns))
+			if orderByRelation {
+				sqlPaginationRelation = relationPaginationQuery(relation, len(queryParameters), columns[0], ascendingOrder,
+					propertiesIndex+4)
+			}
 			queryParameters = append(queryParameters, relation.queryParameters...)
 		}
 
-		sqlQuery += sqlPagination
+		if orderByRelation {
+			sqlQuery += sqlPaginationRelation
+		} else if ascendingOrder {
+			sqlQuery += sqlPaginationAsc
+		} else {
+			sqlQuery += sqlPaginationDesc
+		}
 
-		rows, err := b.db.Query(sqlQuery, queryParameters...)
+		rows, err := b.db.QueryContext(r.Context(), sqlQuery, queryParameters...)
 		if err != nil {
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				nillog.WithError(err).Errorf("Error 5325: cannot execute query `%s`", sqlQuery)
+				http.Error(w, "Error 5325", databaseErrorStatus(w, err))
 				return
 			}
 		}
@@ -340,7 +428,8 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 			values, object := createScanValuesAndObject(&timestamp, &totalCount)
 			err := rows.Scan(values...)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				nillog.WithError(err).Errorf("Error 5326: cannot scan values")
+				http.Error(w, "Error 5326", http.StatusInternalServerError)
 				return
 			}
 			mergeProperties(object)
@@ -365,7 +454,7 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		w.Header().Set("Pagination-Total-Count", strconv.Itoa(totalCount))
 		w.Header().Set("Pagination-Page-Count", strconv.Itoa(((totalCount-1)/limit)+1))
 		w.Header().Set("Pagination-Current-Page", strconv.Itoa(page))
-		if !from.IsZero() {
+		if !from.IsZero() && !orderByRelation {
 			w.Header().Set("Pagination-Until", from.Format(time.RFC3339Nano))
 		}
 		w.Write(jsonData)
@@ -398,39 +487,45 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 			return
 		}
 
-		if rc.Mutable {
-			if ifNoneMatch := r.Header.Get("If-None-Match"); len(ifNoneMatch) > 0 {
-				// special blob handling for if-non-match: Since we only need the creation time
-				// for calculating the etag, we prefer doing an extra query instead of
-				// loading the entire binary blob into memory for no good reason
-				var timestamp time.Time
-				values, object := createScanValuesAndObject(&timestamp)
-				err = b.db.QueryRow(readQueryMeta+sqlWhereOne+";", queryParameters...).Scan(values...)
-				if err == sql.ErrNoRows {
-					http.Error(w, "no such "+this, http.StatusNotFound)
+		ifNoneMatch := r.Header.Get("If-None-Match")
+		if (rc.Mutable && len(ifNoneMatch) > 0) || len(r.Header.Get("If-Modified-Since")) > 0 {
+			// special blob handling for conditional requests: Since we only need the creation time
+			// for calculating the etag, we prefer doing an extra query instead of
+			// loading the entire binary blob into memory for no good reason
+			var timestamp time.Time
+			values, object := createScanValuesAndObject(&timestamp)
+			err = b.db.QueryRowContext(r.Context(), readQueryMeta+sqlWhereOne+";", queryParameters...).Scan(values...)
+			if err == sql.ErrNoRows {
+				http.Error(w, "no such "+this, http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				if err, ok := err.(*pq.Error); ok && err.Code == "22P02" {
+					http.Error(w, "invalid uuid", http.StatusBadRequest)
 					return
 				}
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
+				rlog.WithError(err).Errorf("Error 5327: cannot read meta data")
+				http.Error(w, "Error 5327", databaseErrorStatus(w, err))
+				return
+			}
+			etag := timeToEtag(timestamp)
+			if (rc.Mutable && ifNoneMatchFound(ifNoneMatch, etag)) || notModifiedSince(r, timestamp) {
+				// headers must be provided also for not modified responses
+				for i := propertiesIndex + 1; i < len(columns); i++ {
+					k := columns[i]
+					w.Header().Set(jsonToHeader[k], *object[k].(*string))
 				}
-				etag := timeToEtag(timestamp)
-				if ifNoneMatchFound(ifNoneMatch, etag) {
-					// headers must be provided also in case If-None-Match is set
+				if rc.Mutable {
 					w.Header().Set("Etag", etag)
-					for i := propertiesIndex + 1; i < len(columns); i++ {
-						k := columns[i]
-						w.Header().Set(jsonToHeader[k], *object[k].(*string))
-					}
-					w.Header().Set("Etag", timeToEtag(timestamp))
-					if len(maxAge) > 0 {
-						w.Header().Set("Cache-Control", maxAge)
-					}
-					metaData, _ := json.Marshal(object)
-					w.Header().Set("Kurbisio-Meta-Data", string(metaData))
-					w.WriteHeader(http.StatusNotModified)
-					return
 				}
+				w.Header().Set("Last-Modified", timestamp.UTC().Format(http.TimeFormat))
+				if len(maxAge) > 0 {
+					w.Header().Set("Cache-Control", maxAge)
+				}
+				metaData, _ := json.Marshal(object)
+				w.Header().Set("Kurbisio-Meta-Data", string(metaData))
+				w.WriteHeader(http.StatusNotModified)
+				return
 			}
 		}
 
@@ -438,19 +533,19 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		var timestamp time.Time
 		values, object := createScanValuesAndObject(&timestamp, &blob)
 
-		err = b.db.QueryRow(readQuery+sqlWhereOne+";", queryParameters...).Scan(values...)
+		err = b.db.QueryRowContext(r.Context(), readQuery+sqlWhereOne+";", queryParameters...).Scan(values...)
 		if err == sql.ErrNoRows {
 			http.Error(w, "no such "+this, http.StatusNotFound)
 			return
 		}
 		if err != nil {
-			status := http.StatusInternalServerError
-
 			// Invalid UUIDs are reported as "invalid_text_representation" which is Code 22P02
 			if err, ok := err.(*pq.Error); ok && err.Code == "22P02" {
-				status = http.StatusBadRequest
+				http.Error(w, "invalid uuid", http.StatusBadRequest)
+				return
 			}
-			http.Error(w, err.Error(), status)
+			rlog.WithError(err).Errorf("Error 5328: cannot read blob")
+			http.Error(w, "Error 5328", databaseErrorStatus(w, err))
 			return
 		}
 
@@ -476,6 +571,7 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		if rc.Mutable {
 			w.Header().Set("Etag", timeToEtag(timestamp))
 		}
+		w.Header().Set("Last-Modified", timestamp.UTC().Format(http.TimeFormat))
 		if len(maxAge) > 0 {
 			w.Header().Set("Cache-Control", maxAge)
 		}
@@ -585,6 +681,7 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		if j, ok := metaJSON["timestamp"]; ok {
 			json.Unmarshal(j, &timestamp)
 		}
+		timestamp = b.truncateTimestamp(timestamp)
 		values[i] = &timestamp
 
 		// prune meta data
@@ -599,25 +696,29 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 
 		tx, err := b.db.BeginTx(r.Context(), nil)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			rlog.WithError(err).Errorf("Error 5329: BeginTx")
+			http.Error(w, "Error 5329", databaseErrorStatus(w, err))
 			return
 		}
 		var id uuid.UUID
-		err = tx.QueryRow(insertQuery, values...).Scan(&id)
+		err = tx.QueryRowContext(r.Context(), insertQuery, values...).Scan(&id)
 		if err != nil {
 			status := http.StatusBadRequest
 			// Non unique external keys are reported as code Code 23505
+			msg := "cannot create " + this
 			if err, ok := err.(*pq.Error); ok && err.Code == "23505" {
 				status = http.StatusConflict
+				msg += ": constraint violation"
 			}
+			rlog.WithError(err).Infof("cannot create %s", this)
 			tx.Rollback()
-			http.Error(w, "cannot create "+this+": "+err.Error(), status)
+			http.Error(w, msg, status)
 			return
 		}
 
 		// re-read meta data and return as json
 		values, response := createScanValuesAndObject(&time.Time{})
-		err = tx.QueryRow(readQueryMeta+"WHERE "+this+"_id = $1;", id).Scan(values...)
+		err = tx.QueryRowContext(r.Context(), readQueryMeta+"WHERE "+this+"_id = $1;", id).Scan(values...)
 		if err != nil {
 			tx.Rollback()
 			rlog.WithError(err).Errorf("Error 5322: create blob")
@@ -642,7 +743,8 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		jsonData, _ := json.Marshal(response)
 		err = b.commitWithNotification(r.Context(), tx, resource, core.OperationCreate, id, jsonData)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			rlog.WithError(err).Errorf("Error 5330: commitWithNotification")
+			http.Error(w, "Error 5330", databaseErrorStatus(w, err))
 			return
 		}
 
@@ -655,10 +757,7 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		rlog := logger.FromContext(r.Context())
 
 		// silent is a low-key feature for the backup/restore tool
-		var silent bool
-		if s := r.URL.Query().Get("silent"); s != "" {
-			silent, _ = strconv.ParseBool(s)
-		}
+		silent := isSilent(r)
 
 		params := mux.Vars(r)
 		authorizedForCreate := false
@@ -753,6 +852,7 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		if j, ok := metaJSON["timestamp"]; ok {
 			json.Unmarshal(j, &timestamp)
 		}
+		timestamp = b.truncateTimestamp(timestamp)
 		values[i] = &timestamp
 
 		// prune meta data
@@ -767,7 +867,8 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 
 		tx, err := b.db.BeginTx(r.Context(), nil)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			rlog.WithError(err).Errorf("Error 5336: BeginTx")
+			http.Error(w, "Error 5336", databaseErrorStatus(w, err))
 			return
 		}
 
@@ -779,7 +880,7 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		if !rc.Mutable {
 			query = insertQuery
 		}
-		err = tx.QueryRow(query, values...).Scan(&primaryID)
+		err = tx.QueryRowContext(r.Context(), query, values...).Scan(&primaryID)
 		if err == sql.ErrNoRows {
 			tx.Rollback()
 			if authorizedForCreate {
@@ -789,17 +890,21 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 			}
 			return
 		}
-		log.Printf("%v\n", values)
-		log.Printf(query)
 		if err != nil {
 			tx.Rollback()
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			if err, ok := err.(*pq.Error); ok && err.Code == "23505" {
+				rlog.WithError(err).Infof("cannot update %s", this)
+				http.Error(w, "cannot update "+this+": constraint violation", http.StatusConflict)
+				return
+			}
+			rlog.WithError(err).Errorf("Error 5331: update blob")
+			http.Error(w, "Error 5331", databaseErrorStatus(w, err))
 			return
 		}
 
 		// re-read meta data and return as json
 		values, response := createScanValuesAndObject(&time.Time{})
-		err = tx.QueryRow(readQueryMeta+"WHERE "+this+"_id = $1;", &primaryID).Scan(values...)
+		err = tx.QueryRowContext(r.Context(), readQueryMeta+"WHERE "+this+"_id = $1;", &primaryID).Scan(values...)
 		if err == sql.ErrNoRows {
 			tx.Rollback()
 			http.Error(w, "upsert failed, no such "+this, http.StatusNotFound)
@@ -807,7 +912,8 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		}
 		if err != nil {
 			tx.Rollback()
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			rlog.WithError(err).Errorf("Error 5332: re-read blob")
+			http.Error(w, "Error 5332", http.StatusInternalServerError)
 			return
 		}
 
@@ -833,7 +939,8 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 			err = b.commitWithNotification(r.Context(), tx, resource, core.OperationUpdate, *values[0].(*uuid.UUID), jsonData)
 		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			rlog.WithError(err).Errorf("Error 5333: commitWithNotification")
+			http.Error(w, "Error 5333", databaseErrorStatus(w, err))
 			return
 		}
 
@@ -882,9 +989,9 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 			value := array[0]
 			switch key {
 			case "until":
-				until, err = time.Parse(time.RFC3339, value)
+				until, err = parseTimeParameter(value)
 			case "from":
-				from, err = time.Parse(time.RFC3339, value)
+				from, err = parseTimeParameter(value)
 			case "filter":
 				i := strings.IndexRune(value, '=')
 				if i < 0 {
@@ -904,7 +1011,9 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 				}
 				if !found {
 					err = fmt.Errorf("unknown filter property '%s'", filterKey)
+					break
 				}
+				err = checkIDFilter(filterKey, filterValue, columns[:propertiesIndex])
 
 			default:
 				err = fmt.Errorf("unknown")
@@ -927,7 +1036,7 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		tx, err := b.db.BeginTx(r.Context(), nil)
 		if err != nil {
 			rlog.WithError(err).Errorf("Error 4731: BeginTx")
-			http.Error(w, "Error 4731", http.StatusInternalServerError)
+			http.Error(w, "Error 4731", databaseErrorStatus(w, err))
 			return
 		}
 
@@ -952,34 +1061,54 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		queryParameters[propertiesIndex-ownerIndex+2] = from.IsZero()
 		queryParameters[propertiesIndex-ownerIndex+3] = from.UTC()
 
-		rows, err := tx.Query(sqlQuery+sqlReturnMeta, queryParameters...)
+		rows, err := tx.QueryContext(r.Context(), sqlQuery+sqlReturnMeta, queryParameters...)
 		if err != nil {
 			tx.Rollback()
+			if isForeignKeyViolation(err) {
+				http.Error(w, "cannot clear "+core.Plural(this)+", they still have dependent resources", http.StatusConflict)
+				return
+			}
 			rlog.WithError(err).Errorf("Error 4732: sqlQuery `%s`", sqlQuery)
-			http.Error(w, "Error 4732", http.StatusInternalServerError)
+			http.Error(w, "Error 4732", databaseErrorStatus(w, err))
 			return
 		}
 		defer rows.Close()
 
-		if rc.needsKSS && b.KssDriver != nil {
-			for rows.Next() {
-				var timestamp time.Time
-				values, _ := createScanValuesAndObject(&timestamp)
-				err := rows.Scan(values...)
-				if err != nil {
-					rlog.WithError(err).Errorf("Error 4725: cannot scan values")
-					http.Error(w, "Error 4725", http.StatusInternalServerError)
-					return
-				}
-				var key string
-				for i := 0; i < propertiesIndex; i++ {
-					key += "/" + resources[i] + "_id/" + values[propertiesIndex-i-1].(*uuid.UUID).String()
-				}
-
-				err = b.KssDriver.DeleteAllWithPrefix(key)
-				if err != nil {
-					rlog.WithError(err).Error("Could not delete key ", key)
-				}
+		var kssKeys []string
+		for rows.Next() {
+			if !rc.needsKSS || b.KssDriver == nil {
+				continue
+			}
+			var timestamp time.Time
+			values, _ := createScanValuesAndObject(&timestamp)
+			err := rows.Scan(values...)
+			if err != nil {
+				tx.Rollback()
+				rlog.WithError(err).Errorf("Error 4725: cannot scan values")
+				http.Error(w, "Error 4725", http.StatusInternalServerError)
+				return
+			}
+			var key string
+			for i := 0; i < propertiesIndex; i++ {
+				key += "/" + resources[i] + "_id/" + values[propertiesIndex-i-1].(*uuid.UUID).String()
+			}
+			kssKeys = append(kssKeys, key)
+		}
+		if err = rows.Err(); err != nil {
+			tx.Rollback()
+			if isForeignKeyViolation(err) {
+				http.Error(w, "cannot clear "+core.Plural(this)+", they still have dependent resources", http.StatusConflict)
+				return
+			}
+			rlog.WithError(err).Errorf("Error 4732: sqlQuery `%s`", sqlQuery)
+			http.Error(w, "Error 4732", databaseErrorStatus(w, err))
+			return
+		}
+		// only delete the stored files once we know that the resources can be deleted
+		for _, key := range kssKeys {
+			err = b.KssDriver.DeleteAllWithPrefix(key)
+			if err != nil {
+				rlog.WithError(err).Error("Could not delete key ", key)
 			}
 		}
 
@@ -994,7 +1123,7 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		err = b.commitWithNotification(r.Context(), tx, resource, core.OperationClear, uuid.UUID{}, notificationJSON)
 		if err != nil {
 			rlog.WithError(err).Errorf("Error 4770: sqlQuery `%s`", sqlQuery)
-			http.Error(w, "Error 4770", http.StatusInternalServerError)
+			http.Error(w, "Error 4770", databaseErrorStatus(w, err))
 			return
 		}
 
@@ -1020,12 +1149,13 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 
 		tx, err := b.db.BeginTx(r.Context(), nil)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			rlog.WithError(err).Errorf("Error 5337: BeginTx")
+			http.Error(w, "Error 5337", databaseErrorStatus(w, err))
 			return
 		}
 		var timestamp time.Time
 		values, object := createScanValuesAndObject(&timestamp)
-		err = tx.QueryRow(deleteQuery+sqlWhereOne+sqlReturnMeta, queryParameters...).Scan(values...)
+		err = tx.QueryRowContext(r.Context(), deleteQuery+sqlWhereOne+sqlReturnMeta, queryParameters...).Scan(values...)
 		if err == sql.ErrNoRows {
 			tx.Rollback()
 			w.WriteHeader(http.StatusNotFound)
@@ -1033,7 +1163,12 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		}
 		if err != nil {
 			tx.Rollback()
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			if isForeignKeyViolation(err) {
+				http.Error(w, "cannot delete "+this+", it still has dependent resources", http.StatusConflict)
+				return
+			}
+			rlog.WithError(err).Errorf("Error 5334: delete blob")
+			http.Error(w, "Error 5334", http.StatusInternalServerError)
 			return
 		}
 
@@ -1056,36 +1191,252 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 		jsonData, _ := json.MarshalWithOption(object, json.DisableHTMLEscape())
 		err = b.commitWithNotification(r.Context(), tx, resource, core.OperationDelete, *primaryID, jsonData)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			rlog.WithError(err).Errorf("Error 5335: commitWithNotification")
+			http.Error(w, "Error 5335", databaseErrorStatus(w, err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	// uploadKey authorizes a multipart upload request and returns the storage key of the blob and its
+	// identifiers. Uploading the data requires the permit to create the blob, or to update it if it is mutable.
+	uploadKey := func(w http.ResponseWriter, r *http.Request) (string, []interface{}, bool) {
+		rlog := logger.FromContext(r.Context())
+		params := mux.Vars(r)
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.IsAuthorized(resources, core.OperationCreate, params, rc.Permits) &&
+				!(rc.Mutable && auth.IsAuthorized(resources, core.OperationUpdate, params, rc.Permits)) {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return "", nil, false
+			}
+		}
+		if b.KssDriver == nil {
+			rlog.Errorf("Error 5338: no kss driver for externally stored %s", resource)
+			http.Error(w, "Error 5338", http.StatusInternalServerError)
+			return "", nil, false
+		}
+
+		queryParameters := make([]interface{}, propertiesIndex)
+		for i := 0; i < propertiesIndex; i++ {
+			queryParameters[i] = params[columns[i]]
+		}
+		ids := make([]interface{}, propertiesIndex)
+		for i := range ids {
+			ids[i] = &uuid.UUID{}
+		}
+		err := b.db.QueryRowContext(r.Context(), "SELECT "+strings.Join(columns[:propertiesIndex], ", ")+
+			fmt.Sprintf(" FROM %s.\"%s\" ", schema, resource)+sqlWhereOne+";", queryParameters...).Scan(ids...)
+		if err == sql.ErrNoRows {
+			http.Error(w, "no such "+this, http.StatusNotFound)
+			return "", nil, false
+		}
+		if err != nil {
+			if err, ok := err.(*pq.Error); ok && err.Code == "22P02" {
+				http.Error(w, "invalid uuid", http.StatusBadRequest)
+				return "", nil, false
+			}
+			rlog.WithError(err).Errorf("Error 5339: cannot read blob")
+			http.Error(w, "Error 5339", databaseErrorStatus(w, err))
+			return "", nil, false
+		}
+		var key string
+		for i := 0; i < propertiesIndex; i++ {
+			key += "/" + resources[i] + "_id/" + ids[propertiesIndex-i-1].(*uuid.UUID).String()
+			queryParameters[i] = ids[i].(*uuid.UUID).String()
+		}
+		return key, queryParameters, true
+	}
+
+	// uploadAllowed rejects an upload which would replace the data of a blob, unless the blob is mutable and
+	// the caller may update it. Uploading into an empty blob only requires the permit to create it.
+	uploadAllowed := func(w http.ResponseWriter, r *http.Request, key string) bool {
+		size, err := b.KssDriver.DataSize(key)
+		if err != nil {
+			logger.FromContext(r.Context()).WithError(err).Errorf("Error 5344: cannot stat `%s`", key)
+			http.Error(w, "Error 5344", http.StatusInternalServerError)
+			return false
+		}
+		if size == 0 {
+			return true
+		}
+		if !rc.Mutable {
+			http.Error(w, this+" already has data and is not mutable", http.StatusConflict)
+			return false
+		}
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.IsAuthorized(resources, core.OperationUpdate, mux.Vars(r), rc.Permits) {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return false
+			}
+		}
+		return true
+	}
+
+	// createUpload initiates a multipart upload and returns the presigned URLs for the requested number of parts
+	createUpload := func(w http.ResponseWriter, r *http.Request) {
+		rlog := logger.FromContext(r.Context())
+		parts, err := strconv.Atoi(r.URL.Query().Get("parts"))
+		if err != nil || parts < 1 || parts > maxUploadParts {
+			http.Error(w, fmt.Sprintf("parameter 'parts' must be between 1 and %d", maxUploadParts), http.StatusBadRequest)
+			return
+		}
+		key, _, ok := uploadKey(w, r)
+		if !ok || !uploadAllowed(w, r, key) {
+			return
+		}
+		uploadID, err := b.KssDriver.CreateMultipartUpload(key)
+		if err != nil {
+			rlog.WithError(err).Errorf("Error 5340: create multipart upload `%s`", key)
+			http.Error(w, "Error 5340: cannot create upload", http.StatusFailedDependency)
+			return
+		}
+		response := MultipartUploadResponse{UploadID: uploadID}
+		for part := 1; part <= parts; part++ {
+			url, err := b.KssDriver.GetPreSignedPartURL(key, uploadID, part, multipartUploadURLValidity)
+			if err != nil {
+				rlog.WithError(err).Errorf("Error 5341: presign part %d of `%s`", part, key)
+				http.Error(w, "Error 5341: cannot create upload", http.StatusFailedDependency)
+				return
+			}
+			response.PartURLs = append(response.PartURLs, url)
+		}
+		jsonData, _ := json.Marshal(response)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(jsonData)
+	}
+
+	// uploadPartURL returns a fresh presigned URL for one part, e.g. to retry a failed part upload
+	uploadPartURL := func(w http.ResponseWriter, r *http.Request) {
+		rlog := logger.FromContext(r.Context())
+		params := mux.Vars(r)
+		part, err := strconv.Atoi(params["part_number"])
+		if err != nil || part < 1 || part > maxUploadParts {
+			http.Error(w, fmt.Sprintf("part number must be between 1 and %d", maxUploadParts), http.StatusBadRequest)
+			return
+		}
+		key, _, ok := uploadKey(w, r)
+		if !ok {
+			return
+		}
+		url, err := b.KssDriver.GetPreSignedPartURL(key, params["upload_id"], part, multipartUploadURLValidity)
+		if err != nil {
+			rlog.WithError(err).Errorf("Error 5341: presign part %d of `%s`", part, key)
+			http.Error(w, "Error 5341: cannot create upload URL", http.StatusFailedDependency)
+			return
+		}
+		jsonData, _ := json.Marshal(map[string]string{"url": url})
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(jsonData)
+	}
+
+	// completeUpload assembles the uploaded parts to the blob. Since the data changed, the timestamp of the
+	// blob is updated, which also changes its Etag, and an update notification is sent.
+	completeUpload := func(w http.ResponseWriter, r *http.Request) {
+		rlog := logger.FromContext(r.Context())
+		var completion MultipartUploadCompletion
+		if err := json.NewDecoder(r.Body).Decode(&completion); err != nil {
+			http.Error(w, "invalid json data: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(completion.Parts) == 0 {
+			http.Error(w, "missing parts", http.StatusBadRequest)
+			return
+		}
+		key, queryParameters, ok := uploadKey(w, r)
+		if !ok || !uploadAllowed(w, r, key) {
+			return
+		}
+		if err := b.KssDriver.CompleteMultipartUpload(key, mux.Vars(r)["upload_id"], completion.Parts); err != nil {
+			switch {
+			case errors.Is(err, kss.ErrNoSuchUpload):
+				http.Error(w, "no such upload", http.StatusNotFound)
+			case errors.Is(err, kss.ErrMissingPart):
+				http.Error(w, "cannot complete upload: missing part", http.StatusBadRequest)
+			case errors.Is(err, kss.ErrEtagMismatch):
+				http.Error(w, "cannot complete upload: etag mismatch", http.StatusBadRequest)
+			case errors.Is(err, kss.ErrPartsOutOfOrder):
+				http.Error(w, "cannot complete upload: parts must be in ascending order", http.StatusBadRequest)
+			default:
+				rlog.WithError(err).Errorf("Error 5342: cannot complete multipart upload `%s`", key)
+				http.Error(w, "Error 5342", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		tx, err := b.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			rlog.WithError(err).Errorf("Error 5345: cannot begin transaction")
+			http.Error(w, "Error 5345", databaseErrorStatus(w, err))
 			return
 		}
+		values, response := createScanValuesAndObject(&time.Time{})
+		updateQuery := fmt.Sprintf("UPDATE %s.\"%s\" SET timestamp = $%d ", schema, resource, propertiesIndex+1) + sqlWhereOne + sqlReturnMeta + ";"
+		err = tx.QueryRowContext(r.Context(), updateQuery, append(queryParameters, time.Now().UTC())...).Scan(values...)
+		if err != nil {
+			tx.Rollback()
+			rlog.WithError(err).Errorf("Error 5346: cannot update timestamp of `%s`", key)
+			http.Error(w, "Error 5346", databaseErrorStatus(w, err))
+			return
+		}
+		jsonData, _ := json.Marshal(response)
+		err = b.commitWithNotification(notificationContext(r), tx, resource, core.OperationUpdate, *values[0].(*uuid.UUID), jsonData)
+		if err != nil {
+			rlog.WithError(err).Errorf("Error 5347: commitWithNotification")
+			http.Error(w, "Error 5347", databaseErrorStatus(w, err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
 
+	// abortUpload aborts a multipart upload and discards the uploaded parts
+	abortUpload := func(w http.ResponseWriter, r *http.Request) {
+		key, _, ok := uploadKey(w, r)
+		if !ok {
+			return
+		}
+		if err := b.KssDriver.AbortMultipartUpload(key, mux.Vars(r)["upload_id"]); err != nil {
+			if errors.Is(err, kss.ErrNoSuchUpload) {
+				http.Error(w, "no such upload", http.StatusNotFound)
+				return
+			}
+			logger.FromContext(r.Context()).WithError(err).Errorf("Error 5343: cannot abort multipart upload `%s`", key)
+			http.Error(w, "Error 5343", http.StatusInternalServerError)
+			return
+		}
 		w.WriteHeader(http.StatusNoContent)
 	}
 
 	// store the collection helper for later usage in relations
 	b.collectionFunctions[this] = &collectionFunctions{
-		list: list,
-		read: read,
+		list:              list,
+		read:              read,
+		table:             resource,
+		searchableColumns: searchableColumns,
 	}
 
+	// the routes which up- or download the blob data are not limited by the request timeout
+
 	// CREATE
-	router.HandleFunc(listRoute, func(w http.ResponseWriter, r *http.Request) {
+	b.withoutTimeout(router.HandleFunc(listRoute, func(w http.ResponseWriter, r *http.Request) {
 		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
 		createWithAuth(w, r)
-	}).Methods(http.MethodOptions, http.MethodPost)
+	}).Methods(http.MethodOptions, http.MethodPost))
 
 	// READ
-	router.HandleFunc(itemRoute, func(w http.ResponseWriter, r *http.Request) {
+	b.withoutTimeout(router.HandleFunc(itemRoute, func(w http.ResponseWriter, r *http.Request) {
 		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
 		readWithAuth(w, r)
-	}).Methods(http.MethodOptions, http.MethodGet)
+	}).Methods(http.MethodOptions, http.MethodGet))
 
 	// UPDATE / CREATE with in in meta data
-	router.HandleFunc(listRoute, func(w http.ResponseWriter, r *http.Request) {
+	b.withoutTimeout(router.HandleFunc(listRoute, func(w http.ResponseWriter, r *http.Request) {
 		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
 		upsertWithAuth(w, r)
-	}).Methods(http.MethodOptions, http.MethodPut)
+	}).Methods(http.MethodOptions, http.MethodPut))
 
 	// LIST
 	router.HandleFunc(listRoute, func(w http.ResponseWriter, r *http.Request) {
@@ -1106,10 +1457,35 @@ func (b *Backend) createBlobResource(router *mux.Router, rc blobConfiguration) {
 	}).Methods(http.MethodOptions, http.MethodDelete)
 
 	// UPDATE / CREATE with fully qualified path
-	router.HandleFunc(itemRoute, func(w http.ResponseWriter, r *http.Request) {
+	b.withoutTimeout(router.HandleFunc(itemRoute, func(w http.ResponseWriter, r *http.Request) {
 		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
 		upsertWithAuth(w, r)
-	}).Methods(http.MethodOptions, http.MethodPut)
+	}).Methods(http.MethodOptions, http.MethodPut))
+
+	if rc.StoredExternally {
+		uploadRoute := itemRoute + "/uploads/{upload_id}"
+
+		// MULTIPART UPLOAD
+		router.HandleFunc(itemRoute+"/uploads", func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			createUpload(w, r)
+		}).Methods(http.MethodOptions, http.MethodPost)
+
+		router.HandleFunc(uploadRoute+"/parts/{part_number}", func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			uploadPartURL(w, r)
+		}).Methods(http.MethodOptions, http.MethodGet)
+
+		router.HandleFunc(uploadRoute, func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			completeUpload(w, r)
+		}).Methods(http.MethodOptions, http.MethodPost)
+
+		router.HandleFunc(uploadRoute, func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			abortUpload(w, r)
+		}).Methods(http.MethodOptions, http.MethodDelete)
+	}
 }
 
 // ifNoneMatchFound returns true if etag is found in ifNoneMatch. The format of ifNoneMatch is one
@@ -1125,12 +1501,29 @@ func ifNoneMatchFound(ifNoneMatch, etag string) bool {
 	if ifNoneMatch == "*" {
 		return true
 	}
+	// If-None-Match uses the weak comparison, hence the weakness indicators do not matter
+	t := strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), "\"")
 	for _, s := range strings.Split(ifNoneMatch, ",") {
-		s = strings.Trim(s, " \"")
-		t := strings.Trim(etag, " \"")
+		s = strings.Trim(strings.TrimPrefix(strings.TrimSpace(s), "W/"), "\"")
 		if s == t {
 			return true
 		}
 	}
 	return false
 }
+
+// notModifiedSince returns true if the request has an If-Modified-Since header and a resource with
+// the given timestamp has not been modified since then. As specified in RFC 7232, If-Modified-Since
+// is ignored if the request also has an If-None-Match header.
+func notModifiedSince(r *http.Request, timestamp time.Time) bool {
+	ifModifiedSince := r.Header.Get("If-Modified-Since")
+	if len(ifModifiedSince) == 0 || len(r.Header.Get("If-None-Match")) > 0 {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	// http dates have a resolution of one second
+	return !timestamp.Truncate(time.Second).After(since)
+}
@@ -7,12 +7,19 @@
 package backend_test
 
 import (
+	"bytes"
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/relabs-tech/kurbisio/core/backend"
+	"github.com/relabs-tech/kurbisio/core/backend/kss"
 )
 
 func TestEtagGetBlob(t *testing.T) {
@@ -83,6 +90,57 @@ func TestEtagGetBlob(t *testing.T) {
 	}
 }
 
+func TestIfModifiedSinceGetBlob(t *testing.T) {
+	blobData, err := os.ReadFile("./testdata/dalarubettrich.png")
+	header := map[string]string{
+		"Content-Type":       "image/png",
+		"Kurbisio-Meta-Data": `{"hello":"world"}`,
+	}
+	b := Blob{}
+	if _, err = testService.client.RawPostBlob("/blobs", header, blobData, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	_, firstHeader, err := testService.client.RawGetBlobWithHeader(
+		"/blobs/"+b.BlobID.String(), map[string]string{}, &[]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastModified := firstHeader.Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatal("Last-Modified is not present in reponse's header")
+	}
+
+	testCases := []struct {
+		name           string
+		header         map[string]string
+		expectedStatus int
+	}{
+		{"last modified", map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+		{"later", map[string]string{"If-Modified-Since": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}, http.StatusNotModified},
+		{"earlier", map[string]string{"If-Modified-Since": b.Timestamp.Add(-time.Hour).UTC().Format(http.TimeFormat)}, http.StatusOK},
+		{"invalid", map[string]string{"If-Modified-Since": "yesterday"}, http.StatusOK},
+		{"if-none-match wins", map[string]string{"If-Modified-Since": lastModified, "If-None-Match": "\"1234\""}, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var receivedBuffer []byte
+			status, h, _ := testService.client.RawGetBlobWithHeader(
+				"/blobs/"+b.BlobID.String(), tc.header, &receivedBuffer)
+			assert.Equal(t, tc.expectedStatus, status)
+			assert.Equal(t, lastModified, h.Get("Last-Modified"))
+			if status == http.StatusNotModified {
+				assert.Equal(t, 0, len(receivedBuffer))
+				assert.Equal(t, firstHeader.Get("Kurbisio-Meta-Data"), h.Get("Kurbisio-Meta-Data"))
+			}
+		})
+	}
+	_, err = testService.client.RawDelete("/blobs") // clear entire collection
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestEtagGetBlobCollection(t *testing.T) {
 	blobData, err := os.ReadFile("./testdata/dalarubettrich.png")
 	header := map[string]string{
@@ -512,3 +570,80 @@ func TestBlobExes(t *testing.T) {
 	}
 
 }
+
+func TestBlobExMultipartUpload(t *testing.T) {
+	a := A{}
+	if _, err := testService.client.RawPost("/as", &a, &a); err != nil {
+		t.Fatal(err)
+	}
+	blobex := BlobEx{}
+	if _, err := testService.client.RawPostBlob("/as/"+a.AID.String()+"/blobexes", map[string]string{}, []byte{}, &blobex); err != nil {
+		t.Fatal(err)
+	}
+	itemPath := "/as/" + a.AID.String() + "/blobexes/" + blobex.BlobExID.String()
+
+	var upload backend.MultipartUploadResponse
+	if _, err := testService.client.RawPost(itemPath+"/uploads?parts=2", nil, &upload); err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, upload.PartURLs, 2) {
+		return
+	}
+
+	parts := [][]byte{[]byte("hello "), []byte("world")}
+	completion := backend.MultipartUploadCompletion{}
+	for i, part := range parts {
+		r := httptest.NewRequest(http.MethodPut, upload.PartURLs[i], bytes.NewReader(part))
+		rec := httptest.NewRecorder()
+		testService.Router.ServeHTTP(rec, r)
+		if !assert.Equal(t, http.StatusOK, rec.Code) {
+			return
+		}
+		completion.Parts = append(completion.Parts, kss.CompletedPart{PartNumber: i + 1, Etag: rec.Header().Get("Etag")})
+	}
+
+	// a wrong etag does not complete the upload
+	wrong := backend.MultipartUploadCompletion{Parts: []kss.CompletedPart{{PartNumber: 1, Etag: "wrong"}}}
+	status, err := testService.client.RawPost(itemPath+"/uploads/"+upload.UploadID, wrong, nil)
+	if assert.NotNil(t, err) {
+		assert.NotContains(t, err.Error(), "kssdata")
+	}
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// an unknown upload is not found, and the error does not reveal the storage path
+	status, err = testService.client.RawPost(itemPath+"/uploads/"+uuid.New().String(), completion, nil)
+	if assert.NotNil(t, err) {
+		assert.NotContains(t, err.Error(), "kssdata")
+	}
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, err = testService.client.RawPost(itemPath+"/uploads/"+upload.UploadID, completion, nil)
+	if err != nil && status != http.StatusNoContent {
+		t.Fatal(err)
+	}
+
+	var data []byte
+	if _, _, err = testService.client.RawGetBlobWithHeader(itemPath, map[string]string{}, &data); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "hello world", string(data))
+
+	// the data of a blob which is not mutable cannot be replaced
+	status, err = testService.client.RawPost(itemPath+"/uploads?parts=1", nil, &upload)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusConflict, status)
+
+	// an aborted upload is gone
+	if _, err := testService.client.RawPostBlob("/as/"+a.AID.String()+"/blobexes", map[string]string{}, []byte{}, &blobex); err != nil {
+		t.Fatal(err)
+	}
+	itemPath = "/as/" + a.AID.String() + "/blobexes/" + blobex.BlobExID.String()
+	if _, err := testService.client.RawPost(itemPath+"/uploads?parts=1", nil, &upload); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = testService.client.RawDelete(itemPath + "/uploads/" + upload.UploadID); err != nil {
+		t.Fatal(err)
+	}
+	status, _ = testService.client.RawDelete(itemPath + "/uploads/" + upload.UploadID)
+	assert.Equal(t, http.StatusNotFound, status)
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/relabs-tech/kurbisio/core"
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// cascadeNotificationBatchSize is the maximum number of cascaded delete notifications which are written with
+// a single statement, and the maximum number of identifiers in one aggregated notification
+const cascadeNotificationBatchSize = 1000
+
+// cascadedChild is a child resource which is deleted together with its parent and which sends delete
+// notifications when this happens
+type cascadedChild struct {
+	resource string
+	// idColumn is the primary identifier of the child, for singletons the identifier of the owner
+	idColumn string
+	// columns are the identifying columns of the child, used as payload of the notifications
+	columns   []string
+	aggregate bool
+}
+
+// cascadedChildren returns the descendants of resource which are configured with notify_on_parent_delete
+// and which the database deletes together with resource, i.e. every resource on the path from resource to
+// the descendant has the on_parent_delete action cascade.
+func (b *Backend) cascadedChildren(resource string) []cascadedChild {
+	type childConfiguration struct {
+		onParentDelete string
+		notify         bool
+		aggregate      bool
+		singleton      bool
+	}
+	configurations := map[string]childConfiguration{}
+	for _, rc := range b.config.Collections {
+		configurations[rc.Resource] = childConfiguration{rc.OnParentDelete, rc.NotifyOnParentDelete, rc.AggregateBatchNotifications, false}
+	}
+	for _, rc := range b.config.Singletons {
+		configurations[rc.Resource] = childConfiguration{"", rc.NotifyOnParentDelete, false, true}
+	}
+	for _, rc := range b.config.Blobs {
+		configurations[rc.Resource] = childConfiguration{rc.OnParentDelete, rc.NotifyOnParentDelete, false, false}
+	}
+
+	var children []cascadedChild
+	for child, configuration := range configurations {
+		if !configuration.notify || !strings.HasPrefix(child, resource+"/") {
+			continue
+		}
+		cascades := true
+		path := resource
+		for _, r := range strings.Split(strings.TrimPrefix(child, resource+"/"), "/") {
+			path += "/" + r
+			if parentDeleteActions[configurations[path].onParentDelete].code != "c" {
+				cascades = false
+				break
+			}
+		}
+		if !cascades {
+			continue
+		}
+
+		resources := strings.Split(child, "/")
+		var columns []string
+		if !configuration.singleton {
+			columns = append(columns, resources[len(resources)-1]+"_id")
+		}
+		for i := len(resources) - 2; i >= 0; i-- {
+			columns = append(columns, resources[i]+"_id")
+		}
+		children = append(children, cascadedChild{
+			resource:  child,
+			idColumn:  columns[0],
+			columns:   columns,
+			aggregate: configuration.aggregate,
+		})
+	}
+	return children
+}
+
+// writeCascadeNotifications writes the delete notifications for the children of a resource which is about to be
+// deleted within the transaction tx. The deleted resource is identified by parentColumns and parentIDs. The
+// notifications are written to the job queue and to the outbox like those of commitWithNotification, with the
+// identifiers of the child as payload. Children with aggregate_batch_notifications instead get one notification
+// per batch, with a zero resource id and the JSON array of the child identifiers as payload.
+//
+// The function returns the written notifications, for which the caller must run the after commit hooks once tx
+// was committed. Nothing is written if the context is silent.
+func (b *Backend) writeCascadeNotifications(ctx context.Context, tx *sql.Tx, children []cascadedChild,
+	parentColumns []string, parentIDs []interface{}) ([]Notification, error) {
+	if core.SilentFromContext(ctx) {
+		return nil, nil
+	}
+	var notifications []Notification
+	for _, child := range children {
+		_, withJob := b.callbacks[notificationJobKey(child.resource, core.OperationDelete)]
+		_, withHook := b.afterCommitHooks[requestKey(child.resource, core.OperationDelete)]
+		if !withJob && !withHook && b.notifier == nil {
+			continue
+		}
+
+		var fields []string
+		for _, column := range child.columns {
+			fields = append(fields, fmt.Sprintf("'%s', %s", column, column))
+		}
+		query := fmt.Sprintf("SELECT %s, json_build_object(%s)::TEXT FROM %s.\"%s\" WHERE %s;",
+			child.idColumn, strings.Join(fields, ", "), b.db.Schema, child.resource, compareIDsString(parentColumns))
+		rows, err := tx.QueryContext(ctx, query, parentIDs...)
+		if err != nil {
+			return nil, err
+		}
+		var ids []uuid.UUID
+		var payloads []string
+		for rows.Next() {
+			var id uuid.UUID
+			var payload string
+			if err = rows.Scan(&id, &payload); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ids = append(ids, id)
+			payloads = append(payloads, payload)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+
+		var batch []Notification
+		if child.aggregate {
+			for start := 0; start < len(ids); start += cascadeNotificationBatchSize {
+				end := start + cascadeNotificationBatchSize
+				if end > len(ids) {
+					end = len(ids)
+				}
+				payload, _ := json.Marshal(ids[start:end])
+				batch = append(batch, Notification{Resource: child.resource, Operation: core.OperationDelete, Payload: payload})
+			}
+		} else {
+			for i := range ids {
+				batch = append(batch, Notification{Resource: child.resource, ResourceID: ids[i], Operation: core.OperationDelete,
+					Payload: []byte(payloads[i])})
+			}
+		}
+
+		for start := 0; start < len(batch); start += cascadeNotificationBatchSize {
+			end := start + cascadeNotificationBatchSize
+			if end > len(batch) {
+				end = len(batch)
+			}
+			if err = b.writeNotificationBatch(ctx, tx, batch[start:end], withJob); err != nil {
+				return nil, err
+			}
+		}
+		notifications = append(notifications, batch...)
+	}
+	return notifications, nil
+}
+
+// writeNotificationBatch writes notifications of one resource and operation with a single statement to the
+// outbox, and also to the job queue if withJob is true
+func (b *Backend) writeNotificationBatch(ctx context.Context, tx *sql.Tx, notifications []Notification, withJob bool) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	resource, operation := notifications[0].Resource, notifications[0].Operation
+	ids := make([]string, len(notifications))
+	payloads := make([]string, len(notifications))
+	for i, notification := range notifications {
+		ids[i] = notification.ResourceID.String()
+		payloads[i] = string(notification.Payload)
+	}
+
+	if b.notifier != nil {
+		_, err := tx.ExecContext(ctx, "INSERT INTO "+b.db.Schema+".\"_outbox_\"(resource,operation,resource_id,payload) "+
+			"SELECT $1, $2, unnest($3::UUID[]), unnest($4::JSON[]);",
+			resource, operation, pq.Array(ids), pq.Array(payloads))
+		if err != nil {
+			return err
+		}
+	}
+	if withJob {
+		_, err := tx.ExecContext(ctx, "INSERT INTO "+b.db.Schema+".\"_job_\""+
+			"(job,type,resource,resource_id,payload,timestamp,attempts_left,context) "+
+			"SELECT 'notification', $1, $2, unnest($3::UUID[]), unnest($4::JSON[]), now() at time zone 'utc', 4, $5;",
+			operation, resource, pq.Array(ids), pq.Array(payloads), logger.SerializeLoggerContext(ctx))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterCascadeCommit triggers the processing of cascaded delete notifications and runs their after commit
+// hooks, once the transaction which wrote them was committed
+func (b *Backend) afterCascadeCommit(ctx context.Context, notifications []Notification) {
+	if len(notifications) == 0 {
+		return
+	}
+	b.TriggerJobs()
+	for _, notification := range notifications {
+		b.afterCommit(ctx, notification.Resource, notification.Operation, notification.ResourceID, notification.Payload)
+	}
+}
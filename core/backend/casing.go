@@ -0,0 +1,234 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/goccy/go-json"
+)
+
+// snakeToCamel converts a snake_case property name to camelCase, e.g. user_id to userId
+func snakeToCamel(s string) string {
+	if !strings.Contains(s, "_") {
+		return s
+	}
+	var result strings.Builder
+	upper := false
+	for i, r := range s {
+		if r == '_' && i > 0 {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		result.WriteRune(r)
+	}
+	return result.String()
+}
+
+// camelToSnake converts a camelCase property name to snake_case, e.g. userId to user_id
+func camelToSnake(s string) string {
+	var result strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				result.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		result.WriteRune(r)
+	}
+	return result.String()
+}
+
+// transformKeys renames the keys of a JSON object with transform, or the keys of the objects in a JSON
+// array like a list response. Nested objects are left as they are, because their keys may be data, for
+// example the keys of a map, which must round-trip unchanged.
+func transformKeys(value interface{}, transform func(string) string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			result[transform(key)] = element
+		}
+		return result
+	case []interface{}:
+		for i := range v {
+			if object, ok := v[i].(map[string]interface{}); ok {
+				v[i] = transformKeys(object, transform)
+			}
+		}
+		return v
+	}
+	return value
+}
+
+// transformJSON renames the top-level object keys of the JSON document data with transform. Data can also be a
+// stream of JSON documents like newline-delimited JSON. If data is not valid JSON, it is returned unchanged.
+func transformJSON(data []byte, transform func(string) string) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var documents [][]byte
+	for {
+		var value interface{}
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return data
+		}
+		document, err := json.MarshalWithOption(transformKeys(value, transform), json.DisableHTMLEscape())
+		if err != nil {
+			return data
+		}
+		documents = append(documents, document)
+	}
+	if len(documents) == 0 {
+		return data
+	}
+	return bytes.Join(documents, []byte("\n"))
+}
+
+// handlePropertyCasing installs a middleware which lets clients use camelCase property names, while
+// the resources are stored with snake_case names. It is active for all requests if the backend was
+// built with CamelCase, otherwise for requests with the header Kurbisio-Property-Casing: camel.
+//
+// The middleware converts the top-level keys of JSON request bodies and the property names of the
+// filter, filter_or and search query parameters to snake_case, and the top-level keys of JSON responses
+// to camelCase. Compressed request bodies are decompressed for the conversion and passed on
+// uncompressed. Since the response is transformed after the handler, the standard compression is
+// applied here and not by the route handlers.
+func (b *Backend) handlePropertyCasing() {
+	casingMiddleware := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !b.camelCase && r.Header.Get("Kurbisio-Property-Casing") != "camel" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Kurbisio-Property-Casing")
+
+			contentType := r.Header.Get("Content-Type")
+			if r.Body != nil && (contentType == "" || strings.Contains(contentType, "json")) {
+				body := r.Body
+				encoding := r.Header.Get("Content-Encoding")
+				if encoding == "" {
+					encoding = r.Header.Get("Kurbisio-Content-Encoding")
+				}
+				switch encoding {
+				case "":
+				case "gzip":
+					reader, err := gzip.NewReader(r.Body)
+					if err != nil {
+						http.Error(w, "cannot read body: "+err.Error(), http.StatusBadRequest)
+						return
+					}
+					defer reader.Close()
+					body = reader
+				default:
+					http.Error(w, "unsupported content encoding "+encoding, http.StatusUnsupportedMediaType)
+					return
+				}
+				data, err := io.ReadAll(body)
+				if err != nil {
+					http.Error(w, "cannot read body: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				data = transformJSON(data, camelToSnake)
+				r.Body = io.NopCloser(bytes.NewReader(data))
+				r.ContentLength = int64(len(data))
+				r.Header.Del("Content-Encoding")
+				r.Header.Del("Kurbisio-Content-Encoding")
+			}
+
+			query := r.URL.Query()
+			for _, key := range []string{"filter", "filter_or", "search"} {
+				for i, value := range query[key] {
+					if j := strings.IndexAny(value, "=~"); j > 0 {
+						query[key][i] = camelToSnake(value[:j]) + value[j:]
+					}
+				}
+			}
+			r.URL.RawQuery = query.Encode()
+
+			// the route handlers must not compress, we need the plain response
+			gzipAccepted := strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+			r.Header.Del("Accept-Encoding")
+
+			cw := &jsonResponseWriter{ResponseWriter: w, gzipAccepted: gzipAccepted, transform: func(data []byte) []byte {
+				return transformJSON(data, snakeToCamel)
+			}}
+			h.ServeHTTP(cw, r)
+			cw.finish()
+		})
+	}
+	b.router.Use(casingMiddleware)
+}
+
+// jsonResponseWriter buffers JSON responses to transform them, e.g. to convert their keys to camelCase.
+// All other responses pass through unchanged.
+type jsonResponseWriter struct {
+	http.ResponseWriter
+	gzipAccepted bool
+	transform    func(data []byte) []byte
+	status       int
+	buffer       bytes.Buffer
+}
+
+func (c *jsonResponseWriter) WriteHeader(status int) {
+	if c.status != 0 {
+		return
+	}
+	if strings.Contains(c.Header().Get("Content-Type"), "json") {
+		// defer the header until we have the complete body
+		c.status = status
+		return
+	}
+	c.status = -1
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *jsonResponseWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.status > 0 {
+		return c.buffer.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// finish writes the transformed JSON response. It must be called after the handler returned
+func (c *jsonResponseWriter) finish() {
+	if c.status <= 0 {
+		return
+	}
+	data := c.transform(c.buffer.Bytes())
+	h := c.Header()
+	if c.gzipAccepted && len(data) > 0 {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		writer.Write(data)
+		writer.Close()
+		data = compressed.Bytes()
+		h.Set("Content-Encoding", "gzip")
+	}
+	if len(data) > 0 {
+		h.Set("Content-Length", strconv.Itoa(len(data)))
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	c.ResponseWriter.Write(data)
+}
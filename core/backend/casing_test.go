@@ -0,0 +1,114 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/relabs-tech/kurbisio/core/access"
+)
+
+func TestPropertyCasing(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user_profile",
+			"searchable_properties": ["first_name"]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	camelRequest := func(method, path string, body interface{}) (int, []byte) {
+		var data []byte
+		if body != nil {
+			data, _ = json.Marshal(body)
+		}
+		r := httptest.NewRequest(method, path, bytes.NewReader(data))
+		r.Header.Set("Kurbisio-Property-Casing", "camel")
+		r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+		rec := httptest.NewRecorder()
+		testService.Router.ServeHTTP(rec, r)
+		return rec.Code, rec.Body.Bytes()
+	}
+
+	status, data := camelRequest(http.MethodPost, "/user_profiles", map[string]interface{}{
+		"firstName": "Jane",
+		"address":   map[string]string{"zipCode": "12345"},
+	})
+	assert.Equal(t, http.StatusCreated, status)
+	var created map[string]interface{}
+	if err := json.Unmarshal(data, &created); err != nil {
+		t.Fatal(err)
+	}
+	id, ok := created["userProfileId"].(string)
+	if !ok {
+		t.Fatalf("missing userProfileId in %s", string(data))
+	}
+	assert.Equal(t, "Jane", created["firstName"])
+	// nested objects keep their keys, which may be data like the keys of a map
+	assert.Equal(t, map[string]interface{}{"zipCode": "12345"}, created["address"])
+
+	// the resource is stored with snake_case names
+	var stored map[string]interface{}
+	if _, err := testService.client.RawGet("/user_profiles/"+id, &stored); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Jane", stored["first_name"])
+	assert.Equal(t, map[string]interface{}{"zipCode": "12345"}, stored["address"])
+
+	status, data = camelRequest(http.MethodGet, "/user_profiles?filter=firstName=Jane", nil)
+	assert.Equal(t, http.StatusOK, status)
+	var list []map[string]interface{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, id, list[0]["userProfileId"])
+	}
+
+	status, data = camelRequest(http.MethodGet, "/user_profiles?filter_or=firstName=Jane&filter_or=firstName=John", nil)
+	assert.Equal(t, http.StatusOK, status)
+	list = nil
+	if err := json.Unmarshal(data, &list); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, id, list[0]["userProfileId"])
+	}
+
+	// compressed bodies are converted as well
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(`{"firstName": "John"}`))
+	writer.Close()
+	r := httptest.NewRequest(http.MethodPost, "/user_profiles", &compressed)
+	r.Header.Set("Kurbisio-Property-Casing", "camel")
+	r.Header.Set("Content-Encoding", "gzip")
+	r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+	rec := httptest.NewRecorder()
+	testService.Router.ServeHTTP(rec, r)
+	if !assert.Equal(t, http.StatusCreated, rec.Code) {
+		return
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawGet("/user_profiles/"+created["userProfileId"].(string), &stored); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "John", stored["first_name"])
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/relabs-tech/kurbisio/core/access"
+	"github.com/relabs-tech/kurbisio/core/csql"
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// maxChangesPerRequest is the maximum number of changes a single change feed request returns
+const maxChangesPerRequest = 1000
+
+// actorSetting is the transaction local database setting which holds the identity of the authenticated
+// request. The change log trigger records it as actor of the changes of the transaction.
+const actorSetting = "kurbisio.actor"
+
+// changeToken is a position in the change feed of a collection. Changes are ordered by the id of their
+// writing transaction first and their sequence number second. Sequence numbers alone are not sufficient:
+// they are assigned when a change is written, but become visible only when the transaction commits, so a
+// lower sequence number can become visible after a higher one.
+type changeToken struct {
+	xid      int64
+	sequence int64
+}
+
+func (t changeToken) String() string {
+	return fmt.Sprintf("%d-%d", t.xid, t.sequence)
+}
+
+// before returns true if t is an earlier position in the change feed than o
+func (t changeToken) before(o changeToken) bool {
+	return t.xid < o.xid || (t.xid == o.xid && t.sequence < o.sequence)
+}
+
+// parseChangeToken parses a token as returned by changeToken.String
+func parseChangeToken(s string) (changeToken, error) {
+	var t changeToken
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return t, fmt.Errorf("invalid token")
+	}
+	var err error
+	if t.xid, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return t, fmt.Errorf("invalid token")
+	}
+	if t.sequence, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return t, fmt.Errorf("invalid token")
+	}
+	return t, nil
+}
+
+// changeFeedQuery returns the query which creates the change log table of a collection, and the trigger
+// which populates it on every write. idColumns are the identifying columns of the collection, its own
+// id first, followed by the ids of its parents.
+//
+// The trigger records every insert, update and delete, including deletes which cascade from a parent and
+// rows written by imports, so the log is complete regardless of the route which wrote the resource. Each
+// change carries the actor of its transaction, see setActor.
+func changeFeedQuery(schema, resource, this string, idColumns []string) string {
+	var createColumns, newValues, oldValues []string
+	createColumns = append(createColumns, idColumns[0]+" uuid NOT NULL")
+	for _, column := range idColumns[1:] {
+		createColumns = append(createColumns, column+" uuid")
+	}
+	for _, column := range idColumns {
+		newValues = append(newValues, "NEW."+column)
+		oldValues = append(oldValues, "OLD."+column)
+	}
+	table := fmt.Sprintf("%s.\"%s/changes\"", schema, resource)
+	function := fmt.Sprintf("%s.\"%s/changes_trigger\"", schema, resource)
+	insert := fmt.Sprintf("INSERT INTO %s (operation, %s) VALUES", table, strings.Join(idColumns, ", "))
+
+	query := fmt.Sprintf("CREATE table IF NOT EXISTS %s (sequence BIGSERIAL PRIMARY KEY, xid BIGINT NOT NULL DEFAULT txid_current(), "+
+		"operation varchar NOT NULL, %s, timestamp timestamp NOT NULL DEFAULT now());", table, strings.Join(createColumns, ", "))
+	query += fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS actor varchar DEFAULT NULLIF(current_setting('%s', true), '');",
+		table, actorSetting)
+	query += fmt.Sprintf("CREATE index IF NOT EXISTS %s ON %s(xid, sequence);", "changes_index_"+this+"_xid", table)
+	query += fmt.Sprintf("CREATE index IF NOT EXISTS %s ON %s(%s, sequence);", "changes_index_"+this+"_id", table, idColumns[0])
+	query += fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		%s ('delete', %s);
+		RETURN OLD;
+	ELSIF TG_OP = 'INSERT' THEN
+		%s ('create', %s);
+	ELSE
+		%s ('update', %s);
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;`, function, insert, strings.Join(oldValues, ", "), insert, strings.Join(newValues, ", "), insert, strings.Join(newValues, ", "))
+	query += fmt.Sprintf("DROP TRIGGER IF EXISTS changes ON %s.\"%s\";", schema, resource)
+	query += fmt.Sprintf("CREATE TRIGGER changes AFTER INSERT OR UPDATE OR DELETE ON %s.\"%s\" FOR EACH ROW EXECUTE PROCEDURE %s();",
+		schema, resource, function)
+	return query
+}
+
+// setActor stores the identity of the authenticated request in the transaction, so that the changes
+// written by the transaction are attributed to it. Changes without an identity, e.g. those of jobs or
+// of requests without authentication, have no actor. It does nothing if no collection records changes.
+func (b *Backend) setActor(ctx context.Context, tx *sql.Tx) error {
+	identity := access.IdentityFromContext(ctx)
+	if identity == "" || !b.recordsChanges() {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, "SELECT set_config($1, $2, true);", actorSetting, identity)
+	return err
+}
+
+// recordsChanges returns true if any collection of the backend has a change feed
+func (b *Backend) recordsChanges() bool {
+	for _, rc := range b.config.Collections {
+		if rc.WithChanges {
+			return true
+		}
+	}
+	return false
+}
+
+// changesHorizon returns the latest change of resource which was pruned. Tokens before the horizon
+// have expired, since changes after them may be lost.
+func (b *Backend) changesHorizon(resource string) (changeToken, error) {
+	var value string
+	timestamp, err := b.Registry.Accessor("changes_horizon").Read(resource, &value)
+	if err != nil || timestamp.IsZero() {
+		return changeToken{}, err
+	}
+	return parseChangeToken(value)
+}
+
+// PruneChanges deletes the recorded changes which are older than the configured changes_retention_days
+// of their collection. Clients whose token points to a pruned change get 410 (Gone) from the change
+// feed and must synchronize again from scratch.
+func (b *Backend) PruneChanges() error {
+	for _, rc := range b.config.Collections {
+		if !rc.WithChanges || rc.ChangesRetentionDays <= 0 {
+			continue
+		}
+		horizon, err := b.changesHorizon(rc.Resource)
+		if err != nil {
+			return err
+		}
+		query := fmt.Sprintf(`WITH pruned AS (DELETE FROM %s."%s/changes" WHERE timestamp < now() - $1 * interval '1 day' RETURNING xid, sequence)
+SELECT xid, sequence FROM pruned ORDER BY xid DESC, sequence DESC LIMIT 1;`, b.db.Schema, rc.Resource)
+		var pruned changeToken
+		err = b.db.QueryRow(query, rc.ChangesRetentionDays).Scan(&pruned.xid, &pruned.sequence)
+		if err == csql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if horizon.before(pruned) {
+			if err = b.Registry.Accessor("changes_horizon").Write(rc.Resource, pruned.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *Backend) handleChanges(router *mux.Router) {
+	logger.Default().Debugln("changes")
+	logger.Default().Debugln("  handle changes route: /kurbisio/changes/prune PUT")
+	router.HandleFunc("/kurbisio/changes/prune", func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.HasRole("admin") {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if err := b.PruneChanges(); err != nil {
+			logger.FromContext(r.Context()).WithError(err).Errorln("Error 4805: cannot prune changes")
+			http.Error(w, "Error 4805", databaseErrorStatus(w, err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods(http.MethodOptions, http.MethodPut)
+}
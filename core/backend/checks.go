@@ -0,0 +1,56 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/lib/pq"
+)
+
+var checkConstraintName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// checkConstraintPrefix returns the name prefix of the check constraints kurbisio creates for a resource
+func checkConstraintPrefix(this string) string {
+	return "check_" + this + "_"
+}
+
+// checkConstraintsQuery returns the query which (re)creates the configured check constraints of a resource,
+// and the messages for their violations by constraint name. The constraints are created NOT VALID: they
+// apply to every item which is written, but existing items are not checked, so that a new constraint
+// never fails the schema update.
+func checkConstraintsQuery(schema, resource, this string, constraints []checkConstraintConfiguration) (string, map[string]string, error) {
+	query := ""
+	messages := map[string]string{}
+	for _, c := range constraints {
+		if !checkConstraintName.MatchString(c.Name) {
+			return "", nil, fmt.Errorf("invalid name '%s', must be lower case letters, digits and underscores", c.Name)
+		}
+		name := checkConstraintPrefix(this) + c.Name
+		if _, ok := messages[postgresIdentifier(name)]; ok {
+			return "", nil, fmt.Errorf("duplicate check constraint '%s'", c.Name)
+		}
+		message := c.Message
+		if message == "" {
+			message = "violates check constraint " + c.Name
+		}
+		messages[postgresIdentifier(name)] = message
+		query += fmt.Sprintf("ALTER TABLE %s.\"%s\" DROP CONSTRAINT IF EXISTS %s;", schema, resource, name)
+		query += fmt.Sprintf("ALTER TABLE %s.\"%s\" ADD CONSTRAINT %s CHECK (%s) NOT VALID;", schema, resource, name, c.Check)
+	}
+	return query, messages, nil
+}
+
+// checkViolation returns the message for err if it is the violation of a configured check constraint
+func checkViolation(err error, messages map[string]string) (string, bool) {
+	if err, ok := err.(*pq.Error); ok && err != nil && err.Code == "23514" {
+		message, ok := messages[err.Constraint]
+		return message, ok
+	}
+	return "", false
+}
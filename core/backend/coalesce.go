@@ -0,0 +1,149 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"github.com/relabs-tech/kurbisio/core/access"
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// readCoalescer lets concurrent identical read requests share a single execution of their handler, and
+// hence a single database query. A nil readCoalescer does not coalesce anything.
+type readCoalescer struct {
+	mutex    sync.Mutex
+	inFlight map[string]*coalescedRead
+	// timeout limits the shared execution, which does not end with the request which started it
+	timeout time.Duration
+}
+
+// coalescedRead is the response of a shared execution. It is complete once done is closed.
+type coalescedRead struct {
+	done   chan struct{}
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (c *coalescedRead) Header() http.Header {
+	return c.header
+}
+
+func (c *coalescedRead) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *coalescedRead) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	return c.body.Write(b)
+}
+
+// newReadCoalescer returns a coalescer if enabled is true, otherwise nil. Timeout limits the shared executions,
+// 0 means no limit.
+func newReadCoalescer(enabled bool, timeout time.Duration) *readCoalescer {
+	if !enabled {
+		return nil
+	}
+	return &readCoalescer{inFlight: map[string]*coalescedRead{}, timeout: timeout}
+}
+
+// coalesceKey returns the key under which read requests are coalesced: the path with the query, the headers which
+// change the response, and the authorization, since permits and interceptors depend on it
+func coalesceKey(r *http.Request) string {
+	auth, _ := json.Marshal(access.AuthorizationFromContext(r.Context()))
+	return r.URL.RequestURI() + "\n" + r.Header.Get("Accept") + "\n" + access.IdentityFromContext(r.Context()) +
+		"\n" + string(auth)
+}
+
+// handler wraps h, so that a GET request which arrives while an identical request is executed waits for
+// that execution and gets its response. The shared execution ignores If-None-Match and If-Modified-Since,
+// instead every request compares its own If-None-Match with the Etag of the shared response.
+func (c *readCoalescer) handler(h http.Handler) http.Handler {
+	if c == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.ServeHTTP(w, r)
+			return
+		}
+		key := coalesceKey(r)
+		c.mutex.Lock()
+		read, ok := c.inFlight[key]
+		if !ok {
+			read = &coalescedRead{done: make(chan struct{}), header: http.Header{}}
+			c.inFlight[key] = read
+			c.mutex.Unlock()
+			go c.execute(h, r, key, read)
+		} else {
+			c.mutex.Unlock()
+		}
+
+		select {
+		case <-read.done:
+		case <-r.Context().Done():
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+			http.Error(w, "request cancelled", http.StatusServiceUnavailable)
+			return
+		}
+
+		for key, values := range read.header {
+			w.Header()[key] = values
+		}
+		if etag := read.header.Get("Etag"); read.status == http.StatusOK && etag != "" &&
+			ifNoneMatchFound(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(read.status)
+		w.Write(read.body.Bytes())
+	})
+}
+
+// execute runs the shared execution of a read. It does not end when the request which started it is cancelled,
+// since other requests may wait for it.
+func (c *readCoalescer) execute(h http.Handler, r *http.Request, key string, read *coalescedRead) {
+	ctx := context.WithoutCancel(r.Context())
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	shared := r.Clone(ctx)
+	shared.Header.Del("If-None-Match")
+	shared.Header.Del("If-Modified-Since")
+	defer func() {
+		// the execution runs in its own goroutine, hence a panic would not be recovered by the server
+		if recovered := recover(); recovered != nil {
+			logger.FromContext(ctx).Errorf("Error 4823: panic in coalesced read: %v", recovered)
+			read.status = 0
+		}
+		c.mutex.Lock()
+		delete(c.inFlight, key)
+		c.mutex.Unlock()
+		if read.status == 0 {
+			read.header = http.Header{}
+			read.body.Reset()
+			read.status = http.StatusInternalServerError
+			read.body.WriteString("Error 4823\n")
+		}
+		close(read.done)
+	}()
+	h.ServeHTTP(read, shared)
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// coerceProperties converts the properties of object listed in coerce to their configured JSON
+// type. This is meant for clients which send numbers or booleans as strings. Values which already
+// have the configured type and null values are left untouched. An error is returned for values which
+// cannot be converted.
+func coerceProperties(object map[string]interface{}, coerce map[string]string) error {
+	// sorted, so that the error is deterministic
+	properties := make([]string, 0, len(coerce))
+	for property := range coerce {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	for _, property := range properties {
+		value, ok := object[property]
+		if !ok || value == nil {
+			continue
+		}
+		coerced, err := coerceValue(value, coerce[property])
+		if err != nil {
+			return fmt.Errorf("cannot coerce property '%s': %v", property, err)
+		}
+		object[property] = coerced
+	}
+	return nil
+}
+
+// coerceValue converts a JSON value to the JSON type jsonType, which is one of number, integer,
+// boolean or string
+func coerceValue(value interface{}, jsonType string) (interface{}, error) {
+	switch jsonType {
+	case "number":
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' is not a number", v)
+			}
+			return f, nil
+		}
+	case "integer":
+		switch v := value.(type) {
+		case float64:
+			if v == float64(int64(v)) {
+				return v, nil
+			}
+			return nil, fmt.Errorf("%v is not an integer", v)
+		case string:
+			i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' is not an integer", v)
+			}
+			return float64(i), nil
+		}
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("'%s' is not a boolean", v)
+			}
+			return b, nil
+		}
+	case "string":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %s", jsonType)
+	}
+	return nil, fmt.Errorf("cannot convert %T to %s", value, jsonType)
+}
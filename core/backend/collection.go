@@ -7,8 +7,15 @@
 package backend
 
 import (
+	"archive/zip"
+	"bytes"
 	"compress/gzip"
+	"context"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -31,6 +38,66 @@ import (
 	"github.com/relabs-tech/kurbisio/core/logger"
 )
 
+// maxIDsPerRequest is the maximum number of ids which can be requested with the ids query parameter
+const maxIDsPerRequest = 100
+
+// maxUpsertRetries is how often an upsert retries if somebody else creates the same singleton concurrently
+const maxUpsertRetries = 3
+
+// IDsResponse is the response of a collection GET request with the ids query parameter. Items are
+// in the order of the requested ids, NotFound contains the requested ids which do not exist.
+type IDsResponse struct {
+	Items    []json.RawMessage `json:"items"`
+	NotFound []string          `json:"not_found"`
+}
+
+// Change is an entry of the change feed of a collection. Operation is create, update or delete. Created
+// and updated items carry their current state in Item, deleted items are tombstones with only their ID.
+type Change struct {
+	Operation string          `json:"operation"`
+	ID        uuid.UUID       `json:"id"`
+	Item      json.RawMessage `json:"item,omitempty"`
+}
+
+// ChangesResponse is the response of the change feed of a collection. Next is the token to pass as
+// since parameter to the next request, More is true if there may be more changes.
+type ChangesResponse struct {
+	Changes []Change `json:"changes"`
+	Next    string   `json:"next"`
+	More    bool     `json:"more"`
+}
+
+// BulkUpdateResponse is the response of a bulk update of a static property. Updated is the number of
+// items whose property was changed.
+type BulkUpdateResponse struct {
+	Updated int `json:"updated"`
+}
+
+// HistoryEntry is an entry of the history of an item. Operation is create, update or delete, Actor is
+// the identity of the authenticated request which made the change, if any.
+type HistoryEntry struct {
+	Operation string    `json:"operation"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor,omitempty"`
+}
+
+// ImportResponse is the response of a collection import. Failures contains one entry for each item
+// which could not be imported.
+type ImportResponse struct {
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Failures  []ImportFailure `json:"failures"`
+}
+
+// ImportFailure describes an item which could not be imported. Index is the position of the item
+// in the uploaded file, starting with 0, ID is its identifier if it has one.
+type ImportFailure struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
 func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConfiguration, singleton bool) {
 	schema := b.db.Schema
 	resource := rc.Resource
@@ -45,10 +112,27 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		nillog.Debugln("  description:", rc.Description)
 	}
 
-	if rc.SchemaID != "" {
-		if !b.JsonValidator.HasSchema(rc.SchemaID) {
+	// singletons are created with PUT, which immutable resources do not have
+	if singleton && rc.Immutable {
+		panic(fmt.Errorf("invalid backend configuration: singleton %s cannot be immutable", resource))
+	}
+
+	// create and update can have their own schemas, e.g. if a property is only required on create
+	createSchemaID, updateSchemaID := rc.SchemaID, rc.SchemaID
+	if rc.SchemaIDCreate != "" {
+		createSchemaID = rc.SchemaIDCreate
+	}
+	if rc.SchemaIDUpdate != "" {
+		updateSchemaID = rc.SchemaIDUpdate
+	}
+
+	for _, schemaID := range []string{rc.SchemaID, rc.SchemaIDCreate, rc.SchemaIDUpdate} {
+		if schemaID != "" && !b.JsonValidator.HasSchema(schemaID) {
+			if b.strictSchemas {
+				panic(fmt.Errorf("invalid backend configuration: schemaID %s of resource %s is unknown", schemaID, rc.Resource))
+			}
 			nillog.Errorf("ERROR: invalid configuration for resource %s, schemaID %s is unknown. Validation is deactivated for this resource",
-				rc.Resource, rc.SchemaID)
+				rc.Resource, schemaID)
 		}
 	}
 
@@ -93,13 +177,52 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 
 	createColumns = append(createColumns, "timestamp timestamp NOT NULL DEFAULT now()")
 	createColumnsLog = append(createColumnsLog, "timestamp timestamp NOT NULL DEFAULT now()")
-	createColumns = append(createColumns, "revision INTEGER NOT NULL DEFAULT 1")
+	// collections with no_revision have no revision column. Their queries read the constant revisionColumn
+	// instead, which is never returned, and updates do not increment it.
+	revisionColumn := "revision"
+	incrementRevision := ", revision = revision + 1 "
+	if rc.NoRevision {
+		if rc.WeakListEtag {
+			nillog.Errorf("resource %s: weak_list_etag requires revisions, it cannot be combined with no_revision", resource)
+			panic("invalid configuration no_revision")
+		}
+		revisionColumn = "0"
+		incrementRevision = " "
+	} else {
+		createColumns = append(createColumns, "revision INTEGER NOT NULL DEFAULT 1")
+	}
 	createColumnsLog = append(createColumnsLog, "revision INTEGER NOT NULL")
 
+	// setListCacheHeaders lets clients and CDNs cache successful list responses for max_age_cache seconds.
+	// It is called together with setting the Etag, so that not modified responses carry the headers as well.
+	setListCacheHeaders := func(w http.ResponseWriter) {
+		if rc.MaxAgeCache <= 0 {
+			return
+		}
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", rc.MaxAgeCache))
+		w.Header().Set("Expires", time.Now().Add(time.Duration(rc.MaxAgeCache)*time.Second).UTC().Format(http.TimeFormat))
+	}
+
+	onParentDelete, err := b.parentDeleteAction(resource, rc.OnParentDelete, singleton)
+	if err != nil {
+		nillog.WithError(err).Errorf("invalid configuration for resource %s", resource)
+		panic("invalid configuration on_parent_delete")
+	}
+
+	// children which send delete notifications when the database deletes them together with this resource
+	var cascaded []cascadedChild
+	if !singleton {
+		cascaded = b.cascadedChildren(resource)
+	}
+
 	var foreignColumns []string
 	for i := len(dependencies) - 1; i >= 0; i-- {
 		that := dependencies[i]
 		createColumn := fmt.Sprintf("%s_id uuid NOT NULL", that)
+		if onParentDelete.code == "n" {
+			// orphans keep their own identifier, but lose their parent
+			createColumn = fmt.Sprintf("%s_id uuid", that)
+		}
 		createColumns = append(createColumns, createColumn)
 		createColumnsLog = append(createColumnsLog, createColumn)
 		columns = append(columns, that+"_id")
@@ -111,12 +234,13 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		majorSearchColumns = majorSearchColumns[1:]
 	}
 
+	var parentForeignKey string
 	if len(dependencies) > 0 {
 		foreign := strings.Join(foreignColumns, ",")
-		createColumn := "FOREIGN KEY (" + foreign + ") " +
+		parentForeignKey = "FOREIGN KEY (" + foreign + ") " +
 			"REFERENCES " + schema + ".\"" + strings.Join(dependencies, "/") + "\" " +
-			"(" + foreign + ") ON DELETE CASCADE"
-		createColumns = append(createColumns, createColumn)
+			"(" + foreign + ") ON DELETE " + onParentDelete.clause
+		createColumns = append(createColumns, parentForeignKey)
 	}
 
 	// enforce a unique constraint on all our identifying indices. This enables child
@@ -148,6 +272,7 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 	columns = append(columns, "properties")
 
 	createPropertiesQuery := ""
+	var propertyIndices []string
 
 	staticPropertiesIndex := len(columns) // where static properties start
 	// static properties are varchars
@@ -162,6 +287,7 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		createIndicesQuery += fmt.Sprintf("CREATE index IF NOT EXISTS %s ON %s.\"%s\"(%s);",
 			"searchable_property_"+this+"_"+property,
 			schema, resource, property)
+		propertyIndices = append(propertyIndices, "searchable_property_"+this+"_"+property)
 		createIndicesQueryLog += fmt.Sprintf("CREATE index IF NOT EXISTS %s ON %s.\"%s/log\"(%s);",
 			"searchable_property_"+this+"_"+property,
 			schema, resource, property)
@@ -169,15 +295,56 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		searchableColumns = append(searchableColumns, property)
 	}
 
+	// partial indices cover only the rows where a searchable property has a specific value. They
+	// keep lookups of rare values fast, e.g. the few devices which are still waiting for provisioning.
+	for _, pi := range rc.PartialIndices {
+		searchable := false
+		for _, property := range rc.SearchableProperties {
+			searchable = searchable || property == pi.Property
+		}
+		if !searchable {
+			nillog.Errorf("partial index on %s of resource %s: not a searchable property", pi.Property, resource)
+			panic("invalid configuration partial index")
+		}
+		indexName := fmt.Sprintf("partial_index_%s_%s_%08x", this, pi.Property, crc32.ChecksumIEEE([]byte(pi.Value)))
+		createIndicesQuery += fmt.Sprintf("CREATE index IF NOT EXISTS %s ON %s.\"%s\"(timestamp) WHERE %s = '%s';",
+			indexName, schema, resource, pi.Property, strings.ReplaceAll(pi.Value, "'", "''"))
+		propertyIndices = append(propertyIndices, indexName)
+	}
+
 	propertiesEndIndex := len(columns) // where properties end
 
-	// an external index is a unique varchar property.
-	if len(rc.ExternalIndex) > 0 {
-		name := rc.ExternalIndex
+	// an external index is a unique varchar property. It is either unique in the entire collection,
+	// or only for the same parent resource. A collection can have several external indices, each with its
+	// own column and unique index.
+	externalIndices := rc.externalIndices()
+	if rc.ExternalIndexPerParent && len(externalIndices) > 0 && len(foreignColumns) == 0 {
+		nillog.Errorf("resource %s: external_index_per_parent requires a parent resource", resource)
+		panic("invalid configuration external_index_per_parent")
+	}
+	// externalIndexByConstraint maps the names of the unique indices to their external index
+	externalIndexByConstraint := map[string]string{}
+	for _, name := range externalIndices {
+		uniqueColumns := name
+		indexName := "external_index_" + this + "_"
+		if rc.ExternalIndexPerParent {
+			indexName += "per_parent_"
+		}
+		if rc.ExternalIndexCaseInsensitive {
+			// the value is stored as it is, only the uniqueness ignores the case
+			uniqueColumns = "lower(" + name + ")"
+			indexName += "ci_"
+		}
+		if rc.ExternalIndexPerParent {
+			uniqueColumns = strings.Join(append(append([]string{}, foreignColumns...), uniqueColumns), ",")
+		}
+		indexName += name
 		createPropertiesQuery += fmt.Sprintf("ALTER TABLE %s.\"%s\" ADD COLUMN IF NOT EXISTS \"%s\" varchar NOT NULL DEFAULT '';", schema, resource, name)
 		createIndicesQuery += fmt.Sprintf("CREATE UNIQUE index IF NOT EXISTS %s ON %s.\"%s\"(%s) WHERE %s <> '';",
-			"external_index_"+this+"_"+name,
-			schema, resource, name, name)
+			indexName,
+			schema, resource, uniqueColumns, name)
+		propertyIndices = append(propertyIndices, indexName)
+		externalIndexByConstraint[postgresIdentifier(indexName)] = name
 		// the log index is not unique
 		createIndicesQueryLog += fmt.Sprintf("CREATE index IF NOT EXISTS %s ON %s.\"%s/log\"(%s);",
 			"external_index_"+this+"_"+name,
@@ -186,43 +353,223 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		searchableColumns = append(searchableColumns, name)
 	}
 
+	// conflictMessage returns the message of a unique violation, which names the external index if it
+	// caused the violation
+	conflictMessage := func(err *pq.Error) string {
+		if name := externalIndexByConstraint[err.Constraint]; name != "" {
+			return externalIndexConflict(name)
+		}
+		return "constraint violation"
+	}
+
+	// generated properties are columns which the database derives from the JSON document. They
+	// are searchable, but never part of the columns we read or write
+	generatedColumns := map[string]generatedColumn{}
+	for _, gp := range rc.GeneratedProperties {
+		for _, column := range columns {
+			if gp.Name == column {
+				nillog.Errorf("generated property %s of resource %s conflicts with an existing column", gp.Name, resource)
+				panic("invalid configuration generated property")
+			}
+		}
+		column, err := newGeneratedColumn(schema, resource, this, gp)
+		if err != nil {
+			nillog.WithError(err).Errorf("invalid generated property in resource %s", resource)
+			panic("invalid configuration generated property")
+		}
+		createPropertiesQuery += column.createQuery
+		propertyIndices = append(propertyIndices, column.index)
+		generatedColumns[gp.Name] = column
+		searchableColumns = append(searchableColumns, gp.Name)
+	}
+
+	// encrypted properties are ciphertext in the JSON document, hence they cannot be columns and the
+	// database cannot derive anything from them
+	if len(rc.EncryptedProperties) > 0 && b.encryption == nil {
+		nillog.Errorf("resource %s has encrypted properties, but the backend has no encryption keys", resource)
+		panic("invalid configuration encrypted properties")
+	}
+	for _, property := range rc.EncryptedProperties {
+		conflict := stringlist(columns).contains(property)
+		for _, gp := range rc.GeneratedProperties {
+			conflict = conflict || strings.Split(gp.Path, ".")[0] == property
+		}
+		if conflict {
+			nillog.Errorf("encrypted property %s of resource %s must be a dynamic property which nothing else derives from", property, resource)
+			panic("invalid configuration encrypted properties")
+		}
+	}
+
+	checkQuery, checkMessages, err := checkConstraintsQuery(schema, resource, this, rc.CheckConstraints)
+	if err != nil {
+		nillog.WithError(err).Errorf("invalid check constraint in resource %s", resource)
+		panic("invalid configuration check constraint")
+	}
+	var checkConstraints []string
+	for name := range checkMessages {
+		checkConstraints = append(checkConstraints, name)
+	}
+
+	coreColumns := append([]string{"timestamp"}, columns[:propertiesIndex+1]...)
+	if !rc.NoRevision {
+		coreColumns = append(coreColumns, "revision")
+	}
+
 	// the "device" collection gets an additional UUID column for the web token
 	if this == "device" {
 		createColumn := "token uuid NOT NULL DEFAULT uuid_generate_v4()"
 		createColumns = append(createColumns, createColumn)
+		coreColumns = append(coreColumns, "token")
+	}
+	if len(rc.EncryptedProperties) > 0 {
+		coreColumns = append(coreColumns, "encryption_key_id")
 	}
 
-	createQuery += "(" + strings.Join(createColumns, ", ") + ");" + createPropertiesQuery + createIndicesQuery
+	createQuery += "(" + strings.Join(createColumns, ", ") + ");" + createPropertiesQuery + createIndicesQuery + checkQuery
+	if rc.WithChanges && !singleton {
+		createQuery += changeFeedQuery(schema, resource, this, columns[:propertiesIndex])
+	}
+	if len(rc.EncryptedProperties) > 0 {
+		createQuery += encryptionKeyQuery(schema, resource, this, rc.EncryptedProperties)
+	}
 
-	var err error
 	if b.updateSchema {
 		_, err = b.db.Exec(createQuery)
 		if err != nil {
 			nillog.WithError(err).Errorf("Error while updating schema when running: %s", createQuery)
 			panic(fmt.Sprintf("invalid configuration updating: err: %v", err))
 		}
+		b.reconcileSchema(schemaLayout{
+			resource:           resource,
+			this:               this,
+			coreColumns:        coreColumns,
+			propertyColumns:    columns[staticPropertiesIndex:],
+			indices:            propertyIndices,
+			checkConstraints:   checkConstraints,
+			generatedColumns:   generatedColumns,
+			parent:             strings.Join(dependencies, "/"),
+			parentColumns:      foreignColumns,
+			parentForeignKey:   parentForeignKey,
+			parentDeleteAction: onParentDelete,
+		})
+	}
+
+	// template properties of the default are resolved at create time, the static properties are applied always
+	staticDefault := rc.Default
+	var defaultTemplates map[string]string
+	if rc.Default != nil {
+		var err error
+		staticDefault, defaultTemplates, err = splitDefault(rc.Default)
+		if err != nil {
+			nillog.WithError(err).Errorf("parse error in backend configuration - default for %s: %s", this, err)
+			panic("invalid configuration parse error")
+		}
 	}
 
-	// if we have a default object and a valid schema, validate the default object
-	if rc.Default != nil && rc.SchemaID != "" && b.JsonValidator.HasSchema(rc.SchemaID) {
+	// if we have a default object and a valid create schema, validate the default object
+	if rc.Default != nil && createSchemaID != "" && b.JsonValidator.HasSchema(createSchemaID) {
 		var defaultJSON map[string]interface{}
 		err := json.Unmarshal(rc.Default, &defaultJSON)
 		if err != nil {
 			nillog.WithError(err).Errorf("parse error in backend configuration - default for %s: %s", this, err)
 			panic("invalid configuration parse error")
 		}
+		for property, value := range exampleDefaultTemplates(defaultTemplates) {
+			defaultJSON[property] = value
+		}
 		// add dummy core identifiers
 		var id uuid.UUID
 		for i := 0; i < propertiesIndex; i++ {
 			defaultJSON[columns[i]] = id
 		}
 		jsonData, _ := json.Marshal(defaultJSON)
-		if err := b.JsonValidator.ValidateString(string(jsonData), rc.SchemaID); err != nil {
+		if err := b.JsonValidator.ValidateString(string(jsonData), createSchemaID); err != nil {
 			nillog.WithError(err).Errorf("validating default for %s: field does not follow schemaID %s",
-				resource, rc.SchemaID)
+				resource, createSchemaID)
 			panic("invalid configuration default")
 		}
 	}
+	rc.Default = staticDefault
+
+	// role defaults apply at create time on top of the default, for the roles of the request
+	roleDefaults, err := parseRoleDefaults(rc.RoleDefaults)
+	if err != nil {
+		nillog.WithError(err).Errorf("parse error in backend configuration - role defaults for %s: %s", this, err)
+		panic("invalid configuration parse error")
+	}
+	if createSchemaID != "" && b.JsonValidator.HasSchema(createSchemaID) {
+		for _, rd := range roleDefaults {
+			defaultJSON := map[string]interface{}{}
+			if rc.Default != nil {
+				json.Unmarshal(rc.Default, &defaultJSON)
+			}
+			for property, value := range exampleDefaultTemplates(defaultTemplates) {
+				defaultJSON[property] = value
+			}
+			patchObject(defaultJSON, rd.static)
+			for property, value := range exampleDefaultTemplates(rd.templates) {
+				defaultJSON[property] = value
+			}
+			var id uuid.UUID
+			for i := 0; i < propertiesIndex; i++ {
+				defaultJSON[columns[i]] = id
+			}
+			jsonData, _ := json.Marshal(defaultJSON)
+			if err := b.JsonValidator.ValidateString(string(jsonData), createSchemaID); err != nil {
+				nillog.WithError(err).Errorf("validating role default %s for %s: field does not follow schemaID %s",
+					rd.role, resource, createSchemaID)
+				panic("invalid configuration default")
+			}
+		}
+	}
+
+	// with reject_unknown_properties, dynamic properties must be declared in the create or the update schema
+	var declaredProperties map[string]bool
+	if rc.RejectUnknownProperties {
+		for _, schemaID := range []string{createSchemaID, updateSchemaID} {
+			names, ok := b.JsonValidator.PropertyNames(schemaID)
+			if !ok {
+				continue
+			}
+			if declaredProperties == nil {
+				declaredProperties = map[string]bool{}
+			}
+			for name := range names {
+				declaredProperties[name] = true
+			}
+		}
+		if declaredProperties == nil {
+			if b.strictSchemas {
+				panic(fmt.Errorf("invalid backend configuration: reject_unknown_properties of resource %s requires a known schema_id", resource))
+			}
+			nillog.Errorf("ERROR: invalid configuration for resource %s, reject_unknown_properties requires a known schema_id. Unknown properties are accepted for this resource", resource)
+		} else {
+			for _, column := range columns {
+				declaredProperties[column] = true
+			}
+		}
+	}
+
+	// unknownProperties returns the sorted names of all extracted dynamic properties which are not declared
+	unknownProperties := func(extract map[string]interface{}) []string {
+		var unknown []string
+		if declaredProperties == nil {
+			return unknown
+		}
+		for key := range extract {
+			if !declaredProperties[key] {
+				unknown = append(unknown, key)
+			}
+		}
+		sort.Strings(unknown)
+		return unknown
+	}
+
+	// immutable properties can be set once, but never be changed afterwards
+	immutableProperties := map[string]bool{}
+	for _, property := range rc.ImmutableProperties {
+		immutableProperties[property] = true
+	}
 
 	singletonRoute := ""
 	listRoute := ""
@@ -241,30 +588,58 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		nillog.Debugln("  handle collection routes:", listRoute, "GET,POST,PUT,PATCH,DELETE")
 		nillog.Debugln("  handle collection routes:", itemRoute, "GET,PUT,PATCH,DELETE")
 	}
+	b.registerHALRoute(listRoute, resource)
+	b.registerHALRoute(itemRoute, resource)
+	if singleton {
+		b.registerHALRoute(singletonRoute, resource)
+	}
+	nillog.Debugln("  handle collection routes:", listRoute+"/export.zip", "GET")
+	if len(externalIndices) > 0 && !singleton {
+		nillog.Debugln("  handle collection routes:", listRoute+"/available", "GET")
+	}
+	if rc.WithChanges && !singleton {
+		nillog.Debugln("  handle collection routes:", listRoute+"/changes", "GET")
+		nillog.Debugln("  handle collection routes:", itemRoute+"/history", "GET")
+	}
+	if !rc.Immutable {
+		nillog.Debugln("  handle collection routes:", listRoute+"/import", "POST")
+	}
 
-	readQuery := "SELECT " + strings.Join(columns, ", ") + fmt.Sprintf(", timestamp, revision FROM %s.\"%s\" ", schema, resource)
+	readQuery := "SELECT " + strings.Join(columns, ", ") + fmt.Sprintf(", timestamp, %s FROM %s.\"%s\" ", revisionColumn, schema, resource)
 	sqlWhereOne := "WHERE " + compareIDsString(columns[:propertiesIndex])
 
+	// deletedQuery checks whether the change feed has a tombstone for an item, see read
+	deletedQuery := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s.\"%s/changes\" ", schema, resource) + sqlWhereOne + " AND operation = 'delete');"
+
 	readQueryWithTotal := "SELECT " + strings.Join(columns, ", ") +
-		fmt.Sprintf(", timestamp, revision, count(*) OVER() AS full_count FROM %s.\"%s\" ", schema, resource)
+		fmt.Sprintf(", timestamp, %s, count(*) OVER() AS full_count FROM %s.\"%s\" ", revisionColumn, schema, resource)
 	readQueryMetaWithTotal := "SELECT " + strings.Join(columns[:propertiesIndex], ", ") +
-		fmt.Sprintf(", timestamp, revision, count(*) OVER() AS full_count FROM %s.\"%s\" ", schema, resource)
+		fmt.Sprintf(", timestamp, %s, count(*) OVER() AS full_count FROM %s.\"%s\" ", revisionColumn, schema, resource)
+	// lists with withtotalcount=false skip the count over all matching items
+	readQueryMeta := "SELECT " + strings.Join(columns[:propertiesIndex], ", ") +
+		fmt.Sprintf(", timestamp, %s FROM %s.\"%s\" ", revisionColumn, schema, resource)
+	weakListEtagQuery := fmt.Sprintf("SELECT count(*), COALESCE(max(revision), 0), COALESCE(sum(revision), 0), COALESCE(sum(hashtext(%s::TEXT)), 0) FROM %s.\"%s\" ",
+		columns[0], schema, resource)
 	sqlWhereAll := "WHERE "
 	if propertiesIndex > ownerIndex {
 		sqlWhereAll += compareIDsString(columns[ownerIndex:propertiesIndex]) + " AND "
 	}
 	sqlWhereAll += fmt.Sprintf("($%d OR timestamp<=$%d) AND ($%d OR timestamp>=$%d) ",
 		propertiesIndex-ownerIndex+1, propertiesIndex-ownerIndex+1+1, propertiesIndex-ownerIndex+1+2, propertiesIndex-ownerIndex+1+3)
-	sqlPaginationDesc := fmt.Sprintf("ORDER BY timestamp DESC,%s DESC LIMIT $%d OFFSET $%d;",
-		columns[0], propertiesIndex-ownerIndex+1+4, propertiesIndex-ownerIndex+1+5)
+	sqlWhereIDs := "WHERE "
+	if propertiesIndex > ownerIndex {
+		sqlWhereIDs += compareIDsString(columns[ownerIndex:propertiesIndex]) + " AND "
+	}
+	sqlWhereIDs += fmt.Sprintf("%s = ANY($%d::UUID[]);", columns[0], propertiesIndex-ownerIndex+1)
 
-	sqlPaginationAsc := fmt.Sprintf("ORDER BY timestamp ASC,%s ASC LIMIT $%d OFFSET $%d;",
-		columns[0], propertiesIndex-ownerIndex+1+4, propertiesIndex-ownerIndex+1+5)
+	sqlPaginationDesc := paginationQuery(columns[0], false, propertiesIndex-ownerIndex+1+4)
+	sqlPaginationAsc := paginationQuery(columns[0], true, propertiesIndex-ownerIndex+1+4)
+	sqlPaginationRandom := fmt.Sprintf("ORDER BY random() LIMIT $%d OFFSET $%d;", propertiesIndex-ownerIndex+1+4, propertiesIndex-ownerIndex+1+5)
 
 	clearQuery := fmt.Sprintf("DELETE FROM %s.\"%s\" ", schema, resource)
 
 	deleteQuery := fmt.Sprintf("DELETE FROM %s.\"%s\" ", schema, resource)
-	sqlReturnObject := " RETURNING " + strings.Join(columns, ", ") + ", timestamp, revision"
+	sqlReturnObject := " RETURNING " + strings.Join(columns, ", ") + ", timestamp, " + revisionColumn
 	sqlReturnMeta := " RETURNING " + strings.Join(columns[:propertiesIndex], ", ") + ", timestamp"
 
 	insertQuery := fmt.Sprintf("INSERT INTO %s.\"%s\" ", schema, resource) + "(" + strings.Join(columns, ", ") + ", timestamp)"
@@ -280,11 +655,26 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		sets[i-propertiesIndex] = columns[i] + " = $" + strconv.Itoa(i+1)
 	}
 	updateQuery += strings.Join(sets, ", ") + ", timestamp = $" + strconv.Itoa(len(columns)+1)
-	updateQuery += ", revision = revision + 1 " + sqlWhereOne + " RETURNING " + primary + "_id;"
+	updateQuery += incrementRevision + sqlWhereOne + " RETURNING " + primary + "_id;"
 
 	updatePropertyQuery := fmt.Sprintf("UPDATE %s.\"%s\" SET ", schema, resource)
 	updatePropertyQuery += " %s = $" + strconv.Itoa(propertiesIndex+1)
-	updatePropertyQuery += ", revision = revision + 1 " + sqlWhereOne + " RETURNING " + primary + "_id;"
+	updatePropertyQuery += incrementRevision + sqlWhereOne + " RETURNING " + primary + "_id;"
+	updatePropertyWithRevisionQuery := fmt.Sprintf("UPDATE %s.\"%s\" SET ", schema, resource)
+	updatePropertyWithRevisionQuery += " %s = $" + strconv.Itoa(propertiesIndex+1)
+	updatePropertyWithRevisionQuery += ", revision = revision + 1 " + sqlWhereOne + " AND revision = $" + strconv.Itoa(propertiesIndex+2) +
+		" RETURNING " + primary + "_id;"
+
+	// csvColumns are the columns of lists requested with format=csv: the identifiers, the static properties,
+	// timestamp and revision, and the configured dynamic properties
+	csvColumns := append(append([]string{}, columns[:propertiesIndex]...), columns[staticPropertiesIndex:]...)
+	csvColumns = append(csvColumns, "timestamp")
+	if !rc.NoRevision {
+		csvColumns = append(csvColumns, "revision")
+	}
+	csvColumns = append(csvColumns, rc.CSVProperties...)
+
+	b.registerWarmUp(resource, readQuery+sqlWhereOne+";", readQueryWithTotal+sqlWhereAll+sqlPaginationDesc, insertQuery, updateQuery)
 
 	var singletonParentExistsQuery string
 	if singleton {
@@ -314,7 +704,9 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		object["timestamp"] = timestamp
 		i++
 		values[i] = revision
-		object["revision"] = revision
+		if !rc.NoRevision {
+			object["revision"] = revision
+		}
 		values = append(values, extra...)
 		return values, object
 	}
@@ -336,7 +728,9 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		if revision != nil {
 			i++
 			values[i] = revision
-			object["revision"] = revision
+			if !rc.NoRevision {
+				object["revision"] = revision
+			}
 		}
 		values = append(values, extra...)
 		return values, object
@@ -357,6 +751,11 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		if err != nil {
 			return
 		}
+		if len(rc.EncryptedProperties) > 0 {
+			if err = b.decryptProperties(resource, rc.EncryptedProperties, properties); err != nil {
+				nillog.WithError(err).Errorf("Error 4819: cannot decrypt properties of %s", this)
+			}
+		}
 		for key, value := range properties {
 			if _, ok := object[key]; !ok { // dynamic properties must not overwrite static properties
 				object[key] = value
@@ -364,7 +763,114 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		}
 	}
 
+	// listByIDs returns the items with the requested ids in the order of the ids, and the ids which
+	// were not found
+	listByIDs := func(w http.ResponseWriter, r *http.Request, value string) {
+		locale := r.URL.Query().Get("locale")
+		for key := range r.URL.Query() {
+			if key != "ids" && key != "locale" {
+				http.Error(w, "parameter '"+key+"' cannot be combined with ids", http.StatusBadRequest)
+				return
+			}
+		}
+		ids := []string{}
+		for _, id := range strings.Split(value, ",") {
+			id = strings.TrimSpace(id)
+			if len(id) == 0 {
+				continue
+			}
+			parsed, err := uuid.Parse(id)
+			if err != nil {
+				http.Error(w, "parameter 'ids': invalid uuid '"+id+"'", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, parsed.String())
+		}
+		if len(ids) > maxIDsPerRequest {
+			http.Error(w, fmt.Sprintf("parameter 'ids': at most %d ids are allowed", maxIDsPerRequest), http.StatusBadRequest)
+			return
+		}
+
+		params := mux.Vars(r)
+		selectors := map[string]string{}
+		queryParameters := []interface{}{}
+		for i := ownerIndex; i < propertiesIndex; i++ { // skip ID
+			selectors[columns[i]] = params[columns[i]]
+			queryParameters = append(queryParameters, params[columns[i]])
+		}
+		queryParameters = append(queryParameters, pq.Array(ids))
+
+		rows, err := b.db.QueryContext(r.Context(), readQuery+sqlWhereIDs, queryParameters...)
+		if err != nil {
+			nillog.WithError(err).Errorf("Error 4790: cannot execute query `%s` %+v", readQuery+sqlWhereIDs, queryParameters)
+			http.Error(w, "Error 4790", databaseErrorStatus(w, err))
+			return
+		}
+		defer rows.Close()
+		objects := map[string]map[string]interface{}{}
+		for rows.Next() {
+			values, object := createScanValuesAndObject(&time.Time{}, new(int))
+			if err := rows.Scan(values...); err != nil {
+				nillog.WithError(err).Errorf("Error 4791: cannot scan values")
+				http.Error(w, "Error 4791", http.StatusInternalServerError)
+				return
+			}
+			mergeProperties(object)
+			// apply defaults if applicable
+			if rc.Default != nil {
+				var defaultJSON map[string]interface{}
+				json.Unmarshal(rc.Default, &defaultJSON)
+				patchObject(defaultJSON, object)
+				object = defaultJSON
+			}
+			localizeObject(object, locale)
+			b.computeProperties(resource, object)
+			objects[values[0].(*uuid.UUID).String()] = object
+		}
+
+		items := []json.RawMessage{}
+		notFound := []string{}
+		for _, id := range ids {
+			object, ok := objects[id]
+			if !ok {
+				notFound = append(notFound, id)
+				continue
+			}
+			// the items are read, so we do the read request interceptors
+			jsonData, _ := json.MarshalWithOption(object, json.DisableHTMLEscape())
+			data, err := b.intercept(r.Context(), resource, core.OperationRead, uuid.MustParse(id), selectors, nil, jsonData)
+			if err != nil {
+				nillog.WithError(err).Errorf("Error 4792: interceptor")
+				http.Error(w, "Error 4792", http.StatusInternalServerError)
+				return
+			}
+			if data != nil {
+				jsonData = data
+			}
+			items = append(items, jsonData)
+		}
+
+		jsonData, _ := json.MarshalWithOption(IDsResponse{Items: items, NotFound: notFound}, json.DisableHTMLEscape())
+		etag := bytesToEtag(jsonData)
+		w.Header().Set("Etag", etag)
+		if ifNoneMatchFound(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(jsonData)
+	}
+
 	list := func(w http.ResponseWriter, r *http.Request, relation *relationInjection) {
+		if ids, ok := r.URL.Query()["ids"]; ok {
+			if relation != nil || len(ids) > 1 {
+				http.Error(w, "illegal parameter 'ids'", http.StatusBadRequest)
+				return
+			}
+			listByIDs(w, r, ids[0])
+			return
+		}
+		b.setServerTime(w)
 		var (
 			queryParameters     []interface{}
 			sqlQuery            string
@@ -378,15 +884,24 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			filterJSONColumns   []string
 			filterJSONValues    []string
 			filterJSONOperators []string
+			orColumns           []string
+			orValues            []string
+			orOperators         []string
+			orSearchable        []bool
 			ascendingOrder      bool
+			randomOrder         bool
+			orderByRelation     bool
 			metaonly            bool
+			withTotalCount      bool = true
+			locale              string
+			format              string
 			err                 error
 		)
 		urlQuery := r.URL.Query()
 		parameters := map[string]string{}
-		var withCompanionUrls bool
+		var withCompanionUrls, raw bool
 		for key, array := range urlQuery {
-			if key != "filter" && len(array) > 1 {
+			if key != "filter" && key != "filter_or" && len(array) > 1 {
 				http.Error(w, "illegal parameter array '"+key+"'", http.StatusBadRequest)
 				return
 			}
@@ -404,29 +919,28 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 					err = fmt.Errorf("out of range")
 				}
 			case "until":
-				until, err = time.Parse(time.RFC3339, value)
+				until, err = parseTimeParameter(value)
 
 			case "from":
-				from, err = time.Parse(time.RFC3339, value)
+				from, err = parseTimeParameter(value)
 
 			case "filter", "search":
 				for _, value := range array {
-					var operator string
-					i := strings.IndexRune(value, '=')
-					if i < 0 {
-						i = strings.IndexRune(value, '~')
-						if i < 0 {
-							err = fmt.Errorf("cannot parse filter, must be of type property=value or property~value")
-							break
-						} else {
-							operator = " LIKE "
-						}
-					} else {
-						operator = "="
+					var filterKey, operator, filterValue string
+					filterKey, operator, filterValue, err = parseFilter(value)
+					if err != nil {
+						break
 					}
-					filterKey := value[:i]
-					filterValue := value[i+1:]
 
+					if operator == "=" {
+						if err = checkIDFilter(filterKey, filterValue, columns[:propertiesIndex]); err != nil {
+							break switchStatement
+						}
+					}
+					if column, ok := generatedColumns[filterKey]; ok && operator == " LIKE " && !column.isText() {
+						err = fmt.Errorf("property '%s' is not text and cannot be searched with a pattern", filterKey)
+						break switchStatement
+					}
 					found := false
 					for _, searchableColumn := range searchableColumns {
 						if filterKey == searchableColumn {
@@ -443,17 +957,64 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 							err = fmt.Errorf("unknown search property '%s'", filterKey)
 							break switchStatement
 						}
+						if stringlist(rc.EncryptedProperties).contains(filterKey) {
+							err = fmt.Errorf("cannot filter by encrypted property '%s'", filterKey)
+							break switchStatement
+						}
 						filterJSONValues = append(filterJSONValues, filterValue)
 						filterJSONColumns = append(filterJSONColumns, filterKey)
+						b.filterUsage.count(resource, filterKey)
 						filterJSONOperators = append(filterJSONOperators, operator)
 					}
 				}
+			case "filter_or":
+				// all filter_or parameters form one group of alternatives, which is combined with the other filters
+				for _, value := range array {
+					var filterKey, operator, filterValue string
+					filterKey, operator, filterValue, err = parseFilter(value)
+					if err != nil {
+						break
+					}
+					if operator == "=" {
+						if err = checkIDFilter(filterKey, filterValue, columns[:propertiesIndex]); err != nil {
+							break switchStatement
+						}
+					}
+					if column, ok := generatedColumns[filterKey]; ok && operator == " LIKE " && !column.isText() {
+						err = fmt.Errorf("property '%s' is not text and cannot be searched with a pattern", filterKey)
+						break switchStatement
+					}
+					searchable := stringlist(searchableColumns).contains(filterKey)
+					if !searchable {
+						if stringlist(rc.EncryptedProperties).contains(filterKey) {
+							err = fmt.Errorf("cannot filter by encrypted property '%s'", filterKey)
+							break switchStatement
+						}
+						b.filterUsage.count(resource, filterKey)
+					}
+					orColumns = append(orColumns, filterKey)
+					orOperators = append(orOperators, operator)
+					orValues = append(orValues, filterValue)
+					orSearchable = append(orSearchable, searchable)
+				}
 			case "order":
-				if value != "asc" && value != "desc" {
-					err = fmt.Errorf("order must be asc or desc")
+				if value != "asc" && value != "desc" && value != "random" {
+					err = fmt.Errorf("order must be asc, desc or random")
 					break
 				}
 				ascendingOrder = (value == "asc")
+				randomOrder = (value == "random")
+
+			case "order_by":
+				if value != "timestamp" && value != "relation_timestamp" {
+					err = fmt.Errorf("order_by must be timestamp or relation_timestamp")
+					break
+				}
+				if value == "relation_timestamp" && relation == nil {
+					err = fmt.Errorf("relation_timestamp is only supported for relations")
+					break
+				}
+				orderByRelation = (value == "relation_timestamp")
 
 			case "metaonly":
 				metaonly, err = strconv.ParseBool(array[0])
@@ -469,6 +1030,25 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 					return
 				}
 
+			case "withtotalcount":
+				withTotalCount, err = strconv.ParseBool(value)
+
+			case "locale":
+				locale = value
+
+			case "raw":
+				raw, err = strconv.ParseBool(value)
+				if err == nil && raw && !b.isAdmin(r) {
+					http.Error(w, "parameter 'raw' requires admin", http.StatusUnauthorized)
+					return
+				}
+
+			case "format":
+				if value != "json" && value != "csv" {
+					err = fmt.Errorf("format must be json or csv")
+				}
+				format = value
+
 			default:
 				err = fmt.Errorf("unknown")
 			}
@@ -480,22 +1060,31 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 				return
 			}
 		}
+		// a random sample is different for every request, so there are no pages to navigate
+		if randomOrder && page > 1 {
+			http.Error(w, "parameter 'page': pagination is not supported with order=random", http.StatusBadRequest)
+			return
+		}
+		if randomOrder && orderByRelation {
+			http.Error(w, "parameter 'order_by': relation_timestamp is not supported with order=random", http.StatusBadRequest)
+			return
+		}
 		params := mux.Vars(r)
 		selectors := map[string]string{}
 		for i := ownerIndex; i < propertiesIndex; i++ { // skip ID
 			selectors[columns[i]] = params[columns[i]]
 		}
-		if metaonly {
-			sqlQuery = readQueryMetaWithTotal
-		} else {
-			sqlQuery = readQueryWithTotal
-		}
-		sqlQuery += sqlWhereAll
+		sqlQuery = sqlWhereAll
 		if len(externalValues) == 0 && len(filterJSONValues) == 0 { // no filter(s), get entire collection
 			queryParameters = make([]interface{}, propertiesIndex-ownerIndex+6)
 		} else {
 			queryParameters = make([]interface{}, propertiesIndex-ownerIndex+6+len(externalValues)+len(filterJSONValues))
 			for i := range externalValues {
+				if rc.ExternalIndexCaseInsensitive && stringlist(externalIndices).contains(externalColumns[i]) {
+					sqlQuery += fmt.Sprintf("AND (lower(%s)%slower($%d)) ", externalColumns[i], externalOperators[i], propertiesIndex-ownerIndex+7+i)
+					queryParameters[propertiesIndex-ownerIndex+6+i] = externalValues[i]
+					continue
+				}
 				sqlQuery += fmt.Sprintf("AND (%s%s$%d) ", externalColumns[i], externalOperators[i], propertiesIndex-ownerIndex+7+i)
 				queryParameters[propertiesIndex-ownerIndex+6+i] = externalValues[i]
 			}
@@ -515,14 +1104,81 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		queryParameters[propertiesIndex-ownerIndex+4] = limit
 		queryParameters[propertiesIndex-ownerIndex+5] = (page - 1) * limit
 
+		if len(orValues) > 0 {
+			alternatives := make([]string, len(orValues))
+			for i := range orValues {
+				queryParameters = append(queryParameters, orValues[i])
+				n := len(queryParameters)
+				switch {
+				case orSearchable[i] && rc.ExternalIndexCaseInsensitive && stringlist(externalIndices).contains(orColumns[i]):
+					alternatives[i] = fmt.Sprintf("lower(%s)%slower($%d)", orColumns[i], orOperators[i], n)
+				case orSearchable[i]:
+					alternatives[i] = fmt.Sprintf("%s%s$%d", orColumns[i], orOperators[i], n)
+				default:
+					alternatives[i] = fmt.Sprintf("properties->>'%s'%s$%d", strings.ReplaceAll(orColumns[i], "'", "''"), orOperators[i], n)
+				}
+			}
+			sqlQuery += "AND (" + strings.Join(alternatives, " OR ") + ") "
+		}
+
+		sqlPaginationRelation := ""
 		if relation != nil {
 			// inject subquery for relation
 			sqlQuery += fmt.Sprintf(relation.subquery,
 				compareIDsStringWithOffset(len(queryParameters), relation.columns))
+			if orderByRelation {
+				sqlPaginationRelation = relationPaginationQuery(relation, len(queryParameters), columns[0], ascendingOrder,
+					propertiesIndex-ownerIndex+1+4)
+			}
 			queryParameters = append(queryParameters, relation.queryParameters...)
 		}
 
-		if ascendingOrder {
+		// the weak validator is an aggregate over all matching items, hence the 304 fast path does
+		// not need to build the body. A random sample changes with every request, it has no validator.
+		var weakEtag string
+		// the weak Etag is derived from the stored data. An interceptor can change the response without
+		// changing the stored data, so then the Etag must be computed from the response
+		if rc.WeakListEtag && !randomOrder && (raw || !b.hasInterceptor(resource, core.OperationList)) {
+			// limit and offset do not apply to the aggregate, but postgres must still know their types
+			aggregateQuery := weakListEtagQuery + sqlQuery +
+				fmt.Sprintf("AND $%d::INTEGER > 0 AND $%d::INTEGER >= 0;", propertiesIndex-ownerIndex+1+4, propertiesIndex-ownerIndex+1+5)
+			var count, maxRevision, sumRevision, sumIDHash int64
+			err = b.db.QueryRowContext(r.Context(), aggregateQuery, queryParameters...).Scan(&count, &maxRevision, &sumRevision, &sumIDHash)
+			if err, ok := err.(*pq.Error); ok && err.Code == "22P02" {
+				http.Error(w, "invalid filter value", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				nillog.WithError(err).Errorf("Error 4799: cannot execute query `%s` %+v", aggregateQuery, queryParameters)
+				http.Error(w, "Error 4799", databaseErrorStatus(w, err))
+				return
+			}
+			weakEtag = bytesToWeakEtag([]byte(fmt.Sprintf("%s:%d:%d:%d:%d", r.URL.RawQuery, count, maxRevision, sumRevision, sumIDHash)))
+			w.Header().Set("Etag", weakEtag)
+			if relation == nil {
+				setListCacheHeaders(w)
+			}
+			if ifNoneMatchFound(r.Header.Get("If-None-Match"), weakEtag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		switch {
+		case metaonly && withTotalCount:
+			sqlQuery = readQueryMetaWithTotal + sqlQuery
+		case metaonly:
+			sqlQuery = readQueryMeta + sqlQuery
+		case withTotalCount:
+			sqlQuery = readQueryWithTotal + sqlQuery
+		default:
+			sqlQuery = readQuery + sqlQuery
+		}
+		if randomOrder {
+			sqlQuery += sqlPaginationRandom
+		} else if orderByRelation {
+			sqlQuery += sqlPaginationRelation
+		} else if ascendingOrder {
 			sqlQuery += sqlPaginationAsc
 
 		} else {
@@ -530,19 +1186,29 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		}
 
 		// fmt.Printf("\n\nQUERY %#v parameters: %#v\n\n", sqlQuery, queryParameters)
-		rows, err := b.db.Query(sqlQuery, queryParameters...)
+		rows, err := b.db.QueryContext(r.Context(), sqlQuery, queryParameters...)
+		if err, ok := err.(*pq.Error); ok && err.Code == "22P02" {
+			// a filter value cannot be converted into the type of its column, e.g. of a generated property
+			http.Error(w, "invalid filter value", http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			nillog.WithError(err).Errorf("Error 4721: cannot execute query `%s` %+v", sqlQuery, queryParameters)
-			http.Error(w, "Error 4721", http.StatusInternalServerError)
+			http.Error(w, "Error 4721", databaseErrorStatus(w, err))
 			return
 		}
 
 		response := []interface{}{}
 		defer rows.Close()
 		var totalCount int
+		var extra []interface{}
+		if withTotalCount {
+			extra = append(extra, &totalCount)
+		}
+		responseBytes := 0
 		for rows.Next() {
 			var timestamp time.Time
-			values, object := createScanValuesAndObjectWithMeta(metaonly, &timestamp, new(int), &totalCount)
+			values, object := createScanValuesAndObjectWithMeta(metaonly, &timestamp, new(int), extra...)
 			err := rows.Scan(values...)
 			if err != nil {
 				nillog.WithError(err).Errorf("Error 4725: cannot scan values")
@@ -573,12 +1239,26 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 
 				mergeProperties(object)
 				// apply defaults if applicable
-				if rc.Default != nil {
+				if rc.Default != nil && !raw {
 					var defaultJSON map[string]interface{}
 					json.Unmarshal(rc.Default, &defaultJSON)
 					patchObject(defaultJSON, object)
 					object = defaultJSON
 				}
+				localizeObject(object, locale)
+				if !raw {
+					b.computeProperties(resource, object)
+				}
+			}
+
+			// stop early if the response becomes too big
+			if b.maxListResponseBytes > 0 {
+				data, _ := json.MarshalWithOption(object, json.DisableHTMLEscape())
+				responseBytes += len(data) + 1
+				if responseBytes > b.maxListResponseBytes {
+					listResponseTooLarge(w, b.maxListResponseBytes, len(response))
+					return
+				}
 			}
 
 			// if we did not have from, take it from the first object
@@ -588,27 +1268,33 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			response = append(response, object)
 		}
 
-		// do request interceptors
+		// do request interceptors, unless the raw stored data was requested
 		jsonData, _ := json.MarshalWithOption(response, json.DisableHTMLEscape())
-		data, err := b.intercept(r.Context(), resource, core.OperationList, uuid.UUID{}, selectors, parameters, jsonData)
-		if err != nil {
-			nillog.WithError(err).Errorf("Error 4726: cannot request interceptors")
-			http.Error(w, "Error 4726", http.StatusInternalServerError)
-			return
+		if !raw {
+			data, err := b.intercept(r.Context(), resource, core.OperationList, uuid.UUID{}, selectors, parameters, jsonData)
+			if err != nil {
+				nillog.WithError(err).Errorf("Error 4726: cannot request interceptors")
+				http.Error(w, "Error 4726", http.StatusInternalServerError)
+				return
+			}
+			if data != nil {
+				jsonData = data
+			}
 		}
-		if data != nil {
-			jsonData = data
+		if b.maxListResponseBytes > 0 && len(jsonData) > b.maxListResponseBytes {
+			listResponseTooLarge(w, b.maxListResponseBytes, len(response))
+			return
 		}
 
-		if page > 0 && totalCount == 0 {
+		if withTotalCount && page > 0 && totalCount == 0 {
 			// sql does not return total count if we ask beyond limits, hence
 			// we need a second query
 			queryParameters[propertiesIndex-ownerIndex+4] = 1
 			queryParameters[propertiesIndex-ownerIndex+5] = 0
-			rows, err := b.db.Query(sqlQuery, queryParameters...)
+			rows, err := b.db.QueryContext(r.Context(), sqlQuery, queryParameters...)
 			if err != nil {
 				nillog.WithError(err).Errorf("Error 4722: cannot execute query `%s` %v", sqlQuery, queryParameters)
-				http.Error(w, "Error 4722", http.StatusInternalServerError)
+				http.Error(w, "Error 4722", databaseErrorStatus(w, err))
 				return
 			}
 			defer rows.Close()
@@ -624,22 +1310,47 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			}
 		}
 
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if format == "csv" {
+			// the CSV is converted from the final list, so it matches the JSON response
+			csvData, err := listToCSV(jsonData, csvColumns)
+			if err != nil {
+				nillog.WithError(err).Errorf("Error 4825: cannot convert list to CSV")
+				http.Error(w, "Error 4825", http.StatusInternalServerError)
+				return
+			}
+			jsonData = csvData
+			w.Header().Set("Content-Type", csvMediaType)
+			w.Header().Set("Content-Disposition", "attachment; filename=\""+core.Plural(this)+".csv\"")
+		} else {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		}
 		w.Header().Set("Pagination-Limit", strconv.Itoa(limit))
-		w.Header().Set("Pagination-Total-Count", strconv.Itoa(totalCount))
-		w.Header().Set("Pagination-Page-Count", strconv.Itoa(((totalCount-1)/limit)+1))
-		w.Header().Set("Pagination-Current-Page", strconv.Itoa(page))
-		if !from.IsZero() {
-			w.Header().Set("Pagination-Until", from.Format(time.RFC3339Nano))
+		if withTotalCount {
+			w.Header().Set("Pagination-Total-Count", strconv.Itoa(totalCount))
 		}
-
-		etag := bytesPlusTotalCountToEtag(jsonData, totalCount)
-		w.Header().Set("Etag", etag)
-		if ifNoneMatchFound(r.Header.Get("If-None-Match"), etag) {
-			w.WriteHeader(http.StatusNotModified)
-			return
+		if !randomOrder {
+			if withTotalCount {
+				w.Header().Set("Pagination-Page-Count", strconv.Itoa(((totalCount-1)/limit)+1))
+			}
+			w.Header().Set("Pagination-Current-Page", strconv.Itoa(page))
+			// until selects by the timestamp of the resources, which is not the order of relation_timestamp
+			if !from.IsZero() && !orderByRelation {
+				w.Header().Set("Pagination-Until", from.Format(time.RFC3339Nano))
+			}
 		}
-		w.Write(jsonData)
+
+		if weakEtag == "" {
+			etag := bytesPlusTotalCountToEtag(jsonData, totalCount)
+			w.Header().Set("Etag", etag)
+			if relation == nil && !randomOrder {
+				setListCacheHeaders(w)
+			}
+			if ifNoneMatchFound(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Write(jsonData)
 
 	}
 
@@ -660,7 +1371,8 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		var err error
 
 		params := mux.Vars(r)
-		noIntercept := false
+		noIntercept, raw := false, false
+		var locale string
 		urlQuery := r.URL.Query()
 		for key, array := range urlQuery {
 			switch key {
@@ -670,8 +1382,20 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 					http.Error(w, "parameter '"+key+"': "+err.Error(), http.StatusBadRequest)
 					return
 				}
+			case "raw":
+				raw, err = strconv.ParseBool(array[0])
+				if err != nil {
+					http.Error(w, "parameter '"+key+"': "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				if raw && !b.isAdmin(r) {
+					http.Error(w, "parameter 'raw' requires admin", http.StatusUnauthorized)
+					return
+				}
 			case "children":
 				break
+			case "locale":
+				locale = array[0]
 			default:
 				http.Error(w, "parameter '"+key+"': unknown query parameter", http.StatusBadRequest)
 				return
@@ -714,8 +1438,9 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			queryParameters = append(queryParameters, relation.queryParameters...)
 		}
 
-		values, object := createScanValuesAndObject(&time.Time{}, new(int))
-		err = b.db.QueryRow(readQuery+sqlWhereOne+subQuery+";", queryParameters...).Scan(values...)
+		var timestamp time.Time
+		values, object := createScanValuesAndObject(&timestamp, new(int))
+		err = b.db.QueryRowContext(r.Context(), readQuery+sqlWhereOne+subQuery+";", queryParameters...).Scan(values...)
 		if err == csql.ErrNoRows {
 			if singleton {
 				var jsonData []byte
@@ -724,7 +1449,7 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 
 				// validate that the parent exists, and if not return not found
 				var parentID uuid.UUID
-				err = b.db.QueryRow(singletonParentExistsQuery, &primaryID).Scan(&parentID)
+				err = b.db.QueryRowContext(r.Context(), singletonParentExistsQuery, &primaryID).Scan(&parentID)
 				if err == csql.ErrNoRows {
 					http.Error(w, "no such "+this, http.StatusNotFound)
 					return
@@ -734,15 +1459,16 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 					return
 				}
 
-				if rc.Default != nil {
+				if rc.Default != nil && !raw {
 					var bodyJSON map[string]interface{}
 					json.Unmarshal(rc.Default, &bodyJSON)
 					for i := 0; i < propertiesIndex; i++ {
 						bodyJSON[columns[i]] = params[columns[i]]
 					}
+					localizeObject(bodyJSON, locale)
 					jsonData, _ = json.Marshal(bodyJSON)
 				}
-				if !noIntercept {
+				if !noIntercept && !raw {
 					data, err := b.intercept(r.Context(), resource, core.OperationRead, primaryID, selectors, nil, jsonData)
 					if err != nil {
 						nillog.WithError(err).Errorf("Error 4751: interceptor")
@@ -768,6 +1494,20 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 				}
 				return
 			}
+			if rc.WithChanges && relation == nil {
+				// the change feed tells apart items which were deleted from items which never existed
+				var deleted bool
+				err = b.db.QueryRowContext(r.Context(), deletedQuery, queryParameters[:propertiesIndex]...).Scan(&deleted)
+				if err != nil {
+					nillog.WithError(err).Errorf("Error 4824: cannot check for deleted %s", this)
+					http.Error(w, "Error 4824", databaseErrorStatus(w, err))
+					return
+				}
+				if deleted {
+					http.Error(w, this+" was deleted", http.StatusGone)
+					return
+				}
+			}
 			http.Error(w, "no such "+this, http.StatusNotFound)
 			return
 		}
@@ -781,18 +1521,22 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 				return
 			}
 			nillog.WithError(err).Errorf("Error 4727: cannot QueryRow")
-			http.Error(w, "Error 4727", status)
+			http.Error(w, "Error 4727", databaseErrorStatus(w, err))
 			return
 		}
 		mergeProperties(object)
 
 		// apply defaults if applicable
-		if rc.Default != nil {
+		if rc.Default != nil && !raw {
 			var defaultJSON map[string]interface{}
 			json.Unmarshal(rc.Default, &defaultJSON)
 			patchObject(defaultJSON, object)
 			object = defaultJSON
 		}
+		localizeObject(object, locale)
+		if !raw {
+			b.computeProperties(resource, object)
+		}
 
 		if rc.WithCompanionFile && b.KssDriver != nil {
 			var key string
@@ -814,13 +1558,16 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			object["companion_download_url"] = downloadURL
 		}
 
-		// do request interceptors
+		// do request interceptors, unless the raw stored data was requested
 		jsonData, _ := json.MarshalWithOption(object, json.DisableHTMLEscape())
-		data, err := b.intercept(r.Context(), resource, core.OperationRead, *values[0].(*uuid.UUID), selectors, nil, jsonData)
-		if err != nil {
-			nillog.WithError(err).Errorf("Error 4748: interceptor")
-			http.Error(w, "Error 4748", http.StatusInternalServerError)
-			return
+		var data []byte
+		if !raw {
+			data, err = b.intercept(r.Context(), resource, core.OperationRead, *values[0].(*uuid.UUID), selectors, nil, jsonData)
+			if err != nil {
+				nillog.WithError(err).Errorf("Error 4748: interceptor")
+				http.Error(w, "Error 4748", http.StatusInternalServerError)
+				return
+			}
 		}
 		if data != nil {
 			jsonData = data
@@ -829,7 +1576,7 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		// add children if requested
 		for key, array := range urlQuery {
 			switch key {
-			case "nointercept":
+			case "nointercept", "locale", "raw":
 				break
 			case "children":
 				if data != nil { // data was changed in interceptor
@@ -841,7 +1588,7 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 					}
 				}
 
-				status, err := b.addChildrenToGetResponse(array, noIntercept, r, object)
+				status, err := b.addChildrenToGetResponse(array, noIntercept || raw, r, object)
 				if err != nil {
 					http.Error(w, err.Error(), status)
 					return
@@ -855,7 +1602,11 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 
 		etag := bytesToEtag(jsonData)
 		w.Header().Set("Etag", etag)
-		if ifNoneMatchFound(r.Header.Get("If-None-Match"), etag) {
+		// updates do not change the timestamp, so it only tells when an immutable item was modified
+		if rc.Immutable {
+			w.Header().Set("Last-Modified", timestamp.UTC().Format(http.TimeFormat))
+		}
+		if ifNoneMatchFound(r.Header.Get("If-None-Match"), etag) || (rc.Immutable && notModifiedSince(r, timestamp)) {
 			w.WriteHeader(http.StatusNotModified)
 			return
 		}
@@ -878,6 +1629,10 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 	}
 
 	updatePropertyWithAuth := func(w http.ResponseWriter, r *http.Request, property string) {
+		if rc.Immutable {
+			http.Error(w, this+" is immutable", http.StatusMethodNotAllowed)
+			return
+		}
 		params := mux.Vars(r)
 
 		if b.authorizationEnabled {
@@ -925,6 +1680,19 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			return
 		}
 
+		// with a revision, the property is only updated if the item still has this revision
+		revision := 0
+		if value := r.URL.Query().Get("revision"); value != "" {
+			revision, err = strconv.Atoi(value)
+			if err == nil && revision < 0 {
+				err = fmt.Errorf("out of range")
+			}
+			if err != nil {
+				http.Error(w, "parameter 'revision': "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
 		query := fmt.Sprintf(updatePropertyQuery, property)
 
 		queryParameters := make([]interface{}, propertiesIndex+1)
@@ -933,25 +1701,89 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			queryParameters[i] = params[columns[i]]
 		}
 		queryParameters[i] = value
+		if revision != 0 && !rc.NoRevision {
+			query = fmt.Sprintf(updatePropertyWithRevisionQuery, property)
+			queryParameters = append(queryParameters, revision)
+		}
 
 		tx, err := b.db.BeginTx(r.Context(), nil)
+		if err == nil {
+			if err = b.setActor(r.Context(), tx); err != nil {
+				tx.Rollback()
+			}
+		}
 		if err != nil {
 			nillog.WithError(err).Errorf("Error 4729: cannot BeginTx")
-			http.Error(w, "Error 4729", http.StatusInternalServerError)
+			http.Error(w, "Error 4729", databaseErrorStatus(w, err))
 			return
 		}
 
+		if immutableProperties[property] {
+			var current string
+			err = tx.QueryRowContext(r.Context(), fmt.Sprintf("SELECT %s FROM %s.\"%s\" ", property, schema, resource)+sqlWhereOne+" FOR UPDATE;",
+				queryParameters[:propertiesIndex]...).Scan(&current)
+			if err == csql.ErrNoRows {
+				tx.Rollback()
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				tx.Rollback()
+				nillog.WithError(err).Errorf("Error 4797: cannot read immutable property %s", property)
+				http.Error(w, "Error 4797", databaseErrorStatus(w, err))
+				return
+			}
+			if current != "" && current != value {
+				tx.Rollback()
+				http.Error(w, "property '"+property+"' of "+this+" is immutable", http.StatusBadRequest)
+				return
+			}
+		}
+
 		var primaryID uuid.UUID
-		err = tx.QueryRow(query, queryParameters...).Scan(&primaryID)
+		err = tx.QueryRowContext(r.Context(), query, queryParameters...).Scan(&primaryID)
+		if err == csql.ErrNoRows && revision != 0 && !rc.NoRevision {
+			// either the item does not exist, or the revision does not match. In the latter case, return
+			// conflict status with the conflicting object
+			values, object := createScanValuesAndObject(&time.Time{}, new(int))
+			err = tx.QueryRowContext(r.Context(), readQuery+sqlWhereOne+";", queryParameters[:propertiesIndex]...).Scan(values...)
+			tx.Rollback()
+			if err == csql.ErrNoRows {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				nillog.WithError(err).Errorf("Error 4808: cannot read conflicting %s", this)
+				http.Error(w, "Error 4808", databaseErrorStatus(w, err))
+				return
+			}
+			mergeProperties(object)
+			jsonData, _ := json.MarshalWithOption(object, json.DisableHTMLEscape())
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusConflict)
+			w.Write(jsonData)
+			return
+		}
 		if err == csql.ErrNoRows {
 			tx.Rollback()
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
+		if err, ok := err.(*pq.Error); ok && err.Code == "23505" {
+			// Non unique external keys are reported as code Code 23505
+			tx.Rollback()
+			http.Error(w, conflictMessage(err), http.StatusConflict)
+			return
+		}
+		if message, ok := checkViolation(err, checkMessages); ok {
+			tx.Rollback()
+			http.Error(w, message, http.StatusUnprocessableEntity)
+			return
+		}
 		if err != nil {
 			tx.Rollback()
 			nillog.WithError(err).Errorf("Error 4728: cannot QueryRow query:`%s`", query)
-			http.Error(w, "Error 4728", http.StatusInternalServerError)
+			http.Error(w, "Error 4728", databaseErrorStatus(w, err))
 			return
 		}
 		notification := map[string]string{
@@ -961,13 +1793,17 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		err = b.commitWithNotification(r.Context(), tx, resource, core.OperationUpdate, primaryID, notificationJSON)
 		if err != nil {
 			nillog.WithError(err).Errorf("Error 4744: sqlQuery `%s`", query)
-			http.Error(w, "Error 4744", http.StatusInternalServerError)
+			http.Error(w, "Error 4744", databaseErrorStatus(w, err))
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
 	}
 
 	deleteWithAuth := func(w http.ResponseWriter, r *http.Request) {
+		if rc.NoDelete {
+			http.Error(w, this+" cannot be deleted", http.StatusMethodNotAllowed)
+			return
+		}
 		rlog := logger.FromContext(r.Context())
 		params := mux.Vars(r)
 		selectors := map[string]string{}
@@ -1018,15 +1854,32 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		}
 
 		tx, err := b.db.BeginTx(r.Context(), nil)
+		if err == nil {
+			if err = b.setActor(r.Context(), tx); err != nil {
+				tx.Rollback()
+			}
+		}
 		if err != nil {
 			rlog.WithError(err).Errorf("Error 4729: cannot BeginTx")
-			http.Error(w, "Error 4729", http.StatusInternalServerError)
+			http.Error(w, "Error 4729", databaseErrorStatus(w, err))
 			return
 		}
 
+		// the children must be enumerated before the delete cascades to them
+		var cascadedNotifications []Notification
+		if len(cascaded) > 0 && !isSilent(r) {
+			cascadedNotifications, err = b.writeCascadeNotifications(r.Context(), tx, cascaded, columns[:propertiesIndex], queryParameters)
+			if err != nil {
+				tx.Rollback()
+				rlog.WithError(err).Errorf("Error 4818: cannot write cascaded notifications")
+				http.Error(w, "Error 4818", databaseErrorStatus(w, err))
+				return
+			}
+		}
+
 		var timestamp time.Time
 		values, object := createScanValuesAndObject(&timestamp, new(int))
-		err = tx.QueryRow(deleteQuery+sqlWhereOne+sqlReturnObject, queryParameters...).Scan(values...)
+		err = tx.QueryRowContext(r.Context(), deleteQuery+sqlWhereOne+sqlReturnObject, queryParameters...).Scan(values...)
 		if err == csql.ErrNoRows {
 			tx.Rollback()
 			w.WriteHeader(http.StatusNotFound)
@@ -1034,8 +1887,12 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		}
 		if err != nil {
 			tx.Rollback()
+			if isForeignKeyViolation(err) {
+				http.Error(w, "cannot delete "+this+", it still has dependent resources", http.StatusConflict)
+				return
+			}
 			rlog.WithError(err).Errorf("Error 4730: cannot QueryRow")
-			http.Error(w, "Error 4730", http.StatusInternalServerError)
+			http.Error(w, "Error 4730", databaseErrorStatus(w, err))
 			return
 		}
 		if rc.needsKSS && b.KssDriver != nil {
@@ -1053,27 +1910,179 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		mergeProperties(object)
 		jsonData, _ := json.MarshalWithOption(object, json.DisableHTMLEscape())
 
-		var silent bool
-		if s := r.URL.Query().Get("silent"); s != "" {
-			silent, _ = strconv.ParseBool(s)
+		err = b.commitWithNotification(notificationContext(r), tx, resource, core.OperationDelete, primaryID, jsonData)
+		if err != nil {
+			nillog.WithError(err).Errorf("Error 4750: cannot QueryRow")
+			http.Error(w, "Error 4750", databaseErrorStatus(w, err))
+			return
 		}
+		b.afterCascadeCommit(r.Context(), cascadedNotifications)
 
-		if silent {
-			err = tx.Commit()
+		if returnPrevious(r) {
+			// the deleted object is the previous state
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			w.Write(jsonData)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
 
-		} else {
-			err = b.commitWithNotification(r.Context(), tx, resource, core.OperationDelete, primaryID, jsonData)
+	// updatePropertyBulkWithAuth sets a static property of all items which match the query parameters with a
+	// single statement. Items which already have the value are left alone, all others get a new revision.
+	// Instead of one notification per item, there is a single update notification with a zero id and the
+	// identifiers of the updated items as payload.
+	updatePropertyBulkWithAuth := func(w http.ResponseWriter, r *http.Request, property string) {
+		if rc.Immutable {
+			http.Error(w, this+" is immutable", http.StatusMethodNotAllowed)
+			return
+		}
+		rlog := logger.FromContext(r.Context())
+		params := mux.Vars(r)
+
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.IsAuthorized(resources, core.OperationUpdate, params, rc.Permits) {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if immutableProperties[property] {
+			http.Error(w, "property '"+property+"' of "+this+" is immutable", http.StatusBadRequest)
+			return
 		}
+
+		value, err := url.PathUnescape(params[property])
 		if err != nil {
-			nillog.WithError(err).Errorf("Error 4750: cannot QueryRow")
-			http.Error(w, "Error 4750", http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("cannot unescape %s, err: %v", params[property], err), http.StatusBadRequest)
 			return
 		}
 
-		w.WriteHeader(http.StatusNoContent)
+		var (
+			until          time.Time
+			from           time.Time
+			externalColumn string
+			externalValue  string
+		)
+		urlQuery := r.URL.Query()
+		for key, array := range urlQuery {
+			if len(array) > 1 {
+				http.Error(w, "illegal parameter array '"+key+"'", http.StatusBadRequest)
+				return
+			}
+			switch key {
+			case "until":
+				until, err = parseTimeParameter(array[0])
+			case "from":
+				from, err = parseTimeParameter(array[0])
+			case "filter":
+				i := strings.IndexRune(array[0], '=')
+				if i < 0 {
+					err = fmt.Errorf("cannot parse filter, must be of type property=value")
+					break
+				}
+				externalColumn, externalValue = array[0][:i], array[0][i+1:]
+				found := false
+				for _, searchableColumn := range searchableColumns {
+					found = found || externalColumn == searchableColumn
+				}
+				if !found {
+					err = fmt.Errorf("unknown filter property '%s'", externalColumn)
+					break
+				}
+				err = checkIDFilter(externalColumn, externalValue, columns[:propertiesIndex])
+			case "silent":
+			default:
+				err = fmt.Errorf("unknown")
+			}
+			if err != nil {
+				http.Error(w, "parameter '"+key+"': "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		queryParameters := []interface{}{}
+		for i := ownerIndex; i < propertiesIndex; i++ { // skip ID
+			queryParameters = append(queryParameters, params[columns[i]])
+		}
+		queryParameters = append(queryParameters, until.IsZero(), until.UTC(), from.IsZero(), from.UTC(), value)
+		sqlQuery := fmt.Sprintf("UPDATE %s.\"%s\" SET %s = $%d", schema, resource, property, len(queryParameters)) + incrementRevision +
+			sqlWhereAll + fmt.Sprintf("AND %s <> $%d ", property, len(queryParameters))
+		if externalColumn != "" {
+			queryParameters = append(queryParameters, externalValue)
+			sqlQuery += fmt.Sprintf("AND %s = $%d ", externalColumn, len(queryParameters))
+		}
+		sqlQuery += "RETURNING " + columns[0] + ";"
+
+		tx, err := b.db.BeginTx(r.Context(), nil)
+		if err == nil {
+			if err = b.setActor(r.Context(), tx); err != nil {
+				tx.Rollback()
+			}
+		}
+		if err != nil {
+			rlog.WithError(err).Errorf("Error 4814: BeginTx")
+			http.Error(w, "Error 4814", databaseErrorStatus(w, err))
+			return
+		}
+		rows, err := tx.QueryContext(r.Context(), sqlQuery, queryParameters...)
+		if err != nil {
+			tx.Rollback()
+			rlog.WithError(err).Errorf("Error 4815: sqlQuery `%s`", sqlQuery)
+			http.Error(w, "Error 4815", databaseErrorStatus(w, err))
+			return
+		}
+		ids := []string{}
+		for rows.Next() {
+			var id uuid.UUID
+			if err = rows.Scan(&id); err != nil {
+				break
+			}
+			ids = append(ids, id.String())
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		rows.Close()
+		if err, ok := err.(*pq.Error); ok && err.Code == "23505" {
+			// Non unique external keys are reported as code Code 23505
+			tx.Rollback()
+			http.Error(w, conflictMessage(err), http.StatusConflict)
+			return
+		}
+		if message, ok := checkViolation(err, checkMessages); ok {
+			tx.Rollback()
+			http.Error(w, message, http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			tx.Rollback()
+			rlog.WithError(err).Errorf("Error 4816: cannot scan values")
+			http.Error(w, "Error 4816", databaseErrorStatus(w, err))
+			return
+		}
+
+		if len(ids) == 0 {
+			err = tx.Commit()
+		} else {
+			payload, _ := json.Marshal(ids)
+			err = b.commitWithNotification(notificationContext(r), tx, resource, core.OperationUpdate, uuid.UUID{}, payload)
+		}
+		if err != nil {
+			rlog.WithError(err).Errorf("Error 4817: commitWithNotification")
+			http.Error(w, "Error 4817", databaseErrorStatus(w, err))
+			return
+		}
+		jsonData, _ := json.Marshal(BulkUpdateResponse{Updated: len(ids)})
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(jsonData)
 	}
 
 	clearWithAuth := func(w http.ResponseWriter, r *http.Request) {
+		if rc.NoDelete {
+			http.Error(w, this+" cannot be deleted", http.StatusMethodNotAllowed)
+			return
+		}
 		var err error
 		rlog := logger.FromContext(r.Context())
 
@@ -1110,9 +2119,9 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			value := array[0]
 			switch key {
 			case "until":
-				until, err = time.Parse(time.RFC3339, value)
+				until, err = parseTimeParameter(value)
 			case "from":
-				from, err = time.Parse(time.RFC3339, value)
+				from, err = parseTimeParameter(value)
 			case "filter":
 				i := strings.IndexRune(value, '=')
 				if i < 0 {
@@ -1132,7 +2141,9 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 				}
 				if !found {
 					err = fmt.Errorf("unknown filter property '%s'", filterKey)
+					break
 				}
+				err = checkIDFilter(filterKey, filterValue, columns[:propertiesIndex])
 
 			default:
 				err = fmt.Errorf("unknown")
@@ -1153,9 +2164,14 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		}
 
 		tx, err := b.db.BeginTx(r.Context(), nil)
+		if err == nil {
+			if err = b.setActor(r.Context(), tx); err != nil {
+				tx.Rollback()
+			}
+		}
 		if err != nil {
 			rlog.WithError(err).Errorf("Error 4731: BeginTx")
-			http.Error(w, "Error 4731", http.StatusInternalServerError)
+			http.Error(w, "Error 4731", databaseErrorStatus(w, err))
 			return
 		}
 
@@ -1180,33 +2196,54 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		queryParameters[propertiesIndex-ownerIndex+2] = from.IsZero()
 		queryParameters[propertiesIndex-ownerIndex+3] = from.UTC()
 
-		rows, err := tx.Query(sqlQuery+sqlReturnMeta, queryParameters...)
+		rows, err := tx.QueryContext(r.Context(), sqlQuery+sqlReturnMeta, queryParameters...)
 		if err != nil {
 			tx.Rollback()
+			if isForeignKeyViolation(err) {
+				http.Error(w, "cannot clear "+core.Plural(this)+", they still have dependent resources", http.StatusConflict)
+				return
+			}
 			rlog.WithError(err).Errorf("Error 4732: sqlQuery `%s`", sqlQuery)
-			http.Error(w, "Error 4732", http.StatusInternalServerError)
+			http.Error(w, "Error 4732", databaseErrorStatus(w, err))
 			return
 		}
 		defer rows.Close()
 
-		if rc.needsKSS && b.KssDriver != nil {
-			for rows.Next() {
-				var timestamp time.Time
-				values, _ := createScanValuesAndObjectWithMeta(true, &timestamp, nil)
-				err := rows.Scan(values...)
-				if err != nil {
-					rlog.WithError(err).Errorf("Error 4725: cannot scan values")
-					http.Error(w, "Error 4725", http.StatusInternalServerError)
-					return
-				}
-				var key string
-				for i := 0; i < propertiesIndex; i++ {
-					key += "/" + resources[i] + "_id/" + values[propertiesIndex-i-1].(*uuid.UUID).String()
-				}
-				err = b.KssDriver.DeleteAllWithPrefix(key)
-				if err != nil {
-					rlog.WithError(err).Error("Could not delete key ", key)
-				}
+		var kssKeys []string
+		for rows.Next() {
+			if !rc.needsKSS || b.KssDriver == nil {
+				continue
+			}
+			var timestamp time.Time
+			values, _ := createScanValuesAndObjectWithMeta(true, &timestamp, nil)
+			err := rows.Scan(values...)
+			if err != nil {
+				tx.Rollback()
+				rlog.WithError(err).Errorf("Error 4725: cannot scan values")
+				http.Error(w, "Error 4725", http.StatusInternalServerError)
+				return
+			}
+			var key string
+			for i := 0; i < propertiesIndex; i++ {
+				key += "/" + resources[i] + "_id/" + values[propertiesIndex-i-1].(*uuid.UUID).String()
+			}
+			kssKeys = append(kssKeys, key)
+		}
+		if err = rows.Err(); err != nil {
+			tx.Rollback()
+			if isForeignKeyViolation(err) {
+				http.Error(w, "cannot clear "+core.Plural(this)+", they still have dependent resources", http.StatusConflict)
+				return
+			}
+			rlog.WithError(err).Errorf("Error 4732: sqlQuery `%s`", sqlQuery)
+			http.Error(w, "Error 4732", databaseErrorStatus(w, err))
+			return
+		}
+		// only delete the stored files once we know that the resources can be deleted
+		for _, key := range kssKeys {
+			err = b.KssDriver.DeleteAllWithPrefix(key)
+			if err != nil {
+				rlog.WithError(err).Error("Could not delete key ", key)
 			}
 		}
 
@@ -1221,13 +2258,52 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		err = b.commitWithNotification(r.Context(), tx, resource, core.OperationClear, uuid.UUID{}, notificationJSON)
 		if err != nil {
 			rlog.WithError(err).Errorf("Error 4770: sqlQuery `%s`", sqlQuery)
-			http.Error(w, "Error 4770", http.StatusInternalServerError)
+			http.Error(w, "Error 4770", databaseErrorStatus(w, err))
 			return
 		}
 
 		w.WriteHeader(http.StatusNoContent)
 	}
 
+	// findByExternalIndex returns the identifiers of the item which has the same value of the external index
+	// name as the insert values of a create, or nil if there is none
+	findByExternalIndex := func(ctx context.Context, values []interface{}, name string) (map[string]string, error) {
+		var value interface{}
+		for i := propertiesIndex + 1; i < len(columns); i++ {
+			if columns[i] == name {
+				value = values[i]
+			}
+		}
+		sqlQuery := fmt.Sprintf("SELECT %s FROM %s.\"%s\" WHERE %s = $1", strings.Join(columns[:propertiesIndex], ", "), schema, resource, name)
+		if rc.ExternalIndexCaseInsensitive {
+			sqlQuery = fmt.Sprintf("SELECT %s FROM %s.\"%s\" WHERE lower(%s) = lower($1)", strings.Join(columns[:propertiesIndex], ", "), schema, resource, name)
+		}
+		queryParameters := []interface{}{value}
+		if rc.ExternalIndexPerParent {
+			for i := ownerIndex; i < propertiesIndex; i++ {
+				queryParameters = append(queryParameters, values[i])
+				sqlQuery += fmt.Sprintf(" AND %s = $%d", columns[i], len(queryParameters))
+			}
+		}
+		identifiers := make([]uuid.UUID, propertiesIndex)
+		scanValues := make([]interface{}, propertiesIndex)
+		for i := range identifiers {
+			scanValues[i] = &identifiers[i]
+		}
+		err := b.db.QueryRowContext(ctx, sqlQuery+";", queryParameters...).Scan(scanValues...)
+		if err == csql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		existing := map[string]string{}
+		for i := range identifiers {
+			existing[columns[i]] = identifiers[i].String()
+		}
+		return existing, nil
+	}
+
 	create := func(w http.ResponseWriter, r *http.Request, bodyJSON map[string]interface{}) {
 		var err error
 
@@ -1235,16 +2311,31 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		calledFromUpsert := bodyJSON != nil
 
 		// low-key features for the backup/restore tool
-		var silent, force bool
+		var force bool
 		if calledFromUpsert {
-			if s := r.URL.Query().Get("silent"); s != "" {
-				silent, _ = strconv.ParseBool(s)
-			}
 			if s := r.URL.Query().Get("force"); s != "" {
 				force, _ = strconv.ParseBool(s)
 			}
 		}
 
+		// with on_conflict=return_existing, a create which conflicts with the external index of an existing
+		// item returns that item instead of 409 (Conflict)
+		returnExisting := false
+		if !calledFromUpsert {
+			switch onConflict := r.URL.Query().Get("on_conflict"); onConflict {
+			case "":
+			case "return_existing":
+				if len(externalIndices) == 0 || singleton {
+					http.Error(w, "parameter 'on_conflict': "+this+" has no external index", http.StatusBadRequest)
+					return
+				}
+				returnExisting = true
+			default:
+				http.Error(w, "parameter 'on_conflict': unknown value '"+onConflict+"'", http.StatusBadRequest)
+				return
+			}
+		}
+
 		params := mux.Vars(r)
 		selectors := map[string]string{}
 		for i := ownerIndex; i < propertiesIndex; i++ { // skip ID
@@ -1266,6 +2357,11 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 				http.Error(w, "invalid json data: "+err.Error(), http.StatusBadRequest)
 				return
 			}
+			if err = coerceProperties(bodyJSON, rc.Coerce); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			b.stripComputedProperties(resource, bodyJSON)
 		}
 
 		// build insert query and validate that we have all parameters
@@ -1275,7 +2371,7 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		if !calledFromUpsert {
 			// the primary resource identifier, always create a new one unless we are called
 			// from upsert.
-			primaryID := uuid.New()
+			primaryID := newPrimaryID(rc.IDVersion)
 			// update the bodyJSON so we can validate
 			bodyJSON[columns[0]] = primaryID
 			values[0] = primaryID
@@ -1311,25 +2407,33 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			}
 		}
 
-		if rc.Default != nil {
-			var defaultJSON map[string]interface{}
-			json.Unmarshal(rc.Default, &defaultJSON)
+		if rc.Default != nil || len(defaultTemplates) > 0 || len(roleDefaults) > 0 {
+			defaultJSON := map[string]interface{}{}
+			if rc.Default != nil {
+				json.Unmarshal(rc.Default, &defaultJSON)
+			}
+			resolveDefaultTemplates(r.Context(), defaultTemplates, defaultJSON)
+			applyRoleDefaults(r.Context(), roleDefaults, defaultJSON)
 			patchObject(defaultJSON, bodyJSON)
 			bodyJSON = defaultJSON
 		}
 
 		jsonData, _ := json.MarshalWithOption(bodyJSON, json.DisableHTMLEscape())
 
-		validateSchema := rc.SchemaID != "" && !force
+		validateSchema := createSchemaID != "" && !force
 
 		if validateSchema {
-			if !b.JsonValidator.HasSchema(rc.SchemaID) {
-				rlog.Errorf("ERROR: invalid configuration for resource %s, schemaID %s is unknown. Validation is deactivated for this resource", rc.Resource, rc.SchemaID)
-			} else if err := b.JsonValidator.ValidateString(string(jsonData), rc.SchemaID); err != nil {
+			if !b.JsonValidator.HasSchema(createSchemaID) && b.strictSchemas {
+				rlog.Errorf("Error 4809: invalid configuration for resource %s, schemaID %s is unknown", rc.Resource, createSchemaID)
+				http.Error(w, "Error 4809", http.StatusInternalServerError)
+				return
+			} else if !b.JsonValidator.HasSchema(createSchemaID) {
+				rlog.Errorf("ERROR: invalid configuration for resource %s, schemaID %s is unknown. Validation is deactivated for this resource", rc.Resource, createSchemaID)
+			} else if err := b.JsonValidator.ValidateString(string(jsonData), createSchemaID); err != nil {
 				rlog.WithError(err).Errorf("properties '%v' field does not follow schemaID %s",
-					string(jsonData), rc.SchemaID)
+					string(jsonData), createSchemaID)
 				http.Error(w, fmt.Sprintf("document '%v' field does not follow schemaID %s, %v",
-					string(jsonData), rc.SchemaID, err), http.StatusBadRequest)
+					string(jsonData), createSchemaID, err), http.StatusBadRequest)
 				return
 			}
 		}
@@ -1382,6 +2486,17 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			}
 			extract[key] = value
 		}
+		if unknown := unknownProperties(extract); !force && len(unknown) > 0 {
+			http.Error(w, "unknown properties: "+strings.Join(unknown, ", "), http.StatusBadRequest)
+			return
+		}
+		if len(rc.EncryptedProperties) > 0 {
+			if err = b.encryptProperties(resource, rc.EncryptedProperties, extract); err != nil {
+				rlog.WithError(err).Errorf("Error 4820: cannot encrypt properties")
+				http.Error(w, "Error 4820", http.StatusInternalServerError)
+				return
+			}
+		}
 
 		propertiesJSON, _ := json.MarshalWithOption(extract, json.DisableHTMLEscape())
 		values[i] = propertiesJSON
@@ -1410,29 +2525,69 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 				timestamp = t.UTC()
 			}
 		}
+		timestamp = b.truncateTimestamp(timestamp)
 		values[i] = &timestamp
 		i++
 
 		tx, err := b.db.BeginTx(r.Context(), nil)
+		if err == nil {
+			if err = b.setActor(r.Context(), tx); err != nil {
+				tx.Rollback()
+			}
+		}
 		if err != nil {
 			rlog.WithError(err).Errorf("Error 4733: BeginTx")
-			http.Error(w, "Error 4733", http.StatusInternalServerError)
+			http.Error(w, "Error 4733", databaseErrorStatus(w, err))
 			return
 		}
 		var id uuid.UUID
-		err = tx.QueryRow(insertQuery, values...).Scan(&id)
+		err = tx.QueryRowContext(r.Context(), insertQuery, values...).Scan(&id)
 		if err == csql.ErrNoRows {
 			tx.Rollback()
 			http.Error(w, "singleton "+this+" already exists", http.StatusUnprocessableEntity)
 			return
+		} else if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" && returnExisting && externalIndexByConstraint[pqErr.Constraint] != "" {
+			tx.Rollback()
+			existing, err := findByExternalIndex(r.Context(), values, externalIndexByConstraint[pqErr.Constraint])
+			if err != nil {
+				rlog.WithError(err).Errorf("Error 4813: cannot find existing %s", this)
+				http.Error(w, "Error 4813", databaseErrorStatus(w, err))
+				return
+			}
+			if existing == nil {
+				// the conflicting item was deleted in the meantime
+				http.Error(w, conflictMessage(pqErr), http.StatusConflict)
+				return
+			}
+			if b.authorizationEnabled {
+				auth := access.AuthorizationFromContext(r.Context())
+				if !auth.IsAuthorized(resources, core.OperationRead, existing, rc.Permits) {
+					http.Error(w, conflictMessage(pqErr), http.StatusConflict)
+					return
+				}
+			}
+			req := mux.SetURLVars(r.Clone(r.Context()), existing)
+			req.Method = http.MethodGet
+			req.URL.RawQuery = ""
+			read(w, req, nil)
+			return
+		} else if message, ok := checkViolation(err, checkMessages); ok {
+			tx.Rollback()
+			http.Error(w, message, http.StatusUnprocessableEntity)
+			return
 		} else if err != nil {
 			status := http.StatusInternalServerError
 			msg := "Error 4734"
-			if err, ok := err.(*pq.Error); ok && (err.Code == "23505" || err.Code == "23502" || err.Code == "23503") {
-				if err.Code == "23505" {
+			if err, ok := err.(*pq.Error); ok && (err.Code == "23505" || err.Code == "23502" || err.Code == "23503" || err.Code == "22P02") {
+				if err.Code == "22P02" {
+					// a property cannot be converted into the type of its generated column
+					status = http.StatusBadRequest
+					msg = "invalid property value"
+					rlog.WithError(err).Infof("Invalid text representation: QueryRow query: `%s`", insertQuery)
+				} else if err.Code == "23505" {
 					// Non unique external keys are reported as code Code 23505
 					status = http.StatusConflict
-					msg = "constraint violation"
+					msg = conflictMessage(err)
 					rlog.WithError(err).Infof("Constraint violation: QueryRow query: `%s`", insertQuery)
 				} else if err.Code == "23502" {
 					// Not null constraints are reported as Code 23502
@@ -1454,7 +2609,7 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 
 		// re-read data and return as json
 		values, object := createScanValuesAndObject(&timestamp, new(int))
-		err = tx.QueryRow(readQuery+"WHERE "+primary+"_id = $1;", id).Scan(values...)
+		err = tx.QueryRowContext(r.Context(), readQuery+"WHERE "+primary+"_id = $1;", id).Scan(values...)
 		if err != nil {
 			tx.Rollback()
 			rlog.WithError(err).Errorf("Error 4735: re-read object")
@@ -1487,14 +2642,10 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		mergeProperties(object)
 		jsonData, _ = json.MarshalWithOption(object, json.DisableHTMLEscape())
 
-		if silent {
-			err = tx.Commit()
-		} else {
-			err = b.commitWithNotification(r.Context(), tx, resource, core.OperationCreate, id, jsonData)
-		}
+		err = b.commitWithNotification(notificationContext(r), tx, resource, core.OperationCreate, id, jsonData)
 		if err != nil {
 			rlog.WithError(err).Error("Error 4737: commitWithNotification")
-			http.Error(w, "Error 4737", http.StatusInternalServerError)
+			http.Error(w, "Error 4737", databaseErrorStatus(w, err))
 			return
 		}
 
@@ -1522,16 +2673,26 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		create(w, r, nil)
 	}
 
-	upsertWithAuth := func(w http.ResponseWriter, r *http.Request) {
+	// identifiersAndRevision are the properties which an update with return=changed always returns
+	identifiersAndRevision := append([]string{}, columns[:propertiesIndex]...)
+	if !rc.NoRevision {
+		identifiersAndRevision = append(identifiersAndRevision, "revision")
+	}
+
+	// upsertWithModifier upserts like upsertWithAuth. For PATCH requests, modify is called with the patched
+	// object while the object is locked, before it is written
+	upsertWithModifier := func(w http.ResponseWriter, r *http.Request, modify func(objectJSON map[string]interface{}) error) {
 		var err error
 
+		if rc.Immutable {
+			http.Error(w, this+" is immutable", http.StatusMethodNotAllowed)
+			return
+		}
+
 		rlog := logger.FromContext(r.Context())
 
 		// low-key features for the backup/restore tool
-		var silent, force bool
-		if s := r.URL.Query().Get("silent"); s != "" {
-			silent, _ = strconv.ParseBool(s)
-		}
+		var force bool
 		if s := r.URL.Query().Get("force"); s != "" {
 			force, _ = strconv.ParseBool(s)
 		}
@@ -1557,6 +2718,11 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			http.Error(w, "invalid json data: "+err.Error(), http.StatusBadRequest)
 			return
 		}
+		if err = coerceProperties(bodyJSON, rc.Coerce); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b.stripComputedProperties(resource, bodyJSON)
 
 		// primary id can come from parameter (fully qualified put) or from body json (collection put).
 		primaryID := params[columns[0]]
@@ -1591,18 +2757,23 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		}
 
 		tx, err := b.db.BeginTx(r.Context(), nil)
+		if err == nil {
+			if err = b.setActor(r.Context(), tx); err != nil {
+				tx.Rollback()
+			}
+		}
 		if err != nil {
 			rlog.WithError(err).Errorf("Error 4736: Update of resource `%s`", resource)
-			http.Error(w, "Error 4736", http.StatusInternalServerError)
+			http.Error(w, "Error 4736", databaseErrorStatus(w, err))
 			return
 		}
 
 		var timestamp time.Time
 		var currentRevision int
-		retried := false
+		retries := 0
 	Retry:
 		current, object := createScanValuesAndObject(&timestamp, &currentRevision)
-		err = tx.QueryRow(readQuery+"WHERE "+primary+"_id = $1 FOR UPDATE;", &primaryID).Scan(current...)
+		err = tx.QueryRowContext(r.Context(), readQuery+"WHERE "+primary+"_id = $1 FOR UPDATE;", &primaryID).Scan(current...)
 		if err == csql.ErrNoRows {
 			// item does not exist yet.
 			if singleton {
@@ -1622,8 +2793,21 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 				}
 			}
 
+			createJSON := bodyJSON
+			if modify != nil {
+				// modify a copy, the body may be needed again after a retry
+				createJSON = make(map[string]interface{}, len(bodyJSON))
+				for key, value := range bodyJSON {
+					createJSON[key] = value
+				}
+				if err := modify(createJSON); err != nil {
+					tx.Rollback()
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
 			rec := httptest.NewRecorder()
-			create(rec, r, bodyJSON)
+			create(rec, r, createJSON)
 			if rec.Code == http.StatusCreated {
 				// all is good, we are done, we can rollback this transaction
 				tx.Rollback()
@@ -1631,10 +2815,17 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 				w.WriteHeader(http.StatusCreated)
 				w.Write(rec.Body.Bytes())
 				return
-			} else if rec.Code == http.StatusUnprocessableEntity && !retried {
-				// race condition: somebody else has create the object right now
-				retried = true
-				goto Retry
+			} else if rec.Code == http.StatusUnprocessableEntity && singleton {
+				// race condition: somebody else has created the singleton right now
+				if retries < maxUpsertRetries {
+					retries++
+					time.Sleep(time.Duration(retries*10+rand.Intn(10)) * time.Millisecond)
+					goto Retry
+				}
+				tx.Rollback()
+				w.Header().Set("Retry-After", contentionRetryAfter())
+				http.Error(w, "too much contention on "+this, http.StatusTooManyRequests)
+				return
 			}
 			err = tx.Rollback()
 			http.Error(w, rec.Body.String(), rec.Code)
@@ -1646,7 +2837,7 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			http.Error(w, "Error 4737", http.StatusInternalServerError)
 			return
 		}
-		if revision != 0 && revision != currentRevision {
+		if revision != 0 && revision != currentRevision && !rc.NoRevision {
 			tx.Rollback()
 			// revision does not match, return conflict status with the conflicting object
 			mergeProperties(object)
@@ -1658,19 +2849,71 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 		}
 		mergeProperties(object)
 
+		// the previous state of the object, returned on request for change tracking
+		var previous json.RawMessage
+		if returnPrevious(r) {
+			previous, _ = json.MarshalWithOption(object, json.DisableHTMLEscape())
+		}
+		// the state before the update, to return only the changed properties on request
+		var before []byte
+		if returnChanged(r) {
+			before, _ = json.MarshalWithOption(object, json.DisableHTMLEscape())
+		}
+
 		primaryUUID := *current[0].(*uuid.UUID)
 		primaryID = primaryUUID.String()
 
+		// immutable properties which are set must not change. A PUT which omits them keeps them
+		if len(immutableProperties) > 0 {
+			stored, _ := json.MarshalWithOption(object, json.DisableHTMLEscape())
+			var storedJSON map[string]interface{}
+			json.Unmarshal(stored, &storedJSON)
+			for _, property := range rc.ImmutableProperties {
+				currentValue, ok := storedJSON[property]
+				if !ok || currentValue == nil || currentValue == "" {
+					continue
+				}
+				requestedValue, ok := bodyJSON[property]
+				if !ok {
+					if r.Method != http.MethodPatch {
+						bodyJSON[property] = currentValue
+					}
+					continue
+				}
+				currentData, _ := json.Marshal(currentValue)
+				requestedData, _ := json.Marshal(requestedValue)
+				if !bytes.Equal(currentData, requestedData) {
+					tx.Rollback()
+					http.Error(w, "property '"+property+"' of "+this+" is immutable", http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
 		// for MethodPatch we get the existing object from the database and patch property by property
+		unchanged := false
 		if r.Method == http.MethodPatch {
 
 			// convert object into generic json for patching (the datatypes are different compared to the database) in the database)
 			body, _ := json.MarshalWithOption(object, json.DisableHTMLEscape())
 			var objectJSON map[string]interface{}
 			json.Unmarshal(body, &objectJSON)
+			before, _ := json.MarshalWithOption(objectJSON, json.DisableHTMLEscape())
 
 			// now bodyJSON from the request becomes a patch
 			patchObject(objectJSON, bodyJSON)
+			if modify != nil {
+				if err := modify(objectJSON); err != nil {
+					tx.Rollback()
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+
+			// a patch which does not change anything is not written. Companion files are excluded,
+			// because their clients patch to obtain a new upload URL
+			after, _ := json.MarshalWithOption(objectJSON, json.DisableHTMLEscape())
+			unchanged = bytes.Equal(before, after) && !rc.WithCompanionFile
 
 			// rewrite this put request to contain the entire (patched) object
 			bodyJSON = objectJSON
@@ -1719,17 +2962,51 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			bodyJSON[k] = values[i]
 		}
 
+		if unchanged {
+			// no-op patch: keep the revision and do not notify, return the current object
+			tx.Rollback()
+			if rc.Default != nil {
+				var defaultJSON map[string]interface{}
+				json.Unmarshal(rc.Default, &defaultJSON)
+				patchObject(defaultJSON, object)
+				object = defaultJSON
+			}
+			if previous != nil {
+				object["previous"] = previous
+			}
+			jsonData, _ := json.MarshalWithOption(object, json.DisableHTMLEscape())
+			if before != nil {
+				jsonData = changedProperties(jsonData, jsonData, identifiersAndRevision)
+			}
+			// the Etag reflects the bytes which are actually returned
+			etag := bytesToEtag(jsonData)
+			w.Header().Set("Etag", etag)
+			if ifNoneMatchFound(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			w.Write(jsonData)
+			return
+		}
+
 		jsonData, _ := json.MarshalWithOption(bodyJSON, json.DisableHTMLEscape())
-		validateSchema := rc.SchemaID != "" && !force
+		validateSchema := updateSchemaID != "" && !force
 		if validateSchema {
-			if !b.JsonValidator.HasSchema(rc.SchemaID) {
-				rlog.Errorf("ERROR: invalid configuration for resource %s, schemaID %s is unknown. Validation is deactivated for this resource", rc.Resource, rc.SchemaID)
-			} else if err := b.JsonValidator.ValidateString(string(jsonData), rc.SchemaID); err != nil {
+			if !b.JsonValidator.HasSchema(updateSchemaID) && b.strictSchemas {
+				tx.Rollback()
+				rlog.Errorf("Error 4810: invalid configuration for resource %s, schemaID %s is unknown", rc.Resource, updateSchemaID)
+				http.Error(w, "Error 4810", http.StatusInternalServerError)
+				return
+			} else if !b.JsonValidator.HasSchema(updateSchemaID) {
+				rlog.Errorf("ERROR: invalid configuration for resource %s, schemaID %s is unknown. Validation is deactivated for this resource", rc.Resource, updateSchemaID)
+			} else if err := b.JsonValidator.ValidateString(string(jsonData), updateSchemaID); err != nil {
 				tx.Rollback()
 				rlog.WithError(err).Errorf("properties '%v' field does not follow schemaID %s",
-					string(jsonData), rc.SchemaID)
+					string(jsonData), updateSchemaID)
 				http.Error(w, fmt.Sprintf("document '%v' field does not follow schemaID %s, %v",
-					string(jsonData), rc.SchemaID, err), http.StatusBadRequest)
+					string(jsonData), updateSchemaID, err), http.StatusBadRequest)
 				return
 			}
 		}
@@ -1771,6 +3048,19 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			}
 			extract[key] = value
 		}
+		if unknown := unknownProperties(extract); !force && len(unknown) > 0 {
+			tx.Rollback()
+			http.Error(w, "unknown properties: "+strings.Join(unknown, ", "), http.StatusBadRequest)
+			return
+		}
+		if len(rc.EncryptedProperties) > 0 {
+			if err = b.encryptProperties(resource, rc.EncryptedProperties, extract); err != nil {
+				tx.Rollback()
+				rlog.WithError(err).Errorf("Error 4821: cannot encrypt properties")
+				http.Error(w, "Error 4821", http.StatusInternalServerError)
+				return
+			}
+		}
 
 		propertiesJSON, _ := json.MarshalWithOption(extract, json.DisableHTMLEscape())
 		values[i] = propertiesJSON
@@ -1795,16 +3085,32 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 				return
 			}
 			if !t.IsZero() {
-				timestamp = t.UTC()
+				timestamp = b.truncateTimestamp(t.UTC())
 			}
 		}
 		values[i] = timestamp
 		i++
 
-		err = tx.QueryRow(updateQuery, values...).Scan(&primaryID)
+		err = tx.QueryRowContext(r.Context(), updateQuery, values...).Scan(&primaryID)
 		if err == csql.ErrNoRows {
 			tx.Rollback()
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, "update failed, no such "+this, http.StatusBadRequest)
+			return
+		} else if err, ok := err.(*pq.Error); ok && err.Code == "22P02" {
+			// a property cannot be converted into the type of its generated column
+			tx.Rollback()
+			rlog.WithError(err).Infof("Invalid text representation: update object")
+			http.Error(w, "invalid property value", http.StatusBadRequest)
+			return
+		} else if ok && err.Code == "23505" {
+			// Non unique external keys are reported as code Code 23505
+			tx.Rollback()
+			rlog.WithError(err).Infof("Constraint violation: update object")
+			http.Error(w, conflictMessage(err), http.StatusConflict)
+			return
+		} else if message, ok := checkViolation(err, checkMessages); ok {
+			tx.Rollback()
+			http.Error(w, message, http.StatusUnprocessableEntity)
 			return
 		} else if err != nil {
 			tx.Rollback()
@@ -1815,7 +3121,7 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 
 		// re-read new values and return as json
 		values, response := createScanValuesAndObject(&timestamp, &revision)
-		err = tx.QueryRow(readQuery+"WHERE "+primary+"_id = $1;", &primaryID).Scan(values...)
+		err = tx.QueryRowContext(r.Context(), readQuery+"WHERE "+primary+"_id = $1;", &primaryID).Scan(values...)
 		if err != nil {
 			tx.Rollback()
 			rlog.WithError(err).Errorf("Error 4740: re-read object")
@@ -1847,116 +3153,806 @@ func (b *Backend) createCollectionResource(router *mux.Router, rc collectionConf
 			}
 		}
 
-		if silent {
-			err = tx.Commit()
-		} else {
-			err = b.commitWithNotification(r.Context(), tx, resource, core.OperationUpdate, *values[0].(*uuid.UUID), jsonData)
-		}
+		err = b.commitWithNotification(notificationContext(r), tx, resource, core.OperationUpdate, *values[0].(*uuid.UUID), jsonData)
 		if err != nil {
 			rlog.WithError(err).Errorf("Error 4739: commitWithNotification")
-			http.Error(w, "Error 4739", http.StatusInternalServerError)
+			http.Error(w, "Error 4739", databaseErrorStatus(w, err))
 			return
 		}
 
 		// We add companion_upload_url after inserting in the database if needed
 		if uploadURL != "" {
 			response["companion_upload_url"] = uploadURL
+		}
+		if previous != nil {
+			response["previous"] = previous
+		}
+		if uploadURL != "" || previous != nil {
 			jsonData, _ = json.MarshalWithOption(response, json.DisableHTMLEscape())
 		}
+		if before != nil {
+			jsonData = changedProperties(before, jsonData, identifiersAndRevision)
+		}
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
 		w.Write(jsonData)
 	}
 
+	upsertWithAuth := func(w http.ResponseWriter, r *http.Request) {
+		upsertWithModifier(w, r, nil)
+	}
+
+	// appendWithAuth appends the elements of the JSON array in the request body to an array property. It
+	// is a patch of the object, hence it locks the object, validates it and increases its revision like
+	// any other update.
+	appendWithAuth := func(w http.ResponseWriter, r *http.Request) {
+		property := mux.Vars(r)["property"]
+		for _, column := range columns {
+			if column == property {
+				http.Error(w, "cannot append to "+property+", it is not a dynamic property", http.StatusBadRequest)
+				return
+			}
+		}
+		if immutableProperties[property] {
+			http.Error(w, "property '"+property+"' of "+this+" is immutable", http.StatusBadRequest)
+			return
+		}
+		var elements []interface{}
+		if err := json.NewDecoder(r.Body).Decode(&elements); err != nil {
+			http.Error(w, "invalid json array: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		unique, _ := strconv.ParseBool(r.URL.Query().Get("unique"))
+
+		// the request becomes an empty patch, optionally with the expected revision
+		patch := map[string]interface{}{}
+		if value := r.URL.Query().Get("revision"); value != "" {
+			revision, err := strconv.Atoi(value)
+			if err != nil || revision < 0 {
+				http.Error(w, "parameter 'revision': invalid value", http.StatusBadRequest)
+				return
+			}
+			patch["revision"] = revision
+		}
+		body, _ := json.Marshal(patch)
+		req := r.Clone(r.Context())
+		req.Method = http.MethodPatch
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.Header.Del("Content-Encoding")
+		req.Header.Del("Kurbisio-Content-Encoding")
+		upsertWithModifier(w, req, func(objectJSON map[string]interface{}) error {
+			return appendToArray(objectJSON, property, elements, unique)
+		})
+	}
+
+	// available checks whether a value of the external index is still available, without exposing any
+	// other data. Whoever may create or list resources may check, because they could find out anyway.
+	available := func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.IsAuthorized(resources, core.OperationCreate, params, rc.Permits) &&
+				!auth.IsAuthorized(resources, core.OperationList, params, rc.Permits) {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		urlQuery := r.URL.Query()
+		var name string
+		for key := range urlQuery {
+			if !stringlist(externalIndices).contains(key) {
+				http.Error(w, "parameter '"+key+"': unknown query parameter", http.StatusBadRequest)
+				return
+			}
+			if name != "" {
+				http.Error(w, "parameter '"+key+"': only one external index can be checked at a time", http.StatusBadRequest)
+				return
+			}
+			name = key
+		}
+		value := urlQuery.Get(name)
+		if value == "" {
+			http.Error(w, "missing parameter '"+strings.Join(externalIndices, "' or '")+"'", http.StatusBadRequest)
+			return
+		}
+
+		// the external index is either unique in the entire collection, or for the same parent
+		sqlQuery := fmt.Sprintf("SELECT NOT EXISTS (SELECT 1 FROM %s.\"%s\" WHERE %s = $1", schema, resource, name)
+		if rc.ExternalIndexCaseInsensitive {
+			sqlQuery = fmt.Sprintf("SELECT NOT EXISTS (SELECT 1 FROM %s.\"%s\" WHERE lower(%s) = lower($1)", schema, resource, name)
+		}
+		queryParameters := []interface{}{value}
+		if rc.ExternalIndexPerParent {
+			sqlQuery += " AND " + compareIDsStringWithOffset(1, columns[ownerIndex:propertiesIndex])
+			for i := ownerIndex; i < propertiesIndex; i++ { // skip ID
+				queryParameters = append(queryParameters, params[columns[i]])
+			}
+		}
+		sqlQuery += ");"
+
+		var isAvailable bool
+		err := b.db.QueryRowContext(r.Context(), sqlQuery, queryParameters...).Scan(&isAvailable)
+		if err != nil {
+			logger.FromContext(r.Context()).WithError(err).Errorf("Error 4798: cannot execute query `%s`", sqlQuery)
+			http.Error(w, "Error 4798", databaseErrorStatus(w, err))
+			return
+		}
+		jsonData, _ := json.Marshal(map[string]bool{"available": isAvailable})
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(jsonData)
+	}
+
+	// changes returns the change feed of the collection: all items which were created, updated or deleted
+	// since the token of a previous request, in the order of their changes. Created and updated items are
+	// returned with their current state, deleted items as tombstones.
+	changes := func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		rlog := logger.FromContext(r.Context())
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.IsAuthorized(resources, core.OperationList, params, rc.Permits) {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		var since changeToken
+		sinceNow := false
+		limit := 100
+		locale := ""
+		urlQuery := r.URL.Query()
+		for key, array := range urlQuery {
+			if len(array) > 1 {
+				http.Error(w, "illegal parameter array '"+key+"'", http.StatusBadRequest)
+				return
+			}
+			var err error
+			switch key {
+			case "since":
+				if array[0] == "now" {
+					sinceNow = true
+					break
+				}
+				since, err = parseChangeToken(array[0])
+			case "limit":
+				limit, err = strconv.Atoi(array[0])
+				if err == nil && (limit < 1 || limit > maxChangesPerRequest) {
+					err = fmt.Errorf("out of range")
+				}
+			case "locale":
+				locale = array[0]
+			default:
+				err = fmt.Errorf("unknown")
+			}
+			if err != nil {
+				http.Error(w, "parameter '"+key+"': "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if rc.ChangesRetentionDays > 0 && !sinceNow {
+			horizon, err := b.changesHorizon(resource)
+			if err != nil {
+				rlog.WithError(err).Errorf("Error 4806: cannot read changes horizon")
+				http.Error(w, "Error 4806", http.StatusInternalServerError)
+				return
+			}
+			if since.before(horizon) {
+				http.Error(w, "parameter 'since': token expired, changes were pruned", http.StatusGone)
+				return
+			}
+		}
+
+		// only changes of transactions older than all running transactions are final. Later changes are
+		// held back, they are returned by a subsequent request once they are final.
+		queryParameters := []interface{}{}
+		for i := ownerIndex; i < propertiesIndex; i++ { // skip ID
+			queryParameters = append(queryParameters, params[columns[i]])
+		}
+		sqlQuery := fmt.Sprintf("SELECT xid, sequence, operation, %s FROM %s.\"%s/changes\" WHERE ", columns[0], schema, resource)
+		if propertiesIndex > ownerIndex {
+			sqlQuery += compareIDsString(columns[ownerIndex:propertiesIndex]) + " AND "
+		}
+		n := len(queryParameters)
+
+		// since=now returns no changes, but the token of the latest final change
+		if sinceNow {
+			sqlQuery := fmt.Sprintf("SELECT xid, sequence FROM %s.\"%s/changes\" WHERE xid < txid_snapshot_xmin(txid_current_snapshot()) ORDER BY xid DESC, sequence DESC LIMIT 1;",
+				schema, resource)
+			err := b.db.QueryRowContext(r.Context(), sqlQuery).Scan(&since.xid, &since.sequence)
+			if err != nil && err != csql.ErrNoRows {
+				rlog.WithError(err).Errorf("Error 4807: cannot execute query `%s`", sqlQuery)
+				http.Error(w, "Error 4807", databaseErrorStatus(w, err))
+				return
+			}
+			jsonData, _ := json.Marshal(ChangesResponse{Changes: []Change{}, Next: since.String()})
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write(jsonData)
+			return
+		}
+		sqlQuery += fmt.Sprintf("(xid, sequence) > ($%d, $%d) AND xid < txid_snapshot_xmin(txid_current_snapshot()) ORDER BY xid, sequence LIMIT $%d;",
+			n+1, n+2, n+3)
+		queryParameters = append(queryParameters, since.xid, since.sequence, limit)
+
+		rows, err := b.db.QueryContext(r.Context(), sqlQuery, queryParameters...)
+		if err != nil {
+			rlog.WithError(err).Errorf("Error 4800: cannot execute query `%s` %+v", sqlQuery, queryParameters)
+			http.Error(w, "Error 4800", databaseErrorStatus(w, err))
+			return
+		}
+		defer rows.Close()
+		var all []Change
+		next := since
+		for rows.Next() {
+			var c Change
+			if err := rows.Scan(&next.xid, &next.sequence, &c.Operation, &c.ID); err != nil {
+				rlog.WithError(err).Errorf("Error 4801: cannot scan values")
+				http.Error(w, "Error 4801", http.StatusInternalServerError)
+				return
+			}
+			all = append(all, c)
+		}
+		rows.Close()
+
+		// an item which changed several times is only reported with its last change
+		var order []Change
+		reported := map[uuid.UUID]bool{}
+		for i := len(all) - 1; i >= 0; i-- {
+			if !reported[all[i].ID] {
+				reported[all[i].ID] = true
+				order = append([]Change{all[i]}, order...)
+			}
+		}
+
+		var ids []string
+		for _, c := range order {
+			if c.Operation != string(core.OperationDelete) {
+				ids = append(ids, c.ID.String())
+			}
+		}
+		objects := map[string]map[string]interface{}{}
+		if len(ids) > 0 {
+			readParameters := append(queryParameters[:propertiesIndex-ownerIndex:propertiesIndex-ownerIndex], pq.Array(ids))
+			rows, err := b.db.QueryContext(r.Context(), readQuery+sqlWhereIDs, readParameters...)
+			if err != nil {
+				rlog.WithError(err).Errorf("Error 4802: cannot execute query `%s` %+v", readQuery+sqlWhereIDs, readParameters)
+				http.Error(w, "Error 4802", databaseErrorStatus(w, err))
+				return
+			}
+			defer rows.Close()
+			for rows.Next() {
+				values, object := createScanValuesAndObject(&time.Time{}, new(int))
+				if err := rows.Scan(values...); err != nil {
+					rlog.WithError(err).Errorf("Error 4803: cannot scan values")
+					http.Error(w, "Error 4803", http.StatusInternalServerError)
+					return
+				}
+				mergeProperties(object)
+				// apply defaults if applicable
+				if rc.Default != nil {
+					var defaultJSON map[string]interface{}
+					json.Unmarshal(rc.Default, &defaultJSON)
+					patchObject(defaultJSON, object)
+					object = defaultJSON
+				}
+				localizeObject(object, locale)
+				b.computeProperties(resource, object)
+				objects[values[0].(*uuid.UUID).String()] = object
+			}
+		}
+
+		selectors := map[string]string{}
+		for i := ownerIndex; i < propertiesIndex; i++ { // skip ID
+			selectors[columns[i]] = params[columns[i]]
+		}
+		response := ChangesResponse{Changes: []Change{}, Next: next.String(), More: len(all) == limit}
+		for _, c := range order {
+			if c.Operation == string(core.OperationDelete) {
+				response.Changes = append(response.Changes, c)
+				continue
+			}
+			object, ok := objects[c.ID.String()]
+			if !ok {
+				// the item was deleted by a later change, which is not final yet or beyond the limit
+				continue
+			}
+			// the items are read, so we do the read request interceptors
+			jsonData, _ := json.MarshalWithOption(object, json.DisableHTMLEscape())
+			data, err := b.intercept(r.Context(), resource, core.OperationRead, c.ID, selectors, nil, jsonData)
+			if err != nil {
+				rlog.WithError(err).Errorf("Error 4804: interceptor")
+				http.Error(w, "Error 4804", http.StatusInternalServerError)
+				return
+			}
+			if data != nil {
+				jsonData = data
+			}
+			c.Item = jsonData
+			response.Changes = append(response.Changes, c)
+		}
+
+		jsonData, _ := json.MarshalWithOption(response, json.DisableHTMLEscape())
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(jsonData)
+	}
+
+	// history returns the recorded changes of a single item in chronological order, together with the
+	// identity which made them. Only the latest maxChangesPerRequest changes are returned.
+	history := func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		rlog := logger.FromContext(r.Context())
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.IsAuthorized(resources, core.OperationRead, params, rc.Permits) {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if len(r.URL.Query()) > 0 {
+			http.Error(w, "history takes no parameters", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(params[columns[0]])
+		if err != nil {
+			http.Error(w, "invalid "+columns[0], http.StatusBadRequest)
+			return
+		}
+		queryParameters := []interface{}{id}
+		for i := ownerIndex; i < propertiesIndex; i++ { // skip ID
+			queryParameters = append(queryParameters, params[columns[i]])
+		}
+		sqlQuery := fmt.Sprintf("SELECT operation, timestamp, actor FROM %s.\"%s/changes\" WHERE %s=$1", schema, resource, columns[0])
+		if propertiesIndex > ownerIndex {
+			sqlQuery += " AND " + compareIDsStringWithOffset(1, columns[ownerIndex:propertiesIndex])
+		}
+		sqlQuery += fmt.Sprintf(" ORDER BY sequence DESC LIMIT %d;", maxChangesPerRequest)
+
+		rows, err := b.db.QueryContext(r.Context(), sqlQuery, queryParameters...)
+		if err != nil {
+			rlog.WithError(err).Errorf("Error 4811: cannot execute query `%s` %+v", sqlQuery, queryParameters)
+			http.Error(w, "Error 4811", databaseErrorStatus(w, err))
+			return
+		}
+		defer rows.Close()
+		response := []HistoryEntry{}
+		for rows.Next() {
+			var entry HistoryEntry
+			var actor *string
+			if err := rows.Scan(&entry.Operation, &entry.Timestamp, &actor); err != nil {
+				rlog.WithError(err).Errorf("Error 4812: cannot scan values")
+				http.Error(w, "Error 4812", http.StatusInternalServerError)
+				return
+			}
+			if actor != nil {
+				entry.Actor = *actor
+			}
+			entry.Timestamp = entry.Timestamp.UTC()
+			response = append([]HistoryEntry{entry}, response...)
+		}
+
+		jsonData, _ := json.MarshalWithOption(response, json.DisableHTMLEscape())
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(jsonData)
+	}
+
+	// export streams all resources of the collection as a zip archive with one JSON file per resource.
+	// The archive is written while the rows are read, so memory stays bounded for large collections.
+	export := func(w http.ResponseWriter, r *http.Request) {
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.HasRole("admin") {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		rlog := logger.FromContext(r.Context())
+		params := mux.Vars(r)
+		queryParameters := []interface{}{}
+		for i := ownerIndex; i < propertiesIndex; i++ { // skip ID
+			queryParameters = append(queryParameters, params[columns[i]])
+		}
+		queryParameters = append(queryParameters, true, time.Time{}, true, time.Time{})
+
+		sqlQuery := readQuery + sqlWhereAll + "ORDER BY timestamp ASC, " + columns[0] + " ASC;"
+		rows, err := b.db.QueryContext(r.Context(), sqlQuery, queryParameters...)
+		if err != nil {
+			rlog.WithError(err).Errorf("Error 4793: cannot execute query `%s` %+v", sqlQuery, queryParameters)
+			http.Error(w, "Error 4793", databaseErrorStatus(w, err))
+			return
+		}
+		defer rows.Close()
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+core.Plural(this)+".zip\"")
+		archive := zip.NewWriter(w)
+		for rows.Next() {
+			values, object := createScanValuesAndObject(&time.Time{}, new(int))
+			if err = rows.Scan(values...); err != nil {
+				// the response has started already, a truncated archive tells the client that the export failed
+				rlog.WithError(err).Errorf("Error 4794: cannot scan values")
+				return
+			}
+			mergeProperties(object)
+			entry, err := archive.Create(values[0].(*uuid.UUID).String() + ".json")
+			if err != nil {
+				rlog.WithError(err).Errorf("Error 4795: cannot write export of %s", resource)
+				return
+			}
+			if err = json.NewEncoder(entry).EncodeWithOption(object, json.DisableHTMLEscape()); err != nil {
+				rlog.WithError(err).Errorf("Error 4795: cannot write export of %s", resource)
+				return
+			}
+		}
+		if err = rows.Err(); err != nil {
+			rlog.WithError(err).Errorf("Error 4794: cannot read rows")
+			return
+		}
+		if err = archive.Close(); err != nil {
+			rlog.WithError(err).Errorf("Error 4795: cannot write export of %s", resource)
+		}
+	}
+
+	// importItems upserts every item of an uploaded ndjson file or zip archive, as written by export. Each
+	// item is upserted like a single PUT request, the query parameters silent and force are passed on.
+	importItems := func(w http.ResponseWriter, r *http.Request) {
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.HasRole("admin") {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		rlog := logger.FromContext(r.Context())
+
+		// the body and, if it is compressed, the uncompressed data are limited to maxImportBytes
+		body := http.MaxBytesReader(w, r.Body, b.maxImportBytes)
+		if r.Header.Get("Content-Encoding") == "gzip" || r.Header.Get("Kurbisio-Content-Encoding") == "gzip" {
+			reader, err := gzip.NewReader(body)
+			if err != nil {
+				if importTooLarge(w, err, b.maxImportBytes) {
+					return
+				}
+				http.Error(w, "invalid gzipped data: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = http.MaxBytesReader(w, reader, b.maxImportBytes)
+		}
+
+		items := []json.RawMessage{}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/zip") {
+			// the zip directory is at the end of the archive, so it has to be read entirely
+			data, err := io.ReadAll(body)
+			if err != nil {
+				if importTooLarge(w, err, b.maxImportBytes) {
+					return
+				}
+				http.Error(w, "cannot read body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				http.Error(w, "invalid zip archive: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			total := int64(0)
+			for _, file := range archive.File {
+				if file.FileInfo().IsDir() {
+					continue
+				}
+				f, err := file.Open()
+				if err != nil {
+					http.Error(w, "invalid zip archive: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				item, err := io.ReadAll(io.LimitReader(f, b.maxImportItemBytes+1))
+				f.Close()
+				if err != nil {
+					http.Error(w, "invalid zip archive: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				if int64(len(item)) > b.maxImportItemBytes {
+					http.Error(w, fmt.Sprintf("item %s exceeds the maximum size of %d bytes", file.Name, b.maxImportItemBytes),
+						http.StatusRequestEntityTooLarge)
+					return
+				}
+				total += int64(len(item))
+				if total > b.maxImportBytes {
+					http.Error(w, fmt.Sprintf("import exceeds the maximum size of %d bytes", b.maxImportBytes),
+						http.StatusRequestEntityTooLarge)
+					return
+				}
+				items = append(items, item)
+			}
+		} else {
+			decoder := json.NewDecoder(body)
+			for {
+				var item json.RawMessage
+				err := decoder.Decode(&item)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					if importTooLarge(w, err, b.maxImportBytes) {
+						return
+					}
+					http.Error(w, fmt.Sprintf("invalid ndjson data after %d items: %s", len(items), err.Error()), http.StatusBadRequest)
+					return
+				}
+				if int64(len(item)) > b.maxImportItemBytes {
+					http.Error(w, fmt.Sprintf("item %d exceeds the maximum size of %d bytes", len(items), b.maxImportItemBytes),
+						http.StatusRequestEntityTooLarge)
+					return
+				}
+				items = append(items, item)
+			}
+		}
+
+		// with aggregated notifications, the items are upserted silently and the notifications are sent
+		// afterwards, one for all created and one for all updated items
+		aggregate := rc.AggregateBatchNotifications
+		if isSilent(r) {
+			aggregate = false
+		}
+		created := []string{}
+		updated := []string{}
+
+		params := mux.Vars(r)
+		response := ImportResponse{Failures: []ImportFailure{}}
+		for i, item := range items {
+			var meta map[string]interface{}
+			json.Unmarshal(item, &meta)
+			id, _ := meta[columns[0]].(string)
+
+			// every item gets its own request, since upsert adds the primary identifier to the route variables
+			vars := map[string]string{}
+			for key, value := range params {
+				vars[key] = value
+			}
+			req := mux.SetURLVars(r.Clone(r.Context()), vars)
+			req.Method = http.MethodPut
+			req.Header.Del("Content-Encoding")
+			req.Header.Del("Kurbisio-Content-Encoding")
+			req.Header.Set("Content-Type", "application/json")
+			req.Body = io.NopCloser(bytes.NewReader(item))
+			if aggregate {
+				query := req.URL.Query()
+				query.Set("silent", "true")
+				req.URL.RawQuery = query.Encode()
+			}
+
+			rec := httptest.NewRecorder()
+			upsertWithAuth(rec, req)
+			if rec.Code == http.StatusOK || rec.Code == http.StatusCreated {
+				response.Succeeded++
+				if rec.Code == http.StatusCreated {
+					created = append(created, id)
+				} else {
+					updated = append(updated, id)
+				}
+				continue
+			}
+			response.Failed++
+			response.Failures = append(response.Failures, ImportFailure{
+				Index:  i,
+				ID:     id,
+				Status: rec.Code,
+				Error:  strings.TrimSpace(rec.Body.String()),
+			})
+		}
+		rlog.Infof("imported %d %s, %d failed", response.Succeeded, core.Plural(this), response.Failed)
+
+		if aggregate {
+			notifications := []struct {
+				operation core.Operation
+				ids       []string
+			}{{core.OperationCreate, created}, {core.OperationUpdate, updated}}
+			for _, notification := range notifications {
+				if len(notification.ids) == 0 {
+					continue
+				}
+				payload, _ := json.Marshal(notification.ids)
+				tx, err := b.db.BeginTx(r.Context(), nil)
+				if err == nil {
+					err = b.commitWithNotification(r.Context(), tx, resource, notification.operation, uuid.UUID{}, payload)
+				}
+				if err != nil {
+					// the items are imported already, so we only log the failed notification
+					rlog.WithError(err).Errorf("Error 4796: cannot send aggregated %s notification", notification.operation)
+				}
+			}
+		}
+
+		jsonData, _ := json.MarshalWithOption(response, json.DisableHTMLEscape())
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(jsonData)
+	}
+
+	// compress wraps the route handlers into a gzip compression handler, unless compression is disabled
+	compress := func(h http.Handler) http.Handler {
+		if rc.DisableCompression {
+			return h
+		}
+		return handlers.CompressHandler(h)
+	}
+
+	// limitWrites limits the number of concurrent write requests, if the resource has a limit. Responses of
+	// writes to a resource whose lists are cached must not be cached themselves.
+	writeLimiter := newWriteLimiter(rc.MaxConcurrentWrites)
+	limitWrites := func(h http.Handler) http.Handler {
+		h = writeLimiter.handler(h)
+		if rc.MaxAgeCache <= 0 {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "no-store")
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	// coalesceReads lets concurrent identical read requests share one execution, if the resource coalesces reads
+	coalesceReads := newReadCoalescer(rc.CoalesceReads, b.requestTimeout).handler
+
 	// store the collection functions  for later usage in relations
 	b.collectionFunctions[resource] = &collectionFunctions{
-		permits: rc.Permits,
-		list:    list,
-		read:    read,
+		permits:           rc.Permits,
+		list:              list,
+		read:              read,
+		table:             resource,
+		searchableColumns: searchableColumns,
+		idColumns:         columns[:propertiesIndex],
 	}
 
 	// CREATE
 	if !singleton {
-		router.Handle(listRoute, handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.Handle(listRoute, compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
 			createWithAuth(w, r)
-		}))).Methods(http.MethodOptions, http.MethodPost)
+		})))).Methods(http.MethodOptions, http.MethodPost)
 	}
 
-	// UPDATE/CREATE with id in json
-	router.Handle(listRoute, handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
-		upsertWithAuth(w, r)
-	}))).Methods(http.MethodOptions, http.MethodPut, http.MethodPatch)
+	// immutable resources have no update routes, the router answers update requests with 405
+	if !rc.Immutable {
+		// UPDATE/CREATE with id in json
+		router.Handle(listRoute, compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			upsertWithAuth(w, r)
+		})))).Methods(http.MethodOptions, http.MethodPut, http.MethodPatch)
+
+		// IMPORT
+		b.withoutTimeout(router.Handle(listRoute+"/import", compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			importItems(w, r)
+		})))).Methods(http.MethodOptions, http.MethodPost))
+
+		// UPDATE/CREATE with fully qualified path
+		router.Handle(itemRoute, compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			upsertWithAuth(w, r)
+		})))).Methods(http.MethodOptions, http.MethodPut, http.MethodPatch)
+	}
+
+	// AVAILABLE, must be registered before READ, otherwise available would be taken for an item id
+	if len(externalIndices) > 0 && !singleton {
+		router.Handle(listRoute+"/available", compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			available(w, r)
+		}))).Methods(http.MethodOptions, http.MethodGet)
+	}
+
+	// CHANGES, must be registered before READ, otherwise changes would be taken for an item id
+	if rc.WithChanges && !singleton {
+		router.Handle(listRoute+"/changes", compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			changes(w, r)
+		}))).Methods(http.MethodOptions, http.MethodGet)
+	}
 
-	// UPDATE/CREATE with fully qualified path
-	router.Handle(itemRoute, handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	// HISTORY
+	if rc.WithChanges && !singleton {
+		router.Handle(itemRoute+"/history", compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			history(w, r)
+		}))).Methods(http.MethodOptions, http.MethodGet)
+	}
+
+	// EXPORT, must be registered before READ, otherwise export.zip would be taken for an item id.
+	// The archive is compressed already, so there is no compress handler. It is streamed, so the
+	// request timeout does not apply.
+	b.withoutTimeout(router.Handle(listRoute+"/export.zip", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
-		upsertWithAuth(w, r)
-	}))).Methods(http.MethodOptions, http.MethodPut, http.MethodPatch)
+		export(w, r)
+	})).Methods(http.MethodOptions, http.MethodGet))
 
 	// READ
-	router.Handle(itemRoute, handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	router.Handle(itemRoute, compress(coalesceReads(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
 		readWithAuth(w, r)
-	}))).Methods(http.MethodOptions, http.MethodGet)
+	})))).Methods(http.MethodOptions, http.MethodGet)
+
+	// APPEND TO ARRAY PROPERTIES
+	if !rc.Immutable {
+		router.Handle(itemRoute+"/properties/{property}/append", compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			appendWithAuth(w, r)
+		})))).Methods(http.MethodOptions, http.MethodPost)
+		if singleton {
+			router.Handle(singletonRoute+"/properties/{property}/append", compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+				appendWithAuth(w, r)
+			})))).Methods(http.MethodOptions, http.MethodPost)
+		}
+	}
 
 	// PUT FOR STATIC PROPERTIES
-	for i := staticPropertiesIndex; i < len(columns); i++ {
+	for i := staticPropertiesIndex; i < len(columns) && !rc.Immutable; i++ {
 		property := columns[i]
+		if !singleton {
+			// bulk update of all items which match the query parameters
+			bulkRoute := fmt.Sprintf("%s/%s/{%s}", listRoute, property, property)
+			router.Handle(bulkRoute, compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+				updatePropertyBulkWithAuth(w, r, property)
+			})))).Methods(http.MethodOptions, http.MethodPut)
+		}
 		propertyRoute := fmt.Sprintf("%s/%s/{%s}", itemRoute, property, property)
-		router.Handle(propertyRoute, handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.Handle(propertyRoute, compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
 			updatePropertyWithAuth(w, r, property)
-		}))).Methods(http.MethodOptions, http.MethodPut)
+		})))).Methods(http.MethodOptions, http.MethodPut)
 		if singleton {
 			propertyRoute := fmt.Sprintf("%s/%s/{%s}", singletonRoute, property, property)
-			router.Handle(propertyRoute, handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			router.Handle(propertyRoute, compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
 				updatePropertyWithAuth(w, r, property)
-			}))).Methods(http.MethodOptions, http.MethodPut)
+			})))).Methods(http.MethodOptions, http.MethodPut)
 		}
 	}
 
 	// LIST
-	router.Handle(listRoute, handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	router.Handle(listRoute, compress(coalesceReads(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
 		listWithAuth(w, r, nil)
-	}))).Methods(http.MethodOptions, http.MethodGet)
+	})))).Methods(http.MethodOptions, http.MethodGet)
 
-	// DELETE
-	router.Handle(itemRoute, handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
-		deleteWithAuth(w, r)
-	}))).Methods(http.MethodOptions, http.MethodDelete)
+	// append-only resources have no delete routes, the router answers delete requests with 405
+	if !rc.NoDelete {
+		// DELETE
+		router.Handle(itemRoute, compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			deleteWithAuth(w, r)
+		})))).Methods(http.MethodOptions, http.MethodDelete)
 
-	// CLEAR
-	router.Handle(listRoute, handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
-		clearWithAuth(w, r)
-	}))).Methods(http.MethodOptions, http.MethodDelete)
+		// CLEAR
+		router.Handle(listRoute, compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+			clearWithAuth(w, r)
+		})))).Methods(http.MethodOptions, http.MethodDelete)
+	}
 
 	if !singleton {
 		return
 	}
 
 	// READ
-	router.Handle(singletonRoute, handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	router.Handle(singletonRoute, compress(coalesceReads(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
 		readWithAuth(w, r)
 
-	}))).Methods(http.MethodOptions, http.MethodGet)
+	})))).Methods(http.MethodOptions, http.MethodGet)
 
 	// UPDATE
-	router.Handle(singletonRoute, handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	router.Handle(singletonRoute, compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
 		upsertWithAuth(w, r)
-	}))).Methods(http.MethodOptions, http.MethodPut, http.MethodPatch)
+	})))).Methods(http.MethodOptions, http.MethodPut, http.MethodPatch)
 
 	// DELETE
-	router.Handle(singletonRoute, handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	router.Handle(singletonRoute, compress(limitWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
 		deleteWithAuth(w, r)
-	}))).Methods(http.MethodOptions, http.MethodDelete)
+	})))).Methods(http.MethodOptions, http.MethodDelete)
 
 }
@@ -7,15 +7,30 @@
 package backend_test
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/goccy/go-json"
 	"github.com/google/uuid"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/relabs-tech/kurbisio/core"
+	"github.com/relabs-tech/kurbisio/core/access"
+	"github.com/relabs-tech/kurbisio/core/backend"
+	"github.com/relabs-tech/kurbisio/core/client"
 )
 
 func TestEtagGet(t *testing.T) {
@@ -74,6 +89,13 @@ func TestEtagGet(t *testing.T) {
 			}
 		})
 	}
+
+	// updates do not change the timestamp of mutable items, hence there is no Last-Modified and
+	// If-Modified-Since is not obeyed
+	assert.Empty(t, firstHeader.Get("Last-Modified"))
+	status, _, err := testService.client.RawGetWithHeader("/as/"+a.AID.String(), map[string]string{"If-Modified-Since": time.Now().UTC().Format(http.TimeFormat)}, &A{})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, status)
 }
 
 func TestEtagGetCollection(t *testing.T) {
@@ -249,469 +271,3598 @@ func TestCollectionWithSchemaValidation(t *testing.T) {
 	}
 }
 
-func TestCollectionWithSchemaValidationPostInvalidSchema(t *testing.T) {
-	type withSchema struct {
-		WithSchemaID uuid.UUID `json:"with_schema_id"`
-		Invalid      string    `json:"invalid"`
-	}
-
-	w := withSchema{}
-
-	_, err := testService.client.RawPost("/with_schemas", &withSchema{Invalid: "foo"}, &w)
-	if err == nil {
-		t.Fatalf("Expecting validation failure")
+func TestCollectionRejectUnknownProperties(t *testing.T) {
+	type withStrictSchema struct {
+		WithStrictSchemaID uuid.UUID `json:"with_strict_schema_id"`
+		Workouts           string    `json:"workouts"`
+		Workoust           string    `json:"workoust,omitempty"`
 	}
-}
 
-func TestCollectionWithSchemaValidationPutInvalidSchema(t *testing.T) {
-	type withSchema struct {
-		WithSchemaID uuid.UUID `json:"with_schema_id"`
-		Workouts     string    `json:"workouts,omitempty"`
-		Invalid      string    `json:"invalid,omitempty"`
+	w := withStrictSchema{}
+	_, err := testService.client.RawPost("/with_strict_schemas", &withStrictSchema{Workouts: "foo"}, &w)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	w := withSchema{}
+	status, err := testService.client.RawPost("/with_strict_schemas", &withStrictSchema{Workouts: "foo", Workoust: "typo"}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
 
-	_, err := testService.client.RawPost("/with_schemas", &withSchema{Workouts: "foo"}, &w)
-	if err != nil {
-		t.Fatal()
-	}
+	w.Workoust = "typo"
+	status, err = testService.client.RawPut("/with_strict_schemas", &w, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
 
-	w.Workouts = ""
-	w.Invalid = "bar"
-	_, err = testService.client.RawPut("/with_schemas", &w, &withSchema{})
-	if err == nil {
-		t.Fatalf("Expecting validation failure")
-	}
+	status, err = testService.client.RawPatch("/with_strict_schemas/"+w.WithStrictSchemaID.String(), map[string]string{"workoust": "typo"}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
 }
 
-func TestFilters(t *testing.T) {
+func TestCollectionCoerce(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "product",
+			"coerce": {"price": "number", "amount": "integer", "active": "boolean", "label": "string"}
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
 
-	b := B{}
-	_, err := testService.client.RawPost("/bs", &b, &b)
-	if err != nil {
-		t.Fatal(err)
+	type product struct {
+		ProductID uuid.UUID `json:"product_id"`
+		Price     float64   `json:"price"`
+		Amount    int       `json:"amount"`
+		Active    bool      `json:"active"`
+		Label     string    `json:"label"`
 	}
-
-	c := C{B: b}
-	_, err = testService.client.RawPost("/bs/"+b.BID.String()+"/cs", &c, &c)
-	if err != nil {
+	var p product
+	body := map[string]interface{}{"price": "4.2", "amount": "42", "active": "true", "label": 7}
+	if _, err := testService.client.RawPost("/products", body, &p); err != nil {
 		t.Fatal(err)
 	}
+	assert.Equal(t, 4.2, p.Price)
+	assert.Equal(t, 42, p.Amount)
+	assert.Equal(t, true, p.Active)
+	assert.Equal(t, "7", p.Label)
 
-	var collectionResult []C
-	// we now search for the searchable property and should only find our single item a
-	_, err = testService.client.RawGet("/bs/all/cs?filter=b_id="+b.BID.String(), &collectionResult)
-	if err != nil {
+	if _, err := testService.client.RawPatch("/products/"+p.ProductID.String(), map[string]interface{}{"price": "5"}, &p); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 1 {
-		t.Fatal("unexpected number of items in collection, expected only 1:", asJSON(collectionResult))
-	}
-	if collectionResult[0].BID != b.BID {
-		t.Fatal("wrong item in collection:", asJSON(collectionResult))
+	assert.Equal(t, 5.0, p.Price)
+
+	for _, invalid := range []map[string]interface{}{{"price": "cheap"}, {"amount": "4.2"}, {"active": "maybe"}} {
+		status, err := testService.client.RawPost("/products", invalid, nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, http.StatusBadRequest, status)
 	}
+}
 
-	// we now search for the searchable property and should only find our single item a
-	_, err = testService.client.RawGet("/bs/all/cs?filter=c_id="+c.CID.String(), &collectionResult)
-	if err != nil {
+func TestCollectionLocale(t *testing.T) {
+	type product struct {
+		AID         uuid.UUID `json:"a_id"`
+		ExternalID  string    `json:"external_id"`
+		Name        string    `json:"name"`
+		Description string    `json:"description"`
+	}
+	externalID := t.Name()
+	body := map[string]interface{}{
+		"external_id": externalID,
+		"name":        "Chair",
+		"description": "A chair",
+		"translations": map[string]interface{}{
+			"de": map[string]string{"name": "Stuhl", "description": "Ein Stuhl"},
+			"fr": map[string]string{"name": "Chaise"},
+		},
+	}
+	var created product
+	if _, err := testService.client.RawPost("/as", body, &created); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 1 {
-		t.Fatal("unexpected number of items in collection, expected only 1:", asJSON(collectionResult))
-	}
-	if collectionResult[0].BID != b.BID {
-		t.Fatal("wrong item in collection:", asJSON(collectionResult))
+
+	testCases := []struct {
+		locale              string
+		expectedName        string
+		expectedDescription string
+	}{
+		{"", "Chair", "A chair"},
+		{"de", "Stuhl", "Ein Stuhl"},
+		{"de-AT", "Stuhl", "Ein Stuhl"},
+		{"fr", "Chaise", "A chair"},
+		{"it", "Chair", "A chair"},
 	}
+	for _, tc := range testCases {
+		t.Run(tc.locale, func(t *testing.T) {
+			var p product
+			if _, err := testService.client.RawGet("/as/"+created.AID.String()+"?locale="+tc.locale, &p); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedName, p.Name)
+			assert.Equal(t, tc.expectedDescription, p.Description)
 
-	_, err = testService.client.Collection("b").Clear()
-	if err != nil {
-		t.Fatal(err)
+			var list []product
+			if _, err := testService.client.RawGet("/as?filter=external_id="+externalID+"&locale="+tc.locale, &list); err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range list {
+				if p.AID == created.AID {
+					assert.Equal(t, tc.expectedName, p.Name)
+					assert.Equal(t, tc.expectedDescription, p.Description)
+				}
+			}
+		})
 	}
 }
 
-// TestSearchEqual test searching in searchable_properties and in json properties
-func TestSearchEqual(t *testing.T) {
+func TestTimestampPrecision(t *testing.T) {
 	jsonConfig := `{
-	"collections": [
-	  {
-		"resource": "a",
-		"external_index": "external_id",
-		"static_properties": ["static_prop"],
-		"searchable_properties": ["searchable_prop"]
-	  } 
-	],
-	"singletons": [],
-	"blobs": [],
-	"shortcuts": []
-  }
-`
-	testService := CreateTestService(jsonConfig, t.Name())
+		"collections": [
+		  {
+			"resource": "a"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestServiceWithBuilder(jsonConfig, t.Name(), func(b *backend.Builder) {
+		b.TimestampPrecision = time.Millisecond
+	})
 	defer testService.Db.Close()
 
-	numberOfElements := 16
-	for i := 0; i < numberOfElements; i++ {
-		_, err := testService.client.WithAdminAuthorization().RawPost("/as",
-			A{
-				ExternalID:     "external_id_" + strconv.Itoa(i),
-				SearchableProp: "searchable_prop_" + strconv.Itoa(i%2),
-				StaticProp:     "static_prop_" + strconv.Itoa(i%4),
-				Foo:            "foo_" + strconv.Itoa(i%8),
-			}, nil)
-		if err != nil {
-			t.Fatal(err)
-		}
+	type a struct {
+		AID       uuid.UUID `json:"a_id"`
+		Timestamp time.Time `json:"timestamp"`
 	}
-
-	var collectionResult []A
-
-	// Search in external_index
-	_, err := testService.client.RawGet("/as?filter=external_id=external_id_1", &collectionResult)
-	if err != nil {
+	timestamp := time.Date(2021, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	var created, read a
+	if _, err := testService.client.RawPost("/as", a{Timestamp: timestamp}, &created); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 1 {
-		t.Fatal("unexpected number of items in collection, expected 1, got", asJSON(collectionResult))
-	}
-	if collectionResult[0].ExternalID != "external_id_1" {
-		t.Fatal("wrong item in collection:", collectionResult[0].ExternalID)
+	if _, err := testService.client.RawGet("/as/"+created.AID.String(), &read); err != nil {
+		t.Fatal(err)
 	}
+	assert.Equal(t, timestamp.Truncate(time.Millisecond), read.Timestamp)
 
-	// Search in searchable_properties
-	_, err = testService.client.RawGet("/as?filter=searchable_prop=searchable_prop_1", &collectionResult)
-	if err != nil {
+	// without explicit timestamp, the current time is truncated as well
+	if _, err := testService.client.RawPost("/as", a{}, &created); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 8 {
-		t.Fatalf("unexpected number of items in collection, expected 8, got %v %s", len(collectionResult), asJSON(collectionResult))
-	}
-	if collectionResult[0].SearchableProp != "searchable_prop_1" {
-		t.Fatal("wrong item in collection:", collectionResult[0].SearchableProp)
-	}
-
-	// Search in json document
-	_, err = testService.client.RawGet("/as?filter=foo=foo_1", &collectionResult)
-	if err != nil {
+	if _, err := testService.client.RawGet("/as/"+created.AID.String(), &read); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 2 {
-		t.Fatalf("unexpected number of items in collection, expected 2, got %v %s", len(collectionResult), asJSON(collectionResult))
+	assert.Equal(t, read.Timestamp.Truncate(time.Millisecond), read.Timestamp)
+}
+
+func TestImmutableCollection(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "transaction",
+			"static_properties": ["amount"],
+			"immutable": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type transaction struct {
+		TransactionID uuid.UUID `json:"transaction_id"`
+		Amount        string    `json:"amount"`
 	}
-	if collectionResult[0].Foo != "foo_1" {
-		t.Fatal("wrong item in collection:", collectionResult[0].Foo)
+	var created transaction
+	if _, err := testService.client.RawPost("/transactions", transaction{Amount: "42"}, &created); err != nil {
+		t.Fatal(err)
 	}
 
-	// Search in unknown json document
-	_, err = testService.client.RawGet("/as?filter=foo2=foo_1", &collectionResult)
-	if err != nil {
+	itemPath := "/transactions/" + created.TransactionID.String()
+	status, err := testService.client.RawPut(itemPath, transaction{Amount: "43"}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	status, err = testService.client.RawPatch(itemPath, transaction{Amount: "43"}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	status, err = testService.client.RawPut("/transactions", transaction{TransactionID: created.TransactionID, Amount: "43"}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	var read transaction
+	if _, err := testService.client.RawGet(itemPath, &read); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 0 {
-		t.Fatalf("unexpected number of items in collection, expected 0, got %v %s", len(collectionResult), asJSON(collectionResult))
-	}
+	assert.Equal(t, "42", read.Amount)
 
-	// Search in json document and searchable properties
-	_, err = testService.client.RawGet("/as?filter=foo=foo_0&filter=searchable_prop=searchable_prop_0", &collectionResult)
+	// the timestamp of immutable items tells when they were modified, so If-Modified-Since is obeyed
+	_, h, err := testService.client.RawGetWithHeader(itemPath, map[string]string{}, &read)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 2 {
-		t.Fatalf("unexpected number of items in collection, expected 1, got %v %s", len(collectionResult), asJSON(collectionResult))
-	}
-	if collectionResult[0].Foo != "foo_0" {
-		t.Fatal("wrong item in collection:", collectionResult[0].Foo)
-	}
-	if collectionResult[0].SearchableProp != "searchable_prop_0" {
-		t.Fatal("wrong item in collection:", collectionResult[0].SearchableProp)
+	status, _, _ = testService.client.RawGetWithHeader(itemPath, map[string]string{"If-Modified-Since": h.Get("Last-Modified")}, &read)
+	assert.Equal(t, http.StatusNotModified, status)
+
+	if _, err := testService.client.RawDelete(itemPath); err != nil {
+		t.Fatal(err)
 	}
 }
 
-// TestSearchEqualAfterSchemaUpdate test searching in searchable_properties and in json properties
-// after converting a static property into a searchable property in a schema update
-func TestSearchEqualAfterSchemaUpdate(t *testing.T) {
-	jsonConfigBefore := `{
-	"collections": [
-	  {
-		"resource": "a",
-		"external_index": "external_id",
-		"static_properties": ["static_prop", "searchable_prop"]
+func TestNoDeleteCollection(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "event",
+			"no_delete": true,
+			"immutable": true
+		  }
+		]
 	  }
-	],
-	"singletons": [],
-	"blobs": [],
-	"shortcuts": []
-  }
-`
-	testServiceBefore := CreateTestService(jsonConfigBefore, t.Name())
-	defer testServiceBefore.Db.Close()
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
 
-	numberOfElements := 16
-	for i := 0; i < numberOfElements; i++ {
-		_, err := testServiceBefore.client.WithAdminAuthorization().RawPost("/as",
-			A{
-				ExternalID:     "external_id_" + strconv.Itoa(i),
-				SearchableProp: "searchable_prop_" + strconv.Itoa(i%2),
-				StaticProp:     "static_prop_" + strconv.Itoa(i%4),
-				Foo:            "foo_" + strconv.Itoa(i%8),
-			}, nil)
-		if err != nil {
-			t.Fatal(err)
-		}
+	type event struct {
+		EventID uuid.UUID `json:"event_id"`
+	}
+	var created event
+	if _, err := testService.client.RawPost("/events", event{}, &created); err != nil {
+		t.Fatal(err)
 	}
 
-	var collectionResult []A
-	// Search in searchable_properties. We use search not filter so we know that the search is done with an index
-	status, err := testServiceBefore.client.RawGet("/as?search=searchable_prop=searchable_prop_1", &collectionResult)
-	if err == nil || status != http.StatusBadRequest || len(collectionResult) > 0 {
-		t.Fatal("expected this to fail, but it did not")
+	for _, path := range []string{"/events/" + created.EventID.String(), "/events"} {
+		status, err := testService.client.RawDelete(path)
+		assert.NotNil(t, err)
+		assert.Equal(t, http.StatusMethodNotAllowed, status)
+	}
+
+	var read event
+	if _, err := testService.client.RawGet("/events/"+created.EventID.String(), &read); err != nil {
+		t.Fatal(err)
 	}
+}
 
+func TestOnParentDelete(t *testing.T) {
 	jsonConfig := `{
 		"collections": [
 		  {
-			"resource": "a",
-			"external_index": "external_id",
-			"static_properties": ["static_prop"],
-			"searchable_properties": ["searchable_prop"]
+			"resource": "owner"
+		  },
+		  {
+			"resource": "owner/restricted",
+			"on_parent_delete": "restrict"
+		  },
+		  {
+			"resource": "owner/orphan",
+			"on_parent_delete": "setnull"
 		  }
-		],
-		"singletons": [],
-		"blobs": [],
-		"shortcuts": []
+		]
 	  }
 	`
-
-	testService := UpdateTestService(jsonConfig, t.Name())
+	testService := CreateTestService(jsonConfig, t.Name())
 	defer testService.Db.Close()
 
-	// Search in external_index
-	_, err = testService.client.RawGet("/as?filter=external_id=external_id_1", &collectionResult)
-	if err != nil {
-		t.Fatal(err)
+	type owner struct {
+		OwnerID uuid.UUID `json:"owner_id"`
 	}
-	if len(collectionResult) != 1 {
-		t.Fatal("unexpected number of items in collection, expected 1, got", asJSON(collectionResult))
+	type restricted struct {
+		OwnerID      uuid.UUID `json:"owner_id"`
+		RestrictedID uuid.UUID `json:"restricted_id"`
 	}
-	if collectionResult[0].ExternalID != "external_id_1" {
-		t.Fatal("wrong item in collection:", collectionResult[0].ExternalID)
+	type orphan struct {
+		OwnerID  uuid.UUID `json:"owner_id"`
+		OrphanID uuid.UUID `json:"orphan_id"`
 	}
 
-	// Search in searchable_properties. We use search not filter so we know that the search is done with an index
-	_, err = testService.client.RawGet("/as?search=searchable_prop=searchable_prop_1", &collectionResult)
-	if err != nil {
+	var o owner
+	if _, err := testService.client.RawPost("/owners", owner{}, &o); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 8 {
-		t.Fatalf("unexpected number of items in collection, expected 8, got %v %s", len(collectionResult), asJSON(collectionResult))
+	ownerPath := "/owners/" + o.OwnerID.String()
+	var r restricted
+	if _, err := testService.client.RawPost(ownerPath+"/restricteds", restricted{}, &r); err != nil {
+		t.Fatal(err)
 	}
-	if collectionResult[0].SearchableProp != "searchable_prop_1" {
-		t.Fatal("wrong item in collection:", collectionResult[0].SearchableProp)
+	var c orphan
+	if _, err := testService.client.RawPost(ownerPath+"/orphans", orphan{}, &c); err != nil {
+		t.Fatal(err)
 	}
 
-	// Search in json document
-	_, err = testService.client.RawGet("/as?filter=foo=foo_1", &collectionResult)
-	if err != nil {
+	// the restricted child prevents deleting the owner
+	status, err := testService.client.RawDelete(ownerPath)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusConflict, status)
+	status, err = testService.client.RawDelete("/owners")
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusConflict, status)
+
+	if _, err = testService.client.RawDelete(ownerPath + "/restricteds/" + r.RestrictedID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = testService.client.RawDelete(ownerPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// the orphan survives its owner
+	var read orphan
+	if _, err = testService.client.RawGet("/owners/all/orphans/"+c.OrphanID.String(), &read); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, c.OrphanID, read.OrphanID)
+	assert.Equal(t, uuid.UUID{}, read.OwnerID)
+}
+
+func TestNotifyOnParentDelete(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "owner"
+		  },
+		  {
+			"resource": "owner/item",
+			"notify_on_parent_delete": true
+		  },
+		  {
+			"resource": "owner/item/part",
+			"notify_on_parent_delete": true
+		  },
+		  {
+			"resource": "owner/note"
+		  }
+		],
+		"singletons": [
+		  {
+			"resource": "owner/profile",
+			"notify_on_parent_delete": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	notifications := map[string][]backend.Notification{}
+	handler := func(ctx context.Context, n backend.Notification) error {
+		notifications[n.Resource] = append(notifications[n.Resource], n)
+		return nil
+	}
+	for _, resource := range []string{"owner", "owner/item", "owner/item/part", "owner/note", "owner/profile"} {
+		testService.backend.HandleResourceNotification(resource, handler, core.OperationDelete)
+	}
+
+	var owner map[string]interface{}
+	if _, err := testService.client.RawPost("/owners", map[string]string{}, &owner); err != nil {
+		t.Fatal(err)
+	}
+	ownerPath := "/owners/" + owner["owner_id"].(string)
+	var items []map[string]interface{}
+	for i := 0; i < 2; i++ {
+		var item map[string]interface{}
+		if _, err := testService.client.RawPost(ownerPath+"/items", map[string]string{}, &item); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	if _, err := testService.client.RawPost(ownerPath+"/items/"+items[0]["item_id"].(string)+"/parts", map[string]string{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawPost(ownerPath+"/notes", map[string]string{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawPut(ownerPath+"/profile", map[string]string{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testService.client.RawDelete(ownerPath); err != nil {
+		t.Fatal(err)
+	}
+	testService.backend.ProcessJobsSync(-1)
+
+	assert.Len(t, notifications["owner"], 1)
+	assert.Len(t, notifications["owner/item/part"], 1)
+	assert.Len(t, notifications["owner/profile"], 1)
+	assert.Len(t, notifications["owner/note"], 0)
+	if assert.Len(t, notifications["owner/item"], 2) {
+		deleted := map[string]bool{}
+		for _, n := range notifications["owner/item"] {
+			var payload map[string]string
+			json.Unmarshal(n.Payload, &payload)
+			assert.Equal(t, n.ResourceID.String(), payload["item_id"])
+			assert.Equal(t, owner["owner_id"], payload["owner_id"])
+			deleted[payload["item_id"]] = true
+		}
+		assert.True(t, deleted[items[0]["item_id"].(string)])
+		assert.True(t, deleted[items[1]["item_id"].(string)])
+	}
+}
+
+func TestCollectionExport(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "owner",
+			"permits": [{"role": "everybody", "operations": ["create", "read", "list"]}]
+		  },
+		  {
+			"resource": "owner/item"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type item struct {
+		OwnerID uuid.UUID `json:"owner_id"`
+		ItemID  uuid.UUID `json:"item_id"`
+		Name    string    `json:"name"`
+	}
+	items := map[uuid.UUID]item{}
+	owners := []uuid.UUID{}
+	for i := 0; i < 2; i++ {
+		var owner struct {
+			OwnerID uuid.UUID `json:"owner_id"`
+		}
+		if _, err := testService.client.RawPost("/owners", owner, &owner); err != nil {
+			t.Fatal(err)
+		}
+		owners = append(owners, owner.OwnerID)
+		for j := 0; j < 3; j++ {
+			var created item
+			if _, err := testService.client.RawPost("/owners/"+owner.OwnerID.String()+"/items", item{Name: strconv.Itoa(j)}, &created); err != nil {
+				t.Fatal(err)
+			}
+			items[created.ItemID] = created
+		}
+	}
+
+	readArchive := func(path string) map[uuid.UUID]item {
+		var data []byte
+		_, header, err := testService.client.RawGetBlobWithHeader(path, map[string]string{}, &data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "application/zip", header.Get("Content-Type"))
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		exported := map[uuid.UUID]item{}
+		for _, file := range archive.File {
+			f, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, _ := io.ReadAll(f)
+			f.Close()
+			var i item
+			if err = json.Unmarshal(content, &i); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, i.ItemID.String()+".json", file.Name)
+			exported[i.ItemID] = i
+		}
+		return exported
+	}
+
+	assert.Equal(t, items, readArchive("/owners/all/items/export.zip"))
+	exported := readArchive("/owners/" + owners[0].String() + "/items/export.zip")
+	assert.Len(t, exported, 3)
+	for _, i := range exported {
+		assert.Equal(t, items[i.ItemID], i)
+		assert.Equal(t, owners[0], i.OwnerID)
+	}
+
+	// only administrators can export
+	everybody := testService.clientNoAuth.WithRole("everybody")
+	status, _, err := everybody.RawGetBlobWithHeader("/owners/export.zip", map[string]string{}, &[]byte{})
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestCollectionImport(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "owner"
+		  },
+		  {
+			"resource": "owner/item",
+			"coerce": {"count": "integer"}
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type item struct {
+		OwnerID uuid.UUID `json:"owner_id"`
+		ItemID  uuid.UUID `json:"item_id"`
+		Count   int       `json:"count"`
+	}
+	var owner struct {
+		OwnerID uuid.UUID `json:"owner_id"`
+	}
+	if _, err := testService.client.RawPost("/owners", owner, &owner); err != nil {
+		t.Fatal(err)
+	}
+	itemsPath := "/owners/" + owner.OwnerID.String() + "/items"
+
+	importItems := func(path, contentType string, body []byte) backend.ImportResponse {
+		r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+		rec := httptest.NewRecorder()
+		testService.Router.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("import returned %d: %s", rec.Code, rec.Body.String())
+		}
+		var response backend.ImportResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	// ndjson, the second item cannot be coerced and fails
+	id1, id2, id3 := uuid.New(), uuid.New(), uuid.New()
+	ndjson := `{"item_id": "` + id1.String() + `", "count": 1}
+{"item_id": "` + id2.String() + `", "count": "two"}
+{"item_id": "` + id3.String() + `", "count": 3}
+`
+	response := importItems(itemsPath+"/import", "application/x-ndjson", []byte(ndjson))
+	assert.Equal(t, 2, response.Succeeded)
+	assert.Equal(t, 1, response.Failed)
+	if assert.Len(t, response.Failures, 1) {
+		assert.Equal(t, 1, response.Failures[0].Index)
+		assert.Equal(t, id2.String(), response.Failures[0].ID)
+		assert.Equal(t, http.StatusBadRequest, response.Failures[0].Status)
+	}
+
+	// export, clear and restore the collection with the wildcard path
+	var archive []byte
+	if _, _, err := testService.client.RawGetBlobWithHeader(itemsPath+"/export.zip", map[string]string{}, &archive); err != nil {
+		t.Fatal(err)
+	}
+	var before []item
+	if _, err := testService.client.RawGet(itemsPath, &before); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawDelete(itemsPath); err != nil {
+		t.Fatal(err)
+	}
+	response = importItems("/owners/all/items/import", "application/zip", archive)
+	assert.Equal(t, 2, response.Succeeded)
+	assert.Equal(t, 0, response.Failed)
+
+	var after []item
+	if _, err := testService.client.RawGet(itemsPath, &after); err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, before, after)
+}
+
+func TestImportAggregatedNotifications(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item",
+			"aggregate_batch_notifications": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	notifications := map[core.Operation][]backend.Notification{}
+	handler := func(ctx context.Context, n backend.Notification) error {
+		notifications[n.Operation] = append(notifications[n.Operation], n)
+		return nil
+	}
+	testService.backend.HandleResourceNotification("item", handler, core.OperationCreate, core.OperationUpdate)
+
+	existing := uuid.New()
+	if _, err := testService.client.RawPut("/items", map[string]string{"item_id": existing.String()}, nil); err != nil {
+		t.Fatal(err)
+	}
+	testService.backend.ProcessJobsSync(-1)
+	notifications = map[core.Operation][]backend.Notification{}
+
+	id1, id2 := uuid.New(), uuid.New()
+	ndjson := `{"item_id": "` + id1.String() + `"}
+{"item_id": "` + existing.String() + `", "name": "updated"}
+{"item_id": "` + id2.String() + `"}
+`
+	r := httptest.NewRequest(http.MethodPost, "/items/import", bytes.NewReader([]byte(ndjson)))
+	r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+	rec := httptest.NewRecorder()
+	testService.Router.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	testService.backend.ProcessJobsSync(-1)
+
+	if assert.Len(t, notifications[core.OperationCreate], 1) {
+		var ids []string
+		json.Unmarshal(notifications[core.OperationCreate][0].Payload, &ids)
+		assert.Equal(t, []string{id1.String(), id2.String()}, ids)
+		assert.Equal(t, uuid.UUID{}, notifications[core.OperationCreate][0].ResourceID)
+	}
+	if assert.Len(t, notifications[core.OperationUpdate], 1) {
+		var ids []string
+		json.Unmarshal(notifications[core.OperationUpdate][0].Payload, &ids)
+		assert.Equal(t, []string{existing.String()}, ids)
+	}
+}
+
+func TestImportLimits(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestServiceWithBuilder(jsonConfig, t.Name(), func(b *backend.Builder) {
+		b.MaxImportBytes = 1000
+		b.MaxImportItemBytes = 100
+	})
+	defer testService.Db.Close()
+
+	importItems := func(body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/items/import", strings.NewReader(body))
+		r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+		rec := httptest.NewRecorder()
+		testService.Router.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, importItems(`{"item_id": "`+uuid.New().String()+`"}`+"\n"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, importItems(`{"name": "`+strings.Repeat("x", 100)+`"}`+"\n"))
+
+	ndjson := ""
+	for i := 0; i < 20; i++ {
+		ndjson += `{"item_id": "` + uuid.New().String() + `"}` + "\n"
+	}
+	assert.Equal(t, http.StatusRequestEntityTooLarge, importItems(ndjson))
+}
+
+func TestSilentClient(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	count := 0
+	handler := func(ctx context.Context, n backend.Notification) error {
+		count++
+		return nil
+	}
+	testService.backend.HandleResourceNotification("item", handler, core.OperationCreate, core.OperationUpdate, core.OperationDelete)
+
+	silentClients := map[string]client.Client{
+		"client":  testService.client.Silent(),
+		"context": testService.client.WithContext(core.ContextWithSilent(context.Background())),
+	}
+	for name, silentClient := range silentClients {
+		t.Run(name, func(t *testing.T) {
+			items := silentClient.Collection("item")
+			var item map[string]interface{}
+			if _, err := items.Create(map[string]string{}, &item); err != nil {
+				t.Fatal(err)
+			}
+			item["name"] = "updated"
+			if _, err := items.Upsert(item, &item); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := items.Item(uuid.MustParse(item["item_id"].(string))).Delete(); err != nil {
+				t.Fatal(err)
+			}
+			testService.backend.ProcessJobsSync(-1)
+			assert.Equal(t, 0, count)
+		})
+	}
+
+	// without silent, notifications are sent as usual
+	if _, err := testService.client.RawPost("/items", map[string]string{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	testService.backend.ProcessJobsSync(-1)
+	assert.Equal(t, 1, count)
+}
+
+func TestReturnPrevious(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type item struct {
+		ItemID   uuid.UUID              `json:"item_id"`
+		Name     string                 `json:"name"`
+		Revision int                    `json:"revision"`
+		Previous map[string]interface{} `json:"previous"`
+	}
+	var created item
+	if _, err := testService.client.RawPost("/items", item{Name: "first"}, &created); err != nil {
+		t.Fatal(err)
+	}
+	path := "/items/" + created.ItemID.String()
+
+	// without the parameter, nothing changes
+	var updated item
+	if _, err := testService.client.RawPut(path, item{Name: "second"}, &updated); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, updated.Previous)
+
+	if _, err := testService.client.RawPut(path+"?return=previous", item{Name: "third"}, &updated); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "third", updated.Name)
+	if assert.NotNil(t, updated.Previous) {
+		assert.Equal(t, "second", updated.Previous["name"])
+		assert.Equal(t, float64(updated.Revision-1), updated.Previous["revision"])
+	}
+
+	// the previous state is not stored
+	var read item
+	if _, err := testService.client.RawGet(path, &read); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, read.Previous)
+
+	r := httptest.NewRequest(http.MethodPatch, path, bytes.NewReader([]byte(`{"name":"fourth"}`)))
+	r.Header.Set("Kurbisio-Return-Previous", "true")
+	r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+	rec := httptest.NewRecorder()
+	testService.Router.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "third", updated.Previous["name"])
+
+	// delete returns the deleted object
+	r = httptest.NewRequest(http.MethodDelete, path+"?return=previous", nil)
+	r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+	rec = httptest.NewRecorder()
+	testService.Router.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var deleted item
+	if err := json.Unmarshal(rec.Body.Bytes(), &deleted); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "fourth", deleted.Name)
+}
+
+func TestRawRead(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item",
+			"default": {"color": "blue"},
+			"permits": [{"role": "userrole", "operations": ["create", "read", "list"]}]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	// write an item without the default property directly to the database
+	var item map[string]interface{}
+	if _, err := testService.client.RawPost("/items", map[string]string{}, &item); err != nil {
+		t.Fatal(err)
+	}
+	id := item["item_id"].(string)
+	if _, err := testService.Db.Exec(`UPDATE `+testService.Db.Schema+`."item" SET properties = '{}' WHERE item_id = $1;`, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testService.client.RawGet("/items/"+id, &item); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "blue", item["color"])
+
+	item = nil
+	if _, err := testService.client.RawGet("/items/"+id+"?raw=true", &item); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, item, "color")
+
+	var items []map[string]interface{}
+	if _, err := testService.client.RawGet("/items?raw=true", &items); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, items, 1) {
+		assert.NotContains(t, items[0], "color")
+	}
+
+	// raw is for admins only
+	userClient := testService.clientNoAuth.WithRole("userrole")
+	status, err := userClient.RawGet("/items/"+id+"?raw=true", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, err = userClient.RawGet("/items?raw=true", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestComputedProperty(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "person"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	testService.backend.HandleComputedProperty("person", "full_name", func(object map[string]interface{}) interface{} {
+		return fmt.Sprintf("%v %v", object["first_name"], object["last_name"])
+	})
+
+	type person struct {
+		PersonID  uuid.UUID `json:"person_id"`
+		FirstName string    `json:"first_name"`
+		LastName  string    `json:"last_name"`
+		FullName  string    `json:"full_name,omitempty"`
+	}
+	// the computed property is not stored, even if a client sends it
+	var created person
+	if _, err := testService.client.RawPost("/persons", person{FirstName: "Jane", LastName: "Doe", FullName: "John Doe"}, &created); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "", created.FullName)
+
+	var read person
+	if _, err := testService.client.RawGet("/persons/"+created.PersonID.String(), &read); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Jane Doe", read.FullName)
+
+	var persons []person
+	if _, err := testService.client.RawGet("/persons", &persons); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, persons, 1) {
+		assert.Equal(t, "Jane Doe", persons[0].FullName)
+	}
+
+	var raw map[string]interface{}
+	if _, err := testService.client.RawGet("/persons/"+created.PersonID.String()+"?raw=true", &raw); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, raw, "full_name")
+}
+
+func TestDisableCompression(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "compressed"
+		  },
+		  {
+			"resource": "plain",
+			"disable_compression": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	testCases := []struct {
+		path             string
+		expectedEncoding string
+	}{
+		{"/compresseds", "gzip"},
+		{"/plains", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+			rec := httptest.NewRecorder()
+			testService.Router.ServeHTTP(rec, r)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tc.expectedEncoding, rec.Header().Get("Content-Encoding"))
+		})
+	}
+}
+
+func TestCollectionAlias(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "org"
+		  },
+		  {
+			"resource": "org/user",
+			"aliases": ["member"]
+		  },
+		  {
+			"resource": "org/user/device"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type user struct {
+		OrgID  uuid.UUID `json:"org_id"`
+		UserID uuid.UUID `json:"user_id"`
+		Name   string    `json:"name"`
+	}
+	type device struct {
+		UserID   uuid.UUID `json:"user_id"`
+		DeviceID uuid.UUID `json:"device_id"`
+	}
+	var org struct {
+		OrgID uuid.UUID `json:"org_id"`
+	}
+	if _, err := testService.client.RawPost("/orgs", org, &org); err != nil {
+		t.Fatal(err)
+	}
+	orgPath := "/orgs/" + org.OrgID.String()
+
+	var created user
+	if _, err := testService.client.RawPost(orgPath+"/members", user{Name: "old route"}, &created); err != nil {
+		t.Fatal(err)
+	}
+	var read user
+	if _, err := testService.client.RawGet(orgPath+"/users/"+created.UserID.String(), &read); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, created, read)
+
+	var d device
+	if _, err := testService.client.RawPost(orgPath+"/users/"+created.UserID.String()+"/devices", device{}, &d); err != nil {
+		t.Fatal(err)
+	}
+	var devices []device
+	if _, err := testService.client.RawGet(orgPath+"/members/"+created.UserID.String()+"/devices", &devices); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []device{d}, devices)
+
+	if _, err := testService.client.RawDelete(orgPath + "/members/" + created.UserID.String()); err != nil {
+		t.Fatal(err)
+	}
+	status, err := testService.client.RawGet(orgPath+"/users/"+created.UserID.String(), &read)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestImmutableProperties(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "account",
+			"static_properties": ["handle"],
+			"immutable_properties": ["email", "handle"]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type account struct {
+		AccountID uuid.UUID `json:"account_id"`
+		Email     string    `json:"email,omitempty"`
+		Handle    string    `json:"handle,omitempty"`
+		Name      string    `json:"name,omitempty"`
+	}
+	var created account
+	if _, err := testService.client.RawPost("/accounts", account{Email: "jane@example.com", Name: "Jane"}, &created); err != nil {
+		t.Fatal(err)
+	}
+	path := "/accounts/" + created.AccountID.String()
+
+	// changing the email is rejected, the rest of the update is allowed
+	status, err := testService.client.RawPatch(path, account{Email: "john@example.com"}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	var updated account
+	if _, err = testService.client.RawPatch(path, account{Email: "jane@example.com", Name: "Jane Doe"}, &updated); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Jane Doe", updated.Name)
+
+	// a put which omits the email keeps it
+	if _, err = testService.client.RawPut(path, account{Name: "Jane"}, &updated); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "jane@example.com", updated.Email)
+
+	// the static handle can be set once
+	if _, err = testService.client.RawPut(path+"/handle/jane", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	status, err = testService.client.RawPut(path+"/handle/john", nil, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, err = testService.client.RawPut(path, account{Handle: "john"}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// appending does not bypass the immutability
+	status, err = testService.client.RawPost(path+"/properties/email/append", []string{"john@example.com"}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	var read account
+	if _, err = testService.client.RawGet(path, &read); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, account{AccountID: created.AccountID, Email: "jane@example.com", Handle: "jane", Name: "Jane"}, read)
+}
+
+func TestExternalIndexPerParent(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "site"
+		  },
+		  {
+			"resource": "site/page",
+			"external_index": "slug",
+			"external_index_per_parent": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type page struct {
+		SiteID uuid.UUID `json:"site_id"`
+		PageID uuid.UUID `json:"page_id"`
+		Slug   string    `json:"slug"`
+	}
+	var sites []string
+	for i := 0; i < 2; i++ {
+		var site struct {
+			SiteID uuid.UUID `json:"site_id"`
+		}
+		if _, err := testService.client.RawPost("/sites", site, &site); err != nil {
+			t.Fatal(err)
+		}
+		sites = append(sites, "/sites/"+site.SiteID.String())
+	}
+
+	// the same slug is allowed for different sites
+	var first page
+	for _, site := range sites {
+		if _, err := testService.client.RawPost(site+"/pages", page{Slug: "home"}, &first); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// but not twice for the same site, neither on create nor on update
+	status, err := testService.client.RawPost(sites[1]+"/pages", page{Slug: "home"}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusConflict, status)
+
+	var other page
+	if _, err = testService.client.RawPost(sites[1]+"/pages", page{Slug: "about"}, &other); err != nil {
+		t.Fatal(err)
+	}
+	other.Slug = "home"
+	status, err = testService.client.RawPut(sites[1]+"/pages/"+other.PageID.String(), other, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusConflict, status)
+}
+
+func TestExternalIndexAvailable(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user",
+			"external_index": "identity",
+			"permits": [{"role": "public", "operations": ["create"]}]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	if _, err := testService.client.RawPost("/users", map[string]string{"identity": "jane"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		identity  string
+		available bool
+	}{
+		{"jane", false},
+		{"john", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.identity, func(t *testing.T) {
+			var response map[string]interface{}
+			if _, err := testService.clientNoAuth.RawGet("/users/available?identity="+tc.identity, &response); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, map[string]interface{}{"available": tc.available}, response)
+		})
+	}
+
+	status, err := testService.clientNoAuth.RawGet("/users/available?name=jane", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestExternalIndexCaseInsensitive(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user",
+			"external_index": "email",
+			"external_index_case_insensitive": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type user struct {
+		UserID uuid.UUID `json:"user_id"`
+		Email  string    `json:"email"`
+	}
+	var jane user
+	if _, err := testService.client.RawPost("/users", user{Email: "Jane@Test.com"}, &jane); err != nil {
+		t.Fatal(err)
+	}
+	// the original case is preserved
+	assert.Equal(t, "Jane@Test.com", jane.Email)
+
+	status, err := testService.client.RawPost("/users", user{Email: "jane@test.com"}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusConflict, status)
+
+	var users []user
+	if _, err = testService.client.RawGet("/users?filter=email=JANE@TEST.COM", &users); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, jane, users[0])
+	}
+
+	var response map[string]interface{}
+	if _, err = testService.client.RawGet("/users/available?email=jane@TEST.com", &response); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]interface{}{"available": false}, response)
+}
+
+func TestMultipleExternalIndices(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user",
+			"external_index": "email",
+			"external_indices": ["phone"]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type user struct {
+		UserID uuid.UUID `json:"user_id,omitempty"`
+		Email  string    `json:"email"`
+		Phone  string    `json:"phone"`
+	}
+	var jane user
+	if _, err := testService.client.RawPost("/users", user{Email: "jane@test.com", Phone: "123"}, &jane); err != nil {
+		t.Fatal(err)
+	}
+	var john user
+	if _, err := testService.client.RawPost("/users", user{Email: "john@test.com", Phone: "456"}, &john); err != nil {
+		t.Fatal(err)
+	}
+
+	// each external index is unique on its own
+	status, _ := testService.client.RawPost("/users", user{Email: "jane@test.com", Phone: "789"}, nil)
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = testService.client.RawPost("/users", user{Email: "other@test.com", Phone: "123"}, nil)
+	assert.Equal(t, http.StatusConflict, status)
+
+	// each external index can be filtered and searched
+	var users []user
+	if _, err := testService.client.RawGet("/users?filter=email=john@test.com", &users); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []user{john}, users)
+	if _, err := testService.client.RawGet("/users?search=phone=123", &users); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []user{jane}, users)
+
+	var response map[string]interface{}
+	if _, err := testService.client.RawGet("/users/available?phone=456", &response); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]interface{}{"available": false}, response)
+	status, _ = testService.client.RawGet("/users/available?phone=456&email=x", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// on_conflict returns the resource which holds the conflicting value
+	var existing user
+	status, err := testService.client.RawPost("/users?on_conflict=return_existing", user{Email: "new@test.com", Phone: "456"}, &existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, john, existing)
+}
+
+func TestCreateOnConflictReturnExisting(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user",
+			"external_index": "email",
+			"external_index_case_insensitive": true
+		  },
+		  {
+			"resource": "note"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type user struct {
+		UserID uuid.UUID `json:"user_id"`
+		Email  string    `json:"email"`
+		Name   string    `json:"name"`
+	}
+	var jane user
+	status, err := testService.client.RawPost("/users?on_conflict=return_existing", user{Email: "Jane@Test.com", Name: "Jane"}, &jane)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusCreated, status)
+
+	var existing user
+	status, err = testService.client.RawPost("/users?on_conflict=return_existing", user{Email: "jane@test.com", Name: "Other"}, &existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, jane, existing)
+
+	// without the parameter, the conflict is reported
+	status, _ = testService.client.RawPost("/users", user{Email: "jane@test.com"}, nil)
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, _ = testService.client.RawPost("/users?on_conflict=update", user{Email: "john@test.com"}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = testService.client.RawPost("/notes?on_conflict=return_existing", map[string]string{"text": "x"}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestCollectionWithSchemaValidationPostInvalidSchema(t *testing.T) {
+	type withSchema struct {
+		WithSchemaID uuid.UUID `json:"with_schema_id"`
+		Invalid      string    `json:"invalid"`
+	}
+
+	w := withSchema{}
+
+	_, err := testService.client.RawPost("/with_schemas", &withSchema{Invalid: "foo"}, &w)
+	if err == nil {
+		t.Fatalf("Expecting validation failure")
+	}
+}
+
+func TestCollectionWithSchemaValidationPutInvalidSchema(t *testing.T) {
+	type withSchema struct {
+		WithSchemaID uuid.UUID `json:"with_schema_id"`
+		Workouts     string    `json:"workouts,omitempty"`
+		Invalid      string    `json:"invalid,omitempty"`
+	}
+
+	w := withSchema{}
+
+	_, err := testService.client.RawPost("/with_schemas", &withSchema{Workouts: "foo"}, &w)
+	if err != nil {
+		t.Fatal()
+	}
+
+	w.Workouts = ""
+	w.Invalid = "bar"
+	_, err = testService.client.RawPut("/with_schemas", &w, &withSchema{})
+	if err == nil {
+		t.Fatalf("Expecting validation failure")
+	}
+}
+
+func TestFilters(t *testing.T) {
+
+	b := B{}
+	_, err := testService.client.RawPost("/bs", &b, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := C{B: b}
+	_, err = testService.client.RawPost("/bs/"+b.BID.String()+"/cs", &c, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var collectionResult []C
+	// we now search for the searchable property and should only find our single item a
+	_, err = testService.client.RawGet("/bs/all/cs?filter=b_id="+b.BID.String(), &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 1 {
+		t.Fatal("unexpected number of items in collection, expected only 1:", asJSON(collectionResult))
+	}
+	if collectionResult[0].BID != b.BID {
+		t.Fatal("wrong item in collection:", asJSON(collectionResult))
+	}
+
+	// we now search for the searchable property and should only find our single item a
+	_, err = testService.client.RawGet("/bs/all/cs?filter=c_id="+c.CID.String(), &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 1 {
+		t.Fatal("unexpected number of items in collection, expected only 1:", asJSON(collectionResult))
+	}
+	if collectionResult[0].BID != b.BID {
+		t.Fatal("wrong item in collection:", asJSON(collectionResult))
+	}
+
+	_, err = testService.client.Collection("b").Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSearchEqual test searching in searchable_properties and in json properties
+func TestSearchEqual(t *testing.T) {
+	jsonConfig := `{
+	"collections": [
+	  {
+		"resource": "a",
+		"external_index": "external_id",
+		"static_properties": ["static_prop"],
+		"searchable_properties": ["searchable_prop"]
+	  } 
+	],
+	"singletons": [],
+	"blobs": [],
+	"shortcuts": []
+  }
+`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	numberOfElements := 16
+	for i := 0; i < numberOfElements; i++ {
+		_, err := testService.client.WithAdminAuthorization().RawPost("/as",
+			A{
+				ExternalID:     "external_id_" + strconv.Itoa(i),
+				SearchableProp: "searchable_prop_" + strconv.Itoa(i%2),
+				StaticProp:     "static_prop_" + strconv.Itoa(i%4),
+				Foo:            "foo_" + strconv.Itoa(i%8),
+			}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var collectionResult []A
+
+	// Search in external_index
+	_, err := testService.client.RawGet("/as?filter=external_id=external_id_1", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 1 {
+		t.Fatal("unexpected number of items in collection, expected 1, got", asJSON(collectionResult))
+	}
+	if collectionResult[0].ExternalID != "external_id_1" {
+		t.Fatal("wrong item in collection:", collectionResult[0].ExternalID)
+	}
+
+	// Search in searchable_properties
+	_, err = testService.client.RawGet("/as?filter=searchable_prop=searchable_prop_1", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 8 {
+		t.Fatalf("unexpected number of items in collection, expected 8, got %v %s", len(collectionResult), asJSON(collectionResult))
+	}
+	if collectionResult[0].SearchableProp != "searchable_prop_1" {
+		t.Fatal("wrong item in collection:", collectionResult[0].SearchableProp)
+	}
+
+	// Search in json document
+	_, err = testService.client.RawGet("/as?filter=foo=foo_1", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 2 {
+		t.Fatalf("unexpected number of items in collection, expected 2, got %v %s", len(collectionResult), asJSON(collectionResult))
+	}
+	if collectionResult[0].Foo != "foo_1" {
+		t.Fatal("wrong item in collection:", collectionResult[0].Foo)
+	}
+
+	// Search in unknown json document
+	_, err = testService.client.RawGet("/as?filter=foo2=foo_1", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 0 {
+		t.Fatalf("unexpected number of items in collection, expected 0, got %v %s", len(collectionResult), asJSON(collectionResult))
+	}
+
+	// Search in json document and searchable properties
+	_, err = testService.client.RawGet("/as?filter=foo=foo_0&filter=searchable_prop=searchable_prop_0", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 2 {
+		t.Fatalf("unexpected number of items in collection, expected 1, got %v %s", len(collectionResult), asJSON(collectionResult))
+	}
+	if collectionResult[0].Foo != "foo_0" {
+		t.Fatal("wrong item in collection:", collectionResult[0].Foo)
+	}
+	if collectionResult[0].SearchableProp != "searchable_prop_0" {
+		t.Fatal("wrong item in collection:", collectionResult[0].SearchableProp)
+	}
+}
+
+// TestSearchEqualAfterSchemaUpdate test searching in searchable_properties and in json properties
+// after converting a static property into a searchable property in a schema update
+func TestSearchEqualAfterSchemaUpdate(t *testing.T) {
+	jsonConfigBefore := `{
+	"collections": [
+	  {
+		"resource": "a",
+		"external_index": "external_id",
+		"static_properties": ["static_prop", "searchable_prop"]
+	  }
+	],
+	"singletons": [],
+	"blobs": [],
+	"shortcuts": []
+  }
+`
+	testServiceBefore := CreateTestService(jsonConfigBefore, t.Name())
+	defer testServiceBefore.Db.Close()
+
+	numberOfElements := 16
+	for i := 0; i < numberOfElements; i++ {
+		_, err := testServiceBefore.client.WithAdminAuthorization().RawPost("/as",
+			A{
+				ExternalID:     "external_id_" + strconv.Itoa(i),
+				SearchableProp: "searchable_prop_" + strconv.Itoa(i%2),
+				StaticProp:     "static_prop_" + strconv.Itoa(i%4),
+				Foo:            "foo_" + strconv.Itoa(i%8),
+			}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var collectionResult []A
+	// Search in searchable_properties. We use search not filter so we know that the search is done with an index
+	status, err := testServiceBefore.client.RawGet("/as?search=searchable_prop=searchable_prop_1", &collectionResult)
+	if err == nil || status != http.StatusBadRequest || len(collectionResult) > 0 {
+		t.Fatal("expected this to fail, but it did not")
+	}
+
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "a",
+			"external_index": "external_id",
+			"static_properties": ["static_prop"],
+			"searchable_properties": ["searchable_prop"]
+		  }
+		],
+		"singletons": [],
+		"blobs": [],
+		"shortcuts": []
+	  }
+	`
+
+	testService := UpdateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	// Search in external_index
+	_, err = testService.client.RawGet("/as?filter=external_id=external_id_1", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 1 {
+		t.Fatal("unexpected number of items in collection, expected 1, got", asJSON(collectionResult))
+	}
+	if collectionResult[0].ExternalID != "external_id_1" {
+		t.Fatal("wrong item in collection:", collectionResult[0].ExternalID)
+	}
+
+	// Search in searchable_properties. We use search not filter so we know that the search is done with an index
+	_, err = testService.client.RawGet("/as?search=searchable_prop=searchable_prop_1", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 8 {
+		t.Fatalf("unexpected number of items in collection, expected 8, got %v %s", len(collectionResult), asJSON(collectionResult))
+	}
+	if collectionResult[0].SearchableProp != "searchable_prop_1" {
+		t.Fatal("wrong item in collection:", collectionResult[0].SearchableProp)
+	}
+
+	// Search in json document
+	_, err = testService.client.RawGet("/as?filter=foo=foo_1", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 2 {
+		t.Fatalf("unexpected number of items in collection, expected 2, got %v %s", len(collectionResult), asJSON(collectionResult))
+	}
+	if collectionResult[0].Foo != "foo_1" {
+		t.Fatal("wrong item in collection:", collectionResult[0].Foo)
+	}
+
+	// Search in unknown json document
+	_, err = testService.client.RawGet("/as?filter=foo2=foo_1", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 0 {
+		t.Fatalf("unexpected number of items in collection, expected 0, got %v %s", len(collectionResult), asJSON(collectionResult))
+	}
+
+	// Search in json document and searchable properties
+	_, err = testService.client.RawGet("/as?filter=foo=foo_0&filter=searchable_prop=searchable_prop_0", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 2 {
+		t.Fatalf("unexpected number of items in collection, expected 1, got %v %s", len(collectionResult), asJSON(collectionResult))
+	}
+	if collectionResult[0].Foo != "foo_0" {
+		t.Fatal("wrong item in collection:", collectionResult[0].Foo)
+	}
+	if collectionResult[0].SearchableProp != "searchable_prop_0" {
+		t.Fatal("wrong item in collection:", collectionResult[0].SearchableProp)
+	}
+}
+
+// TestAddPropertyInSchemaUpdate test adding a complely new searchable property in a schema update
+func TestAddPropertyInSchemaUpdate(t *testing.T) {
+	jsonConfigBefore := `{
+		"collections": [
+		  {
+			"resource": "a"
+		  }
+		],
+		"singletons": [],
+		"blobs": [],
+		"shortcuts": []
+	  }
+	`
+	testServiceBefore := CreateTestService(jsonConfigBefore, t.Name())
+	defer testServiceBefore.Db.Close()
+
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "a",
+			"searchable_properties": ["searchable_prop"]
+		  }
+		],
+		"singletons": [],
+		"blobs": [],
+		"shortcuts": []
+	  }
+	`
+
+	testService := UpdateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	numberOfElements := 16
+	for i := 0; i < numberOfElements; i++ {
+		_, err := testService.client.WithAdminAuthorization().RawPost("/as",
+			A{
+				SearchableProp: "searchable_prop_" + strconv.Itoa(i%2),
+			}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var collectionResult []A
+
+	// Search in searchable_properties
+	_, err := testService.client.RawGet("/as?search=searchable_prop=searchable_prop_1", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 8 {
+		t.Fatalf("unexpected number of items in collection, expected 8, got %v %s", len(collectionResult), asJSON(collectionResult))
+	}
+	if collectionResult[0].SearchableProp != "searchable_prop_1" {
+		t.Fatal("wrong item in collection:", collectionResult[0].SearchableProp)
+	}
+}
+
+// TestDemoteSearchablePropertyInSchemaUpdate tests that turning a searchable property into a static property
+// drops the stale index but keeps the data
+func TestDemoteSearchablePropertyInSchemaUpdate(t *testing.T) {
+	jsonConfigBefore := `{
+		"collections": [
+		  {
+			"resource": "a",
+			"searchable_properties": ["searchable_prop"]
+		  }
+		],
+		"singletons": [],
+		"blobs": [],
+		"shortcuts": []
+	  }
+	`
+	testServiceBefore := CreateTestService(jsonConfigBefore, t.Name())
+	defer testServiceBefore.Db.Close()
+
+	var created A
+	_, err := testServiceBefore.client.RawPost("/as", A{SearchableProp: "searchable_prop_0"}, &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "a",
+			"static_properties": ["searchable_prop"]
+		  }
+		],
+		"singletons": [],
+		"blobs": [],
+		"shortcuts": []
+	  }
+	`
+	testService := UpdateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var count int
+	err = testService.Db.QueryRow("SELECT count(*) FROM pg_indexes WHERE schemaname = $1 AND tablename = 'a' AND indexname = 'searchable_property_a_searchable_prop';",
+		testService.Db.Schema).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, count, "stale searchable index should have been dropped")
+
+	var result A
+	_, err = testService.client.RawGet("/as/"+created.AID.String(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "searchable_prop_0", result.SearchableProp)
+}
+
+func TestSearchPattern(t *testing.T) {
+	jsonConfig := `{
+	"collections": [
+	  {
+		"resource": "a",
+		"external_index": "external_id",
+		"static_properties": ["static_prop"],
+		"searchable_properties": ["searchable_prop"]
+	  } 
+	],
+	"singletons": [],
+	"blobs": [],
+	"shortcuts": []
+  }
+`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	numberOfElements := 16
+	for i := 0; i < numberOfElements; i++ {
+		_, err := testService.client.WithAdminAuthorization().RawPost("/as",
+			A{
+				ExternalID:     "external_id_" + strconv.Itoa(i),
+				SearchableProp: "searchable_prop_" + strconv.Itoa(i%2),
+				Foo:            "foo_" + strconv.Itoa(i%8),
+			}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var collectionResult []A
+
+	// Search in external_index
+	_, err := testService.client.RawGet("/as?filter="+url.QueryEscape("external_id~%_id_1"), &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 1 {
+		t.Fatalf("unexpected number of items in collection, expected 1, got %v %v", len(collectionResult), asJSON(collectionResult))
+	}
+	if collectionResult[0].ExternalID != "external_id_1" {
+		t.Fatal("wrong item in collection:", collectionResult[0].ExternalID)
+	}
+
+	_, err = testService.client.RawGet("/as?filter="+url.QueryEscape("external_id~external%"), &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 16 {
+		t.Fatal("unexpected number of items in collection, expected 16, got", asJSON(collectionResult))
+	}
+
+	// Search in json document
+	_, err = testService.client.RawGet("/as?filter="+url.QueryEscape("foo~%o_1"), &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 2 {
+		t.Fatalf("unexpected number of items in collection, expected 2, got %v %s", len(collectionResult), asJSON(collectionResult))
+	}
+
+	// Search in unknown json document
+	_, err = testService.client.RawGet("/as?filter=foo2~foo_1", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 0 {
+		t.Fatalf("unexpected number of items in collection, expected 0, got %v %s", len(collectionResult), asJSON(collectionResult))
+	}
+
+	// Search in json document and searchable properties
+	_, err = testService.client.RawGet("/as?filter="+url.QueryEscape("foo~%o_0")+"&filter="+url.QueryEscape("searchable_prop~%_prop_0"), &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collectionResult) != 2 {
+		t.Fatalf("unexpected number of items in collection, expected 1, got %v %s", len(collectionResult), asJSON(collectionResult))
+	}
+	if collectionResult[0].Foo != "foo_0" {
+		t.Fatal("wrong item in collection:", collectionResult[0].Foo)
+	}
+	if collectionResult[0].SearchableProp != "searchable_prop_0" {
+		t.Fatal("wrong item in collection:", collectionResult[0].SearchableProp)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	a := A{ExternalID: t.Name()}
+	if _, err := testService.client.RawPost("/as", a, &a); err != nil {
+		t.Fatal(err)
+	}
+
+	var result A
+	status, err := testService.client.RawPatch("/as/"+a.AID.String(),
+		map[string]string{"foo": "new_foo"}, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK || result.Foo != "new_foo" {
+		t.Fatalf("patch did not work")
+	}
+
+	// patching an unknown object should return 404 not found
+	unknownID := uuid.New()
+	status, err = testService.client.RawPatch("/as/"+unknownID.String(),
+		map[string]string{"foo": "new_foo"}, &result)
+	if err == nil || status != http.StatusNotFound {
+		t.Fatalf("patch of unknown object did return %d", status)
+	}
+
+}
+
+func TestPatchWithoutChanges(t *testing.T) {
+	a := A{ExternalID: t.Name(), Foo: "foo"}
+	if _, err := testService.client.RawPost("/as", a, &a); err != nil {
+		t.Fatal(err)
+	}
+
+	type withRevision struct {
+		Revision int    `json:"revision"`
+		Foo      string `json:"foo"`
+	}
+	var created withRevision
+	if _, err := testService.client.RawGet("/as/"+a.AID.String(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	// neither an empty patch nor a patch with the current values bumps the revision
+	for _, patch := range []map[string]string{{}, {"foo": "foo"}} {
+		var result withRevision
+		status, err := testService.client.RawPatch("/as/"+a.AID.String(), patch, &result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, created.Revision, result.Revision)
+		assert.Equal(t, "foo", result.Foo)
+	}
+
+	var result withRevision
+	_, err := testService.client.RawPatch("/as/"+a.AID.String(), map[string]string{"foo": "bar"}, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, created.Revision+1, result.Revision)
+}
+
+func TestGetByIDs(t *testing.T) {
+	var first, second A
+	if _, err := testService.client.RawPost("/as", A{ExternalID: t.Name() + "1"}, &first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawPost("/as", A{ExternalID: t.Name() + "2"}, &second); err != nil {
+		t.Fatal(err)
+	}
+	missing := uuid.New()
+
+	ids := second.AID.String() + "," + missing.String() + "," + first.AID.String()
+	var response struct {
+		Items    []A      `json:"items"`
+		NotFound []string `json:"not_found"`
+	}
+	if _, err := testService.client.RawGet("/as?ids="+ids, &response); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 2, len(response.Items)) {
+		assert.Equal(t, second.AID, response.Items[0].AID)
+		assert.Equal(t, first.AID, response.Items[1].AID)
+	}
+	assert.Equal(t, []string{missing.String()}, response.NotFound)
+
+	if _, err := testService.client.RawGet("/as?ids=not-a-uuid", &response); err == nil {
+		t.Fatal("expected an error for an invalid id")
+	}
+	if _, err := testService.client.RawGet("/as?ids="+ids+"&limit=2", &response); err == nil {
+		t.Fatal("expected an error for ids combined with other parameters")
+	}
+}
+
+func TestGeneratedProperties(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "a",
+			"generated_properties": [
+				{"name": "price_cents", "type": "int", "path": "price.cents"}
+			]
+		  }
+		],
+		"singletons": [],
+		"blobs": [],
+		"shortcuts": []
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type price struct {
+		Cents interface{} `json:"cents"`
+	}
+	type withPrice struct {
+		AID   uuid.UUID `json:"a_id"`
+		Price price     `json:"price"`
+	}
+
+	for i := 0; i < 4; i++ {
+		_, err := testService.client.RawPost("/as", withPrice{Price: price{Cents: 100 * (i % 2)}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var collectionResult []withPrice
+	_, err := testService.client.RawGet("/as?search=price_cents=100", &collectionResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(collectionResult))
+	for _, item := range collectionResult {
+		assert.Equal(t, float64(100), item.Price.Cents)
+	}
+
+	status, err := testService.client.RawPost("/as", withPrice{Price: price{Cents: "not a number"}}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// numbers cannot be searched with a pattern, and filter values must have the type of the column
+	for _, query := range []string{"search=price_cents~=10", "filter=price_cents=abc", "filter_or=price_cents=abc"} {
+		status, err = testService.client.RawGet("/as?"+query, &collectionResult)
+		assert.NotNil(t, err, query)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+}
+
+func TestPartialIndices(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "device",
+			"searchable_properties": ["provisioning_status"],
+			"partial_indices": [{"property": "provisioning_status", "value": "waiting"}]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var definition string
+	err := testService.Db.QueryRow("SELECT indexdef FROM pg_indexes WHERE schemaname = $1 AND tablename = 'device' AND indexname LIKE 'partial_index_device_provisioning_status_%';",
+		testService.Db.Schema).Scan(&definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, definition, "WHERE ((provisioning_status)::text = 'waiting'::text)")
+
+	for _, status := range []string{"provisioned", "waiting", "provisioned"} {
+		if _, err := testService.client.RawPost("/devices", map[string]string{"provisioning_status": status}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var devices []map[string]interface{}
+	if _, err := testService.client.RawGet("/devices?filter=provisioning_status=waiting", &devices); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, devices, 1)
+}
+
+func TestCheckConstraints(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "product",
+			"check_constraints": [
+				{"name": "price_not_negative", "check": "(properties->>'price')::numeric >= 0", "message": "price must not be negative"}
+			]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var product map[string]interface{}
+	if _, err := testService.client.RawPost("/products", map[string]interface{}{"price": 10}, &product); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := testService.client.RawPost("/products", map[string]interface{}{"price": -1}, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "price must not be negative")
+	}
+
+	status, _ = testService.client.RawPatch("/products/"+product["product_id"].(string), map[string]interface{}{"price": -5}, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+
+	// force bypasses the schema validation, but not the constraint
+	product["price"] = -5
+	status, _ = testService.client.RawPut("/products?force=true", product, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+}
+
+func TestIDVersion(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "event",
+			"id_version": 7
+		  },
+		  {
+			"resource": "item"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var ids []uuid.UUID
+	for i := 0; i < 3; i++ {
+		var event map[string]interface{}
+		if _, err := testService.client.RawPost("/events", map[string]interface{}{"n": i}, &event); err != nil {
+			t.Fatal(err)
+		}
+		id, err := uuid.Parse(event["event_id"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uuid.Version(7), id.Version())
+		ids = append(ids, id)
+		time.Sleep(2 * time.Millisecond)
+	}
+	// time-ordered identifiers sort in the order of their creation
+	assert.True(t, ids[0].String() < ids[1].String() && ids[1].String() < ids[2].String())
+
+	// client provided identifiers are honored
+	clientID := uuid.New()
+	var event map[string]interface{}
+	if _, err := testService.client.RawPut("/events", map[string]interface{}{"event_id": clientID}, &event); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, clientID.String(), event["event_id"])
+
+	var item map[string]interface{}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{}, &item); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uuid.Version(4), uuid.MustParse(item["item_id"].(string)).Version())
+}
+
+func TestWeakListEtag(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item",
+			"weak_list_etag": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var item map[string]interface{}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{"name": "a"}, &item); err != nil {
+		t.Fatal(err)
+	}
+	id := item["item_id"].(string)
+
+	var items []map[string]interface{}
+	status, h, err := testService.client.RawGetWithHeader("/items", map[string]string{}, &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, items, 1)
+	etag := h.Get("Etag")
+	assert.True(t, strings.HasPrefix(etag, "W/"), etag)
+
+	status, _, _ = testService.client.RawGetWithHeader("/items", map[string]string{"If-None-Match": etag}, &items)
+	assert.Equal(t, http.StatusNotModified, status)
+
+	// an update changes the revision and hence the validator
+	if _, err := testService.client.RawPatch("/items/"+id, map[string]interface{}{"name": "b"}, &item); err != nil {
+		t.Fatal(err)
+	}
+	status, h, err = testService.client.RawGetWithHeader("/items", map[string]string{"If-None-Match": etag}, &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, etag, h.Get("Etag"))
+
+	// a different query has a different validator
+	status, _, err = testService.client.RawGetWithHeader("/items?limit=10", map[string]string{"If-None-Match": h.Get("Etag")}, &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestWeakListEtagWithInterceptor(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item",
+			"weak_list_etag": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	// the interceptor changes the response without changing the stored data
+	calls := 0
+	testService.backend.HandleResourceRequest("item", func(ctx context.Context, request backend.Request, data []byte) ([]byte, error) {
+		calls++
+		return []byte(fmt.Sprintf(`[{"call":%d}]`, calls)), nil
+	}, core.OperationList)
+
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{"name": "a"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	status, h, err := testService.client.RawGetWithHeader("/items", map[string]string{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, status)
+	etag := h.Get("Etag")
+	assert.False(t, strings.HasPrefix(etag, "W/"), etag)
+
+	var items []map[string]interface{}
+	status, h, err = testService.client.RawGetWithHeader("/items", map[string]string{"If-None-Match": etag}, &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(2), items[0]["call"])
+	assert.NotEqual(t, etag, h.Get("Etag"))
+}
+
+func TestChangeFeed(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item",
+			"with_changes": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var a, b map[string]interface{}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{"name": "a"}, &a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{"name": "b"}, &b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawPatch("/items/"+a["item_id"].(string), map[string]interface{}{"name": "a2"}, &a); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes backend.ChangesResponse
+	if _, err := testService.client.RawGet("/items/changes", &changes); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, changes.Changes, 2) {
+		// a was changed last, so it comes last, and only with its last change
+		assert.Equal(t, b["item_id"], changes.Changes[0].ID.String())
+		assert.Equal(t, "create", changes.Changes[0].Operation)
+		assert.Equal(t, a["item_id"], changes.Changes[1].ID.String())
+		assert.Equal(t, "update", changes.Changes[1].Operation)
+		var item map[string]interface{}
+		json.Unmarshal(changes.Changes[1].Item, &item)
+		assert.Equal(t, "a2", item["name"])
+	}
+	assert.False(t, changes.More)
+
+	// nothing changed since the last token
+	token := changes.Next
+	if _, err := testService.client.RawGet("/items/changes?since="+token, &changes); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, changes.Changes, 0)
+	assert.Equal(t, token, changes.Next)
+
+	// deletes are reported as tombstones
+	if _, err := testService.client.RawDelete("/items/" + b["item_id"].(string)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawGet("/items/changes?since="+token, &changes); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, changes.Changes, 1) {
+		assert.Equal(t, b["item_id"], changes.Changes[0].ID.String())
+		assert.Equal(t, "delete", changes.Changes[0].Operation)
+		assert.Nil(t, changes.Changes[0].Item)
+	}
+
+	// pagination with limit
+	if _, err := testService.client.RawGet("/items/changes?limit=1", &changes); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, changes.Changes, 1)
+	assert.True(t, changes.More)
+
+	if _, err := testService.client.RawGet("/items/changes?since=invalid", &changes); err == nil {
+		t.Fatal("invalid token must be rejected")
+	}
+}
+
+func TestPruneChanges(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item",
+			"with_changes": true,
+			"changes_retention_days": 1
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var a, b map[string]interface{}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{"name": "a"}, &a); err != nil {
+		t.Fatal(err)
+	}
+	var changes backend.ChangesResponse
+	if _, err := testService.client.RawGet("/items/changes", &changes); err != nil {
+		t.Fatal(err)
+	}
+	token := changes.Next
+
+	if _, err := testService.client.RawDelete("/items/" + a["item_id"].(string)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{"name": "b"}, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	// age the tombstone of a beyond the retention
+	_, err := testService.Db.Exec(`UPDATE `+testService.Db.Schema+`."item/changes" SET timestamp = now() - interval '2 days' WHERE item_id = $1;`,
+		a["item_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawPut("/kurbisio/changes/prune", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the token points before the pruned tombstone, so it expired
+	status, _ := testService.client.RawGet("/items/changes?since="+token, &changes)
+	assert.Equal(t, http.StatusGone, status)
+
+	status, _ = testService.client.RawGet("/items/changes", &changes)
+	assert.Equal(t, http.StatusGone, status)
+
+	// a full synchronization continues with the latest token
+	if _, err := testService.client.RawGet("/items/changes?since=now", &changes); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, changes.Changes, 0)
+	token = changes.Next
+	if _, err := testService.client.RawPatch("/items/"+b["item_id"].(string), map[string]interface{}{"name": "b2"}, &b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawGet("/items/changes?since="+token, &changes); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, changes.Changes, 1) {
+		assert.Equal(t, b["item_id"], changes.Changes[0].ID.String())
+		assert.Equal(t, "update", changes.Changes[0].Operation)
+	}
+}
+
+func TestItemHistory(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item",
+			"with_changes": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	alice := testService.client.WithContext(access.ContextWithIdentity(context.Background(), "alice"))
+	bob := testService.client.WithContext(access.ContextWithIdentity(context.Background(), "bob"))
+
+	var a, b map[string]interface{}
+	if _, err := alice.RawPost("/items", map[string]interface{}{"name": "a"}, &a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.RawPost("/items", map[string]interface{}{"name": "b"}, &b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.RawPatch("/items/"+a["item_id"].(string), map[string]interface{}{"name": "a2"}, &a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawDelete("/items/" + a["item_id"].(string)); err != nil {
+		t.Fatal(err)
+	}
+
+	var history []backend.HistoryEntry
+	if _, err := testService.client.RawGet("/items/"+a["item_id"].(string)+"/history", &history); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, "create", history[0].Operation)
+		assert.Equal(t, "alice", history[0].Actor)
+		assert.Equal(t, "update", history[1].Operation)
+		assert.Equal(t, "bob", history[1].Actor)
+		assert.Equal(t, "delete", history[2].Operation)
+		assert.Equal(t, "", history[2].Actor)
+		assert.False(t, history[0].Timestamp.After(history[2].Timestamp))
+	}
+
+	// changes of other items are not part of the history
+	if _, err := testService.client.RawGet("/items/"+b["item_id"].(string)+"/history", &history); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, history, 1)
+
+	if _, err := testService.client.RawGet("/items/"+uuid.New().String()+"/history", &history); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, history, 0)
+}
+
+func TestReadDeletedItem(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item",
+			"with_changes": true
+		  },
+		  {
+			"resource": "other"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var item, other map[string]interface{}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{}, &item); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawPost("/others", map[string]interface{}{}, &other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawDelete("/items/" + item["item_id"].(string)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawDelete("/others/" + other["other_id"].(string)); err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ := testService.client.RawGet("/items/"+item["item_id"].(string), nil)
+	assert.Equal(t, http.StatusGone, status)
+
+	// an item which never existed is not found
+	status, _ = testService.client.RawGet("/items/"+uuid.New().String(), nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// without change feed, deleted items are not found either
+	status, _ = testService.client.RawGet("/others/"+other["other_id"].(string), nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestUpdatePropertyWithRevision(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item",
+			"static_properties": ["name"]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var item map[string]interface{}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{"name": "a"}, &item); err != nil {
+		t.Fatal(err)
+	}
+	path := "/items/" + item["item_id"].(string)
+
+	// revision 1 matches
+	if _, err := testService.client.RawPut(path+"/name/b?revision=1", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// revision 1 is outdated now, the conflicting object is returned
+	status, err := testService.client.RawPut(path+"/name/c?revision=1", nil, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusConflict, status)
+	if _, err := testService.client.RawGet(path, &item); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "b", item["name"])
+	assert.Equal(t, float64(2), item["revision"])
+
+	// without revision, the update is not checked
+	if _, err := testService.client.RawPut(path+"/name/c", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ = testService.client.RawPut("/items/"+uuid.New().String()+"/name/c?revision=1", nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestNoRevision(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "event",
+			"static_properties": ["kind"],
+			"no_revision": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var event map[string]interface{}
+	if _, err := testService.client.RawPost("/events", map[string]interface{}{"kind": "a", "value": 1}, &event); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, event, "revision")
+	path := "/events/" + event["event_id"].(string)
+
+	// revisions are ignored, hence there are no conflicts
+	if _, err := testService.client.RawPatch(path, map[string]interface{}{"value": 2, "revision": 5}, &event); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, float64(2), event["value"])
+	assert.NotContains(t, event, "revision")
+	if _, err := testService.client.RawPut(path+"/kind/b?revision=5", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testService.client.RawGet(path, &event); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "b", event["kind"])
+	assert.NotContains(t, event, "revision")
+
+	var events []map[string]interface{}
+	if _, err := testService.client.RawGet("/events", &events); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, events, 1) {
+		assert.NotContains(t, events[0], "revision")
+	}
+
+	var columns int
+	err := testService.Db.QueryRow("SELECT count(*) FROM information_schema.columns WHERE table_schema = $1 AND table_name = 'event' AND column_name = 'revision';",
+		testService.Db.Schema).Scan(&columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, columns)
+}
+
+func TestUpdatePropertyBulk(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "device",
+			"searchable_properties": ["provisioning_status"]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	for _, status := range []string{"waiting", "waiting", "provisioned", "failed"} {
+		if _, err := testService.client.RawPost("/devices", map[string]string{"provisioning_status": status}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var response backend.BulkUpdateResponse
+	if _, err := testService.client.RawPut("/devices/provisioning_status/provisioned?filter=provisioning_status=waiting", nil, &response); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, response.Updated)
+
+	var devices []map[string]interface{}
+	if _, err := testService.client.RawGet("/devices?filter=provisioning_status=provisioned", &devices); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, devices, 3) {
+		revisions := map[float64]int{}
+		for _, device := range devices {
+			revisions[device["revision"].(float64)]++
+		}
+		// the device which was provisioned already keeps its revision
+		assert.Equal(t, map[float64]int{1: 1, 2: 2}, revisions)
+	}
+
+	// without filter, all devices are updated which do not have the value yet
+	if _, err := testService.client.RawPut("/devices/provisioning_status/provisioned", nil, &response); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, response.Updated)
+
+	status, _ := testService.client.RawPut("/devices/provisioning_status/waiting?filter=name=x", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestListAsCSV(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item",
+			"static_properties": ["kind"],
+			"csv_properties": ["name", "address"]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var item map[string]interface{}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{
+		"kind":    "a",
+		"name":    "Smith, John",
+		"address": map[string]interface{}{"city": "Berlin"},
+		"other":   "not a column",
+	}, &item); err != nil {
+		t.Fatal(err)
+	}
+
+	var data []byte
+	status, h, err := testService.client.RawGetBlobWithHeader("/items?format=csv", map[string]string{}, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "text/csv; charset=utf-8", h.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="items.csv"`, h.Get("Content-Disposition"))
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, []string{"item_id", "kind", "timestamp", "revision", "name", "address"}, records[0])
+		assert.Equal(t, []string{item["item_id"].(string), "a", item["timestamp"].(string), "1", "Smith, John", `{"city":"Berlin"}`}, records[1])
+	}
+
+	status, _ = testService.client.RawGet("/items?format=xml", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestFilterZeroUUID(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user"
+		  },
+		  {
+			"resource": "user/device"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	// creating with the zero UUID creates a new identifier
+	zero := uuid.Nil.String()
+	var user map[string]interface{}
+	if _, err := testService.client.RawPost("/users", map[string]interface{}{"user_id": zero}, &user); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, zero, user["user_id"])
+	if _, err := testService.client.RawPost("/users/"+user["user_id"].(string)+"/devices", map[string]interface{}{"ref": zero}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// filters on identifiers reject the zero UUID
+	var devices []map[string]interface{}
+	for _, filter := range []string{"user_id=" + zero, "device_id=" + zero} {
+		status, _ := testService.client.RawGet("/users/all/devices?filter="+filter, &devices)
+		assert.Equal(t, http.StatusBadRequest, status, filter)
+	}
+	status, _ := testService.client.RawDelete("/users/all/devices?filter=user_id=" + zero)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// properties of the JSON document are no identifiers
+	if _, err := testService.client.RawGet("/users/all/devices?filter=ref="+zero, &devices); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, devices, 1)
+}
+
+func TestFilterOr(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "device",
+			"searchable_properties": ["status"]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	devices := []map[string]interface{}{
+		{"name": "a", "status": "active", "color": "red"},
+		{"name": "b", "status": "pending", "color": "red"},
+		{"name": "c", "status": "pending", "color": "blue"},
+		{"name": "d", "status": "retired", "color": "red"},
+		{"name": "e", "status": "retired", "color": "green"},
+	}
+	for _, device := range devices {
+		if _, err := testService.client.RawPost("/devices", device, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	find := func(query string) []string {
+		var items []map[string]interface{}
+		if _, err := testService.client.RawGet("/devices?order=asc&"+query, &items); err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, item := range items {
+			names = append(names, item["name"].(string))
+		}
+		return names
+	}
+
+	// searchable properties
+	assert.Equal(t, []string{"a", "b", "c"}, find("filter_or=status=active&filter_or=status=pending"))
+	// properties of the json document, and both mixed
+	assert.Equal(t, []string{"c", "e"}, find("filter_or=color=blue&filter_or=color=green"))
+	assert.Equal(t, []string{"a", "e"}, find("filter_or=status=active&filter_or=color=green"))
+	// the group is combined with the other filters with AND
+	assert.Equal(t, []string{"a", "b"}, find("filter_or=status=active&filter_or=status=pending&filter=color=red"))
+	assert.Equal(t, []string{"b"}, find("filter_or=status=active&filter_or=status=pending&filter=color=red&filter=name=b"))
+	// patterns
+	assert.Equal(t, []string{"b", "c", "d", "e"}, find("filter_or=status~=pend&filter_or=status~=tired"))
+
+	status, _ := testService.client.RawGet("/devices?filter_or=status", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestFilterContainsLiteral(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item",
+			"searchable_properties": ["label"]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	for _, label := range []string{"50% off", "500 off", "a_b", "axb"} {
+		if _, err := testService.client.RawPost("/items", map[string]interface{}{"label": label, "name": label}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	find := func(filter string) []string {
+		var items []map[string]interface{}
+		if _, err := testService.client.RawGet("/items?order=asc&filter="+url.QueryEscape(filter), &items); err != nil {
+			t.Fatal(err)
+		}
+		labels := []string{}
+		for _, item := range items {
+			labels = append(labels, item["label"].(string))
+		}
+		return labels
+	}
+
+	// a pattern treats % and _ as wildcards
+	assert.Equal(t, []string{"50% off", "500 off"}, find("label~50%"))
+	assert.Equal(t, []string{"a_b", "axb"}, find("label~a_b"))
+
+	// contains searches literally, for searchable properties and for properties of the json document
+	assert.Equal(t, []string{"50% off"}, find("label~=50%"))
+	assert.Equal(t, []string{"a_b"}, find("label~=_"))
+	assert.Equal(t, []string{"50% off"}, find("name~=0%"))
+	assert.Equal(t, []string{"a_b"}, find(`name~=a_`))
+}
+
+func TestAfterCommit(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var operations []core.Operation
+	var payloads []map[string]interface{}
+	testService.backend.HandleAfterCommit("item", func(ctx context.Context, n backend.Notification) {
+		// the change is committed already, so it is visible outside of the transaction
+		var count int
+		testService.Db.QueryRow(`SELECT count(*) FROM `+testService.Db.Schema+`."item" WHERE item_id = $1;`, n.ResourceID).Scan(&count)
+		if n.Operation == core.OperationDelete {
+			assert.Equal(t, 0, count)
+		} else {
+			assert.Equal(t, 1, count)
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(n.Payload, &payload)
+		operations = append(operations, n.Operation)
+		payloads = append(payloads, payload)
+	})
+
+	var item map[string]interface{}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{"name": "a"}, &item); err != nil {
+		t.Fatal(err)
+	}
+	path := "/items/" + item["item_id"].(string)
+	if _, err := testService.client.Silent().RawPatch(path, map[string]interface{}{"name": "b"}, &item); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawDelete(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed request does not call the hook
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{"name": "c"}, &item); err != nil {
+		t.Fatal(err)
+	}
+	path = "/items/" + item["item_id"].(string)
+	if _, err := testService.client.RawPatch(path, map[string]interface{}{"name": "d", "revision": 7}, nil); err == nil {
+		t.Fatal("outdated revision must fail")
+	}
+
+	assert.Equal(t, []core.Operation{core.OperationCreate, core.OperationUpdate, core.OperationDelete, core.OperationCreate}, operations)
+	assert.Equal(t, "a", payloads[0]["name"])
+	assert.Equal(t, "b", payloads[1]["name"])
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "ticket",
+			"default": {"status": "new", "owner_id": "{{auth.user_id}}", "created_date": "{{now}}"}
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(configurationJSON, t.Name())
+	defer testService.Db.Close()
+
+	userID := uuid.New().String()
+	client := testService.client.WithAuthorization(&access.Authorization{
+		Roles:     []string{"admin"},
+		Selectors: map[string]string{"user_id": userID},
+	})
+
+	before := time.Now().UTC()
+	var ticket map[string]interface{}
+	if _, err := client.RawPost("/tickets", map[string]interface{}{}, &ticket); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "new", ticket["status"])
+	assert.Equal(t, userID, ticket["owner_id"])
+	created, err := time.Parse(time.RFC3339Nano, ticket["created_date"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Before(before) {
+		t.Fatalf("created_date %v is before the request", created)
+	}
+
+	// explicit values win over templates
+	if _, err := client.RawPost("/tickets", map[string]interface{}{"owner_id": "somebody"}, &ticket); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "somebody", ticket["owner_id"])
+
+	// templates are resolved at create time only, so a request without the selector does not get an owner
+	if _, err := testService.client.RawPost("/tickets", map[string]interface{}{}, &ticket); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "new", ticket["status"])
+	assert.Nil(t, ticket["owner_id"])
+	id := ticket["ticket_id"].(string)
+	if _, err := client.RawGet("/tickets/"+id, &ticket); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, ticket["owner_id"])
+}
+
+func TestRoleDefaults(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "review",
+			"default": {"verified": false, "status": "new"},
+			"role_defaults": {
+				"admin": {"verified": true},
+				"everybody": {"status": "submitted", "author_id": "{{auth.user_id}}"}
+			},
+			"permits": [{"role": "reviewer", "operations": ["create", "read"]}]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(configurationJSON, t.Name())
+	defer testService.Db.Close()
+
+	userID := uuid.New().String()
+	reviewer := testService.clientNoAuth.WithAuthorization(&access.Authorization{
+		Roles:     []string{"reviewer"},
+		Selectors: map[string]string{"user_id": userID},
+	})
+
+	var review map[string]interface{}
+	if _, err := reviewer.RawPost("/reviews", map[string]interface{}{}, &review); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, false, review["verified"])
+	assert.Equal(t, "submitted", review["status"])
+	assert.Equal(t, userID, review["author_id"])
+
+	// admin gets its own default on top of the one of everybody
+	if _, err := testService.client.RawPost("/reviews", map[string]interface{}{}, &review); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, true, review["verified"])
+	assert.Equal(t, "submitted", review["status"])
+	assert.Nil(t, review["author_id"])
+
+	// explicit values win over role defaults
+	if _, err := testService.client.RawPost("/reviews", map[string]interface{}{"verified": false}, &review); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, false, review["verified"])
+}
+
+func TestAppendToArray(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "post"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(configurationJSON, t.Name())
+	defer testService.Db.Close()
+
+	var post map[string]interface{}
+	if _, err := testService.client.RawPost("/posts", map[string]interface{}{"tags": []string{"a"}}, &post); err != nil {
+		t.Fatal(err)
+	}
+	path := "/posts/" + post["post_id"].(string)
+
+	if _, err := testService.client.RawPost(path+"/properties/tags/append", []string{"b", "a"}, &post); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []interface{}{"a", "b", "a"}, post["tags"])
+	assert.Equal(t, float64(2), post["revision"])
+
+	if _, err := testService.client.RawPost(path+"/properties/tags/append?unique=true", []string{"b", "c"}, &post); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []interface{}{"a", "b", "a", "c"}, post["tags"])
+
+	// a missing property becomes a new array
+	if _, err := testService.client.RawPost(path+"/properties/labels/append", []int{1}, &post); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []interface{}{float64(1)}, post["labels"])
+
+	// outdated revisions conflict
+	status, _ := testService.client.RawPost(path+"/properties/tags/append?revision=1", []string{"d"}, nil)
+	assert.Equal(t, http.StatusConflict, status)
+
+	// only arrays can be appended to
+	if _, err := testService.client.RawPatch(path, map[string]interface{}{"name": "x"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	status, _ = testService.client.RawPost(path+"/properties/name/append", []string{"y"}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = testService.client.RawPost("/posts/"+uuid.New().String()+"/properties/tags/append", []string{"y"}, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestMaxConcurrentWrites(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "hot",
+			"max_concurrent_writes": 1
+		  },
+		  {
+			"resource": "cold"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(configurationJSON, t.Name())
+	defer testService.Db.Close()
+
+	// the first create blocks in its interceptor until released
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	testService.backend.HandleResourceRequest("hot", func(ctx context.Context, request backend.Request, data []byte) ([]byte, error) {
+		if blocked != nil {
+			close(blocked)
+			blocked = nil
+			<-release
+		}
+		return data, nil
+	}, core.OperationCreate)
+
+	wait := blocked
+	done := make(chan error)
+	go func() {
+		_, err := testService.client.RawPost("/hots", map[string]interface{}{}, nil)
+		done <- err
+	}()
+	<-wait
+
+	status, _ := testService.client.RawPost("/hots", map[string]interface{}{}, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	// other resources are not affected
+	if _, err := testService.client.RawPost("/colds", map[string]interface{}{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawPost("/hots", map[string]interface{}{}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListMaxAgeCache(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "article",
+			"max_age_cache": 60
+		  },
+		  {
+			"resource": "note"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	request := func(method, path string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader("{}"))
+		r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		testService.Router.ServeHTTP(rec, r)
+		return rec
+	}
+
+	// writes are never cached
+	rec := request(http.MethodPost, "/articles", nil)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	rec = request(http.MethodGet, "/articles", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "max-age=60", rec.Header().Get("Cache-Control"))
+	expires, err := http.ParseTime(rec.Header().Get("Expires"))
+	if assert.NoError(t, err) {
+		assert.WithinDuration(t, time.Now().Add(60*time.Second), expires, 5*time.Second)
+	}
+
+	// not modified responses carry the cache headers as well
+	rec = request(http.MethodGet, "/articles", map[string]string{"If-None-Match": rec.Header().Get("Etag")})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, "max-age=60", rec.Header().Get("Cache-Control"))
+
+	// errors are not cached
+	rec = request(http.MethodGet, "/articles?limit=nope", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Empty(t, rec.Header().Get("Cache-Control"))
+
+	// collections without max_age_cache are not affected
+	rec = request(http.MethodPost, "/notes", nil)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, rec.Header().Get("Cache-Control"))
+	rec = request(http.MethodGet, "/notes", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Cache-Control"))
+	assert.Empty(t, rec.Header().Get("Expires"))
+}
+
+func TestCoalesceReads(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "hot",
+			"coalesce_reads": true
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(configurationJSON, t.Name())
+	defer testService.Db.Close()
+
+	var item map[string]interface{}
+	if _, err := testService.client.RawPost("/hots", map[string]interface{}{"name": "a"}, &item); err != nil {
+		t.Fatal(err)
+	}
+	path := "/hots/" + item["hot_id"].(string)
+
+	// the first read blocks in its interceptor until released
+	var reads atomic.Int32
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	testService.backend.HandleResourceRequest("hot", func(ctx context.Context, request backend.Request, data []byte) ([]byte, error) {
+		if reads.Add(1) == 1 {
+			close(blocked)
+			<-release
+		}
+		return data, nil
+	}, core.OperationRead)
+
+	done := make(chan map[string]interface{}, 3)
+	read := func() {
+		var result map[string]interface{}
+		if _, err := testService.client.RawGet(path, &result); err != nil {
+			t.Error(err)
+		}
+		done <- result
+	}
+	go read()
+	<-blocked
+	go read()
+	go read()
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "a", (<-done)["name"])
+	}
+	assert.Equal(t, int32(1), reads.Load())
+
+	// every request evaluates its own If-None-Match
+	var result map[string]interface{}
+	status, h, err := testService.client.RawGetWithHeader(path, map[string]string{}, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, status)
+	status, _, _ = testService.client.RawGetWithHeader(path, map[string]string{"If-None-Match": h.Get("Etag")}, &result)
+	assert.Equal(t, http.StatusNotModified, status)
+}
+
+func TestReturnChanged(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "profile"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(configurationJSON, t.Name())
+	defer testService.Db.Close()
+
+	var created map[string]interface{}
+	if _, err := testService.client.RawPost("/profiles", map[string]interface{}{"name": "a", "city": "Berlin", "bio": "long text"}, &created); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 2 {
-		t.Fatalf("unexpected number of items in collection, expected 2, got %v %s", len(collectionResult), asJSON(collectionResult))
+	path := "/profiles/" + created["profile_id"].(string)
+
+	var changed map[string]interface{}
+	if _, err := testService.client.RawPatch(path+"?return=changed", map[string]interface{}{"city": "Hamburg", "bio": nil}, &changed); err != nil {
+		t.Fatal(err)
 	}
-	if collectionResult[0].Foo != "foo_1" {
-		t.Fatal("wrong item in collection:", collectionResult[0].Foo)
+	assert.Equal(t, map[string]interface{}{
+		"profile_id": created["profile_id"],
+		"revision":   float64(2),
+		"city":       "Hamburg",
+		"bio":        nil,
+	}, changed)
+
+	// a patch which changes nothing returns the identifiers only
+	changed = nil
+	if _, err := testService.client.RawPatch(path+"?return=changed", map[string]interface{}{"city": "Hamburg"}, &changed); err != nil {
+		t.Fatal(err)
 	}
+	assert.Equal(t, map[string]interface{}{"profile_id": created["profile_id"], "revision": float64(2)}, changed)
+}
 
-	// Search in unknown json document
-	_, err = testService.client.RawGet("/as?filter=foo2=foo_1", &collectionResult)
-	if err != nil {
+func TestStrictSchemas(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "unvalidated",
+			"schema_id": "https://example.com/missing.json"
+		  }
+		]
+	  }
+	`
+	assert.Panics(t, func() {
+		CreateTestServiceWithBuilder(configurationJSON, t.Name(), func(b *backend.Builder) {
+			b.StrictSchemas = true
+		})
+	})
+
+	// without strict schemas, validation is deactivated
+	testService := CreateTestService(configurationJSON, t.Name())
+	defer testService.Db.Close()
+	if _, err := testService.client.RawPost("/unvalidateds", map[string]interface{}{"anything": "goes"}, nil); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 0 {
-		t.Fatalf("unexpected number of items in collection, expected 0, got %v %s", len(collectionResult), asJSON(collectionResult))
+}
+
+func TestSchemaPerOperation(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "account",
+			"schema_id_create": "https://example.com/account_create.json",
+			"schema_id_update": "https://example.com/account_update.json",
+			"reject_unknown_properties": true
+		  }
+		]
+	  }
+	`
+	createSchema := `{
+		"$id": "https://example.com/account_create.json",
+		"type": "object",
+		"properties": {"name": {"type": "string"}, "password": {"type": "string"}},
+		"required": ["name", "password"]
+	}`
+	updateSchema := `{
+		"$id": "https://example.com/account_update.json",
+		"type": "object",
+		"properties": {"name": {"type": "string"}},
+		"required": ["name"]
+	}`
+	testService := CreateTestServiceWithBuilder(configurationJSON, t.Name(), func(b *backend.Builder) {
+		b.JSONSchemas = []string{createSchema, updateSchema}
+	})
+	defer testService.Db.Close()
+
+	status, _ := testService.client.RawPost("/accounts", map[string]interface{}{"name": "a"}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	var account map[string]interface{}
+	if _, err := testService.client.RawPost("/accounts", map[string]interface{}{"name": "a", "password": "secret"}, &account); err != nil {
+		t.Fatal(err)
 	}
+	path := "/accounts/" + account["account_id"].(string)
 
-	// Search in json document and searchable properties
-	_, err = testService.client.RawGet("/as?filter=foo=foo_0&filter=searchable_prop=searchable_prop_0", &collectionResult)
-	if err != nil {
+	// the password is optional on update
+	if _, err := testService.client.RawPut(path, map[string]interface{}{"name": "b"}, nil); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 2 {
-		t.Fatalf("unexpected number of items in collection, expected 1, got %v %s", len(collectionResult), asJSON(collectionResult))
+	status, _ = testService.client.RawPut(path, map[string]interface{}{"password": "secret"}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// an upsert which creates is validated as a create
+	status, _ = testService.client.RawPut("/accounts/"+uuid.New().String(), map[string]interface{}{"name": "c"}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// unknown properties are rejected based on the create and update schemas
+	status, _ = testService.client.RawPost("/accounts", map[string]interface{}{"name": "d", "password": "secret", "nickname": "x"}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = testService.client.RawPatch(path, map[string]interface{}{"nickname": "x"}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestMaxListResponseBytes(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "document"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestServiceWithBuilder(configurationJSON, t.Name(), func(b *backend.Builder) {
+		b.MaxListResponseBytes = 2000
+	})
+	defer testService.Db.Close()
+
+	for i := 0; i < 5; i++ {
+		body := map[string]interface{}{"text": strings.Repeat("x", 500)}
+		if _, err := testService.client.RawPost("/documents", body, nil); err != nil {
+			t.Fatal(err)
+		}
 	}
-	if collectionResult[0].Foo != "foo_0" {
-		t.Fatal("wrong item in collection:", collectionResult[0].Foo)
+
+	status, err := testService.client.RawGet("/documents", nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "limit=")
 	}
-	if collectionResult[0].SearchableProp != "searchable_prop_0" {
-		t.Fatal("wrong item in collection:", collectionResult[0].SearchableProp)
+
+	var documents []map[string]interface{}
+	if _, err := testService.client.RawGet("/documents?limit=2", &documents); err != nil {
+		t.Fatal(err)
 	}
+	assert.Len(t, documents, 2)
 }
 
-// TestAddPropertyInSchemaUpdate test adding a complely new searchable property in a schema update
-func TestAddPropertyInSchemaUpdate(t *testing.T) {
-	jsonConfigBefore := `{
+func TestEncryptedProperties(t *testing.T) {
+	jsonConfig := `{
 		"collections": [
 		  {
-			"resource": "a"
+			"resource": "person",
+			"encrypted_properties": ["ssn", "medical"]
 		  }
-		],
-		"singletons": [],
-		"blobs": [],
-		"shortcuts": []
+		]
 	  }
 	`
-	testServiceBefore := CreateTestService(jsonConfigBefore, t.Name())
-	defer testServiceBefore.Db.Close()
+	testService := CreateTestServiceWithBuilder(jsonConfig, t.Name(), func(b *backend.Builder) {
+		b.EncryptionKeys = map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")}
+		b.EncryptionKeyID = "k1"
+	})
+	defer testService.Db.Close()
+
+	var person map[string]interface{}
+	body := map[string]interface{}{
+		"name":    "alice",
+		"ssn":     "078-05-1120",
+		"medical": map[string]interface{}{"blood_type": "0+"},
+	}
+	if _, err := testService.client.RawPost("/persons", body, &person); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "078-05-1120", person["ssn"])
+	id := person["person_id"].(string)
+
+	// the database only has the ciphertext
+	var stored string
+	err := testService.Db.QueryRow(`SELECT properties::TEXT FROM `+testService.Db.Schema+`."person" WHERE person_id = $1;`, id).Scan(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, stored, "078-05-1120")
+	assert.NotContains(t, stored, "blood_type")
+	assert.Contains(t, stored, "alice")
+
+	// reads, lists and updates see the plaintext
+	var read map[string]interface{}
+	if _, err = testService.client.RawGet("/persons/"+id, &read); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "078-05-1120", read["ssn"])
+	assert.Equal(t, map[string]interface{}{"blood_type": "0+"}, read["medical"])
+
+	if _, err = testService.client.RawPatch("/persons/"+id, map[string]interface{}{"name": "alicia"}, &read); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "078-05-1120", read["ssn"])
+
+	var persons []map[string]interface{}
+	if _, err = testService.client.RawGet("/persons", &persons); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, persons, 1) {
+		assert.Equal(t, "078-05-1120", persons[0]["ssn"])
+		assert.Equal(t, "alicia", persons[0]["name"])
+	}
 
+	// the database cannot filter by ciphertext
+	status, err := testService.client.RawGet("/persons?filter=ssn=078-05-1120", &persons)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+// payloadNotifier records the payloads of the notifications it receives
+type payloadNotifier struct {
+	payloads []string
+}
+
+func (n *payloadNotifier) Notify(resource string, operation core.Operation, payload []byte) {
+	n.payloads = append(n.payloads, string(payload))
+}
+
+func TestEncryptedNotificationPayload(t *testing.T) {
 	jsonConfig := `{
 		"collections": [
 		  {
-			"resource": "a",
-			"searchable_properties": ["searchable_prop"]
+			"resource": "person",
+			"encrypted_properties": ["ssn"]
 		  }
-		],
-		"singletons": [],
-		"blobs": [],
-		"shortcuts": []
+		]
 	  }
 	`
-
-	testService := UpdateTestService(jsonConfig, t.Name())
+	notifier := &payloadNotifier{}
+	testService := CreateTestServiceWithBuilder(jsonConfig, t.Name(), func(b *backend.Builder) {
+		b.EncryptionKeys = map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")}
+		b.EncryptionKeyID = "k1"
+		b.Notifier = notifier
+	})
 	defer testService.Db.Close()
 
-	numberOfElements := 16
-	for i := 0; i < numberOfElements; i++ {
-		_, err := testService.client.WithAdminAuthorization().RawPost("/as",
-			A{
-				SearchableProp: "searchable_prop_" + strconv.Itoa(i%2),
-			}, nil)
+	var received []string
+	testService.backend.HandleResourceNotification("person", func(ctx context.Context, n backend.Notification) error {
+		received = append(received, string(n.Payload))
+		return nil
+	}, core.OperationCreate)
+
+	if _, err := testService.client.RawPost("/persons", map[string]interface{}{"name": "alice", "ssn": "078-05-1120"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the job queue and the outbox only have the ciphertext
+	for _, table := range []string{"_job_", "_outbox_"} {
+		var payload string
+		err := testService.Db.QueryRow(`SELECT payload::TEXT FROM ` + testService.Db.Schema + `."` + table + `" WHERE resource = 'person';`).Scan(&payload)
 		if err != nil {
 			t.Fatal(err)
 		}
+		assert.NotContains(t, payload, "078-05-1120", table)
+		assert.Contains(t, payload, "alice", table)
 	}
 
-	var collectionResult []A
-
-	// Search in searchable_properties
-	_, err := testService.client.RawGet("/as?search=searchable_prop=searchable_prop_1", &collectionResult)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if len(collectionResult) != 8 {
-		t.Fatalf("unexpected number of items in collection, expected 8, got %v %s", len(collectionResult), asJSON(collectionResult))
+	// handlers and the notifier get the plaintext
+	testService.backend.ProcessJobsSync(0)
+	if assert.Len(t, received, 1) {
+		assert.Contains(t, received[0], "078-05-1120")
 	}
-	if collectionResult[0].SearchableProp != "searchable_prop_1" {
-		t.Fatal("wrong item in collection:", collectionResult[0].SearchableProp)
+	if assert.Len(t, notifier.payloads, 1) {
+		assert.Contains(t, notifier.payloads[0], "078-05-1120")
 	}
 }
 
-func TestSearchPattern(t *testing.T) {
+func TestRotateEncryptionKey(t *testing.T) {
 	jsonConfig := `{
-	"collections": [
-	  {
-		"resource": "a",
-		"external_index": "external_id",
-		"static_properties": ["static_prop"],
-		"searchable_properties": ["searchable_prop"]
-	  } 
-	],
-	"singletons": [],
-	"blobs": [],
-	"shortcuts": []
-  }
-`
-	testService := CreateTestService(jsonConfig, t.Name())
+		"collections": [
+		  {
+			"resource": "person",
+			"encrypted_properties": ["ssn"]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestServiceWithBuilder(jsonConfig, t.Name(), func(b *backend.Builder) {
+		b.EncryptionKeys = map[string][]byte{
+			"k1": []byte("0123456789abcdef0123456789abcdef"),
+			"k2": []byte("fedcba9876543210fedcba9876543210"),
+		}
+		b.EncryptionKeyID = "k1"
+	})
 	defer testService.Db.Close()
 
-	numberOfElements := 16
-	for i := 0; i < numberOfElements; i++ {
-		_, err := testService.client.WithAdminAuthorization().RawPost("/as",
-			A{
-				ExternalID:     "external_id_" + strconv.Itoa(i),
-				SearchableProp: "searchable_prop_" + strconv.Itoa(i%2),
-				Foo:            "foo_" + strconv.Itoa(i%8),
-			}, nil)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		var person map[string]interface{}
+		body := map[string]interface{}{"name": fmt.Sprintf("person %d", i), "ssn": fmt.Sprintf("078-05-112%d", i)}
+		if _, err := testService.client.RawPost("/persons", body, &person); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, person["person_id"].(string))
+	}
+	// a person without encrypted values has no key
+	var other map[string]interface{}
+	if _, err := testService.client.RawPost("/persons", map[string]interface{}{"name": "bob"}, &other); err != nil {
+		t.Fatal(err)
+	}
+
+	keyIDs := func() map[string]string {
+		rows, err := testService.Db.Query(`SELECT person_id, COALESCE(encryption_key_id, '') FROM ` + testService.Db.Schema + `."person";`)
 		if err != nil {
 			t.Fatal(err)
 		}
+		defer rows.Close()
+		result := map[string]string{}
+		for rows.Next() {
+			var id, keyID string
+			if err = rows.Scan(&id, &keyID); err != nil {
+				t.Fatal(err)
+			}
+			result[id] = keyID
+		}
+		return result
 	}
+	assert.Equal(t, map[string]string{ids[0]: "k1", ids[1]: "k1", ids[2]: "k1", other["person_id"].(string): ""}, keyIDs())
 
-	var collectionResult []A
+	// invalid rotations are rejected
+	for _, query := range []string{"resource=person&from=k1", "resource=person&from=k1&to=k3",
+		"resource=person&from=k1&to=k1", "resource=unknown&from=k1&to=k2"} {
+		status, err := testService.client.RawPut("/kurbisio/encryption/rotate?"+query, nil, nil)
+		assert.NotNil(t, err, query)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
 
-	// Search in external_index
-	_, err := testService.client.RawGet("/as?filter="+url.QueryEscape("external_id~%_id_1"), &collectionResult)
-	if err != nil {
+	var result map[string]int
+	if _, err := testService.client.RawPut("/kurbisio/encryption/rotate?resource=person&from=k1&to=k2", nil, &result); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 1 {
-		t.Fatalf("unexpected number of items in collection, expected 1, got %v %v", len(collectionResult), asJSON(collectionResult))
-	}
-	if collectionResult[0].ExternalID != "external_id_1" {
-		t.Fatal("wrong item in collection:", collectionResult[0].ExternalID)
-	}
+	assert.Equal(t, 3, result["rotated"])
+	assert.Equal(t, map[string]string{ids[0]: "k2", ids[1]: "k2", ids[2]: "k2", other["person_id"].(string): ""}, keyIDs())
 
-	_, err = testService.client.RawGet("/as?filter="+url.QueryEscape("external_id~external%"), &collectionResult)
+	var stored string
+	err := testService.Db.QueryRow(`SELECT properties::TEXT FROM `+testService.Db.Schema+`."person" WHERE person_id = $1;`, ids[0]).Scan(&stored)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 16 {
-		t.Fatal("unexpected number of items in collection, expected 16, got", asJSON(collectionResult))
-	}
+	assert.Contains(t, stored, `"enc:k2:`)
+	assert.NotContains(t, stored, "078-05-1120")
 
-	// Search in json document
-	_, err = testService.client.RawGet("/as?filter="+url.QueryEscape("foo~%o_1"), &collectionResult)
-	if err != nil {
+	// the items are unchanged for clients
+	var person map[string]interface{}
+	if _, err = testService.client.RawGet("/persons/"+ids[0], &person); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 2 {
-		t.Fatalf("unexpected number of items in collection, expected 2, got %v %s", len(collectionResult), asJSON(collectionResult))
+	assert.Equal(t, "078-05-1120", person["ssn"])
+	assert.Equal(t, float64(1), person["revision"])
+
+	// nothing is left to rotate
+	if _, err = testService.client.RawPut("/kurbisio/encryption/rotate?resource=person&from=k1&to=k2", nil, &result); err != nil {
+		t.Fatal(err)
 	}
+	assert.Equal(t, 0, result["rotated"])
+}
 
-	// Search in unknown json document
-	_, err = testService.client.RawGet("/as?filter=foo2~foo_1", &collectionResult)
-	if err != nil {
+func TestOwnerChain(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "fleet"
+		  },
+		  {
+			"resource": "fleet/user"
+		  },
+		  {
+			"resource": "fleet/user/device",
+			"searchable_properties": ["name"]
+		  }
+		],
+		"singletons": [
+		  {
+			"resource": "fleet/user/profile"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var fleet, user, device, profile map[string]interface{}
+	if _, err := testService.client.RawPost("/fleets", map[string]interface{}{}, &fleet); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 0 {
-		t.Fatalf("unexpected number of items in collection, expected 0, got %v %s", len(collectionResult), asJSON(collectionResult))
+	fleetID := fleet["fleet_id"].(string)
+	if _, err := testService.client.RawPost("/fleets/"+fleetID+"/users", map[string]interface{}{}, &user); err != nil {
+		t.Fatal(err)
+	}
+	userID := user["user_id"].(string)
+	owner := "/fleets/" + fleetID + "/users/" + userID
+	if _, err := testService.client.RawPost(owner+"/devices", map[string]interface{}{"name": "phone"}, &device); err != nil {
+		t.Fatal(err)
+	}
+	deviceID := device["device_id"].(string)
+	if _, err := testService.client.RawPut(owner+"/profile", map[string]interface{}{"nickname": "jo"}, &profile); err != nil {
+		t.Fatal(err)
 	}
 
-	// Search in json document and searchable properties
-	_, err = testService.client.RawGet("/as?filter="+url.QueryEscape("foo~%o_0")+"&filter="+url.QueryEscape("searchable_prop~%_prop_0"), &collectionResult)
-	if err != nil {
+	assertChain := func(item map[string]interface{}, withDevice bool) {
+		t.Helper()
+		assert.Equal(t, fleetID, item["fleet_id"])
+		assert.Equal(t, userID, item["user_id"])
+		if withDevice {
+			assert.Equal(t, deviceID, item["device_id"])
+		}
+	}
+	assertChain(device, true)
+	assertChain(profile, false)
+
+	var read map[string]interface{}
+	if _, err := testService.client.RawGet(owner+"/devices/"+deviceID, &read); err != nil {
 		t.Fatal(err)
 	}
-	if len(collectionResult) != 2 {
-		t.Fatalf("unexpected number of items in collection, expected 1, got %v %s", len(collectionResult), asJSON(collectionResult))
+	assertChain(read, true)
+	if _, err := testService.client.RawGet(owner+"/profile", &read); err != nil {
+		t.Fatal(err)
 	}
-	if collectionResult[0].Foo != "foo_0" {
-		t.Fatal("wrong item in collection:", collectionResult[0].Foo)
+	assertChain(read, false)
+
+	// lists, including wildcard lists and filtered lists, carry the complete owner chain as well
+	for _, path := range []string{
+		owner + "/devices",
+		"/fleets/all/users/all/devices",
+		"/fleets/" + fleetID + "/users/all/devices",
+		"/fleets/all/users/all/devices?filter=name=phone",
+	} {
+		var devices []map[string]interface{}
+		if _, err := testService.client.RawGet(path, &devices); err != nil {
+			t.Fatal(err)
+		}
+		if assert.Len(t, devices, 1, path) {
+			assertChain(devices[0], true)
+		}
 	}
-	if collectionResult[0].SearchableProp != "searchable_prop_0" {
-		t.Fatal("wrong item in collection:", collectionResult[0].SearchableProp)
+	var profiles []map[string]interface{}
+	if _, err := testService.client.RawGet("/fleets/all/users/all/profiles", &profiles); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, profiles, 1) {
+		assertChain(profiles[0], false)
 	}
 }
 
-func TestPatch(t *testing.T) {
-	a := A{ExternalID: t.Name()}
-	if _, err := testService.client.RawPost("/as", a, &a); err != nil {
+func TestAccessPublicRead(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "article",
+			"access": "public_read"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	public := testService.clientNoAuth
+	authenticated := testService.clientNoAuth.WithRole("author")
+
+	// the public cannot write
+	status, err := public.RawPost("/articles", map[string]interface{}{"title": "news"}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	var article map[string]interface{}
+	if _, err = authenticated.RawPost("/articles", map[string]interface{}{"title": "news"}, &article); err != nil {
+		t.Fatal(err)
+	}
+	id := article["article_id"].(string)
+	if _, err = authenticated.RawPatch("/articles/"+id, map[string]interface{}{"title": "old news"}, &article); err != nil {
 		t.Fatal(err)
 	}
 
-	var result A
-	status, err := testService.client.RawPatch("/as/"+a.AID.String(),
-		map[string]string{"foo": "new_foo"}, &result)
-	if err != nil {
+	// but the public can read and list
+	var read map[string]interface{}
+	if _, err = public.RawGet("/articles/"+id, &read); err != nil {
 		t.Fatal(err)
 	}
-	if status != http.StatusOK || result.Foo != "new_foo" {
-		t.Fatalf("patch did not work")
+	assert.Equal(t, "old news", read["title"])
+	var articles []map[string]interface{}
+	if _, err = public.RawGet("/articles", &articles); err != nil {
+		t.Fatal(err)
 	}
+	assert.Len(t, articles, 1)
 
-	// patching an unknown object should return 404 not found
-	unknownID := uuid.New()
-	status, err = testService.client.RawPatch("/as/"+unknownID.String(),
-		map[string]string{"foo": "new_foo"}, &result)
-	if err == nil || status != http.StatusNotFound {
-		t.Fatalf("patch of unknown object did return %d", status)
+	status, err = public.RawDelete("/articles/" + id)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	if _, err = authenticated.RawDelete("/articles/" + id); err != nil {
+		t.Fatal(err)
 	}
-
 }
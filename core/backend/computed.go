@@ -0,0 +1,63 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"github.com/goccy/go-json"
+
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// computedProperty is a virtual property which is computed at read time and never stored
+type computedProperty struct {
+	name    string
+	compute func(object map[string]interface{}) interface{}
+}
+
+// HandleComputedProperty installs a virtual property name for a given resource, e.g. a full_name derived
+// from first_name and last_name. The compute function is called for every object which is read or listed,
+// after the properties were merged and the defaults were applied, and before the read interceptors.
+// It receives the object as generic JSON and returns the value of the property.
+//
+// Computed properties are read-only. They are stripped from the body of create and update requests,
+// so they are never stored. Requests with raw=true do not compute them.
+func (b *Backend) HandleComputedProperty(resource string, name string, compute func(object map[string]interface{}) interface{}) {
+	if !b.hasCollectionOrSingleton(resource) {
+		logger.FromContext(nil).Fatalf("handle computed property for %s: no such collection or singleton", resource)
+	}
+	for _, property := range b.computedProperties[resource] {
+		if property.name == name {
+			logger.FromContext(nil).Fatalf("computed property %s for %s already installed", name, resource)
+		}
+	}
+	logger.FromContext(nil).Debugf("install computed property %s for %s", name, resource)
+	b.computedProperties[resource] = append(b.computedProperties[resource], computedProperty{name: name, compute: compute})
+}
+
+// computeProperties adds the computed properties of resource to object
+func (b *Backend) computeProperties(resource string, object map[string]interface{}) {
+	properties := b.computedProperties[resource]
+	if len(properties) == 0 {
+		return
+	}
+	// the compute functions get generic JSON, not the scanned database values
+	data, _ := json.MarshalWithOption(object, json.DisableHTMLEscape())
+	var objectJSON map[string]interface{}
+	if err := json.Unmarshal(data, &objectJSON); err != nil {
+		return
+	}
+	for _, property := range properties {
+		object[property.name] = property.compute(objectJSON)
+	}
+}
+
+// stripComputedProperties removes the computed properties of resource from a request body
+func (b *Backend) stripComputedProperties(resource string, bodyJSON map[string]interface{}) {
+	for _, property := range b.computedProperties[resource] {
+		delete(bodyJSON, property.name)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxWriteQueueTime is how long a write request waits for a free slot if its resource has
+// reached the maximum number of concurrent writes
+const maxWriteQueueTime = time.Second
+
+// writeLimiter is a semaphore which limits the number of concurrent write requests to a resource.
+// A nil writeLimiter does not limit anything.
+type writeLimiter chan struct{}
+
+// newWriteLimiter returns a limiter for maxConcurrent writes, or nil if maxConcurrent is not positive
+func newWriteLimiter(maxConcurrent int) writeLimiter {
+	if maxConcurrent <= 0 {
+		return nil
+	}
+	return make(writeLimiter, maxConcurrent)
+}
+
+// handler wraps h, so that it runs only if a slot is available. Requests queue for up to maxWriteQueueTime,
+// then they fail with 503 (Service Unavailable) and a Retry-After header.
+func (l writeLimiter) handler(h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			h.ServeHTTP(w, r)
+			return
+		}
+		timer := time.NewTimer(maxWriteQueueTime)
+		defer timer.Stop()
+		select {
+		case l <- struct{}{}:
+		case <-timer.C:
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+			http.Error(w, "too many concurrent writes, try again later", http.StatusServiceUnavailable)
+			return
+		case <-r.Context().Done():
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+			http.Error(w, "too many concurrent writes, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		defer func() { <-l }()
+		h.ServeHTTP(w, r)
+	})
+}
@@ -7,8 +7,11 @@
 package backend
 
 import (
+	"fmt"
+
 	"github.com/goccy/go-json"
 
+	"github.com/relabs-tech/kurbisio/core"
 	"github.com/relabs-tech/kurbisio/core/access"
 )
 
@@ -23,28 +26,131 @@ type Configuration struct {
 
 // collectionConfiguration describes a collection resource
 type collectionConfiguration struct {
-	Resource                      string          `json:"resource"`
-	ExternalIndex                 string          `json:"external_index"`
-	StaticProperties              []string        `json:"static_properties"`
-	SearchableProperties          []string        `json:"searchable_properties"`
-	Permits                       []access.Permit `json:"permits"`
-	Description                   string          `json:"description"`
-	SchemaID                      string          `json:"schema_id"`
-	Default                       json.RawMessage `json:"default"`
-	WithCompanionFile             bool            `json:"with_companion_file"`
-	CompanionPresignedURLValidity int             `json:"companion_presigned_url_validity"`
-	needsKSS                      bool            // true of this collection or any subcollection or subblob needs kss
+	Resource                      string                           `json:"resource"`
+	ExternalIndex                 string                           `json:"external_index"`
+	ExternalIndices               []string                         `json:"external_indices"`
+	ExternalIndexPerParent        bool                             `json:"external_index_per_parent"`
+	ExternalIndexCaseInsensitive  bool                             `json:"external_index_case_insensitive"`
+	StaticProperties              []string                         `json:"static_properties"`
+	SearchableProperties          []string                         `json:"searchable_properties"`
+	GeneratedProperties           []generatedPropertyConfiguration `json:"generated_properties"`
+	PartialIndices                []partialIndexConfiguration      `json:"partial_indices"`
+	CheckConstraints              []checkConstraintConfiguration   `json:"check_constraints"`
+	Permits                       []access.Permit                  `json:"permits"`
+	Access                        string                           `json:"access"`
+	Description                   string                           `json:"description"`
+	SchemaID                      string                           `json:"schema_id"`
+	SchemaIDCreate                string                           `json:"schema_id_create"`
+	SchemaIDUpdate                string                           `json:"schema_id_update"`
+	Default                       json.RawMessage                  `json:"default"`
+	RoleDefaults                  map[string]json.RawMessage       `json:"role_defaults"`
+	WithCompanionFile             bool                             `json:"with_companion_file"`
+	CompanionPresignedURLValidity int                              `json:"companion_presigned_url_validity"`
+	RejectUnknownProperties       bool                             `json:"reject_unknown_properties"`
+	Coerce                        map[string]string                `json:"coerce"`
+	Immutable                     bool                             `json:"immutable"`
+	NoDelete                      bool                             `json:"no_delete"`
+	OnParentDelete                string                           `json:"on_parent_delete"`
+	NotifyOnParentDelete          bool                             `json:"notify_on_parent_delete"`
+	AggregateBatchNotifications   bool                             `json:"aggregate_batch_notifications"`
+	DisableCompression            bool                             `json:"disable_compression"`
+	Aliases                       []string                         `json:"aliases"`
+	ImmutableProperties           []string                         `json:"immutable_properties"`
+	WeakListEtag                  bool                             `json:"weak_list_etag"`
+	NoRevision                    bool                             `json:"no_revision"`
+	MaxAgeCache                   int                              `json:"max_age_cache"`
+	WithChanges                   bool                             `json:"with_changes"`
+	ChangesRetentionDays          int                              `json:"changes_retention_days"`
+	MaxConcurrentWrites           int                              `json:"max_concurrent_writes"`
+	CoalesceReads                 bool                             `json:"coalesce_reads"`
+	IDVersion                     int                              `json:"id_version"`
+	EncryptedProperties           []string                         `json:"encrypted_properties"`
+	CSVProperties                 []string                         `json:"csv_properties"`
+	needsKSS                      bool                             // true of this collection or any subcollection or subblob needs kss
+}
+
+// accessPermits are the permits which the access shortcuts of collections expand to
+var accessPermits = map[string][]access.Permit{
+	// everybody may read, authenticated users may also write
+	"public_read": {
+		{Role: "public", Operations: []core.Operation{core.OperationRead, core.OperationList}},
+		{Role: "everybody", Operations: []core.Operation{core.OperationCreate, core.OperationUpdate, core.OperationDelete}},
+	},
+}
+
+// externalIndices returns all external indices of the collection, the one of external_index first
+func (rc *collectionConfiguration) externalIndices() []string {
+	var indices []string
+	if rc.ExternalIndex != "" {
+		indices = append(indices, rc.ExternalIndex)
+	}
+	for _, index := range rc.ExternalIndices {
+		if !stringlist(indices).contains(index) {
+			indices = append(indices, index)
+		}
+	}
+	return indices
+}
+
+// expandAccess adds the permits of the access shortcuts of all collections to their permits
+func (c *Configuration) expandAccess() error {
+	for i := range c.Collections {
+		rc := &c.Collections[i]
+		if rc.Access == "" {
+			continue
+		}
+		permits, ok := accessPermits[rc.Access]
+		if !ok {
+			return fmt.Errorf("resource %s: unknown access '%s'", rc.Resource, rc.Access)
+		}
+		rc.Permits = append(rc.Permits, permits...)
+	}
+	return nil
+}
+
+// generatedPropertyConfiguration describes a searchable column which the database generates
+// from a dynamic property of the JSON document
+type generatedPropertyConfiguration struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+// partialIndexConfiguration describes an index which only covers the rows where a searchable
+// property has a specific value
+type partialIndexConfiguration struct {
+	Property string `json:"property"`
+	Value    string `json:"value"`
+}
+
+// checkConstraintConfiguration describes a check constraint, which the database enforces for every
+// item which is written. Check is an SQL boolean expression over the columns of the resource.
+type checkConstraintConfiguration struct {
+	Name    string `json:"name"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
 }
 
 // singletonConfiguration describes a singleton resource
 type singletonConfiguration struct {
-	Resource             string          `json:"resource"`
-	Permits              []access.Permit `json:"permits"`
-	Description          string          `json:"description"`
-	SchemaID             string          `json:"schema_id"`
-	StaticProperties     []string        `json:"static_properties"`
-	SearchableProperties []string        `json:"searchable_properties"`
-	Default              json.RawMessage `json:"default"`
+	Resource                string                     `json:"resource"`
+	Permits                 []access.Permit            `json:"permits"`
+	Description             string                     `json:"description"`
+	SchemaID                string                     `json:"schema_id"`
+	SchemaIDCreate          string                     `json:"schema_id_create"`
+	SchemaIDUpdate          string                     `json:"schema_id_update"`
+	StaticProperties        []string                   `json:"static_properties"`
+	SearchableProperties    []string                   `json:"searchable_properties"`
+	Default                 json.RawMessage            `json:"default"`
+	RoleDefaults            map[string]json.RawMessage `json:"role_defaults"`
+	RejectUnknownProperties bool                       `json:"reject_unknown_properties"`
+	Coerce                  map[string]string          `json:"coerce"`
+	DisableCompression      bool                       `json:"disable_compression"`
+	ImmutableProperties     []string                   `json:"immutable_properties"`
+	MaxConcurrentWrites     int                        `json:"max_concurrent_writes"`
+	CoalesceReads           bool                       `json:"coalesce_reads"`
+	NotifyOnParentDelete    bool                       `json:"notify_on_parent_delete"`
+	EncryptedProperties     []string                   `json:"encrypted_properties"`
 }
 
 // blobConfiguration describes a blob collection resource
@@ -58,6 +164,8 @@ type blobConfiguration struct {
 	Permits              []access.Permit `json:"permits"`
 	Description          string          `json:"description"`
 	StoredExternally     bool            `json:"stored_externally"`
+	OnParentDelete       string          `json:"on_parent_delete"`
+	NotifyOnParentDelete bool            `json:"notify_on_parent_delete"`
 	needsKSS             bool            // true of this blob or any subcollection or subblob needs kss
 }
 
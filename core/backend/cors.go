@@ -8,22 +8,103 @@ package backend
 
 import (
 	"net/http"
+	"strings"
 
+	"github.com/gorilla/mux"
+
+	"github.com/relabs-tech/kurbisio/core"
 	"github.com/relabs-tech/kurbisio/core/logger"
 )
 
-func (b *Backend) handleCORS() {
+// corsExposeHeaders returns the response headers which browser clients may read. Besides the
+// generic headers, these are the headers derived from the static properties of blobs, and the
+// additional headers from the builder.
+//
+// The wildcard "*" is kept first for requests without credentials, for requests with credentials
+// browsers only expose the explicitly listed headers.
+func (b *Backend) corsExposeHeaders(additional []string) string {
+	headers := []string{
+		"*",
+		"Etag",
+		"Last-Modified",
+		"Kurbisio-Meta-Data",
+		"Kurbisio-Request-Id",
+		"Kurbisio-Content-Encoding",
+		"Kurbisio-Server-Time",
+		"Kurbisio-Source",
+		"Retry-After",
+		"Pagination-Limit",
+		"Pagination-Total-Count",
+		"Pagination-Page-Count",
+		"Pagination-Current-Page",
+		"Pagination-Until",
+	}
+	for _, rc := range b.config.Blobs {
+		properties := append(append([]string{}, rc.StaticProperties...), rc.SearchableProperties...)
+		if rc.ExternalIndex != "" {
+			properties = append(properties, rc.ExternalIndex)
+		}
+		for _, property := range properties {
+			headers = append(headers, core.PropertyNameToCanonicalHeader(property))
+		}
+	}
+	headers = append(headers, additional...)
+
+	// remove duplicates, but keep the order
+	exposed := []string{}
+	seen := map[string]bool{}
+	for _, header := range headers {
+		key := http.CanonicalHeaderKey(header)
+		if !seen[key] {
+			seen[key] = true
+			exposed = append(exposed, header)
+		}
+	}
+	return strings.Join(exposed, ", ")
+}
+
+// allowedMethods returns the methods which the router serves for the path of r, e.g. GET, PUT, PATCH, DELETE
+// for an item of a mutable collection. Alias and shortcut routes accept every method and route the request
+// again, hence the methods are those of the path they rewrite to.
+func (b *Backend) allowedMethods(r *http.Request) []string {
+	var match mux.RouteMatch
+	if b.router.Match(r, &match) && match.MatchErr == nil {
+		if rewrite, ok := b.rewrittenRoutes[match.Route]; ok {
+			request := r.Clone(r.Context())
+			request.URL.Path = rewrite(r, match.Vars)
+			request.URL.RawPath = ""
+			return b.allowedMethods(request)
+		}
+	}
+
+	methods := []string{http.MethodOptions}
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		request := r.Clone(r.Context())
+		request.Method = method
+		var match mux.RouteMatch
+		if b.router.Match(request, &match) && match.MatchErr == nil {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+func (b *Backend) handleCORS(exposeHeaders []string) {
 
+	exposeHeadersValue := b.corsExposeHeaders(exposeHeaders)
 	corseMiddleware := func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, PATCH")
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, If-None-Match, Access-Control-Allow-Origin, Kurbisio-Content-Encoding")
-			w.Header().Set("Access-Control-Expose-Headers", "*")
+			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, If-None-Match, If-Modified-Since, Access-Control-Allow-Origin, Kurbisio-Content-Encoding, Kurbisio-Accept-Encoding, Kurbisio-Property-Casing, Kurbisio-Return-Previous")
+			w.Header().Set("Access-Control-Expose-Headers", exposeHeadersValue)
 
 			if r.Method == http.MethodOptions {
 				logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method, " (handled by CORS middleware)")
-				w.WriteHeader(http.StatusOK)
+				allowed := strings.Join(b.allowedMethods(r), ", ")
+				w.Header().Set("Allow", allowed)
+				w.Header().Set("Access-Control-Allow-Methods", allowed)
+				w.WriteHeader(http.StatusNoContent)
 				return
 			}
 			h.ServeHTTP(w, r)
@@ -0,0 +1,100 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORSExposeHeaders(t *testing.T) {
+	jsonConfig := `{
+		"blobs": [
+		  {
+			"resource": "image",
+			"static_properties": ["content_type", "file_name"],
+			"external_index": "external_id"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	r := httptest.NewRequest(http.MethodGet, "/images", nil)
+	rec := httptest.NewRecorder()
+	testService.Router.ServeHTTP(rec, r)
+
+	exposed := map[string]bool{}
+	for _, header := range strings.Split(rec.Header().Get("Access-Control-Expose-Headers"), ",") {
+		exposed[strings.TrimSpace(header)] = true
+	}
+	for _, header := range []string{"Kurbisio-Meta-Data", "Etag", "Pagination-Total-Count", "Kurbisio-Server-Time", "Kurbisio-Source", "Content-Type", "File-Name", "External-Id"} {
+		if !exposed[header] {
+			t.Errorf("header %s is not exposed: %v", header, rec.Header().Get("Access-Control-Expose-Headers"))
+		}
+	}
+}
+
+func TestOptionsAllow(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item"
+		  },
+		  {
+			"resource": "entry",
+			"immutable": true,
+			"aliases": ["log"]
+		  }
+		],
+		"shortcuts": [
+		  {
+			"shortcut": "mine",
+			"target": "item"
+		  }
+		],
+		"singletons": [
+		  {
+			"resource": "item/setting"
+		  }
+		],
+		"blobs": [
+		  {
+			"resource": "image"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	id := "4f1638da-861e-4a81-8cc7-e6847b6fdf9b"
+	for path, allowed := range map[string]string{
+		"/items":                    "OPTIONS, GET, POST, PUT, PATCH, DELETE",
+		"/items/" + id:              "OPTIONS, GET, PUT, PATCH, DELETE",
+		"/entries/" + id:            "OPTIONS, GET, DELETE",
+		"/items/" + id + "/setting": "OPTIONS, GET, PUT, PATCH, DELETE",
+		"/images":                   "OPTIONS, GET, POST, PUT, DELETE",
+		"/images/" + id:             "OPTIONS, GET, PUT, DELETE",
+		"/logs/" + id:               "OPTIONS, GET, DELETE",
+		"/mine":                     "OPTIONS, GET, PUT, PATCH, DELETE",
+		"/mine/setting":             "OPTIONS, GET, PUT, PATCH, DELETE",
+	} {
+		r := httptest.NewRequest(http.MethodOptions, path, nil)
+		rec := httptest.NewRecorder()
+		testService.Router.ServeHTTP(rec, r)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s: unexpected status %d", path, rec.Code)
+		}
+		if rec.Header().Get("Allow") != allowed {
+			t.Errorf("%s: expected Allow %s, got %s", path, allowed, rec.Header().Get("Allow"))
+		}
+	}
+}
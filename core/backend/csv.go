@@ -0,0 +1,59 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+
+	"github.com/goccy/go-json"
+)
+
+// csvMediaType is the content type of lists which were requested with format=csv
+const csvMediaType = "text/csv; charset=utf-8"
+
+// listToCSV converts a JSON list response into CSV with a header row of columns and one row per item.
+// Missing and null values become empty cells, nested objects and arrays are serialized as JSON.
+func listToCSV(data []byte, columns []string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var items []map[string]interface{}
+	if err := decoder.Decode(&items); err != nil {
+		return nil, fmt.Errorf("list is not an array of objects: %w", err)
+	}
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write(columns)
+	record := make([]string, len(columns))
+	for _, item := range items {
+		for i, column := range columns {
+			record[i] = csvCell(item[column])
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+// csvCell returns the CSV representation of a JSON value
+func csvCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.MarshalWithOption(value, json.DisableHTMLEscape())
+	return string(data)
+}
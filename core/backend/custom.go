@@ -0,0 +1,60 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/relabs-tech/kurbisio/core"
+	"github.com/relabs-tech/kurbisio/core/access"
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// HandleCustom installs a custom route for endpoints which do not map to a resource, for example a report.
+// The path is relative to the base path and may contain route variables like "/reports/{report_id}", which
+// the handler gets with mux.Vars. The route is served by the backend's router, so it passes the same
+// middlewares as the resource routes, like logging, timeouts, CORS and JSON errors.
+//
+// With authorization enabled, only the given roles may call the route. They have the same meaning as in
+// permits: "everybody" means every authenticated user, "public" also anonymous users, and "admin" is always
+// authorized. GET requests count as reads, so the "admin viewer" role may call them as well. Selectors are
+// not checked, the handler can do so with access.AuthorizationFromContext.
+//
+// Custom routes are matched after the resource routes, so they cannot shadow them. Choose a path which does
+// not collide with any resource, otherwise the resource route answers the request.
+func (b *Backend) HandleCustom(path string, methods []string, roles []string, handler http.HandlerFunc) {
+	if len(methods) == 0 {
+		logger.FromContext(nil).Fatalf("handle custom route %s: no methods", path)
+	}
+	rlog := logger.Default()
+	rlog.Debugln("custom")
+	rlog.Debugln("  handle custom route:", path, methods)
+
+	permits := make([]access.Permit, len(roles))
+	for i, role := range roles {
+		permits[i] = access.Permit{Role: role, Operations: []core.Operation{core.OperationRead, core.OperationUpdate}}
+	}
+
+	b.router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+
+		if b.authorizationEnabled {
+			operation := core.OperationUpdate
+			if r.Method == http.MethodGet {
+				operation = core.OperationRead
+			}
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.IsAuthorized(nil, operation, mux.Vars(r), permits) {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		handler(w, r)
+	}).Methods(append([]string{http.MethodOptions}, methods...)...)
+}
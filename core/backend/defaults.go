@@ -0,0 +1,133 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"github.com/relabs-tech/kurbisio/core/access"
+)
+
+// defaultTemplatePattern matches a default value which is a template token, e.g. "{{auth.user_id}}"
+var defaultTemplatePattern = regexp.MustCompile(`^\{\{\s*([a-z0-9_.]+)\s*\}\}$`)
+
+// splitDefault splits the default of a resource into its static properties and its template properties.
+// The template properties map the property name to the token, e.g. "auth.user_id".
+func splitDefault(def json.RawMessage) (json.RawMessage, map[string]string, error) {
+	var defaultJSON map[string]interface{}
+	if err := json.Unmarshal(def, &defaultJSON); err != nil {
+		return nil, nil, err
+	}
+	templates := map[string]string{}
+	for property, value := range defaultJSON {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		match := defaultTemplatePattern.FindStringSubmatch(s)
+		if match == nil {
+			continue
+		}
+		token := match[1]
+		if token != "now" && !strings.HasPrefix(token, "auth.") {
+			return nil, nil, fmt.Errorf("unknown template token %s for property %s", s, property)
+		}
+		templates[property] = token
+		delete(defaultJSON, property)
+	}
+	if len(templates) == 0 {
+		return def, nil, nil
+	}
+	static, _ := json.Marshal(defaultJSON)
+	return static, templates, nil
+}
+
+// exampleDefaultTemplates returns example values for template properties, to validate a default against its schema.
+// Selectors are identifiers, hence tokens from the authorization resolve to a uuid.
+func exampleDefaultTemplates(templates map[string]string) map[string]interface{} {
+	values := map[string]interface{}{}
+	for property, token := range templates {
+		if token == "now" {
+			values[property] = time.Now().UTC().Format(time.RFC3339Nano)
+		} else {
+			values[property] = "00000000-0000-0000-0000-000000000000"
+		}
+	}
+	return values
+}
+
+// resolveDefaultTemplates resolves the template properties of a default at create time and adds them to
+// defaultJSON. "now" resolves to the current server time, "auth.<selector>" to the selector of the
+// authorization of the request, e.g. "auth.user_id". Tokens which cannot be resolved, for example because
+// the request has no such selector, are skipped.
+func resolveDefaultTemplates(ctx context.Context, templates map[string]string, defaultJSON map[string]interface{}) {
+	for property, token := range templates {
+		if token == "now" {
+			defaultJSON[property] = time.Now().UTC().Format(time.RFC3339Nano)
+			continue
+		}
+		auth := access.AuthorizationFromContext(ctx)
+		if value, ok := auth.Selector(strings.TrimPrefix(token, "auth.")); ok {
+			defaultJSON[property] = value
+		}
+	}
+}
+
+// roleDefault is a default which applies to the items created by a role, in addition to the default of the resource
+type roleDefault struct {
+	role      string
+	static    map[string]interface{}
+	templates map[string]string
+}
+
+// parseRoleDefaults parses the role defaults of a resource. The defaults of "everybody" come first and the
+// other roles follow in alphabetical order, which is the order in which they are applied.
+func parseRoleDefaults(defaults map[string]json.RawMessage) ([]roleDefault, error) {
+	var roleDefaults []roleDefault
+	for role, def := range defaults {
+		static, templates, err := splitDefault(def)
+		if err != nil {
+			return nil, fmt.Errorf("role %s: %w", role, err)
+		}
+		rd := roleDefault{role: role, templates: templates}
+		if err = json.Unmarshal(static, &rd.static); err != nil {
+			return nil, fmt.Errorf("role %s: %w", role, err)
+		}
+		roleDefaults = append(roleDefaults, rd)
+	}
+	sort.Slice(roleDefaults, func(i, j int) bool {
+		if (roleDefaults[i].role == "everybody") != (roleDefaults[j].role == "everybody") {
+			return roleDefaults[i].role == "everybody"
+		}
+		return roleDefaults[i].role < roleDefaults[j].role
+	})
+	return roleDefaults, nil
+}
+
+// applyRoleDefaults adds the role defaults which apply to the authorization of the request to defaultJSON.
+// The default of "everybody" applies to every authenticated request.
+func applyRoleDefaults(ctx context.Context, roleDefaults []roleDefault, defaultJSON map[string]interface{}) {
+	auth := access.AuthorizationFromContext(ctx)
+	for _, rd := range roleDefaults {
+		if !auth.HasRole(rd.role) && !(rd.role == "everybody" && auth.HasRoles()) {
+			continue
+		}
+		// static is shared between requests, hence we patch with a copy
+		var static map[string]interface{}
+		data, _ := json.Marshal(rd.static)
+		json.Unmarshal(data, &static)
+		patchObject(defaultJSON, static)
+		resolveDefaultTemplates(ctx, rd.templates, defaultJSON)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// resourceLevels returns the number of nested resources in resource, e.g. 3 for fleet/user/device
+func resourceLevels(resource string) int {
+	return strings.Count(resource, "/") + 1
+}
+
+// validateResourceDepth returns an error if any resource of the configuration nests deeper than maxDepth.
+// Relations count with the deeper of their two routes, e.g. a relation from device to fleet/user creates
+// the route fleet/user/device.
+func validateResourceDepth(config Configuration, maxDepth int) error {
+	if maxDepth <= 0 {
+		return nil
+	}
+	levels := map[string]int{}
+	for _, rc := range config.Collections {
+		levels[rc.Resource] = resourceLevels(rc.Resource)
+	}
+	for _, rc := range config.Singletons {
+		levels[rc.Resource] = resourceLevels(rc.Resource)
+	}
+	for _, rc := range config.Blobs {
+		levels[rc.Resource] = resourceLevels(rc.Resource)
+	}
+	for _, rc := range config.Relations {
+		left, right := resourceLevels(rc.Left), resourceLevels(rc.Right)
+		if left < right {
+			left = right
+		}
+		levels[rc.Left+"/"+rc.Right] = left + 1
+	}
+	for resource, level := range levels {
+		if level > maxDepth {
+			return fmt.Errorf("resource %s nests %d levels deep, the maximum is %d", resource, level, maxDepth)
+		}
+	}
+	return nil
+}
+
+// handleMaxResourceDepth rejects requests whose path nests deeper than the maximum resource depth with
+// 400 (Bad Request), before the actual routes are matched. The deepest valid route of a resource with n
+// levels is a property route with 2n+2 path segments, /{resources}/{id} per level plus /{property}/{value}.
+// The part route of a multipart blob upload, which ends with /uploads/{upload_id}/parts/{part_number}, may
+// have two more segments. The base path does not count.
+func (b *Backend) handleMaxResourceDepth(router *mux.Router) {
+	if b.maxResourceDepth <= 0 {
+		return
+	}
+	maxSegments := 2*b.maxResourceDepth + 2
+	tooDeep := func(r *http.Request, rm *mux.RouteMatch) bool {
+		segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), b.basePath), "/"), "/")
+		n := len(segments)
+		if n > 4 && segments[n-4] == "uploads" && segments[n-2] == "parts" {
+			return n > maxSegments+2
+		}
+		return n > maxSegments
+	}
+	router.MatcherFunc(tooDeep).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, fmt.Sprintf("resource path nests deeper than %d levels", b.maxResourceDepth), http.StatusBadRequest)
+	})
+}
@@ -41,7 +41,49 @@ Example:
 		]
 	  }
 
-The example creates one resource "user" with an external unique index "identity".
+The example creates one resource "user" with an external unique index "identity". A resource with the same value
+for the external index is rejected with 409 (Conflict). For child resources, the external index can instead be unique
+per parent resource, for example a "slug" which must be unique among the pages of the same site, with
+
+	"external_index_per_parent": true
+
+Values like email addresses are often compared without their case. With
+
+	"external_index_case_insensitive": true
+
+the uniqueness ignores the case, so "Jane@Test.com" conflicts with an existing "jane@test.com". Filters and availability
+checks on the external index ignore the case as well. The value is stored and returned in the case it was written.
+
+A resource which must be unique in more than one property, e.g. a user with a unique email and a unique phone
+number, lists the further properties as external indices:
+
+	"external_index": "email",
+	"external_indices": ["phone"]
+
+or only "external_indices": ["email", "phone"]. Each external index has its own column and unique index, so a
+resource which conflicts in any of them is rejected with 409 (Conflict), and each can be filtered and searched on
+its own. The options external_index_per_parent and external_index_case_insensitive apply to all of them.
+
+Sign-up forms often need to know whether a value is taken, without attempting to create a resource. For collections
+with an external index, this is answered by
+
+	GET /users/available?identity=test@test.com
+	{"available": false}
+
+With several external indices, the request checks one of them at a time, e.g. /users/available?phone=12345.
+
+The request is authorized like a create or a list request on the collection, so a public create permit makes it
+public. The response does not reveal anything else about the resource which holds the value.
+
+Clients which want to get or create a resource, e.g. "create this user unless the identity is taken", can do so in
+a single request with
+
+	POST /users?on_conflict=return_existing
+
+If the new resource conflicts with an external index of an existing one, the request returns the existing resource
+with 200 (OK) instead of 409 (Conflict). With several external indices, this is the resource which holds the
+conflicting value. A created resource is returned with 201 (Created) as usual. The existing
+resource is only returned if the client may read it, otherwise the request fails with 409 (Conflict).
 
 A user has a child resource "user/profile", which is declared as a singleton, i.e. every user can only have one single profile.
 Hence a profile does not have an id of its own, but uses the user_id as its primary identifier, and there
@@ -155,6 +197,63 @@ This creates additional REST routes where every path segment /users/{user_id} is
 generated routes. For example, instead of querying a user's devices with users/f879572d-ac69-4020-b7f8-a9b3e628fd9d/devices
 you would simply query /user/devices.
 
+Clients can learn which shortcuts they can use, e.g. to build navigation, with
+
+	GET /shortcuts
+
+	[
+		{
+			"shortcut": "user",
+			"target": "user",
+			"prefix": "/user",
+			"path": "/users/f879572d-ac69-4020-b7f8-a9b3e628fd9d"
+		}
+	]
+
+The response lists the shortcuts whose roles match the caller and for whose target the caller has all selectors.
+"prefix" is the path of the shortcut and "path" the path of the resource it stands for, both including the base path.
+
+# Base Path
+
+By default, all routes are mounted at the root of the router. To mount the backend under a prefix, for example
+behind a gateway, set the builder option BasePath:
+
+	BasePath: "/api/v1"
+
+All routes, including those of shortcuts, aliases, statistics, version and the other built-in routes, are then
+served below the prefix, e.g. /api/v1/users. Backend.Router returns the subrouter of the prefix. Clients must use the
+same prefix, with client.Client.WithBasePath("/api/v1").
+
+# Trailing Slashes
+
+Routes are defined without a trailing slash, hence by default /users/ is not found. The builder option TrailingSlash
+makes the backend tolerant to clients which append slashes. With TrailingSlashRedirect, a request to a path with
+trailing slashes is redirected with 308 (Permanent Redirect) to the path without them, which keeps the method and the
+body of the request. With TrailingSlashRewrite, the request is served as if the path had no trailing slash. Paths
+which do not exist without the slash either are still not found.
+
+A request with a method which an existing path does not support, e.g. DELETE on an item of a collection with
+"no_delete", is answered with 405 (Method Not Allowed). The Allow header of the response lists the supported methods,
+just like the response to OPTIONS.
+
+# Nesting Depth
+
+Child resources and relations can nest arbitrarily deep. To bound the complexity of routes and queries, the builder
+option MaxResourceDepth limits the number of nested resources, e.g. 3 for "fleet/user/device". A configuration with a
+deeper resource is rejected when the backend is created, and requests with paths nesting deeper than the limit are
+rejected with 400 (Bad Request). By default, there is no limit.
+
+# Aliases
+
+When a resource is renamed, old clients may still use the old routes for a while. A collection can declare alias
+names for its last path segment, for example the collection "user", formerly known as "member", with
+
+	"aliases": ["member"]
+
+is also reachable under /members, /members/{user_id} and all routes below, including child resources. The alias
+routes are rewritten to the actual routes, so they share storage, permits, interceptors and notifications. Note that
+requests and responses use the identifiers of the actual resource, e.g. "user_id" and not "member_id".
+
 # Revisions
 
 Every item has an integer property "revision", which is incremented every time the item is updated. Revisions can be
@@ -163,6 +262,151 @@ non-zero revision number which does not match the item's current revision, then
 the conflicting newer version of the object is returned with an error status (409 - Conflict).
 A PUT or PATCH request with a revision of zero, or no revision at all, will not be checked for possible conflicts.
 
+A PATCH request which does not change the object, for example an empty patch {}, is not written to the database.
+The revision is not incremented, no notification is sent, and the unchanged object is returned with 200 (OK), or with
+304 (Not Modified) if the request carries a matching If-None-Match header. Resources with companion files are always
+written, since their clients patch to obtain a new upload URL.
+
+For change tracking, PUT, PATCH and DELETE requests accept the query parameter "return=previous", or alternatively the
+header "Kurbisio-Return-Previous: true". An update then returns the state before the update in the additional property
+"previous" of the response, unless the request created the object. A delete returns the deleted object with 200 (OK)
+instead of 204 (No Content).
+
+Bandwidth-sensitive clients can request only the changed properties with the query parameter "return=changed". A PUT
+or PATCH then responds with the properties which the update changed, plus the identifiers and the revision of the
+object. Properties which the update removed are returned as null.
+
+A merge patch replaces arrays as a whole. To append to an array property without a read-modify-write cycle, post the
+new elements as a JSON array to the append route of the property:
+
+	POST /users/{user_id}/properties/tags/append?unique=true
+	["blue", "green"]
+
+The elements are appended inside a single transaction, which increments the revision and sends an update notification
+like any other patch. A missing property is created as a new array. With unique=true, elements which the array
+already contains are skipped, and with revision=n the request is only applied if the item has revision n. The route
+only supports dynamic properties, and it responds with the updated object.
+
+Append-only collections with many writes may not need optimistic concurrency at all. With "no_revision": true, a
+collection has no revision column, which saves the increment on every update. Its items have no "revision" property,
+and a revision in PUT, PATCH or property updates is ignored, so updates are never rejected with 409 (Conflict) because
+of a revision. Since weak list Etags are computed from the revisions, "no_revision" cannot be combined with "weak_list_etag".
+
+# Change Feed
+
+Clients which synchronize a collection, for example offline capable apps, need everything which changed since
+their last synchronization. If a collection is configured with "with_changes": true, the database records every
+create, update and delete of its items, and the collection offers a change feed:
+
+	GET /users/{user_id}/devices/changes?since=<token>
+
+This returns the changed items in the order of their changes:
+
+	{
+		"changes": [
+			{"operation": "create", "id": "...", "item": {...}},
+			{"operation": "update", "id": "...", "item": {...}},
+			{"operation": "delete", "id": "..."}
+		],
+		"next": "<token>",
+		"more": false
+	}
+
+Created and updated items carry their current state, deleted items are tombstones. An item which changed several
+times is only reported with its last change. Without "since", the feed starts with the first recorded change. The
+client stores "next" and passes it as "since" to its next request. Each request reads at most "limit" changes,
+default 100 and maximum 1000; if there may be more, the response has "more": true. Changes of transactions which
+are still running are held back until they are final, so a token never skips a change. Changes are recorded by a
+database trigger, hence also deletes which cascade from a parent and imported items are part of the feed.
+The feed requires the list permit.
+
+Deleted items leave only their tombstone in the change log. By default all changes are kept forever. With
+"changes_retention_days", changes older than the given number of days are deleted when the backend prunes
+its change logs, which happens with an admin request to
+
+	PUT /kurbisio/changes/prune
+
+or by calling PruneChanges() of the backend, e.g. from a scheduled event. A client whose token points before a
+pruned change may have missed changes. It gets 410 (Gone) from the change feed and must synchronize again from
+scratch: it requests the latest token with "since=now", which returns no changes, then lists the collection and
+continues with the change feed from that token. Once changes were pruned, requests without "since" also get 410 (Gone).
+
+The change log also answers who changed an item and when. Every change records the identity of the authenticated
+request which made it, and the history of a single item is available at
+
+	GET /users/{user_id}/devices/{device_id}/history
+
+This returns the recorded changes of the item in chronological order:
+
+	[
+		{"operation": "create", "timestamp": "...", "actor": "<identity>"},
+		{"operation": "update", "timestamp": "...", "actor": "<identity>"}
+	]
+
+Changes without an authenticated identity, e.g. those made by jobs, have no actor. The history contains at most
+the latest 1000 changes, it is subject to the same retention as the change feed, and it requires the read permit.
+
+Kurbisio deletes items for real, there is no soft delete. The tombstones of the change log however let clients
+tell apart an item which was deleted from one which never existed: reading a deleted item of a collection with
+"with_changes" returns 410 (Gone) instead of 404 (Not Found), so clients know they can drop their local references.
+Once the tombstone was pruned, the response is 404 (Not Found) again.
+
+# Immutable Collections
+
+Some records, for example audit entries or financial transactions, must never change once they are created. A collection
+declared with
+
+	"immutable": true
+
+has no PUT and PATCH routes, neither for entire objects nor for static properties. Update requests are answered with
+405 (Method Not Allowed). Immutable resources can still be created with POST, read and deleted. Singletons are
+created with PUT, hence they cannot be immutable, and the configuration rejects the option for them.
+
+Append-only collections, for example event logs, forbid deletion with
+
+	"no_delete": true
+
+The collection then has no DELETE routes for single resources and for clearing the collection, and delete requests are
+answered with 405 (Method Not Allowed). The option is independent of "immutable", an audit log would typically set
+both. Note that resources are still deleted together with their parent resource, unless "on_parent_delete" says
+otherwise.
+
+Individual properties, for example a verified email address, can be made immutable with
+
+	"immutable_properties": ["email"]
+
+Such a property can be set when the resource is created, or later if it has no value yet. Once it has a value, a PUT or
+PATCH request which tries to change it is rejected with 400 (Bad Request), and so is a PUT on the route of a static
+property. A PUT which omits the property keeps its current value.
+
+# Deleting Parent Resources
+
+By default, deleting a resource also deletes all its child resources. Collections and blobs can change this with
+
+	"on_parent_delete": "restrict"
+
+With "restrict", a parent resource cannot be deleted as long as it has children in this collection, the request is
+answered with 409 (Conflict). With "setnull", the children survive their parent. Their parent identifiers are set to
+null, and the orphaned resources can still be reached by their own identifier using the "all" wildcard, for example
+
+	GET /users/all/logs/{log_id}
+
+Since "setnull" breaks the path to any descendants, it is only supported for resources which have no children of
+their own and which are not part of a relation. The default is "cascade". Singletons are always deleted together with
+their owner. Changing the option of an existing collection migrates its foreign key when the backend is created
+with UpdateSchema.
+
+The database deletes the children of a resource without sending delete notifications for them, so notification
+handlers only learn about the deleted parent. Collections, singletons and blobs declared with
+
+	"notify_on_parent_delete": true
+
+send a delete notification for each resource which is deleted together with its parent. The notifications are written
+in the transaction which deletes the parent, and their payload carries the identifiers of the deleted child, not the
+entire object. Collections with "aggregate_batch_notifications" instead send one delete notification per 1000
+children, with a zero resource id and the JSON array of the child identifiers as payload. This applies when a single
+resource is deleted, clearing a collection still sends only its clear notification.
+
 # Wildcard Queries
 
 You can replace any id in a path segment with the keyword "all". For example, if some administrators wants
@@ -170,6 +414,44 @@ to retrieve all profiles from all users, they would query
 
 	GET /users/all/profiles
 
+# Export and Import
+
+For backups, an administrator can download an entire collection with a single request
+
+	GET /users/export.zip
+
+The response is a zip archive with one JSON file per resource, named by the resource's identifier. The archive is
+streamed while the resources are read from the database, so it does not require paging and works for collections of
+any size. Child collections can be exported for a single parent or, using the "all" wildcard, for all parents.
+Defaults, translations and interceptors are not applied, the files contain the resources as they are stored.
+
+The counterpart for restoring a backup is
+
+	POST /users/import
+
+The body is either a zip archive as returned by export, with content type "application/zip", or newline-delimited
+JSON with one resource per line. Every resource is upserted as if it was sent with a PUT request. The query
+parameters "silent=true" and "force=true" are passed on, they suppress notifications and skip interceptors and schema
+validation respectively. The response reports the number of imported and failed resources, and for each failure the
+index of the resource in the upload, its identifier and the error:
+
+	{"succeeded": 99, "failed": 1, "failures": [{"index": 17, "id": "...", "status": 400, "error": "..."}]}
+
+Immutable collections cannot be imported.
+
+The size of an import is limited by the builder options MaxImportBytes, which applies to the body and, for a
+compressed body, to the uncompressed data, and MaxImportItemBytes, which applies to every single resource. The
+defaults are 1 GiB and 10 MiB. Imports exceeding a limit fail with 413 (Request Entity Too Large), and no resource
+is imported.
+
+By default, an import sends the same notifications as the individual PUT requests would, one per resource. This can
+flood notification handlers with large imports. A collection declared with
+
+	"aggregate_batch_notifications": true
+
+instead sends a single create notification for all created resources and a single update notification for all updated
+resources. The notifications have a zero resource id, and their payload is the JSON array of the affected identifiers.
+
 # Schema Validation
 
 Every resource by default is essentially a free-form JSON object. This gives a high degree of flexibility, but is prone to errors.
@@ -177,6 +459,51 @@ Therefore you can define a JSON schema ID for any Singleton or Collection resour
 defined, any attempt to PUT, POST or PATCH  this resource will be validated against this schema.
 If validation fails, error 400 will be returned.
 
+If create and update requests need different schemas, for example because a password is required on create but
+optional on update, "schema_id_create" and "schema_id_update" override the "schema_id" for the respective operation.
+An upsert which creates the resource is validated as a create. Default properties are validated against the create
+schema, and with "reject_unknown_properties" a property must be declared in the create or the update schema.
+
+The schemas are passed to the backend builder, either as strings, as an embedded file system, from a directory with
+JSONSchemasDir, or from URLs, e.g. of a schema registry, with JSONSchemasURLs and JSONSchemasRefsURLs. Downloaded
+schemas can be cached in JSONSchemasCacheDir, so that the backend still starts if the registry is unavailable.
+
+If the schema of a "schema_id" is unknown to the backend, validation is deactivated for the resource and an error is
+logged. With the builder option StrictSchemas, such a misconfiguration is caught immediately instead: the backend
+panics at startup, and should the schema still be missing later, write requests fail with 500.
+
+Unless the schema sets "additionalProperties" to false, properties with misspelled names pass the validation and are
+stored silently. Setting "reject_unknown_properties" to true makes the resource reject any POST, PUT or PATCH request
+with error 400, if the document contains properties which are neither declared in the schema nor one of the
+resource's columns. Declared properties include those of "allOf", "anyOf" and "oneOf" sub schemas and of
+referenced schemas.
+
+Some clients send numbers or booleans as strings, which the schema then rejects. The "coerce" property converts
+top level properties to the given JSON type before validation:
+
+	"collections": [
+	  {
+		"resource": "product",
+		"schema_id": "https://example.com/product.json",
+		"coerce": {"price": "number", "active": "boolean"}
+	  }
+	]
+
+Supported types are "number", "integer", "boolean" and "string". A POST, PUT or PATCH request with a value
+which cannot be converted, for example a price "cheap", is rejected with error 400.
+
+Schema validation can be bypassed, e.g. by the backup tool with force=true. Rules which must always hold can be
+enforced by the database with check constraints on collections:
+
+	"check_constraints": [
+		{"name": "price_not_negative", "check": "(properties->>'price')::numeric >= 0", "message": "price must not be negative"}
+	]
+
+The check is an SQL boolean expression over the columns of the collection, dynamic properties are in the JSON
+column "properties". A create or update which violates a constraint fails with 422 (Unprocessable Entity) and the
+message of the constraint. Constraints are added during the schema update. They only apply to items which are written
+afterwards, existing items are not checked. Constraints which are removed from the configuration are dropped.
+
 # Default Properties
 
 Any Singleton or Collection resource can have an additional property "default", which defines default properties for
@@ -185,6 +512,32 @@ In addition, they are also added when older versions of objects are read from th
 are especially useful in combination with schema validation, as they make it possible to add new required properties
 without having to migrate all existing objects in the database.
 
+Default values can also be template tokens, which are resolved when an object is created:
+
+	"default": {"status": "new", "owner_id": "{{auth.user_id}}", "created_date": "{{now}}"}
+
+"{{now}}" resolves to the current server time, "{{auth.<selector>}}" to the selector of the authorization of the
+request, e.g. the id of the authenticated user. If the request has no such selector, the property is left out.
+Properties from the request body always take precedence. Unlike static defaults, template properties are neither
+applied to updates nor to objects which are read from the database.
+
+Defaults can also depend on the role of the creator. Role defaults apply on top of the default when an object is
+created by a request with that role, for example to mark the objects which admins create as verified:
+
+	"default": {"verified": false},
+	"role_defaults": {
+		"admin": {"verified": true},
+		"everybody": {"author_id": "{{auth.user_id}}"}
+	}
+
+The role default of "everybody" applies to every authenticated request and comes first, the defaults of the other
+roles of the request follow in alphabetical order of the roles. Role defaults may contain template tokens, and like
+template properties they are only applied at create time. Properties from the request body still take precedence.
+
+To debug discrepancies between defaults and stored data, admins can read and list resources with the query parameter
+raw=true. The response then contains the objects exactly as they are stored, without default properties and without
+interceptors.
+
 # Static Properties
 
 In the example above, we have extended the user and the device collections with an external index. Likewise it is possible to extend
@@ -192,7 +545,22 @@ resource with list of static string properties, using an array "static_propertie
 advantage, that they can be updated must faster than any other dynamic property. If the user resource from above had a static
 property "name", you could update that name quickly with
 
-	POST /user/{user_id}/name/{new_name}
+	PUT /user/{user_id}/name/{new_name}
+
+The fast update does not check the revision of the item, so it can overwrite concurrent changes. If this matters,
+pass the expected revision as query parameter, e.g. ?revision=3. The property is then only updated if the item still
+has this revision. Otherwise the request fails with 409 (Conflict) and returns the conflicting object, like a PUT or
+PATCH with a revision does.
+
+The same property can be set for many items at once, for example to mark all waiting devices as provisioned:
+
+	PUT /devices/provisioning_status/provisioned?filter=provisioning_status=waiting
+
+The bulk update changes all items of the collection which match the query parameters filter, from and until in a single
+SQL statement, without reading the items. Items which already have the value are left alone, all others get a new
+revision. The response contains the number of updated items, e.g. {"updated": 12}. Instead of one notification per
+item, there is a single update notification with a zero resource id, whose payload is the JSON array of the updated
+identifiers. With silent=true, there is no notification at all.
 
 It is only in rare occasions when you actually need this. In the regular case, properties of a resource should not need to be
 declared static, and property updates should be done with a standard PATCH request, returning the fully patched object.
@@ -204,12 +572,80 @@ to store the provisioning_status for IoT devices.
 Static properties can be made searchable by adding them to the "searchable_properties" array instead. This activates a filter
 in the collection get route with the name of the property. See the chapter on query parameters and pagination below.
 
+Dynamic properties of the JSON document can be promoted to SQL columns without changing the API, using an array
+"generated_properties". Each generated property has a "name", a "type" (varchar, text, int, integer, bigint, numeric,
+double precision or boolean) and a "path" into the JSON document, with nested properties separated by dots:
+
+	"generated_properties": [
+		{"name": "price_cents", "type": "int", "path": "price.cents"}
+	]
+
+The database keeps the column up to date, so existing objects need no backfill. Generated properties are indexed and
+can be used with filter and search like searchable properties, but they are not part of the returned objects.
+A request with a property value which cannot be converted to the type of its generated column is rejected
+with 400 (Bad Request), and so is a filter with such a value. Only generated properties of type varchar or text
+can be searched with a pattern (~ and ~=).
+
+When the configuration changes, the backend detects the drift between the configuration and the existing tables at startup.
+Safe migrations are applied automatically: new columns and indices are created, and indices which are no longer needed, for
+example because a searchable property became a plain static property, are dropped. Unsafe migrations are never applied.
+If a static property was removed, or a column has an unexpected type, the data is kept and a warning with the SQL statement
+required to migrate manually is logged.
+
+# Computed Properties
+
+Derived values, for example a "full_name" from "first_name" and "last_name", can be computed at read time instead of
+being stored. They are registered per resource in code:
+
+	backend.HandleComputedProperty("user", "full_name", func(object map[string]interface{}) interface{} {
+		return fmt.Sprintf("%v %v", object["first_name"], object["last_name"])
+	})
+
+Computed properties are added to every object which is read or listed, before the read interceptors. They are
+read-only and are stripped from the body of create and update requests.
+
+# Encrypted Properties
+
+Sensitive dynamic properties, for example social security numbers, can be stored encrypted, so that they are
+unreadable in the database and in its dumps:
+
+	"encrypted_properties": ["ssn"]
+
+The keys are passed with the builder options EncryptionKeys, which maps key ids to 32 byte keys, and EncryptionKeyID,
+which selects the key for new values. Values are encrypted with AES-256-GCM when a resource is created or updated, and
+decrypted whenever it is read, listed or exported. Every stored value names the id of its key, so older keys must stay
+configured as long as values encrypted with them exist. Values which were stored before a property was declared
+encrypted are returned as they are, and are encrypted with the next update.
+
+The database only sees ciphertext, hence encrypted properties cannot be filtered, searched or indexed. A filter on an
+encrypted property is rejected with 400 (Bad Request), and encrypted properties cannot be static, searchable or
+generated properties, nor external indices. Notification payloads carry the decrypted values, but are stored encrypted
+in the job queue and the outbox until they are delivered.
+
+To rotate a key, add the new key to EncryptionKeys and make it the EncryptionKeyID, so that new values use it. Then
+re-encrypt the existing values of every resource with encrypted properties as an admin:
+
+	PUT /kurbisio/encryption/rotate?resource=person&from=k1&to=k2
+
+The route returns the number of re-encrypted items as {"rotated": n}. Items are processed in batched transactions,
+hence the rotation can run while the backend serves requests, and repeating it after a failure continues where it
+stopped. Items which are locked by concurrent requests are rotated once the requests are done, so after a successful
+rotation no item uses the old key anymore. The route is not limited by the RequestTimeout. The database column
+encryption_key_id marks the key each item is encrypted with. Re-encryption does not change revisions or timestamps
+and sends no notifications. The log of a resource keeps the values with their original key, so remove the old key
+only once neither items nor log entries you still need use it.
+
 # Sorting and Timestamp
 
 Collections of resources are sorted by the timestamp, with latest first. For additional flexibility, it is possible
 to overwrite the timestamp in a POST or PUT request. If you for example import workout activities of a user, you may choose to
 use the start time of each activity as timestamp.
 
+Postgres stores timestamps with microsecond precision, while many clients only represent milliseconds. Set
+Builder.TimestampPrecision, for example to time.Millisecond, to truncate timestamps to that precision when they
+are written. Timestamps then survive a round-trip through such a client unchanged, which keeps Etags and
+pagination with "until" and "from" stable.
+
 # Query Parameters and Pagination
 
 The GET request on single resources - i.e. not on entire collections - can be customized with the "children" query parameter.
@@ -228,6 +664,51 @@ The GET request on collections can be customized with any of the searchable prop
 the resources or the first layer of properties of the json document as a filter. It is possible to search for equality of to search
 a pattern.
 
+A list of specific resources can be requested with the ids query parameter, for example to hydrate
+cached ids:
+
+	GET /users?ids=c8a4d5a8-0a15-4b4b-9a2b-0e2b3c55b6a1,2f6c5a4e-0b7d-4d1e-8a8e-2f1b9c3e7d60
+
+The response is an object with the found resources in "items", in the order of the requested ids, and
+the requested ids which do not exist in "not_found". The ids parameter cannot be combined with other
+query parameters except locale, and at most 100 ids can be requested at once.
+
+Lists can be requested as CSV with the format parameter, e.g. for spreadsheets:
+
+	GET /users?format=csv
+
+The response has the content type text/csv and is offered as download users.csv. It has a header row and
+one row per resource, with the same pagination and filters as the JSON list. The columns are the
+identifiers, the static properties, timestamp and revision, plus the dynamic properties listed in the
+collection configuration as "csv_properties":
+
+	"csv_properties": ["name", "address"]
+
+Nested JSON values like "address" are serialized as JSON strings in their cell. Properties which a
+resource does not have remain empty.
+
+# Translations
+
+Resources can carry localized values in the property "translations", which maps locales to property overrides:
+
+	{
+	  "name": "Chair",
+	  "description": "A chair",
+	  "translations": {
+	    "de": {"name": "Stuhl", "description": "Ein Stuhl"},
+	    "fr": {"name": "Chaise"}
+	  }
+	}
+
+The GET requests on single resources and on collections accept the query parameter locale, for example
+
+	GET /products?locale=de
+
+which overlays the values for the requested locale onto the resource before it is returned. Properties without
+a translation for the locale keep their base value. For a regional locale like "de-AT" without translations,
+the translations for the language "de" are used. The translations are returned as well, so a localized
+resource must not be written back as-is, since this would overwrite its base values.
+
 # Searching and Filtering
 
 Collections support two different operators for searching and filtering: search and filter. The operator "search" is guaranteed to be fast, it only
@@ -248,8 +729,35 @@ _ represents one, single character
 	GET /users?filter=identity~%@test.com
 	returns all users with an email which ends with @test.com
 
+Searching for a substring:
+Since % and _ are wildcards in patterns, a pattern cannot easily search for text which contains them, for example 50%.
+The operator `~=` searches for properties which contain the text literally, without any wildcards:
+
+	GET /products?filter=discount~=50%25
+	returns all products with a discount which contains 50%
+
+Prefer `~=` over a pattern whenever clients pass user input, since user input could otherwise contain wildcards.
+
+Searchable properties are indexed. If almost all resources share one value of a property and only few have another,
+for example devices which are mostly "provisioned" and rarely "waiting", a partial index makes the search for the rare
+value much faster, since it only covers the resources which have it:
+
+	"searchable_properties": ["provisioning_status"],
+	"partial_indices": [{"property": "provisioning_status", "value": "waiting"}]
+
+Partial indices require a searchable property. They are used for the filter provisioning_status=waiting.
+
 If you specify multiple filters, they filter on top of each other (i.e. with logical AND).
 
+For alternatives, use filter_or instead. All filter_or parameters form one group, which matches if any of them matches,
+and the group is combined with the other filters with AND:
+
+	GET /devices?filter_or=status=active&filter_or=status=pending&filter=color=red
+	returns all red devices which are active or pending
+
+filter_or supports the same operators as filter, on searchable properties as well as on the JSON document, and also
+works for relation lists.
+
 Filters can be combined with the wildcard 'all' keyword. For instance, it is possible to get all the devices of a user by filtering
 on the user_id property
 
@@ -257,6 +765,12 @@ on the user_id property
 		This is equivalent to using the following, but may be more convenient to write in some cases.
 	GET users/f879572d-ac69-4020-b7f8-a9b3e628fd9d/devices
 
+The zero UUID 00000000-0000-0000-0000-000000000000 is never an identifier: when a resource is created with it, it
+gets a new identifier instead. Filters which compare an identifier with the zero UUID, like filter=user_id=00000000-0000-0000-0000-000000000000,
+are therefore rejected with 400 (Bad Request), instead of silently returning nothing. Usually such a filter means that
+a null identifier leaked into the request. This applies to the identifiers of the resource and its parents, also
+when filtering relations, but not to properties of the JSON document.
+
 The system supports pagination and filtering of responses by creation time:
 
 	?order=[asc|desc]  sets the sorting order to be descending (newest first, the default) or ascending (oldest first)
@@ -266,6 +780,15 @@ The system supports pagination and filtering of responses by creation time:
 	?until=t  selects items created up until and including the timestamp t. The default is "0001-01-01 00:00:00 +0000 UTC".
 	Timestamps must be formatted following RFC3339 (https://tools.ietf.org/html/rfc3339).
 
+Instead of a timestamp, from and until also accept times relative to the server clock, so clients need not compute
+them: "now", "now" minus or plus a number of seconds (s), minutes (m), hours (h), days (d) or weeks (w), and "today"
+for the start of the current day in UTC. For example, the items of the last seven days are
+
+	GET /users?from=now-7d
+
+Since + means a space in query strings, it must be escaped as %2B, e.g. until=now%2B1h. Unparseable times fail with
+400 (Bad Request). Relative times work wherever from and until do, including when deleting a collection.
+
 The response carries the following custom headers for pagination:
 
 	"Pagination-Limit"        the page limit
@@ -277,6 +800,34 @@ The response carries the following custom headers for pagination:
 The maximum allowed limit is 100, which is also the default limit. Combining pagination with the until-filter
 avoids page drift. A well-behaving application would get the first page without any filter, and then use the timestamp
 reported in the "Pagination-Until" header as until-parameter for querying pages further down.
+Lists have no opaque cursor tokens which could expire: a page is fully described by page and until, which stay
+meaningful for any age. Items deleted since the first page shift the following pages forward, hence clients which
+paginate over a long time should restart with a fresh first page. The only tokens are those of the change feed,
+which expire when their changes are pruned, see Change Feed.
+With the builder option ServerTimeHeader, list responses also carry the header "Kurbisio-Server-Time", see Server Time.
+
+Counting all matching items has a cost on big collections, even when only one page is read. Clients which do not need
+the totals can request a list with "?withtotalcount=false". The query then skips the count, and the response carries
+neither "Pagination-Total-Count" nor "Pagination-Page-Count". Without the page count, HAL responses have no "next"
+link either, so such clients page on until there is a page with less than limit items.
+
+Lists of big documents can become big responses, even with the default limit. The builder option MaxListResponseBytes
+limits the size of list responses. A list which would exceed it fails with 413 (Request Entity Too Large), and the error
+message suggests a lower limit with which the response fits.
+
+Collections and blobs are always ordered by timestamp and then by their primary identifier. Resources with equal
+timestamps, for example from an import with explicit timestamps, therefore appear in the same order no matter
+whether pages are selected with page, with until or with both.
+
+Collections also support random samples, for example for A/B testing or quality assurance
+
+	GET /users?order=random&limit=10
+
+returns 10 randomly selected users. The sample is different for every request, so pagination is not supported in this
+mode: the page parameter is rejected, and the response carries neither "Pagination-Page-Count" and
+"Pagination-Current-Page" nor "Pagination-Until". Filters, from and until still restrict the set to sample from. The
+sample is drawn with ORDER BY random(), which reads all matching rows, so keep the set small with filters on large
+collections.
 
 For collections it is possible to only retrieve meta data, by specifying the ?onlymeta=true query parameter. Meta data are
 all defining identifiers, the timestamp and each object's revision number.
@@ -288,9 +839,58 @@ no identifier or a null identifier, then the system creates a new unique UUID fo
 a primary identifier in the request, which will be honored by the system. This feature - and the choice of UUID for
 primary identifiers - makes it possible to easily transfer data between different databases.
 
+Generated identifiers are random version 4 UUIDs by default. In tables with many writes, random identifiers scatter
+the inserts across the whole primary key index. With
+
+	"id_version": 7
+
+a collection generates time-ordered version 7 UUIDs instead, so new rows are appended to the end of the index.
+Identifiers provided by the client are honored regardless of their version. Lists are still ordered by timestamp
+first, the identifier only breaks ties between equal timestamps, so pagination works the same with either version.
+
+Every response item carries its complete owner chain, i.e. the identifiers of all its parents at any nesting depth. A
+device of "fleet/user/device" has "device_id", "user_id" and "fleet_id", whether it is read, created, updated or
+listed, including wildcard lists like /fleets/all/users/all/devices. Clients can therefore always build the path of
+an item from the item alone.
+
 # Notifications
 
-The backend supports notifications through the Notifier interface specified at construction time.
+The backend supports notifications through the Notifier interface specified at construction time, for example to
+stream changes to an external message broker. The notifications are delivered through a transactional outbox: every
+notification is written to the table "_outbox_" in the same transaction as the change of the resource, so it exists
+if and only if the change was committed. The job processing relays pending notifications to the Notifier in the
+order in which they were written and marks them as published. Notifications which were not yet published when the
+process stopped are published after a restart. A notification can be published twice if the process stops right
+after the Notifier was called, so the receiver should tolerate duplicates. RelayOutbox() relays the outbox on demand.
+
+A Notifier which can fail, for example because the broker is unreachable, implements core.NotifierWithError. When
+NotifyWithError returns an error, the relay stops: the failed notification and all later ones are not marked as
+published and are relayed again, in order, by the next job processing.
+
+Modifying requests with the query parameter "silent=true" do not send notifications. To suppress the notifications of
+an entire sequence of requests, for example a large import through the client, use client.Silent() or a request
+context created with core.ContextWithSilent(). A single event can then be raised after the import.
+
+Notification handlers run asynchronously. For work which must be done before the response is sent, but only once
+the change is committed, for example invalidating an external cache, install a hook with HandleAfterCommit(). The
+hook is called synchronously right after the transaction was committed successfully. It cannot alter the response,
+and it is also called for silent requests.
+
+# Maintenance Window
+
+Heavy events, for example recomputing reports, should not run during business hours. The builder option
+MaintenanceWindow defines a recurring time of day range, optionally restricted to some days of the week, in which
+deferrable events are processed:
+
+	MaintenanceWindow: &backend.MaintenanceWindow{
+		Start: 22 * time.Hour,
+		End:   6 * time.Hour,
+		Days:  []time.Weekday{time.Saturday, time.Sunday},
+	}
+
+An event type becomes deferrable with DefineDeferrableEvent(). A deferrable event which is raised or scheduled outside
+the window is scheduled at the start of the next window instead, and so is a retry. All other events and all
+notifications are processed immediately as usual.
 
 # Relations
 
@@ -314,6 +914,8 @@ Examples:
   - to list right/{right_id}/lefts, one needs to have the "list" permission on the right_permit.
   - to delete left/{left_id}/right/{right_id}, one needs to have the "delete" permission on the left_permit.
   - to delete right/{right_id}/left/{left_id}, one needs to have the "delete" permission on the right_permit.
+  - to delete several relations with left/{left_id}/rights, one needs to have the "delete" permission on the left_permit.
+  - to delete several relations with right/{right_id}/lefts, one needs to have the "delete" permission on the right_permit.
   - the update permission is not used
 
 For each relation, the number of related resources for one other resource is currently limited by 1000. In the above
@@ -323,6 +925,24 @@ Relations support an extra query parameter "?idonly=true", which returns only th
 If you furthermore specify "withtimestamp=true", you will receice both the ids and the timestamp when this relation was
 established.
 
+To only learn how many resources are related, e.g. how many devices a user has, specify "?countonly=true". This returns
+the number of related resources as {"count": N}, without reading them.
+
+Relation lists support the same "filter" and "search" query parameters as collections, see the chapter on searching and
+filtering below. The filters apply to the properties of the related resource, so GET /users/{user_id}/devices?filter=status=active
+lists only the active devices of a user. This works with "?idonly=true" and "?countonly=true" as well.
+
+To remove many relations at once, send a DELETE to the relation list. DELETE /users/{user_id}/devices removes all
+relations of the user, DELETE /users/{user_id}/devices?filter=status=broken only those to broken devices. The request
+body can furthermore hold a JSON array of identifiers, e.g. ["<device_id>", "<device_id>"], to remove only the
+relations to these devices. All matching relations are removed in a single statement, the related resources remain.
+Like the deletion of a single relation, this does not create notifications.
+
+Relation lists are ordered by the timestamp of the related resources, like any other list. To order them by the time the
+relations were established instead, e.g. to list the devices most recently assigned to a user first, specify
+"?order_by=relation_timestamp". It can be combined with "?order=asc" and pagination. Since from and until still select
+by the timestamp of the related resources, these responses do not carry the "Pagination-Until" header.
+
 Relations can also be given an explicit Resource name just like any other collection, which allows multiple different
 relations from the the same resource types. The resource name then becomes a prefix to access the relation.
 
@@ -349,6 +969,16 @@ All static properties, searchable properties and external indices of a blob are
 The property "content_type" hence becomes a header "Content-Type". All other properties are transferred as the
 header "Kurbisio-Meta-Data".
 
+Browser clients can only read response headers which are listed in the Access-Control-Expose-Headers
+header. The backend exposes "Kurbisio-Meta-Data", "Kurbisio-Request-Id", "Kurbisio-Server-Time", "Kurbisio-Source",
+"Etag", the pagination headers and the canonical headers of all blob properties. Additional headers can be exposed
+with Builder.CORSExposeHeaders.
+
+OPTIONS requests, including CORS preflight requests, are answered with 204 (No Content) and an Allow header, which
+lists the methods the route actually serves. For an item of a mutable collection this is for example
+"OPTIONS, GET, PUT, PATCH, DELETE", for an item of an immutable collection "OPTIONS, GET, DELETE". Alias and
+shortcut routes list the methods of the resource they lead to.
+
 Blobs are immutable by default, which means they can be optimally cached. If you need blobs that can be
 updated, for example a profile image, you get declare them mutable like this:
 
@@ -432,9 +1062,137 @@ You can easily check the authorization state of any token, by doing a GET reques
 
 which will return the authorization state for the authenticated requester as JSON object.
 
+Common combinations of permits have a shortcut. A collection with
+
+	"access": "public_read"
+
+can be read and listed by the public, and created, updated and deleted by every authenticated role. The shortcut
+expands to the permits of the roles "public" and "everybody" when the configuration is parsed, in addition to any
+permits of the collection, so it can be combined with further permits, e.g. to let a role also clear the collection.
+
 Singletons conceptually always exist, i.e. they can be updated and patched with a permission for
 "update", even if there is no object in the database yet.
 
+Endpoints which do not map to a resource, for example a complex report, can be added with HandleCustom. The route
+is served by the backend's router, so it passes the same middlewares as the resource routes, and is only authorized
+to the given roles:
+
+	backend.HandleCustom("/reports/{report}", []string{http.MethodGet}, []string{"accountant"}, reportHandler)
+
+The roles have the same meaning as in permits, and GET requests are also authorized to the "admin viewer". Custom
+routes are matched after the resource routes, so their paths must not collide with a resource.
+
+# Errors
+
+Errors are returned as plain text by default, for example "Error 4721" for internal errors or "not authorized".
+If a request accepts "application/json", or if the backend was built with JSONErrors, errors are returned as
+structured JSON instead:
+
+	{
+		"error": {
+			"code": "4721",
+			"message": "Error 4721",
+			"request_id": "f879572d-ac69-4020-b7f8-a9b3e628fd9d"
+		}
+	}
+
+The code is the numeric error code for internal errors, and otherwise derived from the HTTP status, for
+example "bad_request" or "unauthorized". The request id is also part of the server log for the request.
+
+A resource which conflicts with an external index of another resource fails with 409 (Conflict) and the message
+"constraint violation of external index 'email'", so that clients can tell which value is taken. Structured errors
+report the external index also as "property":
+
+	{
+		"error": {
+			"code": "conflict",
+			"message": "constraint violation of external index 'email'",
+			"property": "email",
+			"request_id": "f879572d-ac69-4020-b7f8-a9b3e628fd9d"
+		}
+	}
+
+Internal errors never expose details like database messages to the client. They are reported with their error code
+only, while the details are logged together with the request id. Every response carries the request id in the header
+Kurbisio-Request-Id, so that errors can be correlated with the log also when they are returned as plain text.
+
+If a request fails because the database is temporarily unavailable, for example because all its connections are in
+use or the connection to the database was lost, the error is returned with 503 (Service Unavailable) instead of 500
+and a Retry-After header with the number of seconds a client should wait before retrying.
+
+The builder option RequestTimeout limits how long a single request may take. A request which exceeds it is cancelled,
+including its running database queries, and fails with 503 (Service Unavailable) and a Retry-After header as well.
+Routes which stream big bodies are exempt, since a deadline would truncate them: the up- and download of blobs, and
+the export.zip and import routes of collections. The rotation of encryption keys is exempt as well, since it
+processes all items of a resource.
+
+If an upsert of a singleton keeps colliding with concurrent requests which create the same singleton, it gives up after
+a few retries and fails with 429 (Too Many Requests). The Retry-After header of the response contains a small random
+number of seconds, so that contending clients do not retry at the same time again.
+
+To isolate resources from each other, collections and singletons can limit the number of their concurrent write
+requests with the property "max_concurrent_writes". Further write requests queue for up to one second, and then fail
+with 503 (Service Unavailable) and a Retry-After header. This way, a flood of writes to one resource cannot exhaust
+the database connections which other resources need.
+
+# Compression
+
+Responses of collections and singletons are gzip compressed if the client accepts it with the Accept-Encoding header.
+For small objects with high request rates, the compression costs more CPU than it saves bandwidth. A collection or
+singleton declared with
+
+	"disable_compression": true
+
+always responds uncompressed. Blobs are never compressed, since their data is often compressed already.
+
+Some clients cannot access the standard Content-Encoding, because their HTTP stack decompresses transparently or not
+at all. They can request a compressed body with the header
+
+	Kurbisio-Accept-Encoding: gzip
+
+The response body is then gzip compressed, including blobs and error responses, and marked with the header
+"Kurbisio-Content-Encoding: gzip" instead of "Content-Encoding". This mirrors the Kurbisio-Content-Encoding request
+header, which POST and PUT requests can use for gzip compressed bodies.
+
+# Property Casing
+
+Resources are stored with snake_case property names, which includes all identifiers like "user_id". Clients which
+prefer camelCase can send the header
+
+	Kurbisio-Property-Casing: camel
+
+The top-level keys of JSON request bodies are then converted to snake_case, and the top-level keys of JSON responses,
+or of the items of a list, to camelCase. Nested objects are not converted, since their keys may be data like the keys
+of a map. Gzip compressed request bodies are converted as well, other content encodings are rejected with 415
+(Unsupported Media Type). The property names in the filter, filter_or and search query parameters are converted as
+well, for example "?filter=firstName=Jane". Building the backend with Builder.CamelCase enables the conversion for all requests.
+Headers like Kurbisio-Meta-Data of blobs are not converted. Note that the conversion is only reversible for names which do
+not contain upper case letters or consecutive underscores in their snake_case form.
+
+# HAL Links
+
+Hypermedia clients can request the HAL representation of resources with the header
+
+	Accept: application/hal+json
+
+Single items then carry a "_links" object with links to the item itself, to its parent, to its child resources and
+to its relations, for example
+
+	{
+	  "user_id": "f879572d-ac69-4020-b7f8-a9b3e628fd9d",
+	  ...
+	  "_links": {
+	    "self": {"href": "/users/f879572d-ac69-4020-b7f8-a9b3e628fd9d"},
+	    "devices": {"href": "/users/f879572d-ac69-4020-b7f8-a9b3e628fd9d/devices"},
+	    "profile": {"href": "/users/f879572d-ac69-4020-b7f8-a9b3e628fd9d/profile"}
+	  }
+	}
+
+Lists become an object with the items, each with its own links, in "_embedded" and the links "self", "next" and
+"prev" in "_links". The pagination links keep the "until" of the first page. Links of relations which belong to a
+named relation resource are prefixed with the name, e.g. "membership/groups". Error responses are not transformed,
+and plain JSON remains the default.
+
 # If-None-Match and Etag
 
 All GET requests are served with Etag and obey the If-None-Match request. This allows clients to check
@@ -443,6 +1201,38 @@ the received Etag of a request into the If-None-Match header of a subsequent req
 simply response to that subsequent with a 304 Not Modified in case the resource was not changed. In case
 the resource was changed, the request will be answered as usual.
 
+Blobs and items of immutable collections are additionally served with a Last-Modified header, which is
+derived from the timestamp of the resource, and obey the If-Modified-Since request. Since updates of
+collection items do not change their timestamp unless the client does so explicitly, items of mutable
+collections have no Last-Modified header and rely on Etag instead. If a request has both If-None-Match
+and If-Modified-Since, then If-Modified-Since is ignored.
+
+The Etag of a list is computed from the response body, so even a 304 Not Modified requires building the
+complete body. For big collections, set "weak_list_etag" to true in the collection configuration. Lists
+are then served with a weak Etag like W/"..." instead, which is computed from a cheap aggregate over all
+matching items: their count, the maximum and the sum of their revisions and a hash of their ids. A
+matching If-None-Match is answered with 304 before the body is built. The weak Etag only reflects
+changes to the stored items; changed defaults do not change it. Collections with a list interceptor
+therefore always use the regular Etag, unless raw=true is requested.
+
+Apart from weak list Etags, an Etag is always computed from the exact bytes of the response, after
+defaults, interceptors and options like return=changed were applied.
+
+Like blobs, collections support "max_age_cache" in seconds. Successful lists of such a collection are then served with
+"Cache-Control: max-age=N" and a matching "Expires" header next to their Etag, also for 304 Not Modified responses,
+so that clients and CDNs can cache them and revalidate with If-None-Match afterwards. Random samples, relation lists
+and errors are not cached, and all writes to the collection are answered with "Cache-Control: no-store". Keep in mind
+that a cached list can be up to max_age_cache seconds old, and that lists which depend on the authorization must not
+be cached by a shared cache.
+
+Popular resources are often read by many clients at the same time. Collections and singletons with
+"coalesce_reads" set to true let concurrent identical GET requests share one execution: a request which
+arrives while an identical request is executed waits for it and gets a copy of its response, instead of
+querying the database again. Requests are identical if they have the same path, query and Accept header,
+and the same identity and authorization, so a shared response never crosses authorization boundaries.
+Each request still compares its own If-None-Match with the Etag of the shared response and gets a 304 Not
+Modified if it matches. If-Modified-Since is not evaluated for coalesced requests.
+
 # Externally stored data
 
 Collections allow to store a file with each individual collection item. Unlike blobs which should
@@ -494,6 +1284,24 @@ the URL is used to fetch data. The URL are pre-signed URL with a validity time w
 It is possible to define the validity duration of the pre-signed URL in the configuration using the `companion_presigned_url_validity`
 key which defines the duration in seconds for which the URL will be valid
 
+Blobs declared with "stored_externally" keep their data in the same storage. Large files can be uploaded in parts,
+so a failed part can be retried without starting over. The blob is created first, typically with an empty body,
+then the upload is initiated with the number of parts:
+
+	POST /blobs/{blob_id}/uploads?parts=3
+	{"upload_id": "...", "part_urls": ["...", "...", "..."]}
+
+Each part is uploaded with PUT to its pre-signed URL, which returns the Etag of the part. A fresh URL for a part is
+available at GET /blobs/{blob_id}/uploads/{upload_id}/parts/{part_number}. Finally the upload is completed with
+
+	POST /blobs/{blob_id}/uploads/{upload_id}
+	{"parts": [{"part_number": 1, "etag": "..."}, {"part_number": 2, "etag": "..."}, {"part_number": 3, "etag": "..."}]}
+
+or aborted with DELETE /blobs/{blob_id}/uploads/{upload_id}. Uploads into an empty blob require the permit to create
+the blob, or to update it if the blob is mutable. Replacing the data of a blob requires the permit to update it, and is
+rejected with 409 (Conflict) unless the blob is mutable. Completing an upload updates the timestamp of the blob, and
+with it the Etag, and sends an update notification. With S3, all parts except the last one must be at least 5 MB.
+
 # Deleting a resource also delete the associated companion file if it exist
 
 # Statistics
@@ -527,6 +1335,50 @@ If you are only interested in certain resources, you can filter using the resour
 
 	/statistics?resource=user,device
 
+Counting the rows of big resources scans their complete tables. With approximate=true, the statistics use the
+row estimates of the database planner instead, which are fast but only as accurate as the last analyze:
+
+	/statistics?approximate=true
+
+The computation is limited by the builder option StatisticsTimeout, default 30 seconds. If it takes longer, the
+request fails with 503 (Service Unavailable) and a Retry-After header.
+
+# Index Advice
+
+Filters on properties of the JSON document cannot use an index, see "Searching and Filtering". To find the properties
+which are worth promoting to searchable properties, the backend counts how often lists are filtered by properties of
+the JSON document. Admins can retrieve these counters, the most used first, with
+
+	GET /kurbisio/debug/index-advice?resource=user,device
+
+which returns a JSON body like this:
+
+	{
+		"since": "2021-03-01T08:00:00Z",
+		"advice": [
+			{
+				"resource": "user",
+				"property": "email",
+				"count": 1234,
+				"last_used": "2021-03-02T17:12:45Z",
+				"suggestion": "add email to the searchable_properties or generated_properties of user"
+			}
+		]
+	}
+
+The counters are kept in memory per backend instance since it started, given in "since". Without the resource
+parameter, the advice covers all resources. At most 100 properties are counted per resource, properties which are
+filtered by for the first time after that are ignored.
+
+# Warm-Up
+
+The first request to a resource is slower than the following ones: the database parses and plans its queries and
+loads the metadata of the tables. With the builder option WarmUp, New prepares the read, list, insert and update
+statements of every collection, singleton and blob before it returns, so that this work is done at startup instead.
+With WarmUpAnalyze in addition, the warm-up runs ANALYZE on the resource tables, so that the query planner has fresh
+statistics, e.g. after a restore or a big import. Both make the startup slower. Failures of the warm-up are logged,
+but do not prevent the startup.
+
 # Version
 
 The Version of the software running can be obtain from a dedicated endpoint. The version can be set
@@ -540,5 +1392,31 @@ at compile time with the following parameter:
 	{
 		"version": "1.2.3"
 	}
+
+# Configuration Introspection
+
+Administrators can verify the configuration a backend runs with at
+
+	GET /config
+
+This returns the collections, singletons, blobs, relations and shortcuts as the backend parsed them from its JSON
+configuration, including all options with their default values. It requires the role "admin" or "admin viewer".
+The response contains no secrets, since database credentials and the other builder options are not part of the
+configuration.
+
+# Server Time
+
+Clients compute from and until parameters with their own clock, which may be off. The current time of the
+server is available to everybody at
+
+	GET /time
+
+	{
+		"now": "2021-03-04T10:11:12.123456789Z"
+	}
+
+With the builder option ServerTimeHeader, every list response also carries the server time in the header
+"Kurbisio-Server-Time", taken before the items are read. A client can pass it as "from" parameter of its next
+list request to get exactly the items which were written since.
 */
 package backend
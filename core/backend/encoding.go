@@ -0,0 +1,73 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"compress/gzip"
+	"net/http"
+)
+
+// handleKurbisioContentEncoding installs a middleware which gzip compresses response bodies if the client
+// requests it with the header Kurbisio-Accept-Encoding: gzip. The response then carries the header
+// Kurbisio-Content-Encoding: gzip instead of Content-Encoding, so that neither browsers nor proxies
+// decompress the body transparently. This mirrors the Kurbisio-Content-Encoding request header, which
+// create and upsert accept for gzipped request bodies.
+func (b *Backend) handleKurbisioContentEncoding() {
+	encodingMiddleware := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Kurbisio-Accept-Encoding") != "gzip" || r.Method == http.MethodHead {
+				h.ServeHTTP(w, r)
+				return
+			}
+			// the body must not be compressed twice, also not if the request is routed again internally
+			r.Header.Del("Accept-Encoding")
+			r.Header.Del("Kurbisio-Accept-Encoding")
+			w.Header().Add("Vary", "Kurbisio-Accept-Encoding")
+			gw := &gzipResponseWriter{ResponseWriter: w}
+			h.ServeHTTP(gw, r)
+			gw.finish()
+		})
+	}
+	b.router.Use(encodingMiddleware)
+}
+
+// gzipResponseWriter compresses the response body and marks it with Kurbisio-Content-Encoding
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	writer      *gzip.Writer
+	wroteHeader bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	if status != http.StatusNoContent && status != http.StatusNotModified {
+		g.Header().Set("Kurbisio-Content-Encoding", "gzip")
+		g.Header().Del("Content-Length")
+		g.writer = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.writer == nil {
+		return g.ResponseWriter.Write(b)
+	}
+	return g.writer.Write(b)
+}
+
+// finish flushes the compressed body. It must be called after the handler returned
+func (g *gzipResponseWriter) finish() {
+	if g.writer != nil {
+		g.writer.Close()
+	}
+}
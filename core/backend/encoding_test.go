@@ -0,0 +1,92 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/relabs-tech/kurbisio/core/access"
+)
+
+func TestKurbisioContentEncoding(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "a"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	var created map[string]interface{}
+	if _, err := testService.client.RawPost("/as", map[string]string{"name": "compressed"}, &created); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name             string
+		acceptEncoding   string
+		expectedEncoding string
+	}{
+		{"kurbisio encoding", "", "gzip"},
+		{"kurbisio and standard encoding", "gzip", "gzip"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/as/"+created["a_id"].(string), nil)
+			r.Header.Set("Kurbisio-Accept-Encoding", "gzip")
+			if tc.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+			rec := httptest.NewRecorder()
+			testService.Router.ServeHTTP(rec, r)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tc.expectedEncoding, rec.Header().Get("Kurbisio-Content-Encoding"))
+			assert.Equal(t, "", rec.Header().Get("Content-Encoding"))
+
+			// compressed exactly once
+			reader, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var read map[string]interface{}
+			if err = json.Unmarshal(data, &read); err != nil {
+				t.Fatal(err, string(data))
+			}
+			assert.Equal(t, "compressed", read["name"])
+		})
+	}
+
+	// without body there is nothing to compress
+	_, header, err := testService.client.RawGetWithHeader("/as/"+created["a_id"].(string), map[string]string{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/as/"+created["a_id"].(string), nil)
+	r.Header.Set("Kurbisio-Accept-Encoding", "gzip")
+	r.Header.Set("If-None-Match", header.Get("Etag"))
+	r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+	rec := httptest.NewRecorder()
+	testService.Router.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, "", rec.Header().Get("Kurbisio-Content-Encoding"))
+}
@@ -0,0 +1,415 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/relabs-tech/kurbisio/core/access"
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// encryptedPrefix marks an encrypted property value. The value has the format enc:<key id>:<base64 of nonce and
+// ciphertext>, so that every value names the key it was encrypted with.
+const encryptedPrefix = "enc:"
+
+// encryptionRotationBatchSize is the number of rows which RotateEncryptionKey re-encrypts in one transaction
+const encryptionRotationBatchSize = 100
+
+// encryption encrypts and decrypts the values of encrypted properties with AES-256-GCM
+type encryption struct {
+	keys map[string]cipher.AEAD
+	// keyID is the key which encrypts new values
+	keyID string
+}
+
+// newEncryption returns the encryption for the given keys, which must be 32 bytes each. keyID selects the key
+// for new values. It returns nil if there are no keys.
+func newEncryption(keys map[string][]byte, keyID string) (*encryption, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	e := &encryption{keys: map[string]cipher.AEAD{}, keyID: keyID}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id '%s'", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s must have 32 bytes", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if e.keys[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := e.keys[keyID]; !ok {
+		return nil, fmt.Errorf("unknown key id '%s'", keyID)
+	}
+	return e, nil
+}
+
+// encrypt encrypts the JSON encoding of value with the key keyID. The additional data binds the ciphertext to
+// a property, so that an encrypted value cannot be copied to another property.
+func (e *encryption) encrypt(keyID string, value interface{}, additionalData string) (string, error) {
+	aead, ok := e.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("unknown key id '%s'", keyID)
+	}
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(additionalData))
+	return encryptedPrefix + keyID + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt returns the decrypted value and the id of the key it was encrypted with. Values which are not
+// encrypted, e.g. those written before the property was declared encrypted, are returned as they are.
+func (e *encryption) decrypt(value interface{}, additionalData string) (interface{}, string, error) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, encryptedPrefix) {
+		return value, "", nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(s, encryptedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return nil, "", fmt.Errorf("malformed encrypted value")
+	}
+	keyID := parts[0]
+	aead, ok := e.keys[keyID]
+	if !ok {
+		return nil, keyID, fmt.Errorf("unknown key id '%s'", keyID)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, keyID, fmt.Errorf("malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(additionalData))
+	if err != nil {
+		return nil, keyID, err
+	}
+	var decrypted interface{}
+	if err = json.Unmarshal(plaintext, &decrypted); err != nil {
+		return nil, keyID, err
+	}
+	return decrypted, keyID, nil
+}
+
+// encryptProperties encrypts the encrypted properties of resource in the dynamic properties of an object,
+// before they are written to the database. Null values stay null.
+func (b *Backend) encryptProperties(resource string, encryptedProperties []string, properties map[string]interface{}) error {
+	for _, property := range encryptedProperties {
+		value, ok := properties[property]
+		if !ok || value == nil {
+			continue
+		}
+		encrypted, err := b.encryption.encrypt(b.encryption.keyID, value, resource+"/"+property)
+		if err != nil {
+			return err
+		}
+		properties[property] = encrypted
+	}
+	return nil
+}
+
+// decryptProperties decrypts the encrypted properties of resource in the dynamic properties of an object,
+// after they were read from the database. A value which cannot be decrypted is removed, so that ciphertext
+// never reaches a client.
+func (b *Backend) decryptProperties(resource string, encryptedProperties []string, properties map[string]interface{}) error {
+	var failed error
+	for _, property := range encryptedProperties {
+		value, ok := properties[property]
+		if !ok {
+			continue
+		}
+		decrypted, _, err := b.encryption.decrypt(value, resource+"/"+property)
+		if err != nil {
+			delete(properties, property)
+			failed = fmt.Errorf("cannot decrypt %s: %w", property, err)
+			continue
+		}
+		properties[property] = decrypted
+	}
+	return failed
+}
+
+// encryptedPropertiesOf returns the encrypted properties of the collection or singleton resource
+func (b *Backend) encryptedPropertiesOf(resource string) []string {
+	for _, rc := range b.config.Collections {
+		if rc.Resource == resource {
+			return rc.EncryptedProperties
+		}
+	}
+	for _, rc := range b.config.Singletons {
+		if rc.Resource == resource {
+			return rc.EncryptedProperties
+		}
+	}
+	return nil
+}
+
+// sealPayload encrypts the encrypted properties of resource in a notification payload, before the payload is
+// stored in the job queue or the outbox, so that the database only sees ciphertext. Payloads which are not JSON
+// objects, like the identifiers of bulk operations, are returned as they are.
+func (b *Backend) sealPayload(resource string, payload []byte) ([]byte, error) {
+	encryptedProperties := b.encryptedPropertiesOf(resource)
+	if len(encryptedProperties) == 0 || b.encryption == nil {
+		return payload, nil
+	}
+	var object map[string]interface{}
+	if json.Unmarshal(payload, &object) != nil {
+		return payload, nil
+	}
+	if err := b.encryptProperties(resource, encryptedProperties, object); err != nil {
+		return nil, err
+	}
+	return json.MarshalWithOption(object, json.DisableHTMLEscape())
+}
+
+// openPayload decrypts the encrypted properties of resource in a notification payload which was sealed with
+// sealPayload, so that the receivers of notifications get the decrypted values
+func (b *Backend) openPayload(resource string, payload []byte) ([]byte, error) {
+	encryptedProperties := b.encryptedPropertiesOf(resource)
+	if len(encryptedProperties) == 0 || b.encryption == nil {
+		return payload, nil
+	}
+	var object map[string]interface{}
+	if json.Unmarshal(payload, &object) != nil {
+		return payload, nil
+	}
+	err := b.decryptProperties(resource, encryptedProperties, object)
+	opened, _ := json.MarshalWithOption(object, json.DisableHTMLEscape())
+	return opened, err
+}
+
+// encryptionKeyIDExpression returns the SQL expression which extracts the id of the encryption key from the
+// encrypted properties of a row. All encrypted properties of a row are written together and hence share a key.
+// The expression is null if the row has no encrypted values.
+func encryptionKeyIDExpression(row string, encryptedProperties []string) string {
+	var keyIDs []string
+	for _, property := range encryptedProperties {
+		keyIDs = append(keyIDs, fmt.Sprintf("substring(%s.properties->>'%s' from '^%s([^:]+):')",
+			row, strings.ReplaceAll(property, "'", "''"), encryptedPrefix))
+	}
+	return "COALESCE(" + strings.Join(keyIDs, ", ") + ")"
+}
+
+// encryptionKeyQuery returns the query which creates the encryption_key_id column of a resource with encrypted
+// properties, and the trigger which maintains it on every write. The column marks the key the row is encrypted
+// with, so that RotateEncryptionKey finds the rows which still use an old key.
+func encryptionKeyQuery(schema, resource, this string, encryptedProperties []string) string {
+	function := fmt.Sprintf("%s.\"%s/encryption_trigger\"", schema, resource)
+	query := fmt.Sprintf("ALTER TABLE %s.\"%s\" ADD COLUMN IF NOT EXISTS encryption_key_id varchar;", schema, resource)
+	query += fmt.Sprintf("CREATE index IF NOT EXISTS %s ON %s.\"%s\"(encryption_key_id);",
+		"encryption_key_"+this, schema, resource)
+	query += fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger AS $$
+BEGIN
+	NEW.encryption_key_id := %s;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;`, function, encryptionKeyIDExpression("NEW", encryptedProperties))
+	query += fmt.Sprintf("DROP TRIGGER IF EXISTS encryption_key ON %s.\"%s\";", schema, resource)
+	query += fmt.Sprintf("CREATE TRIGGER encryption_key BEFORE INSERT OR UPDATE ON %s.\"%s\" FOR EACH ROW EXECUTE PROCEDURE %s();",
+		schema, resource, function)
+	return query
+}
+
+// validateRotation returns the encrypted properties of resource and the column which identifies its items, or an
+// error if the keys of a rotation are not valid or resource has no encrypted properties
+func (b *Backend) validateRotation(resource, fromKeyID, toKeyID string) ([]string, string, error) {
+	if b.encryption == nil {
+		return nil, "", fmt.Errorf("the backend has no encryption keys")
+	}
+	for _, keyID := range []string{fromKeyID, toKeyID} {
+		if _, ok := b.encryption.keys[keyID]; !ok {
+			return nil, "", fmt.Errorf("unknown key id '%s'", keyID)
+		}
+	}
+	if fromKeyID == toKeyID {
+		return nil, "", fmt.Errorf("the keys must differ")
+	}
+	resources := strings.Split(resource, "/")
+	var encryptedProperties []string
+	var idColumn string
+	for _, rc := range b.config.Collections {
+		if rc.Resource == resource {
+			encryptedProperties = rc.EncryptedProperties
+			idColumn = resources[len(resources)-1] + "_id"
+		}
+	}
+	// singletons are identified by their owner
+	for _, rc := range b.config.Singletons {
+		if rc.Resource == resource && len(resources) > 1 {
+			encryptedProperties = rc.EncryptedProperties
+			idColumn = resources[len(resources)-2] + "_id"
+		}
+	}
+	if len(encryptedProperties) == 0 {
+		return nil, "", fmt.Errorf("resource %s has no encrypted properties", resource)
+	}
+	return encryptedProperties, idColumn, nil
+}
+
+// RotateEncryptionKey re-encrypts the encrypted properties of all items of resource which are encrypted with the
+// key fromKeyID, using the key toKeyID. Both keys must be known to the backend, see Builder.EncryptionKeys. The
+// items are processed in batches, each in its own transaction, so the rotation can run while the backend serves
+// requests, and it can be resumed after a failure. Items which are locked by concurrent requests are rotated once
+// their locks are released, items which were written with another key meanwhile are left as they are. When the
+// function returns without error, no item of resource uses fromKeyID anymore. It returns the number of rotated items.
+//
+// Re-encryption does not change the revision or the timestamp of an item and sends no notifications.
+func (b *Backend) RotateEncryptionKey(ctx context.Context, resource, fromKeyID, toKeyID string) (int, error) {
+	encryptedProperties, idColumn, err := b.validateRotation(resource, fromKeyID, toKeyID)
+	if err != nil {
+		return 0, err
+	}
+
+	// items which were written before the encryption_key_id column existed have no marker yet. Batches skip
+	// items which are locked by concurrent requests. Once only locked items are left, the rotation waits for
+	// them, so that no item with the old key remains when it returns.
+	selectQuery := fmt.Sprintf("SELECT %s, properties FROM %s.\"%s\" WHERE encryption_key_id = $1 "+
+		"OR (encryption_key_id IS NULL AND %s = $1) LIMIT %d FOR UPDATE",
+		idColumn, b.db.Schema, resource, encryptionKeyIDExpression(b.db.Schema+".\""+resource+"\"", encryptedProperties),
+		encryptionRotationBatchSize)
+	skipLocked := true
+	updateQuery := fmt.Sprintf("UPDATE %s.\"%s\" SET properties = $1 WHERE %s = $2;", b.db.Schema, resource, idColumn)
+
+	rotated := 0
+	for {
+		tx, err := b.db.BeginTx(ctx, nil)
+		if err != nil {
+			return rotated, err
+		}
+		query := selectQuery + ";"
+		if skipLocked {
+			query = selectQuery + " SKIP LOCKED;"
+		}
+		rows, err := tx.QueryContext(ctx, query, fromKeyID)
+		if err != nil {
+			tx.Rollback()
+			return rotated, err
+		}
+		var ids []uuid.UUID
+		var items [][]byte
+		for rows.Next() {
+			var id uuid.UUID
+			var properties []byte
+			if err = rows.Scan(&id, &properties); err != nil {
+				break
+			}
+			ids = append(ids, id)
+			items = append(items, properties)
+		}
+		rows.Close()
+		if err == nil {
+			err = rows.Err()
+		}
+		if err != nil {
+			tx.Rollback()
+			return rotated, err
+		}
+		if len(ids) == 0 {
+			tx.Rollback()
+			if !skipLocked {
+				return rotated, nil
+			}
+			skipLocked = false
+			continue
+		}
+
+		for i, id := range ids {
+			var properties map[string]interface{}
+			if err = json.Unmarshal(items[i], &properties); err != nil {
+				break
+			}
+			for _, property := range encryptedProperties {
+				value, ok := properties[property]
+				if !ok || value == nil {
+					continue
+				}
+				additionalData := resource + "/" + property
+				var decrypted interface{}
+				if decrypted, _, err = b.encryption.decrypt(value, additionalData); err != nil {
+					err = fmt.Errorf("cannot decrypt %s of %s: %w", property, id, err)
+					break
+				}
+				if properties[property], err = b.encryption.encrypt(toKeyID, decrypted, additionalData); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+			propertiesJSON, _ := json.Marshal(properties)
+			if _, err = tx.ExecContext(ctx, updateQuery, string(propertiesJSON), id); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			return rotated, err
+		}
+		if err = tx.Commit(); err != nil {
+			return rotated, err
+		}
+		rotated += len(ids)
+		skipLocked = true
+	}
+}
+
+func (b *Backend) handleEncryption(router *mux.Router) {
+	logger.Default().Debugln("encryption")
+	logger.Default().Debugln("  handle encryption route: /kurbisio/encryption/rotate PUT")
+	// a rotation processes all items of a resource, hence it is not limited by the request timeout
+	b.withoutTimeout(router.HandleFunc("/kurbisio/encryption/rotate", func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.HasRole("admin") {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		urlQuery := r.URL.Query()
+		resource, from, to := urlQuery.Get("resource"), urlQuery.Get("from"), urlQuery.Get("to")
+		if resource == "" || from == "" || to == "" {
+			http.Error(w, "resource, from and to are required", http.StatusBadRequest)
+			return
+		}
+		if _, _, err := b.validateRotation(resource, from, to); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rotated, err := b.RotateEncryptionKey(r.Context(), resource, from, to)
+		if err != nil {
+			logger.FromContext(r.Context()).WithError(err).Errorf("Error 4822: cannot rotate encryption key of %s", resource)
+			http.Error(w, "Error 4822", databaseErrorStatus(w, err))
+			return
+		}
+		jsonData, _ := json.Marshal(map[string]int{"rotated": rotated})
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(jsonData)
+	}).Methods(http.MethodOptions, http.MethodPut))
+}
@@ -0,0 +1,220 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/lib/pq"
+
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// ErrorResponse is the structured error body which is returned when JSON errors are enabled with
+// Builder.JSONErrors, or requested by the client with "Accept: application/json"
+type ErrorResponse struct {
+	Error ErrorDetails `json:"error"`
+}
+
+// ErrorDetails describes an error. Code is the numeric error code for internal errors, e.g. "4721",
+// and otherwise derived from the HTTP status, e.g. "bad_request". Property is the external index
+// whose uniqueness a conflict violated, e.g. "email".
+type ErrorDetails struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Property  string `json:"property,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+var errorCodePattern = regexp.MustCompile(`^Error (\d+)`)
+
+var externalIndexConflictPattern = regexp.MustCompile(`^constraint violation of external index '([^']+)'`)
+
+// externalIndexConflict returns the message of a 409 (Conflict) because of a unique violation of the
+// external index property. Structured errors report the property separately.
+func externalIndexConflict(property string) string {
+	return "constraint violation of external index '" + property + "'"
+}
+
+// errorCode returns the code for an error message with the given HTTP status
+func errorCode(message string, status int) string {
+	if match := errorCodePattern.FindStringSubmatch(message); match != nil {
+		return match[1]
+	}
+	code := strings.ToLower(http.StatusText(status))
+	if code == "" {
+		return "error"
+	}
+	return strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(code)
+}
+
+// retryAfterSeconds is the Retry-After value for requests which failed because the database
+// is temporarily unavailable
+const retryAfterSeconds = 5
+
+// contentionRetryAfter returns the Retry-After value for requests which failed because of write
+// contention. It is randomized, so that contending clients do not retry at the same time again.
+func contentionRetryAfter() string {
+	return strconv.Itoa(1 + rand.Intn(3))
+}
+
+// isDatabaseUnavailable returns true if err means that the database cannot serve requests right now,
+// because all connections are in use or the connection to the database failed. Unlike other
+// database errors, these errors are transient.
+func isDatabaseUnavailable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "53300": // too_many_connections
+			return true
+		case pqErr.Code == "57P03": // cannot_connect_now
+			return true
+		case pqErr.Code.Class() == "08": // connection_exception
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.As(err, &netErr)
+}
+
+// databaseErrorStatus returns the HTTP status for a failed database operation. If the database is
+// temporarily unavailable, this is 503 (Service Unavailable) and a Retry-After header is added to the
+// response, so that clients back off instead of retrying immediately. Otherwise it is 500.
+func databaseErrorStatus(w http.ResponseWriter, err error) int {
+	if isDatabaseUnavailable(err) {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// listResponseTooLarge responds with 413 (Request Entity Too Large) to a list request whose response would
+// exceed maxBytes. fitting is the number of items which did fit, as guidance for a lower limit.
+func listResponseTooLarge(w http.ResponseWriter, maxBytes int, fitting int) {
+	limit := fitting
+	if limit < 1 {
+		limit = 1
+	}
+	http.Error(w, fmt.Sprintf("response exceeds the maximum size of %d bytes, request fewer items, e.g. with limit=%d", maxBytes, limit),
+		http.StatusRequestEntityTooLarge)
+}
+
+// importTooLarge responds with 413 (Request Entity Too Large) and returns true if err comes from
+// exceeding the maximum size of an import.
+func importTooLarge(w http.ResponseWriter, err error, maxBytes int64) bool {
+	var maxBytesError *http.MaxBytesError
+	if !errors.As(err, &maxBytesError) {
+		return false
+	}
+	http.Error(w, fmt.Sprintf("import exceeds the maximum size of %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+	return true
+}
+
+// errorResponseWriter rewrites plain text error responses, as written by http.Error, into
+// structured JSON error responses. All other responses pass through unchanged.
+type errorResponseWriter struct {
+	http.ResponseWriter
+	requestID string
+	status    int
+	buffer    bytes.Buffer
+}
+
+func (e *errorResponseWriter) WriteHeader(status int) {
+	if status >= http.StatusBadRequest && strings.HasPrefix(e.Header().Get("Content-Type"), "text/plain") {
+		// defer the header until we have the complete message
+		e.status = status
+		return
+	}
+	e.ResponseWriter.WriteHeader(status)
+}
+
+func (e *errorResponseWriter) Write(b []byte) (int, error) {
+	if e.status != 0 {
+		return e.buffer.Write(b)
+	}
+	return e.ResponseWriter.Write(b)
+}
+
+// finish writes the buffered error as JSON. It must be called after the handler returned
+func (e *errorResponseWriter) finish() {
+	if e.status == 0 {
+		return
+	}
+
+	// the message may have been compressed by a compress handler
+	var reader io.Reader = &e.buffer
+	switch e.Header().Get("Content-Encoding") {
+	case "gzip":
+		if r, err := gzip.NewReader(&e.buffer); err == nil {
+			reader = r
+		}
+	case "deflate":
+		reader = flate.NewReader(&e.buffer)
+	}
+	message, _ := io.ReadAll(reader)
+
+	details := ErrorDetails{
+		Message:   strings.TrimSpace(string(message)),
+		RequestID: e.requestID,
+	}
+	details.Code = errorCode(details.Message, e.status)
+	if match := externalIndexConflictPattern.FindStringSubmatch(details.Message); match != nil && e.status == http.StatusConflict {
+		details.Property = match[1]
+	}
+	jsonData, _ := json.MarshalWithOption(ErrorResponse{Error: details}, json.DisableHTMLEscape())
+
+	h := e.Header()
+	h.Del("Content-Encoding")
+	h.Del("Content-Length")
+	h.Del("X-Content-Type-Options")
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	e.ResponseWriter.WriteHeader(e.status)
+	e.ResponseWriter.Write(jsonData)
+}
+
+// handleErrors installs a middleware which returns structured JSON errors, if JSON errors are
+// enabled for the backend or requested by the client.
+//
+// Internal errors are only reported with their error code to the client, the details are logged
+// with the request id. The middleware therefore adds the request id as header Kurbisio-Request-Id to
+// every response, so that errors can be correlated with the log.
+func (b *Backend) handleErrors() {
+	errorMiddleware := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := logger.RequestIDFromContext(r.Context())
+			if requestID != "" {
+				w.Header().Set("Kurbisio-Request-Id", requestID)
+			}
+			if !b.jsonErrors && !strings.Contains(r.Header.Get("Accept"), "application/json") {
+				h.ServeHTTP(w, r)
+				return
+			}
+			ew := &errorResponseWriter{
+				ResponseWriter: w,
+				requestID:      requestID,
+			}
+			h.ServeHTTP(ew, r)
+			ew.finish()
+		})
+	}
+	b.router.Use(errorMiddleware)
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/relabs-tech/kurbisio/core/backend"
+)
+
+func TestJSONErrors(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "a"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	testCases := []struct {
+		name           string
+		accept         string
+		acceptEncoding string
+		path           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"unauthorized", "application/json", "", "/as", http.StatusUnauthorized, "unauthorized"},
+		{"unauthorized compressed", "application/json", "gzip", "/as", http.StatusUnauthorized, "unauthorized"},
+		{"plain text", "", "", "/as", http.StatusUnauthorized, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+			if tc.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			testService.Router.ServeHTTP(rec, r)
+
+			assert.Equal(t, tc.expectedStatus, rec.Code)
+			if tc.expectedCode == "" {
+				assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"))
+				return
+			}
+			assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+			assert.Equal(t, "", rec.Header().Get("Content-Encoding"))
+			var response backend.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err, rec.Body.String())
+			}
+			assert.Equal(t, tc.expectedCode, response.Error.Code)
+			assert.Equal(t, "not authorized", response.Error.Message)
+			assert.NotEqual(t, "", response.Error.RequestID)
+		})
+	}
+}
+
+// TestErrorsDoNotLeakDatabaseDetails verifies that database errors do not reach the client
+func TestErrorsDoNotLeakDatabaseDetails(t *testing.T) {
+	testCases := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/as/not-a-uuid"},
+		{http.MethodGet, "/blobs/not-a-uuid"},
+		{http.MethodDelete, "/named_relation/as/not-a-uuid/bs/not-a-uuid"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.method+tc.path, func(t *testing.T) {
+			var err error
+			if tc.method == http.MethodGet {
+				var header http.Header
+				_, header, err = testService.client.RawGetWithHeader(tc.path, map[string]string{}, nil)
+				assert.NotEqual(t, "", header.Get("Kurbisio-Request-Id"))
+			} else {
+				_, err = testService.client.RawDelete(tc.path)
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, leak := range []string{"pq:", "invalid input syntax", "SELECT", "DELETE FROM"} {
+				if strings.Contains(err.Error(), leak) {
+					t.Fatalf("response leaks database details: %s", err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+
+	testService := CreateTestServiceWithBuilder(configurationJSON, t.Name(), func(b *backend.Builder) {
+		b.RequestTimeout = time.Nanosecond
+	})
+	defer testService.Db.Close()
+
+	status, h, err := testService.client.RawGetWithHeader("/as", map[string]string{}, nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, status)
+	}
+	if h.Get("Retry-After") == "" {
+		t.Fatal("Retry-After is empty")
+	}
+
+	// streamed archives are not limited
+	var data []byte
+	if _, _, err = testService.client.RawGetBlobWithHeader("/as/export.zip", map[string]string{}, &data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConflictErrorProperty(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user",
+			"external_indices": ["email", "phone"]
+		  }
+		]
+	  }
+	`
+	testService := CreateTestServiceWithBuilder(jsonConfig, t.Name(), func(b *backend.Builder) {
+		b.JSONErrors = true
+	})
+	defer testService.Db.Close()
+
+	var user map[string]interface{}
+	if _, err := testService.client.RawPost("/users", map[string]string{"email": "jane@test.com", "phone": "123"}, &user); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, property := range []string{"email", "phone"} {
+		t.Run(property, func(t *testing.T) {
+			body := map[string]string{"email": "john@test.com", "phone": "456"}
+			body[property] = user[property].(string)
+			status, err := testService.client.RawPost("/users", body, nil)
+			assert.Equal(t, http.StatusConflict, status)
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), `"property":"`+property+`"`)
+				assert.Contains(t, err.Error(), "constraint violation of external index '"+property+"'")
+			}
+		})
+	}
+
+	// an update which takes the value of another resource conflicts as well
+	var other map[string]interface{}
+	if _, err := testService.client.RawPost("/users", map[string]string{"email": "john@test.com", "phone": "456"}, &other); err != nil {
+		t.Fatal(err)
+	}
+	status, err := testService.client.RawPatch("/users/"+other["user_id"].(string), map[string]string{"phone": "123"}, nil)
+	assert.Equal(t, http.StatusConflict, status)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), `"property":"phone"`)
+	}
+}
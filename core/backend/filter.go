@@ -0,0 +1,47 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"fmt"
+	"strings"
+)
+
+// zeroUUID is the identifier which creating a resource treats as "no identifier", hence no resource has it
+const zeroUUID = "00000000-0000-0000-0000-000000000000"
+
+// likeEscaper escapes the wildcards of SQL LIKE patterns with the default escape character
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// parseFilter parses the value of a filter or search query parameter into the property, the SQL operator
+// and the value to compare with. Supported are property=value for equality, property~pattern for SQL LIKE
+// patterns and property~=text for properties which contain text literally, i.e. % and _ in text are no
+// wildcards.
+func parseFilter(expression string) (property, operator, value string, err error) {
+	i := strings.IndexRune(expression, '=')
+	if i > 0 && expression[i-1] == '~' {
+		return expression[:i-1], " LIKE ", "%" + likeEscaper.Replace(expression[i+1:]) + "%", nil
+	}
+	if i >= 0 {
+		return expression[:i], "=", expression[i+1:], nil
+	}
+	i = strings.IndexRune(expression, '~')
+	if i < 0 {
+		return "", "", "", fmt.Errorf("cannot parse filter, must be of type property=value, property~pattern or property~=text")
+	}
+	return expression[:i], " LIKE ", expression[i+1:], nil
+}
+
+// checkIDFilter rejects a filter which compares one of the idColumns with the zero UUID. No resource has
+// this identifier, so such a filter is most likely a null identifier which leaked into the request, and
+// silently returning nothing would hide the bug.
+func checkIDFilter(property, value string, idColumns []string) error {
+	if value == zeroUUID && stringlist(idColumns).contains(property) {
+		return fmt.Errorf("'%s' cannot be the zero UUID, it is not a valid identifier", property)
+	}
+	return nil
+}
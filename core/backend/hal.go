@@ -0,0 +1,248 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/mux"
+
+	"github.com/relabs-tech/kurbisio/core"
+)
+
+// halMediaType is the media type with which clients request the HAL representation, see handleHAL
+const halMediaType = "application/hal+json"
+
+// halChild is a link from an item to a child resource or to a relation. Its URL is the path of the item
+// between prefix and suffix.
+type halChild struct {
+	name   string
+	prefix string
+	suffix string
+}
+
+// halLink is a link of the HAL representation
+type halLink struct {
+	Href string `json:"href"`
+}
+
+// registerHALRoute declares that route returns items of resource, either a single item or a list of items
+func (b *Backend) registerHALRoute(route, resource string) {
+	b.halRoutes[route] = resource
+}
+
+// halChildren returns the links from the items of resource to its children and relations
+func (b *Backend) halChildren(resource string) []halChild {
+	var children []halChild
+	isChild := func(child string) (string, bool) {
+		if !strings.HasPrefix(child, resource+"/") || strings.Contains(strings.TrimPrefix(child, resource+"/"), "/") {
+			return "", false
+		}
+		return strings.TrimPrefix(child, resource+"/"), true
+	}
+	for _, rc := range b.config.Collections {
+		if name, ok := isChild(rc.Resource); ok {
+			children = append(children, halChild{name: core.Plural(name), suffix: "/" + core.Plural(name)})
+		}
+	}
+	for _, rc := range b.config.Singletons {
+		if name, ok := isChild(rc.Resource); ok {
+			children = append(children, halChild{name: name, suffix: "/" + name})
+		}
+	}
+	for _, rc := range b.config.Blobs {
+		if name, ok := isChild(rc.Resource); ok {
+			children = append(children, halChild{name: core.Plural(name), suffix: "/" + core.Plural(name)})
+		}
+	}
+	for _, rc := range b.config.Relations {
+		var other string
+		switch resource {
+		case rc.Left:
+			other = rc.Right
+		case rc.Right:
+			other = rc.Left
+		default:
+			continue
+		}
+		resources := strings.Split(other, "/")
+		name := core.Plural(resources[len(resources)-1])
+		child := halChild{name: name, suffix: "/" + name}
+		if rc.Resource != "" {
+			child.name = rc.Resource + "/" + name
+			child.prefix = "/" + rc.Resource
+		}
+		children = append(children, child)
+	}
+	return children
+}
+
+// halPath returns the path of an item of resource, or false if the item lacks an identifier
+func (b *Backend) halPath(resource string, item map[string]interface{}, singleton bool) (string, bool) {
+	resources := strings.Split(resource, "/")
+	path := ""
+	for i, r := range resources {
+		if singleton && i == len(resources)-1 {
+			path += "/" + r
+			break
+		}
+		id, ok := item[r+"_id"].(string)
+		if !ok {
+			return "", false
+		}
+		path += "/" + core.Plural(r) + "/" + id
+	}
+	return path, true
+}
+
+// halLinks returns the _links object of an item of resource
+func (b *Backend) halLinks(resource string, item map[string]interface{}, singletons map[string]bool,
+	children map[string][]halChild) map[string]interface{} {
+	path, ok := b.halPath(resource, item, singletons[resource])
+	if !ok {
+		return nil
+	}
+	links := map[string]interface{}{"self": halLink{Href: b.basePath + path}}
+	if i := strings.LastIndex(resource, "/"); i > 0 {
+		if parentPath, ok := b.halPath(resource[:i], item, singletons[resource[:i]]); ok {
+			links["parent"] = halLink{Href: b.basePath + parentPath}
+		}
+	}
+	for _, child := range children[resource] {
+		links[child.name] = halLink{Href: b.basePath + child.prefix + path + child.suffix}
+	}
+	return links
+}
+
+// halDecode decodes a JSON response, keeping numbers as they are
+func halDecode(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// handleHAL installs a middleware which returns the HAL representation of resources to clients which accept
+// application/hal+json. Single items get a _links object with links to themselves, their parent, their
+// children and their relations. Lists become an object with the items in _embedded and pagination links in
+// _links. All other requests and responses, including errors, pass through unchanged.
+//
+// Like handlePropertyCasing, the middleware transforms the response after the handler, hence it applies the
+// standard compression itself.
+func (b *Backend) handleHAL() {
+	singletons := map[string]bool{}
+	for _, rc := range b.config.Singletons {
+		singletons[rc.Resource] = true
+	}
+	children := map[string][]halChild{}
+	for _, rc := range b.config.Collections {
+		children[rc.Resource] = b.halChildren(rc.Resource)
+	}
+	for _, rc := range b.config.Singletons {
+		children[rc.Resource] = b.halChildren(rc.Resource)
+	}
+	for _, rc := range b.config.Blobs {
+		children[rc.Resource] = b.halChildren(rc.Resource)
+	}
+
+	halMiddleware := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.Contains(r.Header.Get("Accept"), halMediaType) {
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Accept")
+			var resource string
+			var ok bool
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					resource, ok = b.halRoutes[strings.TrimPrefix(template, b.basePath)]
+				}
+			}
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			gzipAccepted := strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+			r.Header.Del("Accept-Encoding")
+
+			self := r.URL.RequestURI()
+			hw := &jsonResponseWriter{ResponseWriter: w, gzipAccepted: gzipAccepted}
+			hw.transform = func(data []byte) []byte {
+				if hw.status != http.StatusOK && hw.status != http.StatusCreated {
+					return data
+				}
+				var result interface{}
+				if data = bytes.TrimSpace(data); bytes.HasPrefix(data, []byte("[")) {
+					var items []map[string]interface{}
+					if err := halDecode(data, &items); err != nil {
+						return data
+					}
+					for _, item := range items {
+						if links := b.halLinks(resource, item, singletons, children); links != nil {
+							item["_links"] = links
+						}
+					}
+					resources := strings.Split(resource, "/")
+					result = map[string]interface{}{
+						"_links":    b.halPaginationLinks(r, self, hw.Header()),
+						"_embedded": map[string]interface{}{core.Plural(resources[len(resources)-1]): items},
+					}
+				} else {
+					var item map[string]interface{}
+					if err := halDecode(data, &item); err != nil || item == nil {
+						return data
+					}
+					if links := b.halLinks(resource, item, singletons, children); links != nil {
+						item["_links"] = links
+					}
+					result = item
+				}
+				transformed, err := json.MarshalWithOption(result, json.DisableHTMLEscape())
+				if err != nil {
+					return data
+				}
+				hw.Header().Set("Content-Type", halMediaType+"; charset=utf-8")
+				return transformed
+			}
+			h.ServeHTTP(hw, r)
+			hw.finish()
+		})
+	}
+	b.router.Use(halMiddleware)
+}
+
+// halPaginationLinks returns the links of a list response: self, and next and prev if the pagination headers
+// of the response indicate further pages. Next and prev keep the "until" of the first page, so that all pages
+// see the same items.
+func (b *Backend) halPaginationLinks(r *http.Request, self string, header http.Header) map[string]interface{} {
+	links := map[string]interface{}{"self": halLink{Href: self}}
+	page, err := strconv.Atoi(header.Get("Pagination-Current-Page"))
+	if err != nil {
+		return links
+	}
+	pageCount, _ := strconv.Atoi(header.Get("Pagination-Page-Count"))
+	pageLink := func(page int) halLink {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		if until := header.Get("Pagination-Until"); until != "" {
+			query.Set("until", until)
+		}
+		return halLink{Href: r.URL.Path + "?" + query.Encode()}
+	}
+	if page < pageCount {
+		links["next"] = pageLink(page + 1)
+	}
+	if page > 1 {
+		links["prev"] = pageLink(page - 1)
+	}
+	return links
+}
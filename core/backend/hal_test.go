@@ -0,0 +1,130 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/relabs-tech/kurbisio/core/access"
+)
+
+func TestHALLinks(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user"
+		  },
+		  {
+			"resource": "user/device"
+		  },
+		  {
+			"resource": "group"
+		  }
+		],
+		"singletons": [
+		  {
+			"resource": "user/profile"
+		  }
+		],
+		"relations": [
+		  {
+			"left": "user",
+			"right": "group"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	halRequest := func(path string, result interface{}) (int, http.Header) {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Accept", "application/hal+json")
+		r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+		rec := httptest.NewRecorder()
+		testService.Router.ServeHTTP(rec, r)
+		if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+			t.Fatalf("%s: %s", err, rec.Body.String())
+		}
+		return rec.Code, rec.Header()
+	}
+	href := func(links interface{}, name string) string {
+		link, _ := links.(map[string]interface{})[name].(map[string]interface{})
+		value, _ := link["href"].(string)
+		return value
+	}
+
+	var userIDs []string
+	for i := 0; i < 3; i++ {
+		var user map[string]interface{}
+		if _, err := testService.client.RawPost("/users", map[string]interface{}{}, &user); err != nil {
+			t.Fatal(err)
+		}
+		userIDs = append(userIDs, user["user_id"].(string))
+	}
+	userID := userIDs[0]
+	var device map[string]interface{}
+	if _, err := testService.client.RawPost("/users/"+userID+"/devices", map[string]interface{}{}, &device); err != nil {
+		t.Fatal(err)
+	}
+	deviceID := device["device_id"].(string)
+
+	// plain JSON stays the default
+	var plain map[string]interface{}
+	if _, err := testService.client.RawGet("/users/"+userID, &plain); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, plain, "_links")
+
+	var user map[string]interface{}
+	status, header := halRequest("/users/"+userID, &user)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, header.Get("Content-Type"), "application/hal+json")
+	assert.Equal(t, userID, user["user_id"])
+	links := user["_links"]
+	assert.Equal(t, "/users/"+userID, href(links, "self"))
+	assert.Equal(t, "/users/"+userID+"/devices", href(links, "devices"))
+	assert.Equal(t, "/users/"+userID+"/profile", href(links, "profile"))
+	assert.Equal(t, "/users/"+userID+"/groups", href(links, "groups"))
+	assert.Equal(t, "", href(links, "parent"))
+
+	var deviceHAL map[string]interface{}
+	halRequest("/users/"+userID+"/devices/"+deviceID, &deviceHAL)
+	assert.Equal(t, "/users/"+userID+"/devices/"+deviceID, href(deviceHAL["_links"], "self"))
+	assert.Equal(t, "/users/"+userID, href(deviceHAL["_links"], "parent"))
+
+	// lists embed the items and link to the next page
+	var list map[string]interface{}
+	status, _ = halRequest("/users?limit=2", &list)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "/users?limit=2", href(list["_links"], "self"))
+	assert.Contains(t, href(list["_links"], "next"), "page=2")
+	assert.Equal(t, "", href(list["_links"], "prev"))
+	users := list["_embedded"].(map[string]interface{})["users"].([]interface{})
+	if assert.Len(t, users, 2) {
+		item := users[0].(map[string]interface{})
+		assert.Equal(t, "/users/"+item["user_id"].(string), href(item["_links"], "self"))
+	}
+
+	halRequest("/users?limit=2&page=2", &list)
+	assert.Equal(t, "", href(list["_links"], "next"))
+	assert.Contains(t, href(list["_links"], "prev"), "page=1")
+
+	// errors are not transformed
+	r := httptest.NewRequest(http.MethodGet, "/users/"+deviceID, nil)
+	r.Header.Set("Accept", "application/hal+json")
+	r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+	rec := httptest.NewRecorder()
+	testService.Router.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NotContains(t, rec.Header().Get("Content-Type"), "application/hal+json")
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/mux"
+
+	"github.com/relabs-tech/kurbisio/core/access"
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// IndexAdvice suggests to promote a property of the JSON document of a resource to a searchable
+// property, because lists of the resource are frequently filtered by it
+type IndexAdvice struct {
+	Resource   string    `json:"resource"`
+	Property   string    `json:"property"`
+	Count      int64     `json:"count"`
+	LastUsed   time.Time `json:"last_used"`
+	Suggestion string    `json:"suggestion"`
+}
+
+// IndexAdviceResponse is the response of the index advice endpoint
+type IndexAdviceResponse struct {
+	Since  time.Time     `json:"since"`
+	Advice []IndexAdvice `json:"advice"`
+}
+
+// maxFilterUsageProperties is the maximum number of properties per resource which filterUsage counts. The
+// property names come from the clients, so without a limit any client could grow the counters without bound.
+const maxFilterUsageProperties = 100
+
+// filterUsage counts the list requests which filter by properties of the JSON document. These filters
+// cannot use an index, hence frequently used ones are candidates for searchable properties.
+type filterUsage struct {
+	mutex    sync.Mutex
+	since    time.Time
+	counters map[string]map[string]*IndexAdvice // resource -> property -> usage
+}
+
+func newFilterUsage() *filterUsage {
+	return &filterUsage{since: time.Now().UTC(), counters: map[string]map[string]*IndexAdvice{}}
+}
+
+// count records a filter on property of the JSON document of resource. Once maxFilterUsageProperties
+// properties of resource are counted, further properties are ignored.
+func (f *filterUsage) count(resource, property string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	properties, ok := f.counters[resource]
+	if !ok {
+		properties = map[string]*IndexAdvice{}
+		f.counters[resource] = properties
+	}
+	usage, ok := properties[property]
+	if !ok {
+		if len(properties) >= maxFilterUsageProperties {
+			return
+		}
+		usage = &IndexAdvice{Resource: resource, Property: property}
+		properties[property] = usage
+	}
+	usage.Count++
+	usage.LastUsed = time.Now().UTC()
+}
+
+// advice returns the usage of all resources, or of the given resources only, the most used first
+func (f *filterUsage) advice(resources map[string]bool) IndexAdviceResponse {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	response := IndexAdviceResponse{Since: f.since, Advice: []IndexAdvice{}}
+	for resource, properties := range f.counters {
+		if len(resources) > 0 && !resources[resource] {
+			continue
+		}
+		for _, usage := range properties {
+			advice := *usage
+			advice.Suggestion = fmt.Sprintf("add %s to the searchable_properties or generated_properties of %s", advice.Property, resource)
+			response.Advice = append(response.Advice, advice)
+		}
+	}
+	sort.Slice(response.Advice, func(i, j int) bool {
+		a, b := response.Advice[i], response.Advice[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		return a.Property < b.Property
+	})
+	return response
+}
+
+func (b *Backend) handleIndexAdvice(router *mux.Router) {
+	logger.Default().Debugln("index advice")
+	logger.Default().Debugln("  handle index advice route: /kurbisio/debug/index-advice GET")
+	router.HandleFunc("/kurbisio/debug/index-advice", func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.HasRole("admin") && !auth.HasRole("admin viewer") {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		resources := map[string]bool{}
+		for key, array := range r.URL.Query() {
+			if key != "resource" {
+				http.Error(w, "parameter '"+key+"': unknown", http.StatusBadRequest)
+				return
+			}
+			for _, values := range array {
+				for _, value := range strings.Split(values, ",") {
+					if !b.hasCollectionOrSingleton(value) {
+						http.Error(w, "parameter 'resource': unknown resource "+value, http.StatusBadRequest)
+						return
+					}
+					resources[value] = true
+				}
+			}
+		}
+		jsonData, _ := json.Marshal(b.filterUsage.advice(resources))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(jsonData)
+	}).Methods(http.MethodOptions, http.MethodGet)
+}
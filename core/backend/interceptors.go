@@ -65,6 +65,12 @@ func (b *Backend) HandleResourceRequest(resource string,
 	}
 }
 
+// hasInterceptor returns true if a request interceptor is installed for resource and operation
+func (b *Backend) hasInterceptor(resource string, operation core.Operation) bool {
+	_, ok := b.interceptors[requestKey(resource, operation)]
+	return ok
+}
+
 func requestKey(resource string, operation core.Operation) string {
 	key := resource + "(" + string(operation) + ")"
 	return key
@@ -86,3 +92,54 @@ func (b *Backend) intercept(ctx context.Context, resource string, operation core
 	}
 	return nil, nil
 }
+
+type afterCommitHook func(ctx context.Context, notification Notification)
+
+// HandleAfterCommit installs a synchronous hook for a given resource and a set of operations, which is called
+// right after the transaction of a write operation was committed successfully, e.g. to invalidate an external
+// cache. If no operations are specified, the hook will be installed for Create, Update, Delete and Clear.
+//
+// Unlike a request handler, the hook runs after the fact and cannot modify data or alter the response.
+// Unlike a notification handler, it runs in-band before the response is sent, but is not retried. The
+// notification passed to the hook has the same payload as a resource notification, see
+// HandleResourceNotification(). Silent requests do not suppress the hook.
+func (b *Backend) HandleAfterCommit(resource string, hook func(ctx context.Context, notification Notification), operations ...core.Operation) {
+	if !b.hasCollectionOrSingleton(resource) {
+		logger.FromContext(nil).Fatalf("handle after commit for %s: no such collection or singleton", resource)
+	}
+
+	if len(operations) == 0 {
+		operations = []core.Operation{core.OperationCreate, core.OperationUpdate, core.OperationDelete, core.OperationClear}
+	}
+	for _, operation := range operations {
+		if operation == core.OperationRead || operation == core.OperationList {
+			logger.FromContext(nil).Fatalf("after commit hooks only work for mutable operations")
+		}
+		key := requestKey(resource, operation)
+		if _, ok := b.afterCommitHooks[key]; ok {
+			logger.FromContext(nil).Fatalf("after commit hook for %s already installed", key)
+		}
+		logger.FromContext(nil).Debugf("install after commit hook for %s", key)
+		b.afterCommitHooks[key] = hook
+	}
+}
+
+// afterCommit calls the after commit hook for resource and operation, if there is one. A panicking hook
+// is logged, it must not fail the already committed request.
+func (b *Backend) afterCommit(ctx context.Context, resource string, operation core.Operation, resourceID uuid.UUID, payload []byte) {
+	hook, ok := b.afterCommitHooks[requestKey(resource, operation)]
+	if !ok {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			logger.FromContext(ctx).Errorf("after commit hook for %s panicked: %v", requestKey(resource, operation), r)
+		}
+	}()
+	hook(ctx, Notification{
+		Resource:   resource,
+		ResourceID: resourceID,
+		Operation:  operation,
+		Payload:    payload,
+	})
+}
@@ -0,0 +1,39 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"net/http"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/mux"
+
+	"github.com/relabs-tech/kurbisio/core/access"
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// handleConfig installs the /config route, which returns the configuration the backend runs with, as parsed
+// from the JSON configuration. The configuration only describes resources, the database credentials and other
+// builder options are not part of it.
+func (b *Backend) handleConfig(router *mux.Router) {
+	logger.Default().Debugln("config")
+	logger.Default().Debugln("  handle config route: /config GET")
+	router.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.HasRole("admin") && !auth.HasRole("admin viewer") {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		jsonData, _ := json.MarshalWithOption(b.config, json.DisableHTMLEscape())
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(jsonData)
+	}).Methods(http.MethodOptions, http.MethodGet)
+}
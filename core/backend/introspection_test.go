@@ -0,0 +1,46 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig(t *testing.T) {
+	var config struct {
+		Collections []struct {
+			Resource             string   `json:"resource"`
+			ExternalIndex        string   `json:"external_index"`
+			StaticProperties     []string `json:"static_properties"`
+			SearchableProperties []string `json:"searchable_properties"`
+		} `json:"collections"`
+		Shortcuts []struct {
+			Shortcut string `json:"shortcut"`
+		} `json:"shortcuts"`
+	}
+	if _, err := testService.client.RawGet("/config", &config); err != nil {
+		t.Fatal(err)
+	}
+	if assert.NotEmpty(t, config.Collections) {
+		a := config.Collections[0]
+		assert.Equal(t, "a", a.Resource)
+		assert.Equal(t, "external_id", a.ExternalIndex)
+		assert.Equal(t, []string{"static_prop"}, a.StaticProperties)
+		assert.Equal(t, []string{"searchable_prop", "other_searchable_prop"}, a.SearchableProperties)
+	}
+	if assert.Len(t, config.Shortcuts, 1) {
+		assert.Equal(t, "b", config.Shortcuts[0].Shortcut)
+	}
+
+	// the configuration is for admins only
+	status, err := testService.clientNoAuth.WithRole("beerole").RawGet("/config", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
@@ -150,6 +150,8 @@ CREATE UNIQUE INDEX IF NOT EXISTS schedules_identity ON ` + b.db.Schema + `._sch
 		if err != nil {
 			panic(err)
 		}
+
+		b.createOutbox()
 	}
 
 	b.jobsInsertQuery = b.prioritizedJobQueries(`INSERT INTO $TABLENAME
@@ -205,6 +207,13 @@ RETURNING scheduled_at;
 	b.jobsUpdateScheduleQuery = b.prioritizedJobQueries(`UPDATE $TABLENAME
 SET scheduled_at = $2,
 implicit_schedule = FALSE
+WHERE serial = $1 RETURNING serial;`)
+
+	// a deferred job was not attempted, so it gets its attempt back
+	b.jobsDeferQuery = b.prioritizedJobQueries(`UPDATE $TABLENAME
+SET scheduled_at = $2,
+implicit_schedule = FALSE,
+attempts_left = attempts_left + 1
 WHERE serial = $1 RETURNING serial;`)
 
 	logger.Default().Debugln("job processing pipelines")
@@ -454,6 +463,11 @@ func (b *Backend) eventsWithAuth(w http.ResponseWriter, r *http.Request) {
 	status, err := b.raiseEventWithResourceInternal(r.Context(), "event", event, nil, false)
 
 	if err != nil {
+		if status >= http.StatusInternalServerError {
+			logger.FromContext(r.Context()).WithError(err).Errorf("Error 4224: raise event")
+			http.Error(w, "Error 4224", status)
+			return
+		}
 		http.Error(w, err.Error(), status)
 		return
 	}
@@ -464,6 +478,7 @@ func (b *Backend) eventsWithAuth(w http.ResponseWriter, r *http.Request) {
 func (b *Backend) pipelineWorker(n int, jobs <-chan job, ready chan<- bool, timeouts [3]time.Duration) {
 
 	rescheduledError := fmt.Errorf("rescheduled rate limited event")
+	deferredError := fmt.Errorf("deferred event to maintenance window")
 	for jb := range jobs {
 		if jb.AttemptsLeft == 0 {
 			ready <- true
@@ -522,6 +537,9 @@ func (b *Backend) pipelineWorker(n int, jobs <-chan job, ready chan<- bool, time
 				notification := jb.notification()
 				key = notificationJobKey(notification.Resource, notification.Operation)
 				if handler, ok := b.callbacks[key]; ok {
+					if notification.Payload, err = b.openPayload(notification.Resource, notification.Payload); err != nil {
+						rlog.WithError(err).Errorf("Error 4827: cannot decrypt notification payload of %s", notification.Resource)
+					}
 					err = handler.notification(ctx, notification)
 				} else {
 					err = fmt.Errorf("no handler for key %s", key)
@@ -558,6 +576,18 @@ func (b *Backend) pipelineWorker(n int, jobs <-chan job, ready chan<- bool, time
 					}
 				}
 
+				// deferrable events, also their retries, must wait for the maintenance window
+				if schedule, deferred := b.deferredSchedule(event.Type, time.Now().UTC()); deferred {
+					var serial int
+					err = b.db.QueryRow(b.jobsDeferQuery[jb.Priority], &jb.Serial, &schedule).Scan(&serial)
+					if err != nil {
+						err = fmt.Errorf("could not defer event: %s #%d - %w", event.Type, jb.Serial, err)
+					} else {
+						err = deferredError
+					}
+					return
+				}
+
 				if handler, ok := b.callbacks[key]; ok {
 					err = handler.event(ctx, event)
 				} else {
@@ -574,6 +604,9 @@ func (b *Backend) pipelineWorker(n int, jobs <-chan job, ready chan<- bool, time
 		if err == rescheduledError {
 			rlog.Debug("successfully rescheduled rate limited event " + key + "[" + jb.Key + "] #" + strconv.Itoa(jb.Serial))
 
+		} else if err == deferredError {
+			rlog.Debug("deferred event to maintenance window " + key + "[" + jb.Key + "] #" + strconv.Itoa(jb.Serial))
+
 		} else if err != nil {
 			rlog.WithError(err).Error("error processing " + key + "[" + jb.Key + "] #" + strconv.Itoa(jb.Serial))
 		} else {
@@ -744,6 +777,10 @@ func (b *Backend) ProcessJobsSyncWithTimeouts(max time.Duration, timeouts [3]tim
 		maxedOutString = " (maxed out)"
 	}
 	rlog.Debugf("process jobs: %d foreground and %d background done%s", jobCountForeground, jobCountBackground, maxedOutString)
+
+	if _, err := b.RelayOutbox(); err != nil {
+		rlog.Errorln("failed to relay outbox:", err.Error())
+	}
 	return maxedOut
 }
 
@@ -934,6 +971,15 @@ func (b *Backend) raiseEventWithResourceInternal(ctx context.Context, job string
 			scheduleAtUTC = &rateLimitedSchedule
 		}
 	}
+	if job == "event" || job == "queued-event" {
+		due := time.Now().UTC()
+		if scheduleAtUTC != nil {
+			due = *scheduleAtUTC
+		}
+		if schedule, deferred := b.deferredSchedule(event.Type, due); deferred {
+			scheduleAtUTC = &schedule
+		}
+	}
 
 	var serial int
 	query := b.jobsInsertQuery
@@ -1035,26 +1081,49 @@ func (b *Backend) commitWithNotification(ctx context.Context, tx *sql.Tx, resour
 	rlog.Debugf("commitWithNotification START")
 	request := notificationJobKey(resource, operation)
 
-	// only create a notification if somebody requested it
-	if _, ok := b.callbacks[request]; !ok {
-		return tx.Commit()
+	// the stored payload must not reveal encrypted properties, they are decrypted again for delivery
+	sealed, err := b.sealPayload(resource, payload)
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	if len(payload) == 0 {
-		payload = []byte("{}")
+	// the notification for the Notifier goes to the outbox, in the same transaction as the write
+	outbox := b.notifier != nil && !core.SilentFromContext(ctx)
+	if outbox {
+		if err := b.writeOutbox(ctx, tx, resource, operation, resourceID, sealed); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// only create a notification if somebody requested it and it was not suppressed with core.ContextWithSilent
+	if _, ok := b.callbacks[request]; !ok || core.SilentFromContext(ctx) {
+		err := tx.Commit()
+		if err == nil {
+			if outbox {
+				b.TriggerJobs()
+			}
+			b.afterCommit(ctx, resource, operation, resourceID, payload)
+		}
+		return err
+	}
+
+	if len(sealed) == 0 {
+		sealed = []byte("{}")
 	}
 
 	contextData := logger.SerializeLoggerContext(ctx)
 
 	rlog.Debugf("commitWithNotification before: tx.QueryRow")
 	var serial int
-	err := tx.QueryRow("INSERT INTO "+b.db.Schema+".\"_job_\""+
+	err = tx.QueryRow("INSERT INTO "+b.db.Schema+".\"_job_\""+
 		"(job,type,resource,resource_id,payload,timestamp,attempts_left,context)"+
 		"VALUES('notification',$1,$2,$3,$4,$5,4,$6) RETURNING serial;",
 		operation,
 		resource,
 		resourceID,
-		payload,
+		sealed,
 		time.Now().UTC(),
 		contextData,
 	).Scan(&serial)
@@ -1070,6 +1139,7 @@ func (b *Backend) commitWithNotification(ctx context.Context, tx *sql.Tx, resour
 	if err == nil {
 		b.TriggerJobs()
 		rlog.Debugf("commitWithNotification after: b.TriggerJobs()")
+		b.afterCommit(ctx, resource, operation, resourceID, payload)
 	}
 	rlog.Debugf("commitWithNotification END")
 	return err
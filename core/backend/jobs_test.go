@@ -8,11 +8,15 @@ package backend_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/relabs-tech/kurbisio/core"
 	"github.com/relabs-tech/kurbisio/core/access"
 	"github.com/relabs-tech/kurbisio/core/backend"
 )
@@ -392,3 +396,170 @@ func TestRaiseEventRecursive(t *testing.T) {
 		t.Fatalf("received %d events, but expected %d", len(events), numExpectedEvents)
 	}
 }
+
+// outboxNotifier records the notifications it receives
+type outboxNotifier struct {
+	notifications []string
+}
+
+func (n *outboxNotifier) Notify(resource string, operation core.Operation, payload []byte) {
+	n.notifications = append(n.notifications, resource+":"+string(operation))
+}
+
+func TestOutbox(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "item"
+		  }
+		]
+	  }
+	`
+	notifier := &outboxNotifier{}
+	testService := CreateTestServiceWithBuilder(configurationJSON, t.Name(), func(b *backend.Builder) {
+		b.Notifier = notifier
+	})
+	defer testService.Db.Close()
+
+	var item map[string]interface{}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{"name": "a"}, &item); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawDelete("/items/" + item["item_id"].(string)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawPost("/items?silent=true", map[string]interface{}{"name": "b"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is published before the relay ran
+	assert.Empty(t, notifier.notifications)
+	testService.backend.ProcessJobsSync(0)
+	assert.Equal(t, []string{"item:create", "item:delete"}, notifier.notifications)
+
+	// published notifications are not published again
+	published, err := testService.backend.RelayOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, published)
+	assert.Len(t, notifier.notifications, 2)
+}
+
+// failingNotifier records the notifications it receives, but fails while failing is set
+type failingNotifier struct {
+	outboxNotifier
+	failing bool
+}
+
+func (n *failingNotifier) NotifyWithError(resource string, operation core.Operation, payload []byte) error {
+	if n.failing {
+		return errors.New("broker unavailable")
+	}
+	n.Notify(resource, operation, payload)
+	return nil
+}
+
+func TestOutboxNotifierWithError(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "item"
+		  }
+		]
+	  }
+	`
+	notifier := &failingNotifier{}
+	testService := CreateTestServiceWithBuilder(configurationJSON, t.Name(), func(b *backend.Builder) {
+		b.Notifier = notifier
+	})
+	defer testService.Db.Close()
+
+	var item map[string]interface{}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{"name": "a"}, &item); err != nil {
+		t.Fatal(err)
+	}
+
+	// failed notifications stay in the outbox
+	notifier.failing = true
+	published, err := testService.backend.RelayOutbox()
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, published)
+	assert.Empty(t, notifier.notifications)
+
+	if _, err := testService.client.RawDelete("/items/" + item["item_id"].(string)); err != nil {
+		t.Fatal(err)
+	}
+
+	// and are published in order once the notifier works again
+	notifier.failing = false
+	published, err = testService.backend.RelayOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, published)
+	assert.Equal(t, []string{"item:create", "item:delete"}, notifier.notifications)
+}
+
+func TestDeferrableEvent(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "item"
+		  }
+		]
+	  }
+	`
+	// a one hour window which starts in six hours, so that now is outside of it
+	windowStart := time.Now().UTC().Add(6 * time.Hour).Truncate(time.Minute)
+	midnight := time.Date(windowStart.Year(), windowStart.Month(), windowStart.Day(), 0, 0, 0, 0, time.UTC)
+	window := &backend.MaintenanceWindow{
+		Start: windowStart.Sub(midnight),
+		End:   (windowStart.Sub(midnight) + time.Hour) % (24 * time.Hour),
+	}
+	testService := CreateTestServiceWithBuilder(configurationJSON, t.Name(), func(b *backend.Builder) {
+		b.MaintenanceWindow = window
+	})
+	defer testService.Db.Close()
+
+	received := map[string]int{}
+	handler := func(ctx context.Context, event backend.Event) error {
+		received[event.Type]++
+		return nil
+	}
+	testService.backend.HandleEvent("urgent", handler)
+	testService.backend.HandleEvent("heavy", handler)
+	testService.backend.DefineDeferrableEvent("heavy")
+
+	ctx := context.Background()
+	if err := testService.backend.RaiseEvent(ctx, backend.Event{Type: "urgent"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := testService.backend.RaiseEvent(ctx, backend.Event{Type: "heavy"}); err != nil {
+		t.Fatal(err)
+	}
+	testService.backend.ProcessJobsSync(-1)
+
+	// only the event which is not deferrable ran, the other one waits for the window
+	assert.Equal(t, map[string]int{"urgent": 1}, received)
+	schedule, err := testService.backend.RetrieveEventSchedule(ctx, backend.Event{Type: "heavy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.NotNil(t, schedule) {
+		assert.WithinDuration(t, windowStart, *schedule, time.Second)
+	}
+
+	// an event which is scheduled within the window keeps its schedule
+	scheduleAt := windowStart.Add(10 * time.Minute)
+	if err = testService.backend.ScheduleEvent(ctx, backend.Event{Type: "heavy", Key: "within"}, scheduleAt); err != nil {
+		t.Fatal(err)
+	}
+	schedule, err = testService.backend.RetrieveEventSchedule(ctx, backend.Event{Type: "heavy", Key: "within"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.NotNil(t, schedule) {
+		assert.WithinDuration(t, scheduleAt, *schedule, time.Second)
+	}
+}
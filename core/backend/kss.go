@@ -53,6 +53,10 @@ func (b *Backend) configureKSS(config kss.Configuration) error {
 				logger.Default().Warnf("KSS has no PublicURL defined, this can only work in test. KSS Public URL shall be set to the name address that is served by Kurbisio")
 			}
 		}
+		if b.basePath != "" {
+			// the file system route is mounted under the base path like all other routes
+			config.LocalConfiguration.PublicURL = strings.TrimSuffix(config.LocalConfiguration.PublicURL, "/") + b.basePath
+		}
 		drv, err := kss.NewLocalFilesystem(b.router, *config.LocalConfiguration)
 		drv.WithCallBack(b.fileUploadedCallBack)
 		if err != nil {
@@ -2,9 +2,12 @@ package kss
 
 import (
 	"crypto"
+	"crypto/md5"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -101,6 +104,10 @@ func (f *LocalFilesystem) handler(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, filePath)
 		return
 	}
+	if r.Method == http.MethodPut && v.Get("upload_id") != "" {
+		f.uploadPart(w, r, key, v.Get("upload_id"), v.Get("part_number"))
+		return
+	}
 	if r.Method == http.MethodPut {
 
 		dirPath := filepath.Dir(filePath)
@@ -206,6 +213,11 @@ func (f *LocalFilesystem) GetPreSignedURL(method Method, key string, expireIn ti
 	v.Set("key", key)
 	v.Set("expiry", time.Now().Add(expireIn).Format(time.RFC3339))
 	v.Set("method", string(method))
+	return f.signURL(key, v)
+}
+
+// signURL returns the signed URL of the filesystem route with the query values v
+func (f *LocalFilesystem) signURL(key string, v url.Values) (URL string, err error) {
 	if strings.Contains(key, "..") {
 		err = fmt.Errorf("'..' is not allowed in a key")
 		return
@@ -290,3 +302,157 @@ func (f *LocalFilesystem) DownloadData(key string) ([]byte, error) {
 	filePath := filepath.Join(f.baseFolder, key, "file")
 	return os.ReadFile(filePath)
 }
+
+// DataSize returns the size of the key object, or 0 if it does not exist
+func (f *LocalFilesystem) DataSize(key string) (int64, error) {
+	info, err := os.Stat(filepath.Join(f.baseFolder, key, "file"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// uploadFolder returns the folder which holds the parts of a multipart upload
+func (f *LocalFilesystem) uploadFolder(key, uploadID string) (string, error) {
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return "", fmt.Errorf("%w: invalid upload id '%s'", ErrNoSuchUpload, uploadID)
+	}
+	return filepath.Join(f.baseFolder, key, "uploads", uploadID), nil
+}
+
+// uploadPart stores one part of a multipart upload and returns its md5 as Etag
+func (f *LocalFilesystem) uploadPart(w http.ResponseWriter, r *http.Request, key, uploadID, partNumber string) {
+	folder, err := f.uploadFolder(key, uploadID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := os.Stat(folder); err != nil {
+		http.Error(w, "no such upload", http.StatusNotFound)
+		return
+	}
+	var number int
+	if _, err := fmt.Sscanf(partNumber, "%d", &number); err != nil || number < 1 {
+		http.Error(w, "invalid part number", http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "cannot read part: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = os.WriteFile(filepath.Join(folder, fmt.Sprintf("part-%05d", number)), data, 0600); err != nil {
+		logger.Default().WithError(err).Errorf("Error 1205: Could not write part %d of `%s` key: '%s'", number, uploadID, key)
+		http.Error(w, "Error 1205", http.StatusInternalServerError)
+		return
+	}
+	sum := md5.Sum(data)
+	w.Header().Set("Etag", "\""+hex.EncodeToString(sum[:])+"\"")
+	w.WriteHeader(http.StatusOK)
+}
+
+// CreateMultipartUpload initiates a multipart upload of the key file
+func (f *LocalFilesystem) CreateMultipartUpload(key string) (uploadID string, err error) {
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return "", err
+	}
+	uploadID = hex.EncodeToString(id)
+	folder, err := f.uploadFolder(key, uploadID)
+	if err != nil {
+		return "", err
+	}
+	return uploadID, os.MkdirAll(folder, 0700)
+}
+
+// GetPreSignedPartURL returns a pre-signed URL to upload the part with partNumber of a multipart upload
+func (f *LocalFilesystem) GetPreSignedPartURL(key, uploadID string, partNumber int, expireIn time.Duration) (URL string, err error) {
+	v := url.Values{}
+	v.Set("key", key)
+	v.Set("expiry", time.Now().Add(expireIn).Format(time.RFC3339))
+	v.Set("method", string(Put))
+	v.Set("upload_id", uploadID)
+	v.Set("part_number", fmt.Sprint(partNumber))
+	return f.signURL(key, v)
+}
+
+// CompleteMultipartUpload assembles the uploaded parts to the key file. The parts must be listed in
+// ascending order with the Etags returned by their upload.
+func (f *LocalFilesystem) CompleteMultipartUpload(key, uploadID string, parts []CompletedPart) error {
+	folder, err := f.uploadFolder(key, uploadID)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(folder); err != nil {
+		return fmt.Errorf("%w '%s'", ErrNoSuchUpload, uploadID)
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("no parts")
+	}
+
+	filePath := filepath.Join(f.baseFolder, key, "file")
+	tmpPath := filepath.Join(folder, "file")
+	dstFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+	var size int64
+	for i, part := range parts {
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return fmt.Errorf("%w: parts must be in ascending order", ErrPartsOutOfOrder)
+		}
+		data, err := os.ReadFile(filepath.Join(folder, fmt.Sprintf("part-%05d", part.PartNumber)))
+		if err != nil {
+			return fmt.Errorf("%w %d", ErrMissingPart, part.PartNumber)
+		}
+		sum := md5.Sum(data)
+		if strings.Trim(part.Etag, "\"") != hex.EncodeToString(sum[:]) {
+			return fmt.Errorf("%w for part %d", ErrEtagMismatch, part.PartNumber)
+		}
+		if _, err = dstFile.Write(data); err != nil {
+			return err
+		}
+		size += int64(len(data))
+	}
+	if err = dstFile.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+	if err = os.RemoveAll(folder); err != nil {
+		logger.Default().WithError(err).Errorf("Could not remove upload folder %s", folder)
+	}
+	f.recurseDeleteParentIfEmpty(filepath.Dir(folder))
+
+	if f.callback != nil {
+		go f.callback(FileUpdatedEvent{
+			Etags: time.Now().Format(time.RFC1123),
+			Key:   key,
+			Type:  "uploaded",
+			Size:  size,
+		})
+	}
+	return nil
+}
+
+// AbortMultipartUpload aborts a multipart upload and deletes the uploaded parts
+func (f *LocalFilesystem) AbortMultipartUpload(key, uploadID string) error {
+	folder, err := f.uploadFolder(key, uploadID)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(folder); err != nil {
+		return fmt.Errorf("%w '%s'", ErrNoSuchUpload, uploadID)
+	}
+	if err = os.RemoveAll(folder); err != nil {
+		return err
+	}
+	f.recurseDeleteParentIfEmpty(filepath.Dir(folder))
+	return nil
+}
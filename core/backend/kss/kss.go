@@ -2,6 +2,7 @@ package kss
 
 import (
 	"crypto/rsa"
+	"errors"
 	"time"
 )
 
@@ -16,6 +17,34 @@ type Driver interface {
 	WithCallBack(FileUpdatedCallBack)
 	UploadData(key string, data []byte) error
 	DownloadData(key string) ([]byte, error)
+	// DataSize returns the size of the key object, or 0 if it does not exist
+	DataSize(key string) (int64, error)
+
+	// CreateMultipartUpload initiates the upload of the key file in parts. The parts are uploaded with
+	// the URLs from GetPreSignedPartURL, then the upload is completed or aborted.
+	CreateMultipartUpload(key string) (uploadID string, err error)
+	GetPreSignedPartURL(key, uploadID string, partNumber int, expireIn time.Duration) (URL string, err error)
+	CompleteMultipartUpload(key, uploadID string, parts []CompletedPart) error
+	AbortMultipartUpload(key, uploadID string) error
+}
+
+// Errors of multipart uploads which are caused by the client. The drivers wrap them, so they must be checked
+// with errors.Is. Any other error of a driver is a server error.
+var (
+	// ErrNoSuchUpload means that the upload does not exist, or was completed or aborted already
+	ErrNoSuchUpload = errors.New("no such upload")
+	// ErrMissingPart means that a listed part was not uploaded
+	ErrMissingPart = errors.New("missing part")
+	// ErrEtagMismatch means that the Etag of a listed part does not match the uploaded part
+	ErrEtagMismatch = errors.New("etag mismatch")
+	// ErrPartsOutOfOrder means that the parts are not listed in ascending order
+	ErrPartsOutOfOrder = errors.New("parts out of order")
+)
+
+// CompletedPart is an uploaded part of a multipart upload. The Etag is the one returned by the part upload.
+type CompletedPart struct {
+	PartNumber int    `json:"part_number"`
+	Etag       string `json:"etag"`
 }
 
 // FileUpdatedEvent contains information about a file event
@@ -3,6 +3,7 @@ package kss
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -18,8 +19,10 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
 	"github.com/relabs-tech/kurbisio/core/logger"
 	"github.com/relabs-tech/kurbisio/core/pointers"
 	"github.com/sirupsen/logrus"
@@ -207,6 +210,113 @@ func (s *S3) DownloadData(key string) ([]byte, error) {
 	return w.Bytes(), nil
 }
 
+// DataSize returns the size of the key object, or 0 if it does not exist
+func (s *S3) DataSize(key string) (int64, error) {
+	cl := s3.NewFromConfig(s.config)
+
+	resp, err := cl.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.baseKeyName + key),
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound" {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file, %v", err)
+	}
+	return resp.ContentLength, nil
+}
+
+// CreateMultipartUpload initiates a multipart upload of the key object
+func (s *S3) CreateMultipartUpload(key string) (uploadID string, err error) {
+	s.logger.Infoln("CreateMultipartUpload ", s.baseKeyName+key)
+	cl := s3.NewFromConfig(s.config)
+
+	resp, err := cl.CreateMultipartUpload(context.TODO(), &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.baseKeyName + key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload, %v", err)
+	}
+	return pointers.SafeString(resp.UploadId), nil
+}
+
+// GetPreSignedPartURL returns a pre-signed URL to upload the part with partNumber of a multipart upload
+func (s *S3) GetPreSignedPartURL(key, uploadID string, partNumber int, expireIn time.Duration) (URL string, err error) {
+	client := s3.NewPresignClient(s3.NewFromConfig(s.config))
+
+	resp, err := client.PresignUploadPart(context.TODO(), &s3.UploadPartInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(s.baseKeyName + key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: int32(partNumber),
+	}, s3.WithPresignExpires(expireIn))
+	if err != nil {
+		return "", err
+	}
+	return resp.URL, nil
+}
+
+// CompleteMultipartUpload assembles the uploaded parts to the key object
+func (s *S3) CompleteMultipartUpload(key, uploadID string, parts []CompletedPart) error {
+	s.logger.Infoln("CompleteMultipartUpload ", s.baseKeyName+key)
+	cl := s3.NewFromConfig(s.config)
+
+	completed := []s3types.CompletedPart{}
+	for _, part := range parts {
+		completed = append(completed, s3types.CompletedPart{
+			ETag:       aws.String(part.Etag),
+			PartNumber: int32(part.PartNumber),
+		})
+	}
+	_, err := cl.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(s.baseKeyName + key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload, %w", s3UploadError(err))
+	}
+	return nil
+}
+
+// s3UploadError translates the S3 errors of multipart uploads which are caused by the client into the
+// errors of the kss package. All other errors are returned unchanged.
+func s3UploadError(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.ErrorCode() {
+	case "NoSuchUpload":
+		return ErrNoSuchUpload
+	case "InvalidPart":
+		return ErrMissingPart
+	case "InvalidPartOrder":
+		return ErrPartsOutOfOrder
+	}
+	return err
+}
+
+// AbortMultipartUpload aborts a multipart upload and deletes the uploaded parts
+func (s *S3) AbortMultipartUpload(key, uploadID string) error {
+	s.logger.Infoln("AbortMultipartUpload ", s.baseKeyName+key)
+	cl := s3.NewFromConfig(s.config)
+
+	_, err := cl.AbortMultipartUpload(context.TODO(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(s.baseKeyName + key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to abort multipart upload, %w", s3UploadError(err))
+	}
+	return nil
+}
+
 // ListAllWithPrefix Lists all keys with prefix
 func (s *S3) ListAllWithPrefix(key string) (keys []string, err error) {
 	s.logger.Infoln("ListAllWithPrefix all ", s.baseKeyName+key)
@@ -322,7 +432,7 @@ func (s *S3) ProcessIncomingSQSMessageRecords(messages []events.SQSMessage) {
 		}
 
 		for _, e := range msg.Records {
-			if e.EventName != "ObjectCreated:Put" {
+			if e.EventName != "ObjectCreated:Put" && e.EventName != "ObjectCreated:CompleteMultipartUpload" {
 				s.logger.Infoln("Got unexpected event name" + e.EventName)
 				continue
 			}
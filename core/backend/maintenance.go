@@ -0,0 +1,117 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// MaintenanceWindow is a recurring time of day range in which deferrable events are processed, see
+// DefineDeferrableEvent. Start and End are offsets from midnight. If End is before Start, the window
+// spans midnight, e.g. from 22:00 to 06:00 the next morning.
+type MaintenanceWindow struct {
+	Start time.Duration
+	End   time.Duration
+	// Days are the days on which the window starts. Default is every day.
+	Days []time.Weekday
+	// Location is the time zone of Start and End. Default is UTC.
+	Location *time.Location
+}
+
+// validate returns an error if the window is empty or its boundaries are not times of day
+func (w *MaintenanceWindow) validate() error {
+	if w.Start < 0 || w.Start >= 24*time.Hour || w.End < 0 || w.End >= 24*time.Hour {
+		return fmt.Errorf("start and end must be between 0 and 24 hours")
+	}
+	if w.Start == w.End {
+		return fmt.Errorf("start and end must differ")
+	}
+	return nil
+}
+
+// onDay returns true if the window starts on weekday
+func (w *MaintenanceWindow) onDay(weekday time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// startOf returns the start of the window on the day of t plus days
+func (w *MaintenanceWindow) startOf(t time.Time, days int) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day()+days, 0, 0, 0, 0, t.Location()).Add(w.Start)
+}
+
+// contains returns true if t is within the window
+func (w *MaintenanceWindow) contains(t time.Time) bool {
+	length := w.End - w.Start
+	if length < 0 {
+		length += 24 * time.Hour
+	}
+	location := w.Location
+	if location == nil {
+		location = time.UTC
+	}
+	t = t.In(location)
+	// a window which spans midnight may have started the day before
+	for _, days := range []int{-1, 0} {
+		start := w.startOf(t, days)
+		if w.onDay(start.Weekday()) && !t.Before(start) && t.Before(start.Add(length)) {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns t if it is within the window, otherwise the start of the next window after t
+func (w *MaintenanceWindow) next(t time.Time) time.Time {
+	if w.contains(t) {
+		return t
+	}
+	location := w.Location
+	if location == nil {
+		location = time.UTC
+	}
+	local := t.In(location)
+	for days := 0; days <= 7; days++ {
+		start := w.startOf(local, days)
+		if start.After(t) && w.onDay(start.Weekday()) {
+			return start.UTC()
+		}
+	}
+	return t
+}
+
+// DefineDeferrableEvent marks the specified event as deferrable. Deferrable events are only processed within
+// the maintenance window of the backend, see Builder.MaintenanceWindow. An event which is raised or scheduled
+// outside the window is held until the next window starts, and so is a retry which would fall outside the window.
+// Events which are not deferrable are processed immediately as usual.
+//
+// Without a maintenance window, deferrable events are processed immediately as well.
+func (b *Backend) DefineDeferrableEvent(event string) {
+	if b.deferrableEvents[event] {
+		log.Fatalf("event %s already defined as deferrable", event)
+	}
+	b.deferrableEvents[event] = true
+}
+
+// deferredSchedule returns the time at which a deferrable event which is due at t can be processed, and true if
+// this is later than t. It returns false for events which are not deferrable or if there is no maintenance window.
+func (b *Backend) deferredSchedule(event string, t time.Time) (time.Time, bool) {
+	if b.maintenanceWindow == nil || !b.deferrableEvents[event] {
+		return t, false
+	}
+	next := b.maintenanceWindow.next(t)
+	return next, next.After(t)
+}
@@ -0,0 +1,35 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// handleMethodNotAllowed installs a handler which answers requests with a method that has no route for an
+// existing path with 405 (Method Not Allowed). Like the response to OPTIONS, the Allow header lists the
+// methods which do have a route. Like the not found handler, it is not passed through the middlewares,
+// hence it returns structured errors itself.
+func (b *Backend) handleMethodNotAllowed() {
+	b.router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Debugln("method not allowed", r.Method, r.URL)
+		w.Header().Set("Allow", strings.Join(b.allowedMethods(r), ", "))
+		if !b.jsonErrors && !strings.Contains(r.Header.Get("Accept"), "application/json") {
+			http.Error(w, "method "+r.Method+" not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ew := &errorResponseWriter{
+			ResponseWriter: w,
+			requestID:      logger.RequestIDFromContext(r.Context()),
+		}
+		http.Error(ew, "method "+r.Method+" not allowed", http.StatusMethodNotAllowed)
+		ew.finish()
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/relabs-tech/kurbisio/core"
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// outboxBatchSize is the maximum number of notifications the relay publishes in one transaction
+const outboxBatchSize = 100
+
+// outboxRetention is how long published notifications are kept in the outbox
+const outboxRetention = 24 * time.Hour
+
+// createOutbox creates the outbox table, which holds the notifications for the Notifier until the relay
+// has published them
+func (b *Backend) createOutbox() {
+	_, err := b.db.Exec(`CREATE table IF NOT EXISTS ` + b.db.Schema + `."_outbox_"
+(serial BIGSERIAL,
+resource VARCHAR NOT NULL,
+operation VARCHAR NOT NULL,
+resource_id uuid NOT NULL DEFAULT uuid_nil(),
+payload JSON NOT NULL DEFAULT'{}'::jsonb,
+timestamp TIMESTAMP NOT NULL DEFAULT now(),
+published_at TIMESTAMP,
+PRIMARY KEY(serial)
+);
+CREATE INDEX IF NOT EXISTS _outbox_pending ON ` + b.db.Schema + `."_outbox_"(serial) WHERE published_at IS NULL;
+`)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// writeOutbox adds a notification to the outbox within the transaction of the write which caused it. It does
+// nothing if the backend has no Notifier.
+func (b *Backend) writeOutbox(ctx context.Context, tx *sql.Tx, resource string, operation core.Operation, resourceID uuid.UUID, payload []byte) error {
+	if b.notifier == nil {
+		return nil
+	}
+	if len(payload) == 0 {
+		payload = []byte("{}")
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO "+b.db.Schema+".\"_outbox_\"(resource,operation,resource_id,payload) VALUES($1,$2,$3,$4);",
+		resource, operation, resourceID, payload)
+	return err
+}
+
+// RelayOutbox publishes the pending notifications of the outbox to the Notifier, in the order in which they
+// were written, and marks them as published. It returns the number of published notifications.
+//
+// A notification is marked as published in the same transaction in which it was read. If the process stops
+// after the Notifier was called but before the transaction was committed, the notification is published
+// again by the next relay, so the Notifier must tolerate duplicates. Only one relay runs at a time, others
+// return immediately.
+//
+// If the Notifier implements core.NotifierWithError and fails, the relay stops and returns the error. The
+// failed notification and all later ones stay in the outbox for the next relay.
+//
+// The relay runs automatically as part of the job processing, see ProcessJobsAsync and ProcessJobsSync.
+func (b *Backend) RelayOutbox() (int, error) {
+	if b.notifier == nil {
+		return 0, nil
+	}
+	published := 0
+	for {
+		n, err := b.relayOutboxBatch()
+		published += n
+		if err != nil || n < outboxBatchSize {
+			return published, err
+		}
+	}
+}
+
+func (b *Backend) relayOutboxBatch() (int, error) {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// the transaction scoped advisory lock makes sure that notifications are published in order
+	var locked bool
+	err = tx.QueryRow("SELECT pg_try_advisory_xact_lock(hashtext($1));", b.db.Schema+"._outbox_").Scan(&locked)
+	if err != nil || !locked {
+		return 0, err
+	}
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT serial, resource, operation, payload FROM %s.\"_outbox_\" WHERE published_at IS NULL ORDER BY serial LIMIT %d;",
+		b.db.Schema, outboxBatchSize))
+	if err != nil {
+		return 0, err
+	}
+	type message struct {
+		serial    int64
+		resource  string
+		operation string
+		payload   []byte
+	}
+	var messages []message
+	for rows.Next() {
+		var m message
+		if err = rows.Scan(&m.serial, &m.resource, &m.operation, &m.payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	// a failed notification stops the batch, so that it and the later ones are published in order by the
+	// next relay
+	var notifyErr error
+	var serials []int64
+	for _, m := range messages {
+		if m.payload, err = b.openPayload(m.resource, m.payload); err != nil {
+			logger.FromContext(nil).WithError(err).Errorf("Error 4828: cannot decrypt outbox payload of %s", m.resource)
+		}
+		if notifier, ok := b.notifier.(core.NotifierWithError); ok {
+			if notifyErr = notifier.NotifyWithError(m.resource, core.Operation(m.operation), m.payload); notifyErr != nil {
+				break
+			}
+		} else {
+			b.notifier.Notify(m.resource, core.Operation(m.operation), m.payload)
+		}
+		serials = append(serials, m.serial)
+	}
+	if len(serials) > 0 {
+		_, err = tx.Exec(fmt.Sprintf("UPDATE %s.\"_outbox_\" SET published_at = now() WHERE serial = ANY($1);", b.db.Schema), pq.Array(serials))
+		if err != nil {
+			return 0, err
+		}
+	}
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s.\"_outbox_\" WHERE published_at < now() - $1 * interval '1 second';", b.db.Schema),
+		int(outboxRetention.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	logger.FromContext(nil).Debugf("relay outbox: published %d notifications", len(serials))
+	if notifyErr != nil {
+		return len(serials), fmt.Errorf("notifier failed: %w", notifyErr)
+	}
+	return len(serials), nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// parentDeleteAction is the foreign key action of a child resource when its parent is deleted
+type parentDeleteAction struct {
+	// clause is the action in the foreign key clause
+	clause string
+	// code is the action as postgres reports it in pg_constraint.confdeltype
+	code string
+}
+
+// parentDeleteActions maps the values of on_parent_delete to foreign key actions. The default is cascade.
+var parentDeleteActions = map[string]parentDeleteAction{
+	"":         {clause: "CASCADE", code: "c"},
+	"cascade":  {clause: "CASCADE", code: "c"},
+	"restrict": {clause: "RESTRICT", code: "r"},
+	"setnull":  {clause: "SET NULL", code: "n"},
+}
+
+// parentDeleteAction validates the on_parent_delete option of a child resource and returns its foreign
+// key action.
+//
+// Restrict and setnull require a parent. Singletons are identified by their owner, so they can only be
+// deleted together with it. Setnull clears the parent identifiers of the child, which breaks the
+// composite foreign keys of its own children and of relations. It is therefore only valid for leaf
+// resources which are not part of any relation.
+func (b *Backend) parentDeleteAction(resource, onParentDelete string, singleton bool) (parentDeleteAction, error) {
+	action, ok := parentDeleteActions[onParentDelete]
+	if !ok {
+		return action, fmt.Errorf("unknown on_parent_delete '%s'", onParentDelete)
+	}
+	if action.code == "c" {
+		return action, nil
+	}
+	if !strings.Contains(resource, "/") {
+		return action, fmt.Errorf("on_parent_delete '%s' requires a parent resource", onParentDelete)
+	}
+	if singleton {
+		return action, fmt.Errorf("on_parent_delete '%s' is not supported for singletons", onParentDelete)
+	}
+	if action.code != "n" {
+		return action, nil
+	}
+
+	var children []string
+	for _, rc := range b.config.Collections {
+		children = append(children, rc.Resource)
+	}
+	for _, rc := range b.config.Singletons {
+		children = append(children, rc.Resource)
+	}
+	for _, rc := range b.config.Blobs {
+		children = append(children, rc.Resource)
+	}
+	for _, child := range children {
+		if strings.HasPrefix(child, resource+"/") {
+			return action, fmt.Errorf("on_parent_delete 'setnull' is not supported for resources with children like %s", child)
+		}
+	}
+	for _, rc := range b.config.Relations {
+		if rc.Left == resource || rc.Right == resource {
+			return action, fmt.Errorf("on_parent_delete 'setnull' is not supported for resources in relations like %s", rc.Resource)
+		}
+	}
+	return action, nil
+}
+
+// reconcileParentDelete brings the foreign key of a child resource to its parent in line with the
+// configured action. The create statements do not touch existing tables, so a changed on_parent_delete
+// option must be migrated here. Replacing the foreign key is safe, it does not affect any data.
+func (b *Backend) reconcileParentDelete(layout schemaLayout) {
+	if layout.parentForeignKey == "" {
+		return
+	}
+	nillog := logger.FromContext(nil)
+	schema := b.db.Schema
+
+	var constraint, code string
+	err := b.db.QueryRow(
+		`SELECT conname, confdeltype FROM pg_constraint
+		WHERE conrelid = (quote_ident($1) || '.' || quote_ident($2))::regclass
+		AND confrelid = (quote_ident($1) || '.' || quote_ident($3))::regclass AND contype = 'f';`,
+		schema, layout.resource, layout.parent).Scan(&constraint, &code)
+	if err != nil {
+		nillog.WithError(err).Errorf("cannot read foreign key of %s to detect schema drift", layout.resource)
+		return
+	}
+	if code == layout.parentDeleteAction.code {
+		return
+	}
+
+	nillog.Infof("schema migration in %s: change the action on parent delete to %s", layout.resource, layout.parentDeleteAction.clause)
+	migration := fmt.Sprintf("ALTER TABLE %s.\"%s\" DROP CONSTRAINT \"%s\", ADD %s;",
+		schema, layout.resource, constraint, layout.parentForeignKey)
+	if _, err = b.db.Exec(migration); err != nil {
+		nillog.WithError(err).Warnf("schema drift in %s: cannot apply migration: %s", layout.resource, migration)
+		return
+	}
+
+	// with setnull the parent identifiers must be nullable, otherwise they must not be null
+	for _, column := range layout.parentColumns {
+		if layout.parentDeleteAction.code == "n" {
+			migration = fmt.Sprintf("ALTER TABLE %s.\"%s\" ALTER COLUMN \"%s\" DROP NOT NULL;", schema, layout.resource, column)
+		} else {
+			migration = fmt.Sprintf("ALTER TABLE %s.\"%s\" ALTER COLUMN \"%s\" SET NOT NULL;", schema, layout.resource, column)
+		}
+		if _, err = b.db.Exec(migration); err != nil {
+			nillog.WithError(err).Warnf("schema drift in %s: cannot apply migration, orphaned resources must be deleted first: %s",
+				layout.resource, migration)
+		}
+	}
+}
+
+// isForeignKeyViolation returns true if err is a foreign key violation. When resources are deleted,
+// this means that they still have children with on_parent_delete restrict.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
@@ -7,8 +7,10 @@
 package backend
 
 import (
+	"bytes"
 	"database/sql"
 	"fmt"
+	"io"
 	"reflect"
 	"sort"
 	"strconv"
@@ -18,6 +20,7 @@ import (
 	"github.com/goccy/go-json"
 
 	"net/http"
+	"net/url"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -152,9 +155,11 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 	virtualLeftResource := resourcePrefix + rc.Left + "/" + right
 	b.relations[virtualLeftResource] = resource
 	virtualLeftCollection := collectionFunctions{
-		permits: rc.LeftPermits,
-		list:    rightCollection.list,
-		read:    rightCollection.read,
+		permits:           rc.LeftPermits,
+		list:              rightCollection.list,
+		read:              rightCollection.read,
+		table:             rightCollection.table,
+		searchableColumns: rightCollection.searchableColumns,
 	}
 
 	b.collectionFunctions[virtualLeftResource] = &virtualLeftCollection
@@ -162,9 +167,11 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 	virtualRightResource := resourcePrefix + rc.Right + "/" + left
 	b.relations[virtualRightResource] = resource
 	virtualRightCollection := collectionFunctions{
-		permits: rc.RightPermits,
-		list:    leftCollection.list,
-		read:    leftCollection.read,
+		permits:           rc.RightPermits,
+		list:              leftCollection.list,
+		read:              leftCollection.read,
+		table:             leftCollection.table,
+		searchableColumns: leftCollection.searchableColumns,
 	}
 
 	b.collectionFunctions[virtualRightResource] = &virtualRightCollection
@@ -179,9 +186,17 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 		compareIDsString(leftColumns[:len(leftColumns)-1]) + sqlPagination + ";"
 	rightQuery := fmt.Sprintf("SELECT %s_id, timestamp FROM %s.\"%s\" WHERE ", left, schema, resource) +
 		compareIDsString(rightColumns[:len(rightColumns)-1]) + sqlPagination + ";"
+	leftCountQuery := fmt.Sprintf("SELECT count(*) FROM %s.\"%s\" WHERE ", schema, resource) +
+		compareIDsString(leftColumns[:len(leftColumns)-1]) + ";"
+	rightCountQuery := fmt.Sprintf("SELECT count(*) FROM %s.\"%s\" WHERE ", schema, resource) +
+		compareIDsString(rightColumns[:len(rightColumns)-1]) + ";"
 
 	leftSQLInjectRelation := fmt.Sprintf(" AND %s_id IN (SELECT %s_id FROM %s.\"%s\" WHERE %%s %s) ", right, right, schema, resource, sqlPagination)
 	rightSQLInjectRelation := fmt.Sprintf(" AND %s_id IN (SELECT %s_id FROM %s.\"%s\" WHERE %%s %s) ", left, left, schema, resource, sqlPagination)
+	leftTimestampSubquery := fmt.Sprintf("(SELECT timestamp FROM %s.\"%s\" WHERE %s_id = %s.\"%s\".%s_id AND %%s)",
+		schema, resource, right, schema, rightCollection.table, right)
+	rightTimestampSubquery := fmt.Sprintf("(SELECT timestamp FROM %s.\"%s\" WHERE %s_id = %s.\"%s\".%s_id AND %%s)",
+		schema, resource, left, schema, leftCollection.table, left)
 	insertQuery := fmt.Sprintf("INSERT INTO %s.\"%s\" (%s) VALUES(%s);", schema, resource, strings.Join(columns, ","), parameterString(len(columns)))
 	deleteQuery := fmt.Sprintf("DELETE FROM %s.\"%s\" WHERE %s;", schema, resource, compareIDsString(columns))
 
@@ -199,9 +214,18 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 		rightItemRoute = rightItemRoute + "/" + core.Plural(r) + "/{" + r + "_id}"
 	}
 
-	rlog.Debugln("  handle routes:", leftListRoute, "GET")
+	// items of relations of relations have no path of their own
+	if _, ok := b.relations[rc.Right]; !ok {
+		b.registerHALRoute(leftListRoute, rc.Right)
+		b.registerHALRoute(leftItemRoute, rc.Right)
+	}
+	if _, ok := b.relations[rc.Left]; !ok {
+		b.registerHALRoute(rightListRoute, rc.Left)
+		b.registerHALRoute(rightItemRoute, rc.Left)
+	}
+	rlog.Debugln("  handle routes:", leftListRoute, "GET,DELETE")
 	rlog.Debugln("  handle routes:", leftItemRoute, "GET,PUT,DELETE")
-	rlog.Debugln("  handle routes:", rightListRoute, "GET")
+	rlog.Debugln("  handle routes:", rightListRoute, "GET,DELETE")
 	rlog.Debugln("  handle routes:", rightItemRoute, "GET,PUT,DELETE")
 
 	// LIST LEFT
@@ -217,11 +241,17 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 			}
 		}
 
-		var idonly, withtimestamp bool
+		var idonly, withtimestamp, countonly bool
 		var err error
 		urlQuery := r.URL.Query()
 		for key, array := range urlQuery {
 			switch key {
+			case "countonly":
+				countonly, err = strconv.ParseBool(array[0])
+				if err != nil {
+					http.Error(w, "parameter '"+key+"': "+err.Error(), http.StatusBadRequest)
+					return
+				}
 			case "idonly":
 				idonly, err = strconv.ParseBool(array[0])
 				if err != nil {
@@ -243,16 +273,44 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 			queryParameters[i] = params[leftColumns[i]]
 		}
 
+		if countonly {
+			query := leftCountQuery
+			if urlQuery.Has("filter") || urlQuery.Has("filter_or") || urlQuery.Has("search") {
+				var filterParameters []interface{}
+				query, filterParameters, err = b.filteredRelationQuery(resource, rightCollection, right,
+					leftColumns[:len(leftColumns)-1], urlQuery, true)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				queryParameters = append(queryParameters, filterParameters...)
+			}
+			b.countRelation(w, r, query, queryParameters)
+			return
+		}
+
 		if idonly {
 			response := []uuid.UUID{}
 			responseWithTimestamp := []map[string]interface{}{}
 			idName := fmt.Sprintf("%s_id", left)
 
-			rows, err := b.db.Query(leftQuery, queryParameters...)
+			query := leftQuery
+			if urlQuery.Has("filter") || urlQuery.Has("filter_or") || urlQuery.Has("search") {
+				var filterParameters []interface{}
+				query, filterParameters, err = b.filteredRelationQuery(resource, rightCollection, right,
+					leftColumns[:len(leftColumns)-1], urlQuery, false)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				queryParameters = append(queryParameters, filterParameters...)
+			}
+
+			rows, err := b.db.QueryContext(r.Context(), query, queryParameters...)
 			if err != sql.ErrNoRows {
 				if err != nil {
 					rlog.WithError(err).Errorln("Error 4123: cannot query database")
-					http.Error(w, "Error 4123: ", http.StatusInternalServerError)
+					http.Error(w, "Error 4123: ", databaseErrorStatus(w, err))
 					return
 				}
 				defer rows.Close()
@@ -286,9 +344,10 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 		}
 
 		injectRelation := &relationInjection{
-			subquery:        leftSQLInjectRelation,
-			columns:         leftColumns[:len(leftColumns)-1], // skip ID
-			queryParameters: queryParameters,
+			subquery:          leftSQLInjectRelation,
+			columns:           leftColumns[:len(leftColumns)-1], // skip ID
+			queryParameters:   queryParameters,
+			timestampSubquery: leftTimestampSubquery,
 		}
 
 		rightCollection.list(w, r, injectRelation)
@@ -307,11 +366,17 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 			}
 		}
 
-		var idonly, withtimestamp bool
+		var idonly, withtimestamp, countonly bool
 		var err error
 		urlQuery := r.URL.Query()
 		for key, array := range urlQuery {
 			switch key {
+			case "countonly":
+				countonly, err = strconv.ParseBool(array[0])
+				if err != nil {
+					http.Error(w, "parameter '"+key+"': "+err.Error(), http.StatusBadRequest)
+					return
+				}
 			case "idonly":
 				idonly, err = strconv.ParseBool(array[0])
 				if err != nil {
@@ -333,16 +398,44 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 			queryParameters[i] = params[rightColumns[i]]
 		}
 
+		if countonly {
+			query := rightCountQuery
+			if urlQuery.Has("filter") || urlQuery.Has("filter_or") || urlQuery.Has("search") {
+				var filterParameters []interface{}
+				query, filterParameters, err = b.filteredRelationQuery(resource, leftCollection, left,
+					rightColumns[:len(rightColumns)-1], urlQuery, true)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				queryParameters = append(queryParameters, filterParameters...)
+			}
+			b.countRelation(w, r, query, queryParameters)
+			return
+		}
+
 		if idonly {
 			response := []uuid.UUID{}
 			responseWithTimestamp := []map[string]interface{}{}
 			idName := fmt.Sprintf("%s_id", left)
 
-			rows, err := b.db.Query(rightQuery, queryParameters...)
+			query := rightQuery
+			if urlQuery.Has("filter") || urlQuery.Has("filter_or") || urlQuery.Has("search") {
+				var filterParameters []interface{}
+				query, filterParameters, err = b.filteredRelationQuery(resource, leftCollection, left,
+					rightColumns[:len(rightColumns)-1], urlQuery, false)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				queryParameters = append(queryParameters, filterParameters...)
+			}
+
+			rows, err := b.db.QueryContext(r.Context(), query, queryParameters...)
 			if err != sql.ErrNoRows {
 				if err != nil {
 					rlog.WithError(err).Errorln("Error 4125: Query")
-					http.Error(w, "Error 4125: ", http.StatusInternalServerError)
+					http.Error(w, "Error 4125: ", databaseErrorStatus(w, err))
 					return
 				}
 				defer rows.Close()
@@ -376,9 +469,10 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 		}
 
 		injectRelation := &relationInjection{
-			subquery:        rightSQLInjectRelation,
-			columns:         rightColumns[:len(rightColumns)-1], // skip ID
-			queryParameters: queryParameters,
+			subquery:          rightSQLInjectRelation,
+			columns:           rightColumns[:len(rightColumns)-1], // skip ID
+			queryParameters:   queryParameters,
+			timestampSubquery: rightTimestampSubquery,
 		}
 
 		leftCollection.list(w, r, injectRelation)
@@ -439,7 +533,7 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 		for i := 0; i < len(columns); i++ {
 			queryParameters[i] = params[columns[i]]
 		}
-		res, err := b.db.Exec(insertQuery, queryParameters...)
+		res, err := b.db.ExecContext(r.Context(), insertQuery, queryParameters...)
 		if err != nil {
 			var code pq.ErrorCode
 			if err, ok := err.(*pq.Error); ok {
@@ -516,9 +610,15 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 		for i := 0; i < len(columns); i++ {
 			queryParameters[i] = params[columns[i]]
 		}
-		res, err := b.db.Exec(deleteQuery, queryParameters...)
+		res, err := b.db.ExecContext(r.Context(), deleteQuery, queryParameters...)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			// Invalid UUIDs are reported as "invalid_text_representation" which is Code 22P02
+			if err, ok := err.(*pq.Error); ok && err.Code == "22P02" {
+				http.Error(w, "invalid uuid", http.StatusBadRequest)
+				return
+			}
+			logger.FromContext(r.Context()).WithError(err).Errorln("Error 4130: Exec")
+			http.Error(w, "Error 4130", http.StatusInternalServerError)
 			return
 		}
 		count, err := res.RowsAffected()
@@ -565,4 +665,212 @@ func (b *Backend) createRelationResource(router *mux.Router, rc relationConfigur
 		delete(w, r)
 	}).Methods(http.MethodOptions, http.MethodDelete)
 
+	// DELETE LEFT LIST
+	router.HandleFunc(leftListRoute, func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+
+		params := mux.Vars(r)
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.IsAuthorized(leftResources, core.OperationDelete, params, rc.LeftPermits) {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		b.deleteRelations(w, r, resource, rightCollection, right, leftColumns[:len(leftColumns)-1])
+	}).Methods(http.MethodOptions, http.MethodDelete)
+
+	// DELETE RIGHT LIST
+	router.HandleFunc(rightListRoute, func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+
+		params := mux.Vars(r)
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.IsAuthorized(rightResources, core.OperationDelete, params, rc.RightPermits) {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		b.deleteRelations(w, r, resource, leftCollection, left, rightColumns[:len(rightColumns)-1])
+	}).Methods(http.MethodOptions, http.MethodDelete)
+
+}
+
+// filteredRelationQuery returns the query for an idonly relation list, which is filtered by the "filter" and
+// "search" parameters in urlQuery. The filters apply to the related resource target, not to the relation table.
+// The relation is selected by the identifiers in columns, which are the first query parameters. The function
+// returns the query and the additional query parameters for the filters. With countOnly, the query returns
+// the number of matching relations instead.
+func (b *Backend) filteredRelationQuery(relationTable string, targetCollection *collectionFunctions, target string,
+	columns []string, urlQuery url.Values, countOnly bool) (string, []interface{}, error) {
+	schema := b.db.Schema
+	if targetCollection.table == "" {
+		return "", nil, fmt.Errorf("%s cannot be filtered", target)
+	}
+
+	query := fmt.Sprintf("SELECT r.%s_id, r.timestamp FROM %s.\"%s\" r JOIN %s.\"%s\" t ON t.%s_id = r.%s_id WHERE ",
+		target, schema, relationTable, schema, targetCollection.table, target, target)
+	if countOnly {
+		query = fmt.Sprintf("SELECT count(*) FROM %s.\"%s\" r JOIN %s.\"%s\" t ON t.%s_id = r.%s_id WHERE ",
+			schema, relationTable, schema, targetCollection.table, target, target)
+	}
+	for i, column := range columns {
+		if i > 0 {
+			query += " AND "
+		}
+		query += fmt.Sprintf("($%d='all' OR r.%s=$%d::UUID)", i+1, column, i+1)
+	}
+
+	filters, filterParameters, err := b.relationFilters(targetCollection, len(columns), urlQuery)
+	if err != nil {
+		return "", nil, err
+	}
+	query += filters
+	if countOnly {
+		return query + ";", filterParameters, nil
+	}
+	query += " ORDER BY r.serial LIMIT 1000;"
+	return query, filterParameters, nil
+}
+
+// relationFilters returns the conditions for the "filter", "filter_or" and "search" parameters in urlQuery, which
+// apply to the related resource target joined as "t", together with their query parameters. The parameters are
+// numbered after the first offset parameters of the query.
+func (b *Backend) relationFilters(targetCollection *collectionFunctions, offset int, urlQuery url.Values) (string, []interface{}, error) {
+	query := ""
+	var filterParameters []interface{}
+	for _, key := range []string{"filter", "search"} {
+		for _, value := range urlQuery[key] {
+			filterKey, operator, filterValue, err := parseFilter(value)
+			if err != nil {
+				return "", nil, fmt.Errorf("parameter '%s': %s", key, err.Error())
+			}
+			if operator == "=" {
+				if err = checkIDFilter(filterKey, filterValue, targetCollection.idColumns); err != nil {
+					return "", nil, fmt.Errorf("parameter '%s': %s", key, err.Error())
+				}
+			}
+			filterParameters = append(filterParameters, filterValue)
+			n := offset + len(filterParameters)
+
+			if stringlist(targetCollection.searchableColumns).contains(filterKey) {
+				query += fmt.Sprintf(" AND (t.%s%s$%d)", filterKey, operator, n)
+			} else if key == "search" {
+				return "", nil, fmt.Errorf("parameter '%s': unknown search property '%s'", key, filterKey)
+			} else {
+				query += fmt.Sprintf(" AND (t.properties->>'%s'%s$%d)", strings.ReplaceAll(filterKey, "'", "''"), operator, n)
+				b.filterUsage.count(targetCollection.table, filterKey)
+			}
+		}
+	}
+
+	// all filter_or parameters form one group of alternatives
+	var alternatives []string
+	for _, value := range urlQuery["filter_or"] {
+		filterKey, operator, filterValue, err := parseFilter(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("parameter 'filter_or': %s", err.Error())
+		}
+		if operator == "=" {
+			if err = checkIDFilter(filterKey, filterValue, targetCollection.idColumns); err != nil {
+				return "", nil, fmt.Errorf("parameter 'filter_or': %s", err.Error())
+			}
+		}
+		filterParameters = append(filterParameters, filterValue)
+		n := offset + len(filterParameters)
+		if stringlist(targetCollection.searchableColumns).contains(filterKey) {
+			alternatives = append(alternatives, fmt.Sprintf("t.%s%s$%d", filterKey, operator, n))
+		} else {
+			alternatives = append(alternatives, fmt.Sprintf("t.properties->>'%s'%s$%d", strings.ReplaceAll(filterKey, "'", "''"), operator, n))
+			b.filterUsage.count(targetCollection.table, filterKey)
+		}
+	}
+	if len(alternatives) > 0 {
+		query += " AND (" + strings.Join(alternatives, " OR ") + ")"
+	}
+	return query, filterParameters, nil
+}
+
+// deleteRelations deletes all relations of the resource selected by the identifiers in columns, which are the
+// route parameters of the request, in a single statement. The relations can be narrowed down with a JSON array
+// of identifiers of the related resource target in the request body, and with the "filter" and "search"
+// parameters, which apply to the related resource like in filteredRelationQuery.
+func (b *Backend) deleteRelations(w http.ResponseWriter, r *http.Request, relationTable string,
+	targetCollection *collectionFunctions, target string, columns []string) {
+	schema := b.db.Schema
+	params := mux.Vars(r)
+
+	var ids []string
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "cannot read body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &ids); err != nil {
+			http.Error(w, "body must be an array of "+target+"_id", http.StatusBadRequest)
+			return
+		}
+		for _, id := range ids {
+			if _, err := uuid.Parse(id); err != nil {
+				http.Error(w, "invalid uuid "+id, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	qualifiedColumns := make([]string, len(columns))
+	queryParameters := make([]interface{}, len(columns))
+	for i, column := range columns {
+		qualifiedColumns[i] = "r." + column
+		queryParameters[i] = params[column]
+	}
+	query := fmt.Sprintf("DELETE FROM %s.\"%s\" r WHERE ", schema, relationTable) + compareIDsString(qualifiedColumns)
+	urlQuery := r.URL.Query()
+	if urlQuery.Has("filter") || urlQuery.Has("filter_or") || urlQuery.Has("search") {
+		if targetCollection.table == "" {
+			http.Error(w, target+" cannot be filtered", http.StatusBadRequest)
+			return
+		}
+		filters, filterParameters, err := b.relationFilters(targetCollection, len(queryParameters), urlQuery)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query = fmt.Sprintf("DELETE FROM %s.\"%s\" r USING %s.\"%s\" t WHERE t.%s_id = r.%s_id AND ",
+			schema, relationTable, schema, targetCollection.table, target, target) + compareIDsString(qualifiedColumns) + filters
+		queryParameters = append(queryParameters, filterParameters...)
+	}
+	if ids != nil {
+		queryParameters = append(queryParameters, pq.Array(ids))
+		query += fmt.Sprintf(" AND r.%s_id = ANY($%d::UUID[])", target, len(queryParameters))
+	}
+
+	_, err = b.db.ExecContext(r.Context(), query+";", queryParameters...)
+	if err != nil {
+		// Invalid UUIDs are reported as "invalid_text_representation" which is Code 22P02
+		if err, ok := err.(*pq.Error); ok && err.Code == "22P02" {
+			http.Error(w, "invalid uuid", http.StatusBadRequest)
+			return
+		}
+		logger.FromContext(r.Context()).WithError(err).Errorf("Error 4132: cannot execute query `%s`", query)
+		http.Error(w, "Error 4132", databaseErrorStatus(w, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// countRelation writes the number of relations which query counts as {"count": N}
+func (b *Backend) countRelation(w http.ResponseWriter, r *http.Request, query string, queryParameters []interface{}) {
+	var count int
+	err := b.db.QueryRowContext(r.Context(), query, queryParameters...).Scan(&count)
+	if err != nil {
+		logger.FromContext(r.Context()).WithError(err).Errorf("Error 4131: cannot execute query `%s`", query)
+		http.Error(w, "Error 4131", databaseErrorStatus(w, err))
+		return
+	}
+	jsonData, _ := json.Marshal(map[string]int{"count": count})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(jsonData)
 }
@@ -9,6 +9,9 @@ package backend_test
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,6 +20,7 @@ import (
 	"github.com/joeshaw/envdecode"
 	_ "github.com/lib/pq"
 
+	"github.com/relabs-tech/kurbisio/core/access"
 	"github.com/relabs-tech/kurbisio/core/backend"
 	"github.com/relabs-tech/kurbisio/core/client"
 	"github.com/relabs-tech/kurbisio/core/csql"
@@ -424,3 +428,289 @@ type TestService struct {
 }
 
 var testService TestService
+
+func TestRelationFilterByRelatedResource(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user"
+		  },
+		  {
+			"resource": "device",
+			"searchable_properties": ["status"]
+		  }
+		],
+		"relations": [
+			{
+				"left": "user",
+				"right": "device"
+			}
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type User struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+	type Device struct {
+		DeviceID uuid.UUID `json:"device_id"`
+		Status   string    `json:"status"`
+		Color    string    `json:"color"`
+	}
+
+	user := User{}
+	if _, err := testService.client.RawPost("/users", &user, &user); err != nil {
+		t.Fatal(err)
+	}
+	devices := []Device{
+		{Status: "active", Color: "red"},
+		{Status: "active", Color: "blue"},
+		{Status: "inactive", Color: "red"},
+	}
+	for i := range devices {
+		if _, err := testService.client.RawPost("/devices", &devices[i], &devices[i]); err != nil {
+			t.Fatal(err)
+		}
+		path := "/users/" + user.UserID.String() + "/devices/" + devices[i].DeviceID.String()
+		if _, err := testService.client.RawPut(path, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		query    string
+		expected int
+	}{
+		{"filter=status=active", 2},
+		{"search=status=inactive", 1},
+		{"filter=color=red", 2},
+		{"filter=status=active&filter=color=red", 1},
+		{"filter_or=status=inactive&filter_or=color=blue", 2},
+		{"filter_or=status=inactive&filter_or=color=blue&filter=color=red", 1},
+	}
+	for _, tc := range testCases {
+		var result []Device
+		if _, err := testService.client.RawGet("/users/"+user.UserID.String()+"/devices?"+tc.query, &result); err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != tc.expected {
+			t.Fatalf("%s: expected %d devices, got %d", tc.query, tc.expected, len(result))
+		}
+
+		var ids []uuid.UUID
+		if _, err := testService.client.RawGet("/users/"+user.UserID.String()+"/devices?idonly=true&"+tc.query, &ids); err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != tc.expected {
+			t.Fatalf("%s with idonly: expected %d devices, got %d", tc.query, tc.expected, len(ids))
+		}
+
+		var count map[string]int
+		if _, err := testService.client.RawGet("/users/"+user.UserID.String()+"/devices?countonly=true&"+tc.query, &count); err != nil {
+			t.Fatal(err)
+		}
+		if count["count"] != tc.expected {
+			t.Fatalf("%s with countonly: expected %d devices, got %d", tc.query, tc.expected, count["count"])
+		}
+	}
+
+	// counts without filter, in both directions
+	var count map[string]int
+	if _, err := testService.client.RawGet("/users/"+user.UserID.String()+"/devices?countonly=true", &count); err != nil {
+		t.Fatal(err)
+	}
+	if count["count"] != len(devices) {
+		t.Fatalf("expected %d devices, got %d", len(devices), count["count"])
+	}
+	if _, err := testService.client.RawGet("/devices/"+devices[0].DeviceID.String()+"/users?countonly=true", &count); err != nil {
+		t.Fatal(err)
+	}
+	if count["count"] != 1 {
+		t.Fatalf("expected 1 user, got %d", count["count"])
+	}
+
+	// search is only possible on searchable properties
+	status, _ := testService.client.RawGet("/users/"+user.UserID.String()+"/devices?idonly=true&search=color=red", nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, status)
+	}
+}
+
+func TestRelationBulkDelete(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user"
+		  },
+		  {
+			"resource": "device",
+			"searchable_properties": ["status"]
+		  }
+		],
+		"relations": [
+			{
+				"left": "user",
+				"right": "device"
+			}
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type Device struct {
+		DeviceID uuid.UUID `json:"device_id"`
+		Status   string    `json:"status"`
+	}
+
+	var user map[string]interface{}
+	if _, err := testService.client.RawPost("/users", map[string]interface{}{}, &user); err != nil {
+		t.Fatal(err)
+	}
+	userPath := "/users/" + user["user_id"].(string)
+	devices := []Device{{Status: "active"}, {Status: "active"}, {Status: "inactive"}, {Status: "inactive"}, {Status: "broken"}}
+	for i := range devices {
+		if _, err := testService.client.RawPost("/devices", &devices[i], &devices[i]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := testService.client.RawPut(userPath+"/devices/"+devices[i].DeviceID.String(), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	countDevices := func() int {
+		var count map[string]int
+		if _, err := testService.client.RawGet(userPath+"/devices?countonly=true", &count); err != nil {
+			t.Fatal(err)
+		}
+		return count["count"]
+	}
+	deleteWithBody := func(path, body string) int {
+		r := httptest.NewRequest(http.MethodDelete, path, strings.NewReader(body))
+		r = r.WithContext(access.ContextWithAuthorization(r.Context(), &access.Authorization{Roles: []string{"admin"}}))
+		rec := httptest.NewRecorder()
+		testService.Router.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	// by filter on the related resource
+	if _, err := testService.client.RawDelete(userPath + "/devices?filter=status=inactive"); err != nil {
+		t.Fatal(err)
+	}
+	if count := countDevices(); count != 3 {
+		t.Fatalf("expected 3 devices, got %d", count)
+	}
+	// the devices themselves still exist
+	if _, err := testService.client.RawGet("/devices/"+devices[2].DeviceID.String(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// by a list of identifiers in the body
+	body := fmt.Sprintf(`["%s", "%s"]`, devices[0].DeviceID, devices[2].DeviceID)
+	if status := deleteWithBody(userPath+"/devices", body); status != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, status)
+	}
+	if count := countDevices(); count != 2 {
+		t.Fatalf("expected 2 devices, got %d", count)
+	}
+	if status := deleteWithBody(userPath+"/devices", `["not-a-uuid"]`); status != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, status)
+	}
+
+	// from the right side, all remaining relations of a device
+	if _, err := testService.client.RawDelete("/devices/" + devices[4].DeviceID.String() + "/users"); err != nil {
+		t.Fatal(err)
+	}
+	if count := countDevices(); count != 1 {
+		t.Fatalf("expected 1 device, got %d", count)
+	}
+
+	// without filter, all relations of the user
+	if _, err := testService.client.RawDelete(userPath + "/devices"); err != nil {
+		t.Fatal(err)
+	}
+	if count := countDevices(); count != 0 {
+		t.Fatalf("expected 0 devices, got %d", count)
+	}
+}
+
+func TestRelationOrderByRelationTimestamp(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "user"
+		  },
+		  {
+			"resource": "device"
+		  }
+		],
+		"relations": [
+			{
+				"left": "user",
+				"right": "device"
+			}
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	type User struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+	type Device struct {
+		DeviceID uuid.UUID `json:"device_id"`
+	}
+
+	user := User{}
+	if _, err := testService.client.RawPost("/users", &user, &user); err != nil {
+		t.Fatal(err)
+	}
+	devices := make([]Device, 3)
+	for i := range devices {
+		if _, err := testService.client.RawPost("/devices", &devices[i], &devices[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// relate the devices in the opposite order of their creation
+	for i := len(devices) - 1; i >= 0; i-- {
+		path := "/users/" + user.UserID.String() + "/devices/" + devices[i].DeviceID.String()
+		if _, err := testService.client.RawPut(path, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		query    string
+		expected []Device
+	}{
+		{"", []Device{devices[2], devices[1], devices[0]}},
+		{"order_by=relation_timestamp", []Device{devices[0], devices[1], devices[2]}},
+		{"order_by=relation_timestamp&order=asc", []Device{devices[2], devices[1], devices[0]}},
+		{"order_by=relation_timestamp&limit=1&page=2", []Device{devices[1]}},
+	}
+	for _, tc := range testCases {
+		var result []Device
+		if _, err := testService.client.RawGet("/users/"+user.UserID.String()+"/devices?"+tc.query, &result); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result, tc.expected) {
+			t.Fatalf("%s: expected %v, got %v", tc.query, tc.expected, result)
+		}
+	}
+
+	var result []User
+	if _, err := testService.client.RawGet("/devices/"+devices[0].DeviceID.String()+"/users?order_by=relation_timestamp", &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].UserID != user.UserID {
+		t.Fatalf("expected user %s, got %v", user.UserID, result)
+	}
+
+	// ordering by the relation requires a relation
+	status, _ := testService.client.RawGet("/devices?order_by=relation_timestamp", nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, status)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// postgresMaxIdentifierLength is the maximum length of identifiers in postgres (NAMEDATALEN-1).
+// Longer index names are silently truncated by the database.
+const postgresMaxIdentifierLength = 63
+
+// schemaLayout describes the desired layout of a resource table as derived from the configuration
+type schemaLayout struct {
+	resource string
+	this     string
+	// coreColumns are the columns managed by kurbisio itself, e.g. ids, timestamp and revision
+	coreColumns []string
+	// propertyColumns are static, searchable and external index properties. They are all varchars.
+	propertyColumns []string
+	// indices are the names of all property indices which should exist
+	indices []string
+	// checkConstraints are the names of all check constraints which should exist
+	checkConstraints []string
+	// generatedColumns are the columns which the database derives from the JSON document
+	generatedColumns map[string]generatedColumn
+	// parent is the table of the parent resource, parentColumns are the parent identifiers which
+	// reference it with the foreign key parentForeignKey
+	parent             string
+	parentColumns      []string
+	parentForeignKey   string
+	parentDeleteAction parentDeleteAction
+}
+
+// generatedColumn is a column which postgres generates from a property of the JSON document
+type generatedColumn struct {
+	// dataType is the type as reported by information_schema.columns
+	dataType string
+	// createQuery creates the column and its index
+	createQuery string
+	// index is the name of the index on the column
+	index string
+}
+
+// isText returns true if the column holds text, so that it can be searched with a pattern
+func (c generatedColumn) isText() bool {
+	return c.dataType == "character varying" || c.dataType == "text"
+}
+
+// generatedPropertyTypes maps the supported types of generated properties to the
+// data types postgres reports for them
+var generatedPropertyTypes = map[string]string{
+	"varchar":          "character varying",
+	"text":             "text",
+	"int":              "integer",
+	"integer":          "integer",
+	"bigint":           "bigint",
+	"numeric":          "numeric",
+	"double precision": "double precision",
+	"boolean":          "boolean",
+}
+
+var (
+	generatedPropertyName        = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	generatedPropertyPathSegment = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+)
+
+// newGeneratedColumn returns the generated column for a generated property of a resource
+func newGeneratedColumn(schema, resource, this string, gp generatedPropertyConfiguration) (generatedColumn, error) {
+	if !generatedPropertyName.MatchString(gp.Name) {
+		return generatedColumn{}, fmt.Errorf("invalid name '%s', must be lower case letters, digits and underscores", gp.Name)
+	}
+	dataType, ok := generatedPropertyTypes[gp.Type]
+	if !ok {
+		return generatedColumn{}, fmt.Errorf("unsupported type '%s' for '%s'", gp.Type, gp.Name)
+	}
+	path := strings.Split(gp.Path, ".")
+	for _, segment := range path {
+		if !generatedPropertyPathSegment.MatchString(segment) {
+			return generatedColumn{}, fmt.Errorf("invalid path '%s' for '%s'", gp.Path, gp.Name)
+		}
+	}
+	index := "generated_property_" + this + "_" + gp.Name
+	createQuery := fmt.Sprintf("ALTER TABLE %s.\"%s\" ADD COLUMN IF NOT EXISTS \"%s\" %s GENERATED ALWAYS AS ((properties#>>'{%s}')::%s) STORED;",
+		schema, resource, gp.Name, gp.Type, strings.Join(path, ","), gp.Type)
+	createQuery += fmt.Sprintf("CREATE index IF NOT EXISTS %s ON %s.\"%s\"(%s);",
+		index, schema, resource, gp.Name)
+	return generatedColumn{dataType: dataType, createQuery: createQuery, index: index}, nil
+}
+
+// managedIndexPrefixes returns the name prefixes of the property indices kurbisio creates
+// for a resource. Indices with these prefixes which are not part of the desired layout are
+// left-overs from a previous configuration.
+func (l *schemaLayout) managedIndexPrefixes() []string {
+	return []string{
+		"searchable_property_" + l.this + "_",
+		"external_index_" + l.this + "_",
+		"generated_property_" + l.this + "_",
+		"partial_index_" + l.this + "_",
+	}
+}
+
+// postgresIdentifier returns the identifier as postgres stores it: unquoted identifiers are
+// folded to lower case and truncated.
+func postgresIdentifier(name string) string {
+	name = strings.ToLower(name)
+	if len(name) > postgresMaxIdentifierLength {
+		name = name[:postgresMaxIdentifierLength]
+	}
+	return name
+}
+
+// reconcileSchema detects drift between the existing database table of a resource and its
+// desired layout. It is called after the idempotent create statements have been executed,
+// so all desired columns and indices exist at that point.
+//
+// Safe migrations are applied: property indices which are no longer part of the configuration,
+// for example because a searchable property became a static property or the external index
+// was changed, are dropped. Unsafe migrations are never applied automatically, instead a warning
+// with the required manual action is logged. This covers columns of removed properties, which
+// still contain data, and columns with an unexpected type.
+//
+// Generated columns only contain data derived from the JSON document. They are dropped when they
+// are no longer configured, and recreated when their type changed. The foreign key to the parent
+// resource is replaced when the configured action on parent delete changed.
+func (b *Backend) reconcileSchema(layout schemaLayout) {
+	nillog := logger.FromContext(nil)
+	schema := b.db.Schema
+
+	b.reconcileParentDelete(layout)
+	b.reconcileCheckConstraints(layout)
+
+	known := map[string]bool{}
+	for _, column := range layout.coreColumns {
+		known[column] = true
+	}
+	properties := map[string]bool{}
+	for _, column := range layout.propertyColumns {
+		properties[column] = true
+	}
+
+	rows, err := b.db.Query(
+		"SELECT column_name, data_type, is_generated FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2;",
+		schema, layout.resource)
+	if err != nil {
+		nillog.WithError(err).Errorf("cannot read columns of %s to detect schema drift", layout.resource)
+		return
+	}
+	var migrations []string
+	for rows.Next() {
+		var column, dataType, isGenerated string
+		if err = rows.Scan(&column, &dataType, &isGenerated); err != nil {
+			nillog.WithError(err).Errorf("cannot read columns of %s to detect schema drift", layout.resource)
+			rows.Close()
+			return
+		}
+		if known[column] {
+			continue
+		}
+		if generated, ok := layout.generatedColumns[column]; ok {
+			if isGenerated != "ALWAYS" {
+				nillog.Warnf("schema drift in %s: generated property \"%s\" conflicts with an existing column which still contains data. "+
+					"Rename the generated property or drop the column manually with: ALTER TABLE %s.\"%s\" DROP COLUMN \"%s\";",
+					layout.resource, column, schema, layout.resource, column)
+			} else if dataType != generated.dataType {
+				nillog.Infof("schema migration in %s: recreate generated column \"%s\" with type %s", layout.resource, column, generated.dataType)
+				migrations = append(migrations,
+					fmt.Sprintf("ALTER TABLE %s.\"%s\" DROP COLUMN \"%s\";", schema, layout.resource, column)+generated.createQuery)
+			}
+			continue
+		}
+		if isGenerated == "ALWAYS" {
+			nillog.Infof("schema migration in %s: drop generated column \"%s\" which is no longer part of the configuration", layout.resource, column)
+			migrations = append(migrations,
+				fmt.Sprintf("ALTER TABLE %s.\"%s\" DROP COLUMN \"%s\";", schema, layout.resource, column))
+			continue
+		}
+		if !properties[column] {
+			nillog.Warnf("schema drift in %s: column \"%s\" is no longer part of the configuration and still contains data. "+
+				"Restore the property or drop the column manually with: ALTER TABLE %s.\"%s\" DROP COLUMN \"%s\";",
+				layout.resource, column, schema, layout.resource, column)
+			continue
+		}
+		if dataType != "character varying" {
+			nillog.Warnf("schema drift in %s: property column \"%s\" has type %s, expected character varying. "+
+				"Convert the column manually with: ALTER TABLE %s.\"%s\" ALTER COLUMN \"%s\" TYPE varchar;",
+				layout.resource, column, dataType, schema, layout.resource, column)
+		}
+	}
+	rows.Close()
+
+	for _, migration := range migrations {
+		if _, err = b.db.Exec(migration); err != nil {
+			nillog.WithError(err).Warnf("schema drift in %s: cannot apply migration: %s", layout.resource, migration)
+		}
+	}
+
+	desiredIndices := map[string]bool{}
+	for _, index := range layout.indices {
+		desiredIndices[postgresIdentifier(index)] = true
+	}
+	prefixes := layout.managedIndexPrefixes()
+
+	rows, err = b.db.Query(
+		"SELECT indexname FROM pg_indexes WHERE schemaname = $1 AND tablename = $2;",
+		schema, layout.resource)
+	if err != nil {
+		nillog.WithError(err).Errorf("cannot read indices of %s to detect schema drift", layout.resource)
+		return
+	}
+	var staleIndices []string
+	for rows.Next() {
+		var index string
+		if err = rows.Scan(&index); err != nil {
+			nillog.WithError(err).Errorf("cannot read indices of %s to detect schema drift", layout.resource)
+			rows.Close()
+			return
+		}
+		if desiredIndices[index] {
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(index, postgresIdentifier(prefix)) {
+				staleIndices = append(staleIndices, index)
+				break
+			}
+		}
+	}
+	rows.Close()
+
+	for _, index := range staleIndices {
+		nillog.Infof("schema migration in %s: drop index %s which is no longer part of the configuration", layout.resource, index)
+		_, err = b.db.Exec(fmt.Sprintf("DROP INDEX IF EXISTS %s.\"%s\";", schema, index))
+		if err != nil {
+			nillog.WithError(err).Warnf("schema drift in %s: cannot drop stale index %s. Drop it manually with: DROP INDEX %s.\"%s\";",
+				layout.resource, index, schema, index)
+		}
+	}
+}
+
+// reconcileCheckConstraints drops the check constraints of a resource which are no longer part of the
+// configuration. Dropping a constraint is always safe, it does not touch any data.
+func (b *Backend) reconcileCheckConstraints(layout schemaLayout) {
+	nillog := logger.FromContext(nil)
+	schema := b.db.Schema
+
+	desired := map[string]bool{}
+	for _, name := range layout.checkConstraints {
+		desired[postgresIdentifier(name)] = true
+	}
+	rows, err := b.db.Query(
+		"SELECT constraint_name FROM information_schema.table_constraints WHERE table_schema = $1 AND table_name = $2 AND constraint_type = 'CHECK';",
+		schema, layout.resource)
+	if err != nil {
+		nillog.WithError(err).Errorf("cannot read check constraints of %s to detect schema drift", layout.resource)
+		return
+	}
+	var stale []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			nillog.WithError(err).Errorf("cannot read check constraints of %s to detect schema drift", layout.resource)
+			rows.Close()
+			return
+		}
+		if !desired[name] && strings.HasPrefix(name, postgresIdentifier(checkConstraintPrefix(layout.this))) {
+			stale = append(stale, name)
+		}
+	}
+	rows.Close()
+
+	for _, name := range stale {
+		nillog.Infof("schema migration in %s: drop check constraint %s which is no longer part of the configuration", layout.resource, name)
+		_, err = b.db.Exec(fmt.Sprintf("ALTER TABLE %s.\"%s\" DROP CONSTRAINT IF EXISTS \"%s\";", schema, layout.resource, name))
+		if err != nil {
+			nillog.WithError(err).Warnf("schema drift in %s: cannot drop stale check constraint %s", layout.resource, name)
+		}
+	}
+}
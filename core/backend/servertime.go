@@ -0,0 +1,92 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/mux"
+
+	"github.com/relabs-tech/kurbisio/core/access"
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// handleTime installs the /time route, which returns the current time of the server. Clients use it to
+// compensate the skew of their own clock when they compute from and until parameters.
+func (b *Backend) handleTime(router *mux.Router) {
+	logger.Default().Debugln("time")
+	logger.Default().Debugln("  handle time route: /time GET")
+	router.HandleFunc("/time", func(w http.ResponseWriter, r *http.Request) {
+		if b.authorizationEnabled {
+			auth := access.AuthorizationFromContext(r.Context())
+			if !auth.HasRoles() { // time is authorized to everybody
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		data, _ := json.Marshal(map[string]string{"now": time.Now().UTC().Format(time.RFC3339Nano)})
+		w.Write(data)
+	}).Methods(http.MethodOptions, http.MethodGet)
+}
+
+// setServerTime adds the header Kurbisio-Server-Time with the current time of the server to a list
+// response, if the backend was built with ServerTimeHeader. Lists call it before they query the
+// database, so the time never lies after the items of the response were read.
+func (b *Backend) setServerTime(w http.ResponseWriter) {
+	if b.serverTimeHeader {
+		w.Header().Set("Kurbisio-Server-Time", time.Now().UTC().Format(time.RFC3339Nano))
+	}
+}
+
+// relativeTimePattern matches relative times like now-7d, see parseTimeParameter
+var relativeTimePattern = regexp.MustCompile(`^now(?:([+-])(\d+)([smhdw]))?$`)
+
+// relativeTimeUnits are the units of relative times
+var relativeTimeUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// parseTimeParameter parses the value of a from or until query parameter. Besides RFC3339 timestamps, it
+// accepts times relative to the server clock: "now", "now" plus or minus a number of seconds, minutes, hours,
+// days or weeks like "now-7d" or "now+1h", and "today" for the start of the current day in UTC.
+func parseTimeParameter(value string) (time.Time, error) {
+	if value == "today" {
+		return time.Now().UTC().Truncate(24 * time.Hour), nil
+	}
+	if !strings.HasPrefix(value, "now") {
+		return time.Parse(time.RFC3339, value)
+	}
+	match := relativeTimePattern.FindStringSubmatch(value)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("cannot parse relative time '%s', must be like now, now-7d or now+1h with unit s, m, h, d or w", value)
+	}
+	now := time.Now().UTC()
+	if match[1] == "" {
+		return now, nil
+	}
+	n, err := strconv.Atoi(match[2])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse relative time '%s': %w", value, err)
+	}
+	offset := time.Duration(n) * relativeTimeUnits[match[3]]
+	if match[1] == "-" {
+		offset = -offset
+	}
+	return now.Add(offset), nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/relabs-tech/kurbisio/core/backend"
+)
+
+func TestServerTime(t *testing.T) {
+	var response struct {
+		Now time.Time `json:"now"`
+	}
+	before := time.Now()
+	if _, err := testService.client.RawGet("/time", &response); err != nil {
+		t.Fatal(err)
+	}
+	assert.WithinDuration(t, before, response.Now, time.Minute)
+
+	// without the builder option, lists have no server time header
+	_, header, err := testService.client.RawGetWithHeader("/as", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, header.Get("Kurbisio-Server-Time"))
+}
+
+func TestServerTimeHeader(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "item"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestServiceWithBuilder(configurationJSON, t.Name(), func(b *backend.Builder) {
+		b.ServerTimeHeader = true
+	})
+	defer testService.Db.Close()
+
+	_, header, err := testService.client.RawGetWithHeader("/items", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverTime, err := time.Parse(time.RFC3339Nano, header.Get("Kurbisio-Server-Time"))
+	if assert.NoError(t, err) {
+		assert.WithinDuration(t, time.Now(), serverTime, time.Minute)
+	}
+}
+
+func TestRelativeTimeParameters(t *testing.T) {
+	var configurationJSON = `{
+		"collections": [
+		  {
+			"resource": "item"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(configurationJSON, t.Name())
+	defer testService.Db.Close()
+
+	old := map[string]interface{}{"name": "old", "timestamp": time.Now().Add(-10 * 24 * time.Hour).UTC().Format(time.RFC3339)}
+	if _, err := testService.client.RawPost("/items", old, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testService.client.RawPost("/items", map[string]interface{}{"name": "new"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(query string) []string {
+		var items []map[string]interface{}
+		if _, err := testService.client.RawGet("/items?"+query, &items); err != nil {
+			t.Fatal(err)
+		}
+		result := []string{}
+		for _, item := range items {
+			result = append(result, item["name"].(string))
+		}
+		return result
+	}
+	assert.Equal(t, []string{"new"}, names("from=now-7d"))
+	assert.Equal(t, []string{"old"}, names("until=now-1w"))
+	assert.Equal(t, []string{"new", "old"}, names("until=now"))
+	assert.Equal(t, []string{}, names("from=now%2B1h"))
+
+	for _, query := range []string{"from=now-7x", "until=now-d", "from=yesterday"} {
+		status, _ := testService.client.RawGet("/items?"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+
+	if _, err := testService.client.RawDelete("/items?until=now-7d"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"new"}, names(""))
+}
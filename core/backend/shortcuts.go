@@ -0,0 +1,85 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/mux"
+
+	"github.com/relabs-tech/kurbisio/core"
+	"github.com/relabs-tech/kurbisio/core/access"
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// ShortcutInfo describes a shortcut which the caller can use. Prefix is the path of the shortcut, and Path
+// the path of the target resource it stands for, both including the base path.
+type ShortcutInfo struct {
+	Shortcut string `json:"shortcut"`
+	Target   string `json:"target"`
+	Prefix   string `json:"prefix"`
+	Path     string `json:"path"`
+}
+
+// shortcutAuthorized returns true if auth may use the shortcut, i.e. it is an admin or has one of the
+// shortcut's roles. "everybody" and "public" have the same meaning as in permits.
+func shortcutAuthorized(auth *access.Authorization, sc shortcutConfiguration) bool {
+	authorized := auth.HasRole("admin")
+	for i := 0; i < len(sc.Roles) && !authorized; i++ {
+		role := sc.Roles[i]
+		authorized = (auth.HasRole(role) || (auth.HasRoles() && role == "everybody") || role == "public")
+	}
+	return authorized
+}
+
+// shortcutPath returns the path of the target resource of the shortcut for auth, or false if auth lacks a
+// selector for the target
+func shortcutPath(auth *access.Authorization, sc shortcutConfiguration) (string, bool) {
+	path := ""
+	for _, s := range strings.Split(sc.Target, "/") {
+		id, ok := auth.Selector(s + "_id")
+		if !ok {
+			return "", false
+		}
+		path += "/" + core.Plural(s) + "/" + id
+	}
+	return path, true
+}
+
+// handleShortcuts installs the /shortcuts route, which returns the shortcuts the caller can use, so that
+// clients can build navigation with shortcut URLs. A shortcut is usable if the caller is authorized for
+// it and has selectors for all resources of its target.
+func (b *Backend) handleShortcuts(router *mux.Router) {
+	logger.Default().Debugln("shortcuts")
+	logger.Default().Debugln("  handle shortcuts route: /shortcuts GET")
+	router.HandleFunc("/shortcuts", func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Debugln("called route for", r.URL, r.Method)
+		auth := access.AuthorizationFromContext(r.Context())
+		shortcuts := []ShortcutInfo{}
+		for _, sc := range b.config.Shortcuts {
+			if !shortcutAuthorized(auth, sc) {
+				continue
+			}
+			path, ok := shortcutPath(auth, sc)
+			if !ok {
+				continue
+			}
+			shortcuts = append(shortcuts, ShortcutInfo{
+				Shortcut: sc.Shortcut,
+				Target:   sc.Target,
+				Prefix:   b.basePath + "/" + sc.Shortcut,
+				Path:     b.basePath + path,
+			})
+		}
+		jsonData, _ := json.MarshalWithOption(shortcuts, json.DisableHTMLEscape())
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(jsonData)
+	}).Methods(http.MethodOptions, http.MethodGet)
+}
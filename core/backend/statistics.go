@@ -7,9 +7,11 @@
 package backend
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/goccy/go-json"
@@ -87,6 +89,7 @@ func (b *Backend) statisticsWithAuth(w http.ResponseWriter, r *http.Request) {
 	var err error
 	urlQuery := r.URL.Query()
 	filter := map[string]bool{}
+	approximate := false
 	for key, array := range urlQuery {
 		if key != "resource" && len(array) > 1 {
 			http.Error(w, "illegal parameter array '"+key+"'", http.StatusBadRequest)
@@ -109,6 +112,8 @@ func (b *Backend) statisticsWithAuth(w http.ResponseWriter, r *http.Request) {
 					}
 				}
 			}
+		case "approximate":
+			approximate, err = strconv.ParseBool(array[0])
 		default:
 			err = fmt.Errorf("unknown")
 		}
@@ -119,18 +124,28 @@ func (b *Backend) statisticsWithAuth(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	queryStatisticsFromDB := func(stats *[]ResourceStatistics, resources sort.StringSlice) {
+	// the statistics scan complete tables, which can take very long for big resources. We rather give
+	// up and let the client retry, possibly with approximate counts.
+	ctx, cancel := context.WithTimeout(r.Context(), b.statisticsTimeout)
+	defer cancel()
+
+	queryStatisticsFromDB := func(stats *[]ResourceStatistics, resources sort.StringSlice) error {
 		*stats = []ResourceStatistics{} // do not return null in json, but empty array
 		for _, resource := range resources {
 			if len(filter) > 0 && filter[resource] == false {
 				continue
 			}
-			row := b.db.QueryRow(fmt.Sprintf(`SELECT pg_total_relation_size('%s."%s"'), count(*) FROM %s."%s" `, b.db.Schema, resource, b.db.Schema, resource))
+			relation := fmt.Sprintf(`%s."%s"`, b.db.Schema, resource)
+			query := fmt.Sprintf(`SELECT pg_total_relation_size('%s'), count(*) FROM %s`, relation, relation)
+			if approximate {
+				// reltuples is the row estimate of the planner, -1 if the table was never analyzed
+				query = fmt.Sprintf(`SELECT pg_total_relation_size('%s'), GREATEST(reltuples, 0)::bigint FROM pg_class WHERE oid = '%s'::regclass`,
+					relation, relation)
+			}
+			row := b.db.QueryRowContext(ctx, query)
 			var size, count int64
 			if err := row.Scan(&size, &count); err != nil {
-				logger.FromContext(nil).WithError(err).Errorln("Error 4028: Scan")
-				http.Error(w, "Error 4028: ", http.StatusInternalServerError)
-				return
+				return err
 			}
 			var averageSize float64 = 0
 			if count != 0 {
@@ -144,11 +159,33 @@ func (b *Backend) statisticsWithAuth(w http.ResponseWriter, r *http.Request) {
 				AverageSizeB: averageSize,
 			})
 		}
+		return nil
+	}
+	for _, q := range []struct {
+		stats     *[]ResourceStatistics
+		resources sort.StringSlice
+	}{
+		{&s.Collections, collections},
+		{&s.Singletons, singletons},
+		{&s.Relations, relations},
+		{&s.Blobs, blobs},
+	} {
+		if err = queryStatisticsFromDB(q.stats, q.resources); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			logger.FromContext(r.Context()).Warnf("statistics timed out after %s", b.statisticsTimeout)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+			http.Error(w, fmt.Sprintf("statistics timed out after %s, retry later or use approximate=true", b.statisticsTimeout),
+				http.StatusServiceUnavailable)
+			return
+		}
+		logger.FromContext(r.Context()).WithError(err).Errorln("Error 4028: Scan")
+		http.Error(w, "Error 4028: ", databaseErrorStatus(w, err))
+		return
 	}
-	queryStatisticsFromDB(&s.Collections, collections)
-	queryStatisticsFromDB(&s.Singletons, singletons)
-	queryStatisticsFromDB(&s.Relations, relations)
-	queryStatisticsFromDB(&s.Blobs, blobs)
 
 	jsonData, _ := json.Marshal(s)
 	etag := bytesToEtag(jsonData)
@@ -7,10 +7,12 @@
 package backend_test
 
 import (
+	"net/http"
 	"reflect"
 	"sort"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/relabs-tech/kurbisio/core/backend"
 )
@@ -149,6 +151,44 @@ func TestStatisticsFiltered(t *testing.T) {
 
 }
 
+// TestStatisticsApproximate verifies that the statistics can use approximate counts
+func TestStatisticsApproximate(t *testing.T) {
+
+	testService := CreateTestService(configurationJSON, t.Name())
+	defer testService.Db.Close()
+
+	var stats backend.StatisticsDetails
+	status, err := testService.client.WithAdminAuthorization().RawGet("/kurbisio/statistics?resource=a&approximate=true", &stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	s := getResourceByName("a", stats)
+	if s == nil || s.Count < 0 {
+		t.Fatalf("unexpected statistics %v", stats)
+	}
+}
+
+// TestStatisticsTimeout verifies that the statistics fail with 503 if they take longer than the StatisticsTimeout
+func TestStatisticsTimeout(t *testing.T) {
+
+	testService := CreateTestServiceWithBuilder(configurationJSON, t.Name(), func(b *backend.Builder) {
+		b.StatisticsTimeout = time.Nanosecond
+	})
+	defer testService.Db.Close()
+
+	var stats backend.StatisticsDetails
+	status, h, _ := testService.client.WithAdminAuthorization().RawGetWithHeader("/kurbisio/statistics", map[string]string{}, &stats)
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, status)
+	}
+	if h.Get("Retry-After") == "" {
+		t.Fatal("Retry-After is empty")
+	}
+}
+
 func getResourceByName(name string, stats backend.StatisticsDetails) *backend.ResourceStatistics {
 	for _, r := range stats.Collections {
 		if r.Resource == name {
@@ -172,3 +212,59 @@ func getResourceByName(name string, stats backend.StatisticsDetails) *backend.Re
 	}
 	return nil
 }
+
+// TestIndexAdvice verifies that filters on properties of the JSON document are counted
+func TestIndexAdvice(t *testing.T) {
+	jsonConfig := `{
+		"collections": [
+		  {
+			"resource": "item",
+			"searchable_properties": ["label"]
+		  },
+		  {
+			"resource": "other"
+		  }
+		]
+	  }
+	`
+	testService := CreateTestService(jsonConfig, t.Name())
+	defer testService.Db.Close()
+
+	for _, path := range []string{"/items?filter=name=a", "/items?filter=name=b", "/items?filter=color=red", "/items?filter=label=x", "/others?filter=name=a"} {
+		if _, err := testService.client.RawGet(path, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var advice backend.IndexAdviceResponse
+	if _, err := testService.client.RawGet("/kurbisio/debug/index-advice?resource=item", &advice); err != nil {
+		t.Fatal(err)
+	}
+	// label is searchable already, and other was not requested
+	if len(advice.Advice) != 2 {
+		t.Fatalf("unexpected advice %v", advice.Advice)
+	}
+	if advice.Advice[0].Property != "name" || advice.Advice[0].Count != 2 {
+		t.Fatalf("unexpected advice %v", advice.Advice[0])
+	}
+	if advice.Advice[1].Property != "color" || advice.Advice[1].Count != 1 {
+		t.Fatalf("unexpected advice %v", advice.Advice[1])
+	}
+
+	if status, _ := testService.client.RawGet("/kurbisio/debug/index-advice?resource=unknown", nil); status != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d", status)
+	}
+
+	// the number of counted properties is limited, since clients choose the property names
+	for i := 0; i < 120; i++ {
+		if _, err := testService.client.RawGet("/others?filter=p"+strconv.Itoa(i)+"=a", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := testService.client.RawGet("/kurbisio/debug/index-advice?resource=other", &advice); err != nil {
+		t.Fatal(err)
+	}
+	if len(advice.Advice) != 100 {
+		t.Fatalf("unexpected number of advice %d", len(advice.Advice))
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// handleRequestTimeout installs a middleware which limits every request to the configured request
+// timeout. The handlers pass the request context to all database calls, so a request which exceeds
+// its deadline is cancelled in the database. Its error response is then replaced with 503 (Service
+// Unavailable) and a Retry-After header. Routes exempted with withoutTimeout are not limited.
+func (b *Backend) handleRequestTimeout() {
+	if b.requestTimeout <= 0 {
+		return
+	}
+	timeoutMiddleware := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil && b.untimedRoutes[route] {
+				h.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), b.requestTimeout)
+			defer cancel()
+			tw := &timeoutResponseWriter{
+				ResponseWriter: w,
+				ctx:            ctx,
+				timeout:        b.requestTimeout,
+			}
+			h.ServeHTTP(tw, r.WithContext(ctx))
+			if !tw.wroteHeader && ctx.Err() == context.DeadlineExceeded {
+				tw.WriteHeader(http.StatusServiceUnavailable)
+			}
+		})
+	}
+	b.router.Use(timeoutMiddleware)
+}
+
+// withoutTimeout exempts route from the request timeout. It is meant for routes which stream big bodies
+// and legitimately take longer than any sensible timeout, where a deadline would truncate the body.
+func (b *Backend) withoutTimeout(route *mux.Route) {
+	b.untimedRoutes[route] = true
+}
+
+// timeoutResponseWriter replaces server errors with 503 (Service Unavailable) once the deadline
+// of the request context has passed
+type timeoutResponseWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	timeout     time.Duration
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (t *timeoutResponseWriter) WriteHeader(status int) {
+	if t.wroteHeader {
+		return
+	}
+	t.wroteHeader = true
+	if status < http.StatusInternalServerError || t.ctx.Err() != context.DeadlineExceeded {
+		t.ResponseWriter.WriteHeader(status)
+		return
+	}
+	t.timedOut = true
+	t.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+	t.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	t.Header().Set("X-Content-Type-Options", "nosniff")
+	t.Header().Del("Content-Length")
+	t.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(t.ResponseWriter, "request timed out after %s\n", t.timeout)
+}
+
+func (t *timeoutResponseWriter) Write(b []byte) (int, error) {
+	if !t.wroteHeader {
+		t.WriteHeader(http.StatusOK)
+	}
+	if t.timedOut {
+		// the original error message is replaced
+		return len(b), nil
+	}
+	return t.ResponseWriter.Write(b)
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// TrailingSlash selects how the backend handles request paths with a trailing slash, see Builder.TrailingSlash
+type TrailingSlash int
+
+const (
+	// TrailingSlashStrict treats a path with a trailing slash as a different path, e.g. /users/ is not found
+	TrailingSlashStrict TrailingSlash = iota
+	// TrailingSlashRedirect redirects a path with a trailing slash to the path without it, with
+	// 308 (Permanent Redirect), so that clients repeat the request with the same method and body
+	TrailingSlashRedirect
+	// TrailingSlashRewrite serves a path with a trailing slash as if it had none
+	TrailingSlashRewrite
+)
+
+// handleTrailingSlash installs a not found handler which redirects or rewrites paths with trailing slashes to
+// the path without them, if that path has a route. The handler must be a not found handler, since the router
+// does not call middlewares for requests which match no route. Any previous not found handler still serves the
+// paths which are not found either way.
+func (b *Backend) handleTrailingSlash(mode TrailingSlash) {
+	if mode == TrailingSlashStrict {
+		return
+	}
+	notFound := b.router.NotFoundHandler
+	if notFound == nil {
+		notFound = http.NotFoundHandler()
+	}
+	b.router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimRight(r.URL.Path, "/")
+		if path == r.URL.Path || path == "" {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		trimmed := r.Clone(r.Context())
+		trimmed.URL.Path = path
+		trimmed.URL.RawPath = strings.TrimRight(r.URL.RawPath, "/")
+		var match mux.RouteMatch
+		b.router.Match(trimmed, &match)
+		if match.MatchErr != nil && match.MatchErr != mux.ErrMethodMismatch {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		if mode == TrailingSlashRedirect {
+			location := trimmed.URL.EscapedPath()
+			if r.URL.RawQuery != "" {
+				location += "?" + r.URL.RawQuery
+			}
+			logger.FromContext(r.Context()).Debugln("redirect trailing slash to", location)
+			http.Redirect(w, r, location, http.StatusPermanentRedirect)
+			return
+		}
+		logger.FromContext(r.Context()).Debugln("rewrite trailing slash to", trimmed.URL)
+		b.router.ServeHTTP(w, trimmed)
+	})
+}
@@ -31,7 +31,13 @@ func UpdateTestService(config, schemaName string) *TestService {
 	return createTestServiceInternal(config, schemaName, false) // keep schema
 }
 
-func createTestServiceInternal(config, schemaName string, clearSchema bool) *TestService {
+// CreateTestServiceWithBuilder creates a new service like CreateTestService, but lets modify
+// adjust the builder before the backend is created
+func CreateTestServiceWithBuilder(config, schemaName string, modify func(*backend.Builder)) *TestService {
+	return createTestServiceInternal(config, schemaName, true, modify) // clear schema
+}
+
+func createTestServiceInternal(config, schemaName string, clearSchema bool, modifiers ...func(*backend.Builder)) *TestService {
 
 	s := TestService{}
 	if err := envdecode.Decode(&s); err != nil {
@@ -62,6 +68,9 @@ func createTestServiceInternal(config, schemaName string, clearSchema bool) *Tes
 			},
 		},
 	}
+	for _, modify := range modifiers {
+		modify(&builder)
+	}
 	s.backend = backend.New(&builder)
 	s.client = client.NewWithRouter(s.Router).WithAdminAuthorization()
 	s.clientNoAuth = client.NewWithRouter(s.Router)
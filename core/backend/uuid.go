@@ -0,0 +1,41 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newUUIDv7 returns a time-ordered UUID version 7 as specified in RFC 9562: the first 48 bits are the
+// unix time in milliseconds, the remaining bits are random apart from version and variant. Identifiers
+// created later sort after earlier ones, so new rows are appended to the end of the primary key index
+// instead of being scattered across it.
+func newUUIDv7() uuid.UUID {
+	var id uuid.UUID
+	if _, err := rand.Read(id[6:]); err != nil {
+		return uuid.New()
+	}
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(time.Now().UnixMilli()))
+	copy(id[:6], timestamp[2:])
+	id[6] = (id[6] & 0x0f) | 0x70 // version 7
+	id[8] = (id[8] & 0x3f) | 0x80 // variant RFC 4122
+	return id
+}
+
+// newPrimaryID returns a new primary identifier of the given UUID version. Version 7 is time-ordered,
+// every other version creates a random version 4 UUID.
+func newPrimaryID(version int) uuid.UUID {
+	if version == 7 {
+		return newUUIDv7()
+	}
+	return uuid.New()
+}
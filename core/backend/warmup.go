@@ -0,0 +1,64 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/relabs-tech/kurbisio/core/logger"
+)
+
+// warmUpTimeout limits how long the warm-up may delay the startup
+const warmUpTimeout = 60 * time.Second
+
+// warmUpQuery is a hot statement of a resource, which the warm-up prepares
+type warmUpQuery struct {
+	resource string
+	query    string
+}
+
+// registerWarmUp declares the hot statements of resource, typically read, list, insert and update
+func (b *Backend) registerWarmUp(resource string, queries ...string) {
+	for _, query := range queries {
+		b.warmUpQueries = append(b.warmUpQueries, warmUpQuery{resource: resource, query: query})
+	}
+}
+
+// warmUp prepares the hot statements of all resources, so that the first requests do not pay for parsing,
+// planning and loading the table metadata into the database connection. With analyze, it also updates the
+// planner statistics of the resource tables. Failures are logged and do not prevent the startup.
+func (b *Backend) warmUp(analyze bool) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), warmUpTimeout)
+	defer cancel()
+
+	conn, err := b.db.Conn(ctx)
+	if err != nil {
+		logger.Default().WithError(err).Errorln("Error 4826: cannot get connection for warm-up")
+		return
+	}
+	defer conn.Close()
+
+	resources := map[string]bool{}
+	for _, wq := range b.warmUpQueries {
+		if analyze && !resources[wq.resource] {
+			if _, err := conn.ExecContext(ctx, fmt.Sprintf("ANALYZE %s.\"%s\";", b.db.Schema, wq.resource)); err != nil {
+				logger.Default().WithError(err).Errorf("Error 4826: cannot analyze %s", wq.resource)
+			}
+		}
+		resources[wq.resource] = true
+		stmt, err := conn.PrepareContext(ctx, wq.query)
+		if err != nil {
+			logger.Default().WithError(err).Errorf("Error 4826: cannot prepare statement of %s: %s", wq.resource, wq.query)
+			continue
+		}
+		stmt.Close()
+	}
+	logger.Default().Infof("warmed up %d statements of %d resources in %v", len(b.warmUpQueries), len(resources), time.Since(start))
+}
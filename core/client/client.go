@@ -39,9 +39,11 @@ type Client struct {
 	router     *mux.Router
 	httpClient *http.Client
 	url        string
+	basePath   string
 	token      string
 	auth       *access.Authorization
 	ctx        context.Context
+	silent     bool
 }
 
 // NewWithRouter creates a client to make pseudo-REST requests to the backend,
@@ -99,12 +101,30 @@ func (c Client) WithAuthorization(auth *access.Authorization) Client {
 	return c
 }
 
+// WithBasePath returns a new client for a backend which is mounted under basePath, see
+// backend.Builder.BasePath. The base path is prepended to all request paths.
+func (c Client) WithBasePath(basePath string) Client {
+	c.basePath = strings.TrimSuffix(basePath, "/")
+	return c
+}
+
 // WithContext returns a new client with specific request context
 func (c Client) WithContext(ctx context.Context) Client {
 	c.ctx = ctx
 	return c
 }
 
+// Silent returns a new client which suppresses the notifications of all its create, update and
+// delete requests, like the query parameter silent=true does for a single request. The same is
+// achieved for a client with a context created by core.ContextWithSilent.
+//
+// This is useful for large imports, which would otherwise overwhelm the notification handlers.
+// Schedule a single event after the import instead.
+func (c Client) Silent() Client {
+	c.silent = true
+	return c
+}
+
 func (c Client) context() context.Context {
 	ctx := c.ctx
 	if c.ctx == nil {
@@ -113,9 +133,24 @@ func (c Client) context() context.Context {
 	if c.auth != nil {
 		ctx = access.ContextWithAuthorization(ctx, c.auth)
 	}
+	if c.silent {
+		ctx = core.ContextWithSilent(ctx)
+	}
 	return ctx
 }
 
+// requestURL returns the URL for path. The context does not reach a remote backend, hence
+// a silent client adds the query parameter silent=true.
+func (c Client) requestURL(path string) string {
+	if c.router != nil || !(c.silent || (c.ctx != nil && core.SilentFromContext(c.ctx))) {
+		return c.url + c.basePath + path
+	}
+	if strings.Contains(path, "?") {
+		return c.url + c.basePath + path + "&silent=true"
+	}
+	return c.url + c.basePath + path + "?silent=true"
+}
+
 // Collection represents a collection of particular resource
 type Collection struct {
 	prefix     string
@@ -370,6 +405,44 @@ func (r Collection) List(result interface{}) (int, error) {
 	return r.client.RawGet(r.CollectionPath(), result)
 }
 
+// PaginationInfo holds the pagination headers of a list response. Fields are zero
+// if the response does not carry the respective header, e.g. PageCount for random samples.
+type PaginationInfo struct {
+	Limit       int
+	TotalCount  int
+	PageCount   int
+	CurrentPage int
+	// Until is the timestamp of the first item in the response. Pass it as until-parameter
+	// when querying the following pages, to avoid page drift.
+	Until time.Time
+}
+
+// ListWithPagination lists all items of a collection like List, and additionally returns
+// the pagination information of the response.
+//
+// Expects http.StatusOK as response, otherwise it will
+// flag an error. Returns the actual http status code.
+//
+// result can be map[string]interface{} or a raw *[]byte.
+func (r Collection) ListWithPagination(result interface{}) (PaginationInfo, int, error) {
+	var info PaginationInfo
+	status, header, err := r.client.RawGetWithHeader(r.CollectionPath(), map[string]string{}, result)
+	if err != nil {
+		return info, status, err
+	}
+	info.Limit, _ = strconv.Atoi(header.Get("Pagination-Limit"))
+	info.TotalCount, _ = strconv.Atoi(header.Get("Pagination-Total-Count"))
+	info.PageCount, _ = strconv.Atoi(header.Get("Pagination-Page-Count"))
+	info.CurrentPage, _ = strconv.Atoi(header.Get("Pagination-Current-Page"))
+	if until := header.Get("Pagination-Until"); until != "" {
+		info.Until, err = time.Parse(time.RFC3339Nano, until)
+		if err != nil {
+			return info, status, fmt.Errorf("invalid Pagination-Until header: %w", err)
+		}
+	}
+	return info, status, nil
+}
+
 // Item represents a single item in a collection
 type Item struct {
 	col         Collection
@@ -505,6 +578,59 @@ func (r Item) Upsert(body interface{}, result interface{}) (int, error) {
 	return r.col.client.RawPut(r.Path(), body, result)
 }
 
+// ConflictError is returned by UpsertIfRevision if the revision of the item does not match.
+// Object is the current version of the item.
+type ConflictError struct {
+	Path   string
+	Object json.RawMessage
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflict while writing to path:'%s', current object: %s", e.Path, string(e.Object))
+}
+
+// UpsertIfRevision updates an item only if its current revision is revision. It sets the revision
+// property of body and then works like Upsert.
+//
+// If the item has a different revision, the conflicting version of the item is returned as result
+// and the error is a *ConflictError which contains it. This makes it simple to implement
+// read-modify-write loops: modify the conflicting object and try again.
+//
+// body can also be a []byte, result can also be raw *[]byte.
+// result can be nil.
+func (r Item) UpsertIfRevision(body interface{}, revision int, result interface{}) (int, error) {
+	j, ok := body.([]byte)
+	if !ok {
+		var err error
+		j, err = json.Marshal(body)
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("PUT to %s: %w", r.Path(), err)
+		}
+	}
+	var bodyJSON map[string]interface{}
+	if err := json.Unmarshal(j, &bodyJSON); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("PUT to %s: %w", r.Path(), err)
+	}
+	bodyJSON["revision"] = revision
+
+	var resBody []byte
+	status, err := r.col.client.RawPut(r.Path(), bodyJSON, &resBody)
+	if status != http.StatusConflict && err != nil {
+		return status, err
+	}
+	if resBody != nil && result != nil {
+		if raw, ok := result.(*[]byte); ok {
+			*raw = resBody
+		} else if err := json.Unmarshal(resBody, result); err != nil {
+			return status, err
+		}
+	}
+	if status == http.StatusConflict {
+		return status, &ConflictError{Path: r.Path(), Object: resBody}
+	}
+	return status, nil
+}
+
 // UpdateProperty updates a single static property in the fastest possible
 // way. Note: this method does trigger an update resource notificatino, but
 // not with the entire object, only with the updated property.
@@ -592,6 +718,62 @@ func (p Page) Next() Page {
 	}
 }
 
+// Window is a requester for the items of a collection within a time window. The window starts
+// with from and ends before until, so that adjacent windows do not overlap.
+type Window struct {
+	r     Collection
+	from  time.Time
+	until time.Time
+}
+
+// Window returns a requester for the items of a collection with a timestamp from start up to, but
+// excluding, end. Iterate over adjacent windows of the same length with Next and Previous, e.g.
+// day by day:
+//
+//	for window := collection.Window(day, day.AddDate(0, 0, 1)); window.From().Before(end); window = window.Next() {
+//		...
+//	}
+//
+// Do not specify the from and until parameters when using the window requester, as it manages them itself.
+func (r Collection) Window(start, end time.Time) Window {
+	return Window{r: r, from: start, until: end}
+}
+
+// From returns the start of the window
+func (w Window) From() time.Time {
+	return w.from
+}
+
+// Until returns the end of the window, which is not part of the window
+func (w Window) Until() time.Time {
+	return w.until
+}
+
+// Collection returns the collection client restricted to the window. Use it for example to get
+// multiple pages within the window with FirstPage()
+func (w Window) Collection() Collection {
+	// from and until are both inclusive, and the database stores timestamps with microsecond precision
+	return w.r.WithParameter("from", w.from.UTC().Format(time.RFC3339Nano)).
+		WithParameter("until", w.until.Add(-time.Microsecond).UTC().Format(time.RFC3339Nano))
+}
+
+// List gets the items of the window up until the specified limit.
+//
+// If you potentially need multiple pages, use Collection().FirstPage() instead.
+func (w Window) List(result interface{}) (int, error) {
+	return w.Collection().List(result)
+}
+
+// Next returns the window of the same length which starts where this window ends
+func (w Window) Next() Window {
+	return Window{r: w.r, from: w.until, until: w.until.Add(w.until.Sub(w.from))}
+}
+
+// Previous returns the window of the same length which ends where this window starts
+func (w Window) Previous() Window {
+	return Window{r: w.r, from: w.from.Add(-w.until.Sub(w.from)), until: w.from}
+}
+
 // RawGet gets the resource from path. Expects http.StatusOK as response, otherwise it will
 // flag an error. Returns the actual http status code.
 //
@@ -600,7 +782,7 @@ func (p Page) Next() Page {
 // result can be map[string]interface{} or a raw *[]byte.
 // result can be nil.
 func (c Client) RawGet(path string, result interface{}) (int, error) {
-	r, _ := http.NewRequestWithContext(c.context(), http.MethodGet, c.url+path, nil)
+	r, _ := http.NewRequestWithContext(c.context(), http.MethodGet, c.requestURL(path), nil)
 
 	var err error
 	var res *http.Response
@@ -649,7 +831,7 @@ func (c Client) RawGet(path string, result interface{}) (int, error) {
 // result can be map[string]interface{} or a raw *[]byte.
 // result can be nil.
 func (c Client) RawGetWithHeader(path string, header map[string]string, result interface{}) (int, http.Header, error) {
-	r, _ := http.NewRequestWithContext(c.context(), http.MethodGet, c.url+path, nil)
+	r, _ := http.NewRequestWithContext(c.context(), http.MethodGet, c.requestURL(path), nil)
 	for key, value := range header {
 		r.Header.Add(key, value)
 	}
@@ -701,7 +883,7 @@ func (c Client) RawGetWithHeader(path string, header map[string]string, result i
 //
 // Returns the actual http status code and the return header
 func (c *Client) RawGetBlobWithHeader(path string, header map[string]string, blob *[]byte) (int, http.Header, error) {
-	r, _ := http.NewRequestWithContext(c.context(), http.MethodGet, c.url+path, nil)
+	r, _ := http.NewRequestWithContext(c.context(), http.MethodGet, c.requestURL(path), nil)
 	for key, value := range header {
 		r.Header.Add(key, value)
 	}
@@ -761,7 +943,7 @@ func (c Client) RawPost(path string, body interface{}, result interface{}) (int,
 		}
 	}
 
-	r, _ := http.NewRequestWithContext(c.context(), http.MethodPost, c.url+path, bytes.NewBuffer(j))
+	r, _ := http.NewRequestWithContext(c.context(), http.MethodPost, c.requestURL(path), bytes.NewBuffer(j))
 	var res *http.Response
 	var resBody []byte
 	if c.router != nil {
@@ -802,7 +984,7 @@ func (c Client) RawPost(path string, body interface{}, result interface{}) (int,
 // The path can be extend with query strings.
 func (c Client) RawPostBlob(path string, header map[string]string, blob []byte, result interface{}) (int, error) {
 
-	r, _ := http.NewRequestWithContext(c.context(), http.MethodPost, c.url+path, bytes.NewBuffer(blob))
+	r, _ := http.NewRequestWithContext(c.context(), http.MethodPost, c.requestURL(path), bytes.NewBuffer(blob))
 	for key, value := range header {
 		r.Header.Add(key, value)
 	}
@@ -857,7 +1039,7 @@ func (c Client) RawPut(path string, body interface{}, result interface{}) (int,
 		}
 	}
 
-	r, _ := http.NewRequestWithContext(c.context(), http.MethodPut, c.url+path, bytes.NewBuffer(j))
+	r, _ := http.NewRequestWithContext(c.context(), http.MethodPut, c.requestURL(path), bytes.NewBuffer(j))
 	var res *http.Response
 	var resBody []byte
 	if c.router != nil {
@@ -904,7 +1086,7 @@ func (c Client) RawPut(path string, body interface{}, result interface{}) (int,
 // result can be nil.
 func (c Client) RawPutBlob(path string, header map[string]string, blob []byte, result interface{}) (int, error) {
 
-	r, _ := http.NewRequestWithContext(c.context(), http.MethodPut, c.url+path, bytes.NewBuffer(blob))
+	r, _ := http.NewRequestWithContext(c.context(), http.MethodPut, c.requestURL(path), bytes.NewBuffer(blob))
 	for key, value := range header {
 		r.Header.Add(key, value)
 	}
@@ -956,7 +1138,7 @@ func (c Client) RawPatch(path string, body interface{}, result interface{}) (int
 		}
 	}
 
-	r, _ := http.NewRequestWithContext(c.context(), http.MethodPatch, c.url+path, bytes.NewBuffer(j))
+	r, _ := http.NewRequestWithContext(c.context(), http.MethodPatch, c.requestURL(path), bytes.NewBuffer(j))
 	var res *http.Response
 	var resBody []byte
 	if c.router != nil {
@@ -996,7 +1178,7 @@ func (c Client) RawPatch(path string, body interface{}, result interface{}) (int
 //
 // Returns the actual http status code.
 func (c Client) RawDelete(path string) (int, error) {
-	r, _ := http.NewRequestWithContext(c.context(), http.MethodDelete, c.url+path, nil)
+	r, _ := http.NewRequestWithContext(c.context(), http.MethodDelete, c.requestURL(path), nil)
 	var err error
 	var res *http.Response
 	var resBody []byte
@@ -7,6 +7,7 @@
 package client_test
 
 import (
+	"errors"
 	"net/url"
 	"os"
 	"testing"
@@ -71,6 +72,27 @@ func TestCient_TestClient(t *testing.T) {
 	}
 
 }
+func TestCient_Window(t *testing.T) {
+	client := client.NewWithRouter(nil)
+
+	day := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	window := client.Collection("parent").Window(day, day.AddDate(0, 0, 1))
+	from := url.QueryEscape("2021-03-01T00:00:00Z")
+	until := url.QueryEscape("2021-03-01T23:59:59.999999Z")
+	if p := window.Collection().CollectionPath(); p != "/parents?from="+from+"&until="+until {
+		t.Fatal("unexpected collection path:", p)
+	}
+
+	next := window.Next()
+	if !next.From().Equal(day.AddDate(0, 0, 1)) || !next.Until().Equal(day.AddDate(0, 0, 2)) {
+		t.Fatal("unexpected next window:", next.From(), next.Until())
+	}
+	previous := window.Previous()
+	if !previous.From().Equal(day.AddDate(0, 0, -1)) || !previous.Until().Equal(day) {
+		t.Fatal("unexpected previous window:", previous.From(), previous.Until())
+	}
+}
+
 func TestCient_Page_From(t *testing.T) {
 
 	if err := envdecode.Decode(&testService); err != nil {
@@ -205,6 +227,25 @@ func TestUpsert(t *testing.T) {
 		t.Fatalf("Expecting blablabla, got %s. This means that we were not given back the conflicting object from the DB", result.Foo)
 	}
 
+	// a read-modify-write loop with a stale revision
+	item := cl.Collection("aaa").Item(a.AID)
+	aOld.Foo = "conditional"
+	_, err = item.UpsertIfRevision(&aOld, int(*aOld.Revision), &result)
+	var conflict *client.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("Expecting ConflictError, got %v", err)
+	}
+	if result.Foo != "blablabla" || len(conflict.Object) == 0 {
+		t.Fatalf("Expecting the conflicting object, got %s", result.Foo)
+	}
+	result.Foo = "conditional"
+	_, err = item.UpsertIfRevision(&result, int(*result.Revision), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Foo != "conditional" {
+		t.Fatalf("Expecting conditional, got %s", result.Foo)
+	}
 }
 
 func TestCient_limit(t *testing.T) {
@@ -261,4 +302,15 @@ func TestCient_limit(t *testing.T) {
 		t.Fatalf("Expecting 1 item, got %d", len(as))
 	}
 
+	var firstPage []A
+	info, _, err := cl.Collection("aaa").WithParameter("limit", "10").ListWithPagination(&firstPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Limit != 10 || info.TotalCount != 200 || info.PageCount != 20 || info.CurrentPage != 1 {
+		t.Fatalf("unexpected pagination info %+v", info)
+	}
+	if !info.Until.Equal(firstPage[0].Timestamp) {
+		t.Fatalf("Expecting until %v, got %v", firstPage[0].Timestamp, info.Until)
+	}
 }
@@ -7,6 +7,7 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -44,6 +45,23 @@ func (o *Operation) UnmarshalJSON(data []byte) error {
 	}
 }
 
+type contextKey string
+
+const silentContextKey contextKey = "_silent_"
+
+// ContextWithSilent returns a context which suppresses the notifications of all modifying backend
+// requests made with it, like the query parameter silent=true does for a single request. This is
+// useful for large imports, which can schedule a single event afterwards instead.
+func ContextWithSilent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, silentContextKey, true)
+}
+
+// SilentFromContext returns true if notifications are suppressed for the context
+func SilentFromContext(ctx context.Context) bool {
+	silent, _ := ctx.Value(silentContextKey).(bool)
+	return silent
+}
+
 // Plural returns the plural form of the passed singular string.
 //
 // This is the algorithm used to create idiomatic REST routes
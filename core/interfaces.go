@@ -10,3 +10,10 @@ package core
 type Notifier interface {
 	Notify(resource string, operation Operation, payload []byte)
 }
+
+// NotifierWithError is a Notifier which reports whether a notification was delivered. The outbox relay
+// prefers NotifyWithError over Notify and keeps notifications which failed for the next relay.
+type NotifierWithError interface {
+	Notifier
+	NotifyWithError(resource string, operation Operation, payload []byte) error
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package schema
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ReadDir reads the JSON schema files of dir. Like NewValidatorFromFS, json files in dir are
+// returned as top level schemas, while json files in dir/refs are returned as references.
+// The refs subdirectory is optional.
+func ReadDir(dir string) (schemas []string, refs []string, err error) {
+	readDir := func(dir string) ([]string, error) {
+		var strs []string
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read dir %w", err)
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+				continue
+			}
+			str, err := os.ReadFile(filepath.Join(dir, f.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("cannot read file '%s' %w", f.Name(), err)
+			}
+			strs = append(strs, string(str))
+		}
+		return strs, nil
+	}
+
+	schemas, err = readDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	refsDir := filepath.Join(dir, "refs")
+	if _, err := os.Stat(refsDir); os.IsNotExist(err) {
+		return schemas, nil, nil
+	}
+	refs, err = readDir(refsDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return schemas, refs, nil
+}
+
+// Fetch downloads the JSON schemas at urls, e.g. from a schema registry.
+//
+// If cacheDir is not empty, every downloaded schema is stored in cacheDir. Should a later download
+// fail, for example because the registry is unavailable during a deployment, the cached copy is
+// used instead.
+func Fetch(urls []string, cacheDir string) ([]string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	var schemas []string
+	for _, url := range urls {
+		var cacheFile string
+		if cacheDir != "" {
+			cacheFile = filepath.Join(cacheDir, fmt.Sprintf("%x.json", sha1.Sum([]byte(url))))
+		}
+		str, err := fetch(client, url)
+		if err != nil {
+			if cacheFile == "" {
+				return nil, err
+			}
+			cached, cacheErr := os.ReadFile(cacheFile)
+			if cacheErr != nil {
+				return nil, err
+			}
+			str = string(cached)
+		} else if cacheFile != "" {
+			if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+				return nil, fmt.Errorf("cannot create cache dir %w", err)
+			}
+			if err := os.WriteFile(cacheFile, []byte(str), 0o644); err != nil {
+				return nil, fmt.Errorf("cannot cache schema '%s' %w", url, err)
+			}
+		}
+		schemas = append(schemas, str)
+	}
+	return schemas, nil
+}
+
+func fetch(client *http.Client, url string) (string, error) {
+	res, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("cannot fetch schema '%s' %w", url, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot fetch schema '%s': status %d", url, res.StatusCode)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("cannot fetch schema '%s' %w", url, err)
+	}
+	return string(body), nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 Dalarub & Ettrich GmbH - All Rights Reserved
+// Unauthorized copying of this file, via any medium is strictly prohibited
+// Proprietary and confidential
+// info@dalarub.com
+//
+
+package schema_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/relabs-tech/kurbisio/core/schema"
+)
+
+func TestReadDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "top1.json"), []byte(top_level1), 0o644)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a schema"), 0o644)
+	os.Mkdir(filepath.Join(dir, "refs"), 0o755)
+	os.WriteFile(filepath.Join(dir, "refs", "ref1.json"), []byte(ref1), 0o644)
+	os.WriteFile(filepath.Join(dir, "refs", "ref2.json"), []byte(ref2), 0o644)
+
+	schemas, refs, err := schema.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 1 || len(refs) != 2 {
+		t.Fatalf("expected 1 schema and 2 refs, got %d and %d", len(schemas), len(refs))
+	}
+	v, err := schema.NewValidator(schemas, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.HasSchema("http://some_host.com/top1.json") {
+		t.Fatal("schema is expected to be available")
+	}
+}
+
+func TestFetch(t *testing.T) {
+	available := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(top_level2))
+	}))
+	defer server.Close()
+
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	schemas, err := schema.Fetch([]string{server.URL + "/top2.json"}, cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 1 || schemas[0] != top_level2 {
+		t.Fatalf("unexpected schemas %v", schemas)
+	}
+
+	// the cached copy is used if the registry is unavailable
+	available = false
+	schemas, err = schema.Fetch([]string{server.URL + "/top2.json"}, cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 1 || schemas[0] != top_level2 {
+		t.Fatalf("unexpected cached schemas %v", schemas)
+	}
+
+	// without cache, the download fails
+	if _, err = schema.Fetch([]string{server.URL + "/top2.json"}, ""); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -19,6 +19,7 @@ import (
 // Validator is a utility to validate JSON object against a given schema
 type Validator struct {
 	schemaValidators map[string]*gojsonschema.Schema
+	propertyNames    map[string]map[string]bool
 }
 
 // NewValidatorFromFS creates a new Validator using schemas from schemaFS. Json files
@@ -69,7 +70,22 @@ func NewValidator(schemas []string, refs []string) (*Validator, error) {
 	type schema struct {
 		ID string `json:"$id"`
 	}
-	validator := Validator{schemaValidators: make(map[string]*gojsonschema.Schema)}
+	validator := Validator{
+		schemaValidators: make(map[string]*gojsonschema.Schema),
+		propertyNames:    make(map[string]map[string]bool),
+	}
+
+	documents := map[string]map[string]interface{}{}
+	for _, str := range refs {
+		var document map[string]interface{}
+		if err := json.Unmarshal([]byte(str), &document); err != nil {
+			continue // the schema loader reports broken refs
+		}
+		if id, ok := document["$id"].(string); ok {
+			documents[id] = document
+		}
+	}
+
 	for _, str := range schemas {
 		s := schema{}
 		err := json.Unmarshal([]byte(str), &s)
@@ -93,6 +109,12 @@ func NewValidator(schemas []string, refs []string) (*Validator, error) {
 			return nil, fmt.Errorf("cannot compile schema %s %s", s.ID, err)
 		}
 		validator.schemaValidators[s.ID] = schema
+
+		var document map[string]interface{}
+		json.Unmarshal([]byte(str), &document)
+		names := map[string]bool{}
+		collectPropertyNames(document, documents, names, map[string]bool{})
+		validator.propertyNames[s.ID] = names
 	}
 
 	return &validator, nil
@@ -104,6 +126,38 @@ func (v *Validator) HasSchema(schemaID string) bool {
 	return ok
 }
 
+// PropertyNames returns the names of the top level properties which are declared in schemaID.
+// This includes properties declared in allOf, anyOf and oneOf sub schemas and in referenced schemas.
+// The second return value is false if the schema is unknown.
+func (v *Validator) PropertyNames(schemaID string) (map[string]bool, bool) {
+	names, ok := v.propertyNames[schemaID]
+	return names, ok
+}
+
+// collectPropertyNames adds the declared top level property names of document to names. References
+// are resolved with documents, visited protects against reference cycles.
+func collectPropertyNames(document map[string]interface{}, documents map[string]map[string]interface{}, names, visited map[string]bool) {
+	if properties, ok := document["properties"].(map[string]interface{}); ok {
+		for name := range properties {
+			names[name] = true
+		}
+	}
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		subSchemas, _ := document[key].([]interface{})
+		for _, subSchema := range subSchemas {
+			if subDocument, ok := subSchema.(map[string]interface{}); ok {
+				collectPropertyNames(subDocument, documents, names, visited)
+			}
+		}
+	}
+	if ref, ok := document["$ref"].(string); ok && !visited[ref] {
+		visited[ref] = true
+		if refDocument, ok := documents[ref]; ok {
+			collectPropertyNames(refDocument, documents, names, visited)
+		}
+	}
+}
+
 // ValidateStruct validates the given json as a struct against schemaID. If no error is returned,
 // then the passed json is valid
 func (v *Validator) ValidateStruct(json interface{}, schemaID string) error {
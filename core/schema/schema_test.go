@@ -120,3 +120,45 @@ func TestHasSchema(t *testing.T) {
 		t.Fatalf("%s schemaID is not expected to be available", schemaID)
 	}
 }
+
+func TestPropertyNames(t *testing.T) {
+	ref := `{
+		"$id": "http://some_host.com/named.json",
+		"properties": {
+			"name": { "type": "string" }
+		}
+	}`
+	top := `{
+		"$id": "http://some_host.com/person.json",
+		"type": "object",
+		"properties": {
+			"age": { "type": "integer" }
+		},
+		"allOf": [
+			{ "$ref": "http://some_host.com/named.json" },
+			{ "properties": { "email": { "type": "string" } } }
+		]
+	}`
+
+	v, err := schema.NewValidator([]string{top}, []string{ref})
+	if err != nil {
+		t.Fatalf("No error expected when creating validator, got %v", err)
+	}
+
+	names, ok := v.PropertyNames("http://some_host.com/person.json")
+	if !ok {
+		t.Fatal("schema is expected to be available")
+	}
+	for _, name := range []string{"age", "name", "email"} {
+		if !names[name] {
+			t.Fatalf("property %s is expected to be declared, got %v", name, names)
+		}
+	}
+	if len(names) != 3 {
+		t.Fatalf("expected 3 declared properties, got %v", names)
+	}
+
+	if _, ok := v.PropertyNames("http://some_host.com/unknownscehma.json"); ok {
+		t.Fatal("unknown schema is not expected to have property names")
+	}
+}